@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"strings"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/internal/database/sqlite"
+	"github.com/djblackett/chirpy/internal/migrate"
+	"github.com/djblackett/chirpy/server"
+	"github.com/djblackett/chirpy/sql/schema"
+	sqliteschema "github.com/djblackett/chirpy/sql/sqlite/schema"
+)
+
+// store is server.Store plus the queries the CLI commands need.
+type store interface {
+	server.Store
+	CountUsersByRole(ctx context.Context, role string) (int64, error)
+	SetUserRoleByEmail(ctx context.Context, arg database.SetUserRoleByEmailParams) (database.User, error)
+}
+
+// backend is the database chirpy runs against, chosen by the DB_URL scheme.
+type backend struct {
+	db         *sql.DB
+	store      store
+	dialect    migrate.Dialect
+	migrations fs.FS
+}
+
+func openBackend(dbURL string) (backend, error) {
+	if strings.HasPrefix(dbURL, "sqlite:") {
+		db, err := sqlite.Open(sqlite.DSN(dbURL))
+		if err != nil {
+			return backend{}, err
+		}
+		return backend{db: db, store: sqlite.NewTraced(db), dialect: migrate.SQLite, migrations: sqliteschema.FS}, nil
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return backend{}, err
+	}
+	return backend{db: db, store: database.NewTraced(database.NewTxDB(db)), dialect: migrate.Postgres, migrations: schema.FS}, nil
+}
+
+func (b backend) migrator() (*migrate.Migrator, error) {
+	return migrate.New(b.db, b.dialect, b.migrations)
+}
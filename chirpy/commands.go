@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/djblackett/chirpy/internal/config"
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+const usage = `usage: chirpy [options] [command]
+
+With no command, chirpy starts the HTTP server.
+
+commands:
+  promote-admin <email> [--force]   give an existing user the admin role;
+                                    refuses if an admin already exists unless --force is set
+  migrate up                        apply all pending migrations
+  migrate down                      roll back the most recent migration
+  migrate status                    list migrations and when each was applied
+  import-chirps [file]              import chirps from a JSON Lines file, or stdin if
+                                    the file is omitted or -; existing ids are skipped
+  export-chirps [--author <id>] [--since <time>] [--until <time>]
+                                    write visible chirps to stdout as JSON Lines;
+                                    times are RFC 3339`
+
+func runCommand(ctx context.Context, cfg config.Config, b backend, args []string) error {
+	switch args[0] {
+	case "promote-admin":
+		return promoteAdmin(b.store, args[1:])
+	case "import-chirps":
+		return importChirps(ctx, b.store, cfg.MaxChirpLength, args[1:])
+	case "export-chirps":
+		return exportChirps(ctx, b.store, args[1:])
+	case "migrate":
+		return runMigrate(ctx, b, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+// promoteAdmin bootstraps the first admin account. Once an admin exists, further
+// role changes should go through PUT /admin/users/{userID}/role.
+func promoteAdmin(db store, args []string) error {
+	var emails []string
+	force := false
+	for _, arg := range args {
+		switch arg {
+		case "--force":
+			force = true
+		default:
+			emails = append(emails, arg)
+		}
+	}
+	if len(emails) != 1 {
+		return errors.New("promote-admin requires exactly one email address")
+	}
+	email := emails[0]
+
+	ctx := context.Background()
+	if !force {
+		admins, err := db.CountUsersByRole(ctx, string(auth.RoleAdmin))
+		if err != nil {
+			return fmt.Errorf("counting admins: %w", err)
+		}
+		if admins > 0 {
+			return errors.New("an admin already exists; use --force or PUT /admin/users/{userID}/role")
+		}
+	}
+
+	user, err := db.SetUserRoleByEmail(ctx, database.SetUserRoleByEmailParams{
+		Role:  string(auth.RoleAdmin),
+		Email: email,
+	})
+	if err != nil {
+		return fmt.Errorf("promoting %s: %w", email, err)
+	}
+	fmt.Printf("User %s (%s) is now an admin\n", user.Email, user.ID)
+	return nil
+}
+
+// importChirps reports each rejected line on stderr and a summary on stdout.
+func importChirps(ctx context.Context, db store, maxChirpLength int, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("import-chirps takes at most one file\n%s", usage)
+	}
+	var r io.Reader = os.Stdin
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	report, err := server.ImportChirps(ctx, db, r, server.ImportOptions{MaxChirpLength: maxChirpLength})
+	for _, lineErr := range report.Errors {
+		fmt.Fprintf(os.Stderr, "line %d: %s\n", lineErr.Line, lineErr.Error)
+	}
+	if report.ErrorsTruncated {
+		fmt.Fprintf(os.Stderr, "... and %d more rejected lines\n", report.Failed-len(report.Errors))
+	}
+	fmt.Printf("Imported %d chirps, skipped %d existing, rejected %d lines\n", report.Imported, report.Skipped, report.Failed)
+	return err
+}
+
+func exportChirps(ctx context.Context, db store, args []string) error {
+	flags := flag.NewFlagSet("export-chirps", flag.ContinueOnError)
+	author := flags.String("author", "", "only chirps by this user id")
+	since := flags.String("since", "", "only chirps created at or after this time")
+	until := flags.String("until", "", "only chirps created before this time")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q\n%s", flags.Arg(0), usage)
+	}
+
+	var filter server.ExportFilter
+	var err error
+	if *author != "" {
+		if filter.UserID, err = uuid.Parse(*author); err != nil {
+			return fmt.Errorf("--author: %w", err)
+		}
+	}
+	if *since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, *since); err != nil {
+			return fmt.Errorf("--since: %w", err)
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, *until); err != nil {
+			return fmt.Errorf("--until: %w", err)
+		}
+	}
+
+	n, err := server.ExportChirps(ctx, db, os.Stdout, filter)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d chirps\n", n)
+	return nil
+}
+
+func runMigrate(ctx context.Context, b backend, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("migrate requires one of up, down or status\n%s", usage)
+	}
+	migrator, err := b.migrator()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("Applied %s\n", m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+		return err
+	case "down":
+		m, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %s\n", m.Name)
+		return nil
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "Applied At\tMigration")
+		for _, s := range statuses {
+			appliedAt := "Pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", appliedAt, s.Name)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], usage)
+	}
+}
@@ -25,16 +25,24 @@ func CheckPasswordHash(hash, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+type Claims struct {
+	Role Role `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func MakeJWT(userID uuid.UUID, role Role, tokenSecret string, expiresIn time.Duration) (string, error) {
 	// var key *ecdsa.PrivateKey
 	var t *jwt.Token
 	var s string
 
-	t = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   userID.String(),
+	t = jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
 	})
 
 	s, err := t.SignedString([]byte(tokenSecret))
@@ -42,22 +50,36 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	userID, _, err := ValidateJWTWithRole(tokenString, tokenSecret)
+	return userID, err
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+// ValidateJWTWithRole validates the token and returns both the subject and the role claim.
+// Tokens issued before roles existed carry no role claim and are treated as RoleUser.
+func ValidateJWTWithRole(tokenString, tokenSecret string) (uuid.UUID, Role, error) {
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(tokenSecret), nil
 	}, jwt.WithLeeway(5*time.Second))
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, "", err
 	}
-	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
 		id := claims.Subject
 		userID, err := uuid.Parse(id)
 		if err != nil {
-			return uuid.Nil, err
+			return uuid.Nil, "", err
+		}
+		role := claims.Role
+		if role == "" {
+			role = RoleUser
+		}
+		if _, err := ParseRole(string(role)); err != nil {
+			return uuid.Nil, "", jwt.ErrTokenInvalidClaims
 		}
-		return userID, nil
+		return userID, role, nil
 	}
-	return uuid.Nil, jwt.ErrTokenInvalidClaims
+	return uuid.Nil, "", jwt.ErrTokenInvalidClaims
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"testing"
@@ -16,7 +17,7 @@ func TestMakeAndValidateJWT(t *testing.T) {
 	expiresIn := time.Hour
 
 	// Create a JWT
-	tokenString, err := MakeJWT(userID, tokenSecret, expiresIn)
+	tokenString, err := MakeJWT(userID, RoleUser, tokenSecret, expiresIn)
 	if err != nil {
 		t.Fatalf("Error creating JWT: %v", err)
 	}
@@ -33,6 +34,66 @@ func TestMakeAndValidateJWT(t *testing.T) {
 	}
 }
 
+func TestValidateJWTWithRole(t *testing.T) {
+	userID := uuid.New()
+	tokenSecret := "test-secret"
+
+	tokenString, err := MakeJWT(userID, RoleModerator, tokenSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating JWT: %v", err)
+	}
+
+	extractedID, role, err := ValidateJWTWithRole(tokenString, tokenSecret)
+	if err != nil {
+		t.Fatalf("Error validating JWT: %v", err)
+	}
+	if extractedID != userID {
+		t.Errorf("Expected user ID %v, got %v", userID, extractedID)
+	}
+	if role != RoleModerator {
+		t.Errorf("Expected role %q, got %q", RoleModerator, role)
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     Role
+		required Role
+		want     bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{Role(""), RoleUser, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestRoleOutranks(t *testing.T) {
+	tests := []struct {
+		role  Role
+		other Role
+		want  bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleModerator, RoleUser, true},
+		{RoleModerator, RoleModerator, false},
+		{RoleModerator, RoleAdmin, false},
+		{RoleUser, Role(""), true},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Outranks(tt.other); got != tt.want {
+			t.Errorf("%q.Outranks(%q) = %v, want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
+
 // func TestValidateJWTWithWrongSecret(t *testing.T) {
 // 	// Create a test user ID
 // 	userID := uuid.New()
@@ -59,3 +120,31 @@ func TestGetBearerToken(t *testing.T) {
 		t.Errorf("Expected 'test-token', got '%s'", header)
 	}
 }
+
+func TestWebhookSignature(t *testing.T) {
+	secret := MakeWebhookSecret()
+	body := []byte(`{"type":"chirp.created"}`)
+	sent := time.Unix(1700000000, 0)
+	header := SignWebhook(secret, sent, body)
+
+	if err := VerifyWebhookSignature(secret, header, body, sent.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+	}{
+		{"wrong secret", MakeWebhookSecret(), header, body, sent},
+		{"tampered body", secret, header, []byte(`{"type":"chirp.deleted"}`), sent},
+		{"too old", secret, header, body, sent.Add(10 * time.Minute)},
+		{"malformed", secret, "v1=abc", body, sent},
+	}
+	for _, tt := range tests {
+		if err := VerifyWebhookSignature(tt.secret, tt.header, tt.body, tt.now, 5*time.Minute); !errors.Is(err, ErrInvalidWebhookSignature) {
+			t.Errorf("%s: expected ErrInvalidWebhookSignature, got %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import "errors"
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+// roleRank orders roles so that a higher role inherits everything a lower one can do.
+var roleRank = map[Role]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleRank[role]; !ok {
+		return "", ErrInvalidRole
+	}
+	return role, nil
+}
+
+// Outranks reports whether r is strictly above other. Moderators may only act
+// against users they outrank.
+func (r Role) Outranks(other Role) bool {
+	return roleRank[r] > roleRank[other]
+}
+
+// Allows reports whether a user holding r may access something that requires the given role.
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required] && roleRank[r] > 0
+}
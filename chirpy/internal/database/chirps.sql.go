@@ -7,29 +7,48 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const cancelScheduledChirp = `-- name: CancelScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1
+AND publish_at IS NOT NULL
+`
+
+func (q *Queries) CancelScheduledChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelScheduledChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, user_id, body) 
+INSERT INTO chirps (id, created_at, updated_at, user_id, body, publish_at) 
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, body, created_at, updated_at, user_id
+RETURNING id, body, created_at, updated_at, user_id, hidden_at, publish_at
 `
 
 type CreateChirpParams struct {
-	UserID uuid.UUID
-	Body   string
+	UserID    uuid.UUID
+	Body      string
+	PublishAt sql.NullTime
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.UserID, arg.Body)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.UserID, arg.Body, arg.PublishAt)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +56,8 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.HiddenAt,
+		&i.PublishAt,
 	)
 	return i, err
 }
@@ -51,8 +72,45 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const getAllChirpsByUserID = `-- name: GetAllChirpsByUserID :many
+SELECT id, body, created_at, updated_at, user_id, hidden_at, publish_at FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetAllChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirpsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirp = `-- name: GetChirp :one
-SELECT id, body, created_at, updated_at, user_id FROM chirps
+SELECT id, body, created_at, updated_at, user_id, hidden_at, publish_at FROM chirps
 WHERE id = $1
 `
 
@@ -65,17 +123,32 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.HiddenAt,
+		&i.PublishAt,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, body, created_at, updated_at, user_id FROM chirps
-ORDER BY created_at ASC
+SELECT chirps.id, chirps.body, chirps.created_at, chirps.updated_at, chirps.user_id, chirps.hidden_at, chirps.publish_at FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.hidden_at IS NULL
+AND chirps.publish_at IS NULL
+AND users.banned_at IS NULL
+AND (users.suspended_until IS NULL OR users.suspended_until <= NOW())
+AND ($1::uuid IS NULL OR (
+    NOT EXISTS (SELECT 1 FROM user_relationships
+                WHERE user_relationships.user_id = $1
+                AND user_relationships.target_id = chirps.user_id)
+    AND NOT EXISTS (SELECT 1 FROM user_relationships
+                    WHERE user_relationships.target_id = $1
+                    AND user_relationships.user_id = chirps.user_id
+                    AND user_relationships.kind = 'block')))
+ORDER BY chirps.created_at ASC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +162,8 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.HiddenAt,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
@@ -104,13 +179,286 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByUserID = `-- name: GetChirpsByUserID :many
-SELECT id, body, created_at, updated_at, user_id FROM chirps
+SELECT chirps.id, chirps.body, chirps.created_at, chirps.updated_at, chirps.user_id, chirps.hidden_at, chirps.publish_at FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.user_id = $1
+AND chirps.hidden_at IS NULL
+AND chirps.publish_at IS NULL
+AND users.banned_at IS NULL
+AND (users.suspended_until IS NULL OR users.suspended_until <= NOW())
+AND ($2::uuid IS NULL OR (
+    NOT EXISTS (SELECT 1 FROM user_relationships
+                WHERE user_relationships.user_id = $2
+                AND user_relationships.target_id = chirps.user_id)
+    AND NOT EXISTS (SELECT 1 FROM user_relationships
+                    WHERE user_relationships.target_id = $2
+                    AND user_relationships.user_id = chirps.user_id
+                    AND user_relationships.kind = 'block')))
+ORDER BY chirps.created_at ASC
+`
+
+type GetChirpsByUserIDParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.NullUUID
+}
+
+func (q *Queries) GetChirpsByUserID(ctx context.Context, arg GetChirpsByUserIDParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUserID, arg.UserID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentChirps = `-- name: GetRecentChirps :many
+SELECT chirps.id, chirps.body, chirps.created_at, chirps.updated_at, chirps.user_id, chirps.hidden_at, chirps.publish_at, users.handle AS author_handle FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE ($1::uuid IS NULL OR chirps.user_id = $1)
+AND chirps.hidden_at IS NULL
+AND chirps.publish_at IS NULL
+AND users.banned_at IS NULL
+AND (users.suspended_until IS NULL OR users.suspended_until <= NOW())
+AND ($2::uuid IS NULL OR (
+    NOT EXISTS (SELECT 1 FROM user_relationships
+                WHERE user_relationships.user_id = $2
+                AND user_relationships.target_id = chirps.user_id)
+    AND NOT EXISTS (SELECT 1 FROM user_relationships
+                    WHERE user_relationships.target_id = $2
+                    AND user_relationships.user_id = chirps.user_id
+                    AND user_relationships.kind = 'block')))
+ORDER BY chirps.created_at DESC
+LIMIT $3::integer
+`
+
+type GetRecentChirpsParams struct {
+	UserID   uuid.NullUUID
+	ViewerID uuid.NullUUID
+	PageSize int32
+}
+
+type GetRecentChirpsRow struct {
+	ID           uuid.UUID
+	Body         string
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	UserID       uuid.UUID
+	HiddenAt     sql.NullTime
+	PublishAt    sql.NullTime
+	AuthorHandle sql.NullString
+}
+
+func (q *Queries) GetRecentChirps(ctx context.Context, arg GetRecentChirpsParams) ([]GetRecentChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentChirps, arg.UserID, arg.ViewerID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecentChirpsRow
+	for rows.Next() {
+		var i GetRecentChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.PublishAt,
+			&i.AuthorHandle,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVisibleChirp = `-- name: GetVisibleChirp :one
+SELECT chirps.id, chirps.body, chirps.created_at, chirps.updated_at, chirps.user_id, chirps.hidden_at, chirps.publish_at FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1
+AND chirps.hidden_at IS NULL
+AND chirps.publish_at IS NULL
+AND users.banned_at IS NULL
+AND (users.suspended_until IS NULL OR users.suspended_until <= NOW())
+`
+
+func (q *Queries) GetVisibleChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getVisibleChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.PublishAt,
+	)
+	return i, err
+}
+
+const importChirps = `-- name: ImportChirps :execrows
+INSERT INTO chirps (id, body, created_at, updated_at, user_id)
+SELECT
+    unnest($1::uuid[]),
+    unnest($2::text[]),
+    unnest($3::timestamp[]),
+    unnest($4::timestamp[]),
+    unnest($5::uuid[])
+ON CONFLICT (id) DO NOTHING
+`
+
+type ImportChirpsParams struct {
+	Ids        []uuid.UUID
+	Bodies     []string
+	CreatedAts []time.Time
+	UpdatedAts []time.Time
+	UserIds    []uuid.UUID
+}
+
+func (q *Queries) ImportChirps(ctx context.Context, arg ImportChirpsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, importChirps, pq.Array(arg.Ids), pq.Array(arg.Bodies), pq.Array(arg.CreatedAts), pq.Array(arg.UpdatedAts), pq.Array(arg.UserIds))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listChirpsForExport = `-- name: ListChirpsForExport :many
+SELECT id, body, created_at, updated_at, user_id, hidden_at, publish_at FROM chirps
+WHERE hidden_at IS NULL
+AND publish_at IS NULL
+AND ($1::uuid IS NULL OR user_id = $1)
+AND ($2::timestamp IS NULL OR created_at >= $2)
+AND ($3::timestamp IS NULL OR created_at < $3)
+AND (created_at, id) > ($4::timestamp, $5::uuid)
+ORDER BY created_at, id
+LIMIT $6::integer
+`
+
+type ListChirpsForExportParams struct {
+	UserID         uuid.NullUUID
+	Since          sql.NullTime
+	Until          sql.NullTime
+	AfterCreatedAt time.Time
+	AfterID        uuid.UUID
+	PageSize       int32
+}
+
+func (q *Queries) ListChirpsForExport(ctx context.Context, arg ListChirpsForExportParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsForExport, arg.UserID, arg.Since, arg.Until, arg.AfterCreatedAt, arg.AfterID, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listScheduledChirps = `-- name: ListScheduledChirps :many
+SELECT id, body, created_at, updated_at, user_id, hidden_at, publish_at FROM chirps
 WHERE user_id = $1
-ORDER BY created_at ASC
+AND publish_at IS NOT NULL
+ORDER BY publish_at ASC
+`
+
+func (q *Queries) ListScheduledChirps(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listScheduledChirps, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.HiddenAt,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const publishDueChirps = `-- name: PublishDueChirps :many
+UPDATE chirps
+SET created_at = publish_at, updated_at = publish_at, publish_at = NULL
+WHERE id IN (
+    SELECT id FROM chirps
+    WHERE publish_at <= NOW()
+    ORDER BY publish_at
+    LIMIT $1::integer
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, body, created_at, updated_at, user_id, hidden_at, publish_at
 `
 
-func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByUserID, userID)
+func (q *Queries) PublishDueChirps(ctx context.Context, batchSize int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, publishDueChirps, batchSize)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +472,8 @@ func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.HiddenAt,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
@@ -137,3 +487,31 @@ func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const rescheduleChirp = `-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = $1::timestamp, updated_at = NOW()
+WHERE id = $2
+AND publish_at IS NOT NULL
+RETURNING id, body, created_at, updated_at, user_id, hidden_at, publish_at
+`
+
+type RescheduleChirpParams struct {
+	PublishAt time.Time
+	ID        uuid.UUID
+}
+
+func (q *Queries) RescheduleChirp(ctx context.Context, arg RescheduleChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, rescheduleChirp, arg.PublishAt, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.HiddenAt,
+		&i.PublishAt,
+	)
+	return i, err
+}
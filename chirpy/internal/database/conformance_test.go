@@ -0,0 +1,44 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/internal/migrate"
+	"github.com/djblackett/chirpy/server"
+	"github.com/djblackett/chirpy/server/storetest"
+	"github.com/djblackett/chirpy/sql/schema"
+	_ "github.com/lib/pq"
+)
+
+// TestPostgresConformance runs the store conformance suite against a scratch
+// database named by CHIRPY_TEST_DB_URL. Everything in it is dropped.
+func TestPostgresConformance(t *testing.T) {
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("CHIRPY_TEST_DB_URL not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	storetest.Run(t, func(t *testing.T) server.Store {
+		ctx := context.Background()
+		if _, err := db.ExecContext(ctx, "DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+			t.Fatalf("resetting database: %v", err)
+		}
+		migrator, err := migrate.New(db, migrate.Postgres, schema.FS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(ctx); err != nil {
+			t.Fatalf("migrating: %v", err)
+		}
+		return database.New(database.NewTxDB(db))
+	})
+}
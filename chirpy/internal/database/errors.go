@@ -0,0 +1,18 @@
+package database
+
+import "errors"
+
+// IsUniqueViolation reports whether err is a unique or primary key constraint
+// failure from either backend: SQLSTATE 23505 from Postgres, or
+// SQLITE_CONSTRAINT_UNIQUE or SQLITE_CONSTRAINT_PRIMARYKEY from SQLite.
+func IsUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		return pgErr.SQLState() == "23505"
+	}
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == 2067 || sqliteErr.Code() == 1555
+	}
+	return false
+}
@@ -17,6 +17,73 @@ type Chirp struct {
 	CreatedAt sql.NullTime
 	UpdatedAt sql.NullTime
 	UserID    uuid.UUID
+	HiddenAt  sql.NullTime
+	PublishAt sql.NullTime
+}
+
+type ChirpReport struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+	Details    string
+	Status     string
+	CreatedAt  time.Time
+	ResolvedAt sql.NullTime
+	ResolvedBy uuid.NullUUID
+}
+
+type Conversation struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	ParticipantKey sql.NullString
+}
+
+type ConversationParticipant struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	JoinedAt       time.Time
+	LastReadAt     sql.NullTime
+}
+
+type DataExport struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Status      string
+	CreatedAt   time.Time
+	CompletedAt sql.NullTime
+	ExpiresAt   time.Time
+}
+
+type DataExportChunk struct {
+	ExportID uuid.UUID
+	Seq      int32
+	Data     []byte
+}
+
+type Message struct {
+	ID             uuid.UUID
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+	CreatedAt      time.Time
+}
+
+type MessageDeletion struct {
+	MessageID uuid.UUID
+	UserID    uuid.UUID
+}
+
+type ModerationAction struct {
+	ID            uuid.UUID
+	ActorID       uuid.UUID
+	Action        string
+	TargetUserID  uuid.NullUUID
+	TargetChirpID uuid.NullUUID
+	Reason        string
+	ExpiresAt     sql.NullTime
+	CreatedAt     time.Time
 }
 
 type RefreshToken struct {
@@ -28,6 +95,13 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime
 }
 
+type SubscriptionEvent struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Event     string
+	CreatedAt time.Time
+}
+
 type User struct {
 	ID             uuid.UUID
 	Email          string
@@ -35,4 +109,56 @@ type User struct {
 	UpdatedAt      sql.NullTime
 	HashedPassword string
 	IsChirpyRed    sql.NullBool
+	Role           string
+	SuspendedUntil sql.NullTime
+	BannedAt       sql.NullTime
+	DeletedAt      sql.NullTime
+	Handle         sql.NullString
+	DisplayName    string
+	Bio            string
+}
+
+type UserAvatar struct {
+	UserID      uuid.UUID
+	ContentType string
+	Image       []byte
+	UpdatedAt   time.Time
+}
+
+type UserFollow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type UserRelationship struct {
+	UserID    uuid.UUID
+	TargetID  uuid.UUID
+	Kind      string
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	EndpointID     uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Payload        string
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	LastError      string
+	CreatedAt      time.Time
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Url       string
+	Secret    string
+	Events    []string
+	AllUsers  bool
+	CreatedAt time.Time
 }
@@ -16,7 +16,7 @@ INSERT INTO refresh_tokens (user_id, token, expires_at, revoked_at, created_at,
 VALUES (
     $1,
     $2,
-    TIMESTAMP 'now' + INTERVAL '60 days',
+    NOW() + make_interval(secs => $3::integer),
     NULL,
     CURRENT_TIMESTAMP,
     CURRENT_TIMESTAMP
@@ -24,12 +24,13 @@ VALUES (
 `
 
 type CreateRefreshTokenParams struct {
-	UserID uuid.UUID
-	Token  string
+	UserID           uuid.UUID
+	Token            string
+	ExpiresInSeconds int32
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error {
-	_, err := q.db.ExecContext(ctx, createRefreshToken, arg.UserID, arg.Token)
+	_, err := q.db.ExecContext(ctx, createRefreshToken, arg.UserID, arg.Token, arg.ExpiresInSeconds)
 	return err
 }
 
@@ -48,6 +49,42 @@ func (q *Queries) GetUserByRefreshToken(ctx context.Context, token string) (uuid
 	return user_id, err
 }
 
+const listRefreshTokensByUserID = `-- name: ListRefreshTokensByUserID :many
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, listRefreshTokensByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :one
 UPDATE refresh_tokens
 SET revoked_at = CURRENT_TIMESTAMP,
@@ -62,3 +99,16 @@ func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) (uuid.UU
 	err := row.Scan(&user_id)
 	return user_id, err
 }
+
+const revokeRefreshTokensByUserID = `-- name: RevokeRefreshTokensByUserID :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE user_id = $1
+AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokensByUserID, userID)
+	return err
+}
@@ -0,0 +1,258 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const chirpColumns = "id, body, created_at, updated_at, user_id, hidden_at, publish_at"
+
+// visibleChirp matches published chirps that aren't hidden and whose author
+// is neither banned nor suspended as of the bound time.
+const visibleChirp = `hidden_at IS NULL
+AND publish_at IS NULL
+AND user_id IN (
+    SELECT id FROM users
+    WHERE banned_at IS NULL
+    AND (suspended_until IS NULL OR suspended_until <= ?)
+)`
+
+// notHiddenFrom drops chirps by authors the bound viewer blocked or muted, or
+// who blocked the viewer. A NULL viewer sees everything. It binds the viewer
+// three times.
+const notHiddenFrom = `(? IS NULL OR (
+    NOT EXISTS (SELECT 1 FROM user_relationships
+                WHERE user_relationships.user_id = ?
+                AND user_relationships.target_id = chirps.user_id)
+    AND NOT EXISTS (SELECT 1 FROM user_relationships
+                    WHERE user_relationships.target_id = ?
+                    AND user_relationships.user_id = chirps.user_id
+                    AND user_relationships.kind = 'block')))`
+
+func nullUUID(id uuid.NullUUID) any {
+	if !id.Valid {
+		return nil
+	}
+	return id.UUID
+}
+
+func scanChirp(row scanner) (database.Chirp, error) {
+	var i database.Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		nullTime{&i.CreatedAt},
+		nullTime{&i.UpdatedAt},
+		&i.UserID,
+		nullTime{&i.HiddenAt},
+		nullTime{&i.PublishAt},
+	)
+	return i, err
+}
+
+const createChirp = `-- name: CreateChirp :one
+INSERT INTO chirps (id, created_at, updated_at, user_id, body, publish_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING ` + chirpColumns
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	ts := micros(now())
+	return scanChirp(s.q.QueryRowContext(ctx, createChirp, uuid.New(), ts, ts, arg.UserID, arg.Body, nullMicros(arg.PublishAt)))
+}
+
+const getChirps = `-- name: GetChirps :many
+SELECT ` + chirpColumns + ` FROM chirps
+WHERE ` + visibleChirp + `
+AND ` + notHiddenFrom + `
+ORDER BY created_at ASC`
+
+func (s *Store) GetChirps(ctx context.Context, viewerID uuid.NullUUID) ([]database.Chirp, error) {
+	viewer := nullUUID(viewerID)
+	return queryAll(ctx, s.q, scanChirp, getChirps, micros(now()), viewer, viewer, viewer)
+}
+
+const getChirp = `-- name: GetChirp :one
+SELECT ` + chirpColumns + ` FROM chirps
+WHERE id = ?`
+
+func (s *Store) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	return scanChirp(s.q.QueryRowContext(ctx, getChirp, id))
+}
+
+const deleteChirpReports = `-- name: DeleteChirpReports :exec
+DELETE FROM chirp_reports
+WHERE chirp_id = ?`
+
+const deleteChirp = `-- name: DeleteChirp :exec
+DELETE FROM chirps
+WHERE id = ?`
+
+func (s *Store) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	return s.InTx(ctx, func(ctx context.Context) error {
+		if _, err := s.q.ExecContext(ctx, deleteChirpReports, id); err != nil {
+			return err
+		}
+		_, err := s.q.ExecContext(ctx, deleteChirp, id)
+		return err
+	})
+}
+
+const getChirpsByUserID = `-- name: GetChirpsByUserID :many
+SELECT ` + chirpColumns + ` FROM chirps
+WHERE user_id = ?
+AND ` + visibleChirp + `
+AND ` + notHiddenFrom + `
+ORDER BY created_at ASC`
+
+func (s *Store) GetChirpsByUserID(ctx context.Context, arg database.GetChirpsByUserIDParams) ([]database.Chirp, error) {
+	viewer := nullUUID(arg.ViewerID)
+	return queryAll(ctx, s.q, scanChirp, getChirpsByUserID, arg.UserID, micros(now()), viewer, viewer, viewer)
+}
+
+const getRecentChirps = `-- name: GetRecentChirps :many
+SELECT ` + chirpColumns + `, (SELECT handle FROM users WHERE users.id = chirps.user_id) FROM chirps
+WHERE (? IS NULL OR user_id = ?)
+AND ` + visibleChirp + `
+AND ` + notHiddenFrom + `
+ORDER BY created_at DESC
+LIMIT ?`
+
+func (s *Store) GetRecentChirps(ctx context.Context, arg database.GetRecentChirpsParams) ([]database.GetRecentChirpsRow, error) {
+	user, viewer := nullUUID(arg.UserID), nullUUID(arg.ViewerID)
+	return queryAll(ctx, s.q, func(row scanner) (database.GetRecentChirpsRow, error) {
+		var i database.GetRecentChirpsRow
+		err := row.Scan(
+			&i.ID,
+			&i.Body,
+			nullTime{&i.CreatedAt},
+			nullTime{&i.UpdatedAt},
+			&i.UserID,
+			nullTime{&i.HiddenAt},
+			nullTime{&i.PublishAt},
+			&i.AuthorHandle,
+		)
+		return i, err
+	}, getRecentChirps, user, user, micros(now()), viewer, viewer, viewer, arg.PageSize)
+}
+
+const getVisibleChirp = `-- name: GetVisibleChirp :one
+SELECT ` + chirpColumns + ` FROM chirps
+WHERE id = ?
+AND ` + visibleChirp
+
+func (s *Store) GetVisibleChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	return scanChirp(s.q.QueryRowContext(ctx, getVisibleChirp, id, micros(now())))
+}
+
+const getAllChirpsByUserID = `-- name: GetAllChirpsByUserID :many
+SELECT ` + chirpColumns + ` FROM chirps
+WHERE user_id = ?
+ORDER BY created_at ASC`
+
+func (s *Store) GetAllChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	return queryAll(ctx, s.q, scanChirp, getAllChirpsByUserID, userID)
+}
+
+const importChirp = `-- name: ImportChirps :execrows
+INSERT INTO chirps (id, body, created_at, updated_at, user_id)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (id) DO NOTHING`
+
+// ImportChirps inserts the batch row by row in one transaction, as SQLite has
+// no unnest().
+func (s *Store) ImportChirps(ctx context.Context, arg database.ImportChirpsParams) (int64, error) {
+	var inserted int64
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		for i := range arg.Ids {
+			result, err := s.q.ExecContext(ctx, importChirp, arg.Ids[i], arg.Bodies[i], micros(arg.CreatedAts[i]), micros(arg.UpdatedAts[i]), arg.UserIds[i])
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			inserted += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+const listChirpsForExport = `-- name: ListChirpsForExport :many
+SELECT ` + chirpColumns + ` FROM chirps
+WHERE hidden_at IS NULL
+AND publish_at IS NULL
+AND (? IS NULL OR user_id = ?)
+AND (? IS NULL OR created_at >= ?)
+AND (? IS NULL OR created_at < ?)
+AND (created_at, id) > (?, ?)
+ORDER BY created_at, id
+LIMIT ?`
+
+func (s *Store) ListChirpsForExport(ctx context.Context, arg database.ListChirpsForExportParams) ([]database.Chirp, error) {
+	userID := nullUUID(arg.UserID)
+	since, until := nullMicros(arg.Since), nullMicros(arg.Until)
+	return queryAll(ctx, s.q, scanChirp, listChirpsForExport,
+		userID, userID,
+		since, since,
+		until, until,
+		micros(arg.AfterCreatedAt), arg.AfterID,
+		arg.PageSize)
+}
+
+const listScheduledChirps = `-- name: ListScheduledChirps :many
+SELECT ` + chirpColumns + ` FROM chirps
+WHERE user_id = ?
+AND publish_at IS NOT NULL
+ORDER BY publish_at ASC`
+
+func (s *Store) ListScheduledChirps(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	return queryAll(ctx, s.q, scanChirp, listScheduledChirps, userID)
+}
+
+const rescheduleChirp = `-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = ?, updated_at = ?
+WHERE id = ?
+AND publish_at IS NOT NULL
+RETURNING ` + chirpColumns
+
+func (s *Store) RescheduleChirp(ctx context.Context, arg database.RescheduleChirpParams) (database.Chirp, error) {
+	return scanChirp(s.q.QueryRowContext(ctx, rescheduleChirp, micros(arg.PublishAt), micros(now()), arg.ID))
+}
+
+const cancelScheduledChirp = `-- name: CancelScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = ?
+AND publish_at IS NOT NULL`
+
+func (s *Store) CancelScheduledChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := s.q.ExecContext(ctx, cancelScheduledChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SQLite has one writer at a time, so the single UPDATE already claims its
+// rows the way FOR UPDATE SKIP LOCKED does on Postgres.
+const publishDueChirps = `-- name: PublishDueChirps :many
+UPDATE chirps
+SET created_at = publish_at, updated_at = publish_at, publish_at = NULL
+WHERE id IN (
+    SELECT id FROM chirps
+    WHERE publish_at <= ?
+    ORDER BY publish_at
+    LIMIT ?
+)
+RETURNING ` + chirpColumns
+
+func (s *Store) PublishDueChirps(ctx context.Context, batchSize int32) ([]database.Chirp, error) {
+	return queryAll(ctx, s.q, scanChirp, publishDueChirps, micros(now()), batchSize)
+}
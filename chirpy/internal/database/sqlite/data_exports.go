@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const dataExportColumns = "id, user_id, status, created_at, completed_at, expires_at"
+
+func scanDataExport(row scanner) (database.DataExport, error) {
+	var i database.DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		notNullTime{&i.CreatedAt},
+		nullTime{&i.CompletedAt},
+		notNullTime{&i.ExpiresAt},
+	)
+	return i, err
+}
+
+const createDataExport = `-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at, expires_at)
+VALUES (?, ?, 'pending', ?, ?)
+RETURNING ` + dataExportColumns
+
+func (s *Store) CreateDataExport(ctx context.Context, arg database.CreateDataExportParams) (database.DataExport, error) {
+	created := now()
+	expires := created.Add(time.Duration(arg.ExpiresInSeconds) * time.Second)
+	return scanDataExport(s.q.QueryRowContext(ctx, createDataExport, uuid.New(), arg.UserID, micros(created), micros(expires)))
+}
+
+const getDataExport = `-- name: GetDataExport :one
+SELECT ` + dataExportColumns + ` FROM data_exports
+WHERE id = ?
+AND user_id = ?
+AND expires_at > ?`
+
+func (s *Store) GetDataExport(ctx context.Context, arg database.GetDataExportParams) (database.DataExport, error) {
+	return scanDataExport(s.q.QueryRowContext(ctx, getDataExport, arg.ID, arg.UserID, micros(now())))
+}
+
+const completeDataExport = `-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready',
+    completed_at = ?,
+    expires_at = ?
+WHERE id = ?
+AND status = 'pending'`
+
+func (s *Store) CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error {
+	completed := now()
+	expires := completed.Add(time.Duration(arg.ExpiresInSeconds) * time.Second)
+	_, err := s.q.ExecContext(ctx, completeDataExport, micros(completed), micros(expires), arg.ID)
+	return err
+}
+
+const failDataExport = `-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed',
+    completed_at = ?
+WHERE id = ?
+AND status = 'pending'`
+
+func (s *Store) FailDataExport(ctx context.Context, id uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, failDataExport, micros(now()), id)
+	return err
+}
+
+const failStaleDataExports = `-- name: FailStaleDataExports :execrows
+UPDATE data_exports
+SET status = 'failed',
+    completed_at = ?
+WHERE status = 'pending'
+AND created_at <= ?`
+
+func (s *Store) FailStaleDataExports(ctx context.Context, olderThanSeconds int32) (int64, error) {
+	ts := now()
+	result, err := s.q.ExecContext(ctx, failStaleDataExports, micros(ts), micros(ts.Add(-time.Duration(olderThanSeconds)*time.Second)))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const appendDataExportChunk = `-- name: AppendDataExportChunk :exec
+INSERT INTO data_export_chunks (export_id, seq, data)
+VALUES (?, ?, ?)`
+
+func (s *Store) AppendDataExportChunk(ctx context.Context, arg database.AppendDataExportChunkParams) error {
+	_, err := s.q.ExecContext(ctx, appendDataExportChunk, arg.ExportID, arg.Seq, arg.Data)
+	return err
+}
+
+const getDataExportChunk = `-- name: GetDataExportChunk :one
+SELECT data FROM data_export_chunks
+WHERE export_id = ?
+AND seq = ?`
+
+func (s *Store) GetDataExportChunk(ctx context.Context, arg database.GetDataExportChunkParams) ([]byte, error) {
+	var data []byte
+	err := s.q.QueryRowContext(ctx, getDataExportChunk, arg.ExportID, arg.Seq).Scan(&data)
+	return data, err
+}
+
+const deleteDataExportChunks = `-- name: DeleteDataExportChunks :exec
+DELETE FROM data_export_chunks
+WHERE export_id = ?`
+
+func (s *Store) DeleteDataExportChunks(ctx context.Context, exportID uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, deleteDataExportChunks, exportID)
+	return err
+}
+
+// Foreign keys aren't enforced, so deleting exports deletes their chunks first.
+const deleteExpiredDataExportChunks = `-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_export_chunks
+WHERE export_id IN (SELECT id FROM data_exports WHERE expires_at <= ?)`
+
+const deleteExpiredDataExports = `-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports
+WHERE expires_at <= ?`
+
+func (s *Store) DeleteExpiredDataExports(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		ts := micros(now())
+		if _, err := s.q.ExecContext(ctx, deleteExpiredDataExportChunks, ts); err != nil {
+			return err
+		}
+		result, err := s.q.ExecContext(ctx, deleteExpiredDataExports, ts)
+		if err != nil {
+			return err
+		}
+		n, err = result.RowsAffected()
+		return err
+	})
+	return n, err
+}
+
+const deleteDataExportChunksByUserID = `-- name: DeleteDataExportsByUserID :exec
+DELETE FROM data_export_chunks
+WHERE export_id IN (SELECT id FROM data_exports WHERE user_id = ?)`
+
+const deleteDataExportsByUserID = `-- name: DeleteDataExportsByUserID :exec
+DELETE FROM data_exports
+WHERE user_id = ?`
+
+func (s *Store) DeleteDataExportsByUserID(ctx context.Context, userID uuid.UUID) error {
+	return s.InTx(ctx, func(ctx context.Context) error {
+		if _, err := s.q.ExecContext(ctx, deleteDataExportChunksByUserID, userID); err != nil {
+			return err
+		}
+		_, err := s.q.ExecContext(ctx, deleteDataExportsByUserID, userID)
+		return err
+	})
+}
+
+const createSubscriptionEvent = `-- name: CreateSubscriptionEvent :exec
+INSERT INTO subscription_events (id, user_id, event, created_at)
+VALUES (?, ?, ?, ?)`
+
+func (s *Store) CreateSubscriptionEvent(ctx context.Context, arg database.CreateSubscriptionEventParams) error {
+	_, err := s.q.ExecContext(ctx, createSubscriptionEvent, uuid.New(), arg.UserID, arg.Event, micros(now()))
+	return err
+}
+
+const listSubscriptionEvents = `-- name: ListSubscriptionEvents :many
+SELECT id, user_id, event, created_at FROM subscription_events
+WHERE user_id = ?
+ORDER BY created_at ASC`
+
+func (s *Store) ListSubscriptionEvents(ctx context.Context, userID uuid.UUID) ([]database.SubscriptionEvent, error) {
+	return queryAll(ctx, s.q, func(row scanner) (database.SubscriptionEvent, error) {
+		var i database.SubscriptionEvent
+		err := row.Scan(&i.ID, &i.UserID, &i.Event, notNullTime{&i.CreatedAt})
+		return i, err
+	}, listSubscriptionEvents, userID)
+}
@@ -0,0 +1,209 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const conversationColumns = "id, created_at, updated_at, participant_key"
+
+func scanConversation(row scanner) (database.Conversation, error) {
+	var i database.Conversation
+	err := row.Scan(&i.ID, notNullTime{&i.CreatedAt}, notNullTime{&i.UpdatedAt}, &i.ParticipantKey)
+	return i, err
+}
+
+const messageColumns = "id, conversation_id, sender_id, body, created_at"
+
+func scanMessage(row scanner) (database.Message, error) {
+	var i database.Message
+	err := row.Scan(&i.ID, &i.ConversationID, &i.SenderID, &i.Body, notNullTime{&i.CreatedAt})
+	return i, err
+}
+
+const createConversation = `-- name: CreateConversation :one
+INSERT INTO conversations (id, participant_key, created_at, updated_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (participant_key) DO NOTHING
+RETURNING ` + conversationColumns
+
+func (s *Store) CreateConversation(ctx context.Context, participantKey string) (database.Conversation, error) {
+	t := micros(now())
+	return scanConversation(s.q.QueryRowContext(ctx, createConversation, uuid.New(), participantKey, t, t))
+}
+
+const addConversationParticipant = `-- name: AddConversationParticipant :exec
+INSERT INTO conversation_participants (conversation_id, user_id, joined_at)
+VALUES (?, ?, ?)`
+
+func (s *Store) AddConversationParticipant(ctx context.Context, arg database.AddConversationParticipantParams) error {
+	_, err := s.q.ExecContext(ctx, addConversationParticipant, arg.ConversationID, arg.UserID, micros(now()))
+	return err
+}
+
+const getConversation = `-- name: GetConversation :one
+SELECT ` + conversationColumns + ` FROM conversations
+WHERE id = ?`
+
+func (s *Store) GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error) {
+	return scanConversation(s.q.QueryRowContext(ctx, getConversation, id))
+}
+
+const getConversationByParticipantKey = `-- name: GetConversationByParticipantKey :one
+SELECT ` + conversationColumns + ` FROM conversations
+WHERE participant_key = ?`
+
+func (s *Store) GetConversationByParticipantKey(ctx context.Context, participantKey string) (database.Conversation, error) {
+	return scanConversation(s.q.QueryRowContext(ctx, getConversationByParticipantKey, participantKey))
+}
+
+const listConversationsForUser = `-- name: ListConversationsForUser :many
+SELECT conversations.id, conversations.created_at, conversations.updated_at,
+    (SELECT COUNT(*) FROM messages
+     WHERE messages.conversation_id = conversations.id
+     AND messages.sender_id <> ?
+     AND (mine.last_read_at IS NULL OR messages.created_at > mine.last_read_at)
+     AND NOT EXISTS (SELECT 1 FROM message_deletions
+                     WHERE message_deletions.message_id = messages.id
+                     AND message_deletions.user_id = ?)) AS unread_count,
+    participants.user_id AS participant_id,
+    participants.last_read_at AS participant_last_read_at
+FROM conversations
+JOIN conversation_participants mine ON mine.conversation_id = conversations.id
+JOIN conversation_participants participants ON participants.conversation_id = conversations.id
+WHERE mine.user_id = ?
+ORDER BY conversations.updated_at DESC, conversations.id, participants.joined_at, participants.user_id`
+
+func scanConversationForUser(row scanner) (database.ListConversationsForUserRow, error) {
+	var i database.ListConversationsForUserRow
+	err := row.Scan(&i.ID, notNullTime{&i.CreatedAt}, notNullTime{&i.UpdatedAt}, &i.UnreadCount,
+		&i.ParticipantID, nullTime{&i.ParticipantLastReadAt})
+	return i, err
+}
+
+func (s *Store) ListConversationsForUser(ctx context.Context, userID uuid.UUID) ([]database.ListConversationsForUserRow, error) {
+	return queryAll(ctx, s.q, scanConversationForUser, listConversationsForUser, userID, userID, userID)
+}
+
+const listConversationParticipants = `-- name: ListConversationParticipants :many
+SELECT conversation_id, user_id, joined_at, last_read_at FROM conversation_participants
+WHERE conversation_id = ?
+ORDER BY joined_at, user_id`
+
+func scanConversationParticipant(row scanner) (database.ConversationParticipant, error) {
+	var i database.ConversationParticipant
+	err := row.Scan(&i.ConversationID, &i.UserID, notNullTime{&i.JoinedAt}, nullTime{&i.LastReadAt})
+	return i, err
+}
+
+func (s *Store) ListConversationParticipants(ctx context.Context, conversationID uuid.UUID) ([]database.ConversationParticipant, error) {
+	return queryAll(ctx, s.q, scanConversationParticipant, listConversationParticipants, conversationID)
+}
+
+const touchConversation = `-- name: TouchConversation :exec
+UPDATE conversations
+SET updated_at = ?
+WHERE id = ?`
+
+func (s *Store) TouchConversation(ctx context.Context, arg database.TouchConversationParams) error {
+	_, err := s.q.ExecContext(ctx, touchConversation, micros(arg.UpdatedAt), arg.ID)
+	return err
+}
+
+const createMessage = `-- name: CreateMessage :one
+INSERT INTO messages (id, conversation_id, sender_id, body, created_at)
+VALUES (?, ?, ?, ?, ?)
+RETURNING ` + messageColumns
+
+func (s *Store) CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error) {
+	return scanMessage(s.q.QueryRowContext(ctx, createMessage,
+		uuid.New(), arg.ConversationID, arg.SenderID, arg.Body, micros(now())))
+}
+
+const getMessage = `-- name: GetMessage :one
+SELECT ` + messageColumns + ` FROM messages
+WHERE id = ?
+AND conversation_id = ?`
+
+func (s *Store) GetMessage(ctx context.Context, arg database.GetMessageParams) (database.Message, error) {
+	return scanMessage(s.q.QueryRowContext(ctx, getMessage, arg.ID, arg.ConversationID))
+}
+
+const listMessages = `-- name: ListMessages :many
+SELECT ` + messageColumns + ` FROM messages
+WHERE conversation_id = ?
+AND NOT EXISTS (SELECT 1 FROM message_deletions
+                WHERE message_deletions.message_id = messages.id
+                AND message_deletions.user_id = ?)
+AND (? IS NULL OR (created_at, id) < (?, ?))
+ORDER BY created_at DESC, id DESC
+LIMIT ?`
+
+func (s *Store) ListMessages(ctx context.Context, arg database.ListMessagesParams) ([]database.Message, error) {
+	before := nullMicros(arg.BeforeCreatedAt)
+	return queryAll(ctx, s.q, scanMessage, listMessages,
+		arg.ConversationID, arg.UserID,
+		before, before, arg.BeforeID,
+		arg.PageSize)
+}
+
+const markConversationRead = `-- name: MarkConversationRead :exec
+UPDATE conversation_participants
+SET last_read_at = MAX(COALESCE(last_read_at, ?), ?)
+WHERE conversation_id = ?
+AND user_id = ?`
+
+func (s *Store) MarkConversationRead(ctx context.Context, arg database.MarkConversationReadParams) error {
+	readAt := micros(arg.ReadAt)
+	_, err := s.q.ExecContext(ctx, markConversationRead, readAt, readAt, arg.ConversationID, arg.UserID)
+	return err
+}
+
+const deleteMessageForUser = `-- name: DeleteMessageForUser :exec
+INSERT INTO message_deletions (message_id, user_id)
+VALUES (?, ?)
+ON CONFLICT DO NOTHING`
+
+func (s *Store) DeleteMessageForUser(ctx context.Context, arg database.DeleteMessageForUserParams) error {
+	_, err := s.q.ExecContext(ctx, deleteMessageForUser, arg.MessageID, arg.UserID)
+	return err
+}
+
+// Foreign keys aren't enforced, so the deletions of a user's messages go first.
+const deleteMessagesBySenderIDDeletions = `-- name: DeleteMessagesBySenderID :exec
+DELETE FROM message_deletions
+WHERE message_id IN (SELECT id FROM messages WHERE sender_id = ?)`
+
+const deleteMessagesBySenderID = `-- name: DeleteMessagesBySenderID :exec
+DELETE FROM messages
+WHERE sender_id = ?`
+
+func (s *Store) DeleteMessagesBySenderID(ctx context.Context, senderID uuid.UUID) error {
+	return s.InTx(ctx, func(ctx context.Context) error {
+		if _, err := s.q.ExecContext(ctx, deleteMessagesBySenderIDDeletions, senderID); err != nil {
+			return err
+		}
+		_, err := s.q.ExecContext(ctx, deleteMessagesBySenderID, senderID)
+		return err
+	})
+}
+
+const deleteMessageDeletionsByUserID = `-- name: DeleteMessageDeletionsByUserID :exec
+DELETE FROM message_deletions
+WHERE user_id = ?`
+
+func (s *Store) DeleteMessageDeletionsByUserID(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, deleteMessageDeletionsByUserID, userID)
+	return err
+}
+
+const deleteConversationParticipantsByUserID = `-- name: DeleteConversationParticipantsByUserID :exec
+DELETE FROM conversation_participants
+WHERE user_id = ?`
+
+func (s *Store) DeleteConversationParticipantsByUserID(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, deleteConversationParticipantsByUserID, userID)
+	return err
+}
@@ -0,0 +1,151 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const chirpReportColumns = "id, chirp_id, reporter_id, reason, details, status, created_at, resolved_at, resolved_by"
+
+func scanChirpReport(row scanner) (database.ChirpReport, error) {
+	var i database.ChirpReport
+	err := row.Scan(
+		&i.ID,
+		&i.ChirpID,
+		&i.ReporterID,
+		&i.Reason,
+		&i.Details,
+		&i.Status,
+		notNullTime{&i.CreatedAt},
+		nullTime{&i.ResolvedAt},
+		&i.ResolvedBy,
+	)
+	return i, err
+}
+
+const moderationActionColumns = "id, actor_id, action, target_user_id, target_chirp_id, reason, expires_at, created_at"
+
+func scanModerationAction(row scanner) (database.ModerationAction, error) {
+	var i database.ModerationAction
+	err := row.Scan(
+		&i.ID,
+		&i.ActorID,
+		&i.Action,
+		&i.TargetUserID,
+		&i.TargetChirpID,
+		&i.Reason,
+		nullTime{&i.ExpiresAt},
+		notNullTime{&i.CreatedAt},
+	)
+	return i, err
+}
+
+const createChirpReport = `-- name: CreateChirpReport :one
+INSERT INTO chirp_reports (id, chirp_id, reporter_id, reason, details, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING ` + chirpReportColumns
+
+func (s *Store) CreateChirpReport(ctx context.Context, arg database.CreateChirpReportParams) (database.ChirpReport, error) {
+	return scanChirpReport(s.q.QueryRowContext(ctx, createChirpReport,
+		uuid.New(), arg.ChirpID, arg.ReporterID, arg.Reason, arg.Details, micros(now())))
+}
+
+const listOpenChirpReports = `-- name: ListOpenChirpReports :many
+SELECT ` + chirpReportColumns + ` FROM chirp_reports
+WHERE status = 'open'
+ORDER BY created_at ASC`
+
+func (s *Store) ListOpenChirpReports(ctx context.Context) ([]database.ChirpReport, error) {
+	return queryAll(ctx, s.q, scanChirpReport, listOpenChirpReports)
+}
+
+const listChirpReportsByReporter = `-- name: ListChirpReportsByReporter :many
+SELECT ` + chirpReportColumns + ` FROM chirp_reports
+WHERE reporter_id = ?
+ORDER BY created_at ASC`
+
+func (s *Store) ListChirpReportsByReporter(ctx context.Context, reporterID uuid.UUID) ([]database.ChirpReport, error) {
+	return queryAll(ctx, s.q, scanChirpReport, listChirpReportsByReporter, reporterID)
+}
+
+const resolveChirpReports = `-- name: ResolveChirpReports :exec
+UPDATE chirp_reports
+SET status = 'resolved',
+    resolved_at = ?,
+    resolved_by = ?
+WHERE chirp_id = ?
+AND status = 'open'`
+
+func (s *Store) ResolveChirpReports(ctx context.Context, arg database.ResolveChirpReportsParams) error {
+	_, err := s.q.ExecContext(ctx, resolveChirpReports, micros(now()), arg.ResolvedBy, arg.ChirpID)
+	return err
+}
+
+const dismissChirpReport = `-- name: DismissChirpReport :one
+UPDATE chirp_reports
+SET status = 'dismissed',
+    resolved_at = ?,
+    resolved_by = ?
+WHERE id = ?
+AND status = 'open'
+RETURNING ` + chirpReportColumns
+
+func (s *Store) DismissChirpReport(ctx context.Context, arg database.DismissChirpReportParams) (database.ChirpReport, error) {
+	return scanChirpReport(s.q.QueryRowContext(ctx, dismissChirpReport, micros(now()), arg.ResolvedBy, arg.ID))
+}
+
+const hideChirp = `-- name: HideChirp :one
+UPDATE chirps
+SET hidden_at = ?,
+    updated_at = ?
+WHERE id = ?
+RETURNING ` + chirpColumns
+
+func (s *Store) HideChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	ts := micros(now())
+	return scanChirp(s.q.QueryRowContext(ctx, hideChirp, ts, ts, id))
+}
+
+const suspendUser = `-- name: SuspendUser :one
+UPDATE users
+SET suspended_until = ?,
+    updated_at = ?
+WHERE id = ?
+RETURNING ` + userColumns
+
+func (s *Store) SuspendUser(ctx context.Context, arg database.SuspendUserParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, suspendUser, nullMicros(arg.SuspendedUntil), micros(now()), arg.ID))
+}
+
+const banUser = `-- name: BanUser :one
+UPDATE users
+SET banned_at = ?,
+    updated_at = ?
+WHERE id = ?
+RETURNING ` + userColumns
+
+func (s *Store) BanUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	ts := micros(now())
+	return scanUser(s.q.QueryRowContext(ctx, banUser, ts, ts, id))
+}
+
+const createModerationAction = `-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id, actor_id, action, target_user_id, target_chirp_id, reason, expires_at, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING ` + moderationActionColumns
+
+func (s *Store) CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationAction, error) {
+	return scanModerationAction(s.q.QueryRowContext(ctx, createModerationAction,
+		uuid.New(), arg.ActorID, arg.Action, arg.TargetUserID, arg.TargetChirpID, arg.Reason, nullMicros(arg.ExpiresAt), micros(now())))
+}
+
+const listModerationActions = `-- name: ListModerationActions :many
+SELECT ` + moderationActionColumns + ` FROM moderation_actions
+ORDER BY created_at DESC
+LIMIT ?`
+
+func (s *Store) ListModerationActions(ctx context.Context, limit int32) ([]database.ModerationAction, error) {
+	return queryAll(ctx, s.q, scanModerationAction, listModerationActions, limit)
+}
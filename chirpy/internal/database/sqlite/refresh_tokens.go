@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const createRefreshToken = `-- name: CreateRefreshToken :exec
+INSERT INTO refresh_tokens (user_id, token, expires_at, revoked_at, created_at, updated_at)
+VALUES (?, ?, ?, NULL, ?, ?)`
+
+// CreateRefreshToken computes expires_at in Go where Postgres uses
+// NOW() + make_interval(secs => ...).
+func (s *Store) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error {
+	created := now()
+	expires := created.Add(time.Duration(arg.ExpiresInSeconds) * time.Second)
+	_, err := s.q.ExecContext(ctx, createRefreshToken, arg.UserID, arg.Token, micros(expires), micros(created), micros(created))
+	return err
+}
+
+const getUserByRefreshToken = `-- name: GetUserByRefreshToken :one
+SELECT user_id FROM refresh_tokens
+WHERE token = ?
+AND revoked_at IS NULL
+AND expires_at > ?
+LIMIT 1`
+
+func (s *Store) GetUserByRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := s.q.QueryRowContext(ctx, getUserByRefreshToken, token, micros(now())).Scan(&userID)
+	return userID, err
+}
+
+const revokeRefreshToken = `-- name: RevokeRefreshToken :one
+UPDATE refresh_tokens
+SET revoked_at = ?,
+    updated_at = ?
+WHERE token = ?
+RETURNING user_id`
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
+	ts := micros(now())
+	var userID uuid.UUID
+	err := s.q.QueryRowContext(ctx, revokeRefreshToken, ts, ts, token).Scan(&userID)
+	return userID, err
+}
+
+const listRefreshTokensByUserID = `-- name: ListRefreshTokensByUserID :many
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens
+WHERE user_id = ?
+ORDER BY created_at ASC`
+
+func (s *Store) ListRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	return queryAll(ctx, s.q, func(row scanner) (database.RefreshToken, error) {
+		var i database.RefreshToken
+		err := row.Scan(
+			&i.Token,
+			nullTime{&i.CreatedAt},
+			nullTime{&i.UpdatedAt},
+			&i.UserID,
+			notNullTime{&i.ExpiresAt},
+			nullTime{&i.RevokedAt},
+		)
+		return i, err
+	}, listRefreshTokensByUserID, userID)
+}
+
+const revokeRefreshTokensByUserID = `-- name: RevokeRefreshTokensByUserID :exec
+UPDATE refresh_tokens
+SET revoked_at = ?,
+    updated_at = ?
+WHERE user_id = ?
+AND revoked_at IS NULL`
+
+func (s *Store) RevokeRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) error {
+	ts := micros(now())
+	_, err := s.q.ExecContext(ctx, revokeRefreshTokensByUserID, ts, ts, userID)
+	return err
+}
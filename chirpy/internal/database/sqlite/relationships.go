@@ -0,0 +1,140 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const createUserRelationship = `-- name: CreateUserRelationship :exec
+INSERT INTO user_relationships (user_id, target_id, kind, created_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT DO NOTHING`
+
+func (s *Store) CreateUserRelationship(ctx context.Context, arg database.CreateUserRelationshipParams) error {
+	_, err := s.q.ExecContext(ctx, createUserRelationship, arg.UserID, arg.TargetID, arg.Kind, micros(now()))
+	return err
+}
+
+const deleteUserRelationship = `-- name: DeleteUserRelationship :execrows
+DELETE FROM user_relationships
+WHERE user_id = ?
+AND target_id = ?
+AND kind = ?`
+
+func (s *Store) DeleteUserRelationship(ctx context.Context, arg database.DeleteUserRelationshipParams) (int64, error) {
+	result, err := s.q.ExecContext(ctx, deleteUserRelationship, arg.UserID, arg.TargetID, arg.Kind)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listUserRelationships = `-- name: ListUserRelationships :many
+SELECT user_id, target_id, kind, created_at FROM user_relationships
+WHERE user_id = ?
+AND kind = ?
+ORDER BY created_at DESC, target_id`
+
+func scanUserRelationship(row scanner) (database.UserRelationship, error) {
+	var i database.UserRelationship
+	err := row.Scan(&i.UserID, &i.TargetID, &i.Kind, notNullTime{&i.CreatedAt})
+	return i, err
+}
+
+func (s *Store) ListUserRelationships(ctx context.Context, arg database.ListUserRelationshipsParams) ([]database.UserRelationship, error) {
+	return queryAll(ctx, s.q, scanUserRelationship, listUserRelationships, arg.UserID, arg.Kind)
+}
+
+const isBlockedBetween = `-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM user_relationships
+    WHERE kind = 'block'
+    AND ((user_id = ? AND target_id = ?)
+         OR (user_id = ? AND target_id = ?))
+)`
+
+func (s *Store) IsBlockedBetween(ctx context.Context, arg database.IsBlockedBetweenParams) (bool, error) {
+	var blocked bool
+	err := s.q.QueryRowContext(ctx, isBlockedBetween, arg.UserA, arg.UserB, arg.UserB, arg.UserA).Scan(&blocked)
+	return blocked, err
+}
+
+const deleteUserRelationshipsByUserID = `-- name: DeleteUserRelationshipsByUserID :exec
+DELETE FROM user_relationships
+WHERE user_id = ?
+OR target_id = ?`
+
+func (s *Store) DeleteUserRelationshipsByUserID(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, deleteUserRelationshipsByUserID, userID, userID)
+	return err
+}
+
+const followUser = `-- name: FollowUser :execrows
+INSERT INTO user_follows (follower_id, followee_id, created_at)
+SELECT ?, ?, ?
+WHERE NOT EXISTS (
+    SELECT 1 FROM user_relationships
+    WHERE kind = 'block'
+    AND ((user_id = ? AND target_id = ?)
+         OR (user_id = ? AND target_id = ?))
+)
+ON CONFLICT (follower_id, followee_id) DO UPDATE SET created_at = user_follows.created_at`
+
+func (s *Store) FollowUser(ctx context.Context, arg database.FollowUserParams) (int64, error) {
+	result, err := s.q.ExecContext(ctx, followUser, arg.FollowerID, arg.FolloweeID, micros(now()),
+		arg.FollowerID, arg.FolloweeID, arg.FolloweeID, arg.FollowerID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unfollowUser = `-- name: UnfollowUser :execrows
+DELETE FROM user_follows
+WHERE follower_id = ?
+AND followee_id = ?`
+
+func (s *Store) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) (int64, error) {
+	result, err := s.q.ExecContext(ctx, unfollowUser, arg.FollowerID, arg.FolloweeID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listUserFollows = `-- name: ListUserFollows :many
+SELECT follower_id, followee_id, created_at FROM user_follows
+WHERE follower_id = ?
+ORDER BY created_at DESC, followee_id`
+
+func scanUserFollow(row scanner) (database.UserFollow, error) {
+	var i database.UserFollow
+	err := row.Scan(&i.FollowerID, &i.FolloweeID, notNullTime{&i.CreatedAt})
+	return i, err
+}
+
+func (s *Store) ListUserFollows(ctx context.Context, followerID uuid.UUID) ([]database.UserFollow, error) {
+	return queryAll(ctx, s.q, scanUserFollow, listUserFollows, followerID)
+}
+
+const deleteFollowsBetween = `-- name: DeleteFollowsBetween :exec
+DELETE FROM user_follows
+WHERE (follower_id = ? AND followee_id = ?)
+OR (follower_id = ? AND followee_id = ?)`
+
+func (s *Store) DeleteFollowsBetween(ctx context.Context, arg database.DeleteFollowsBetweenParams) error {
+	_, err := s.q.ExecContext(ctx, deleteFollowsBetween, arg.UserA, arg.UserB, arg.UserB, arg.UserA)
+	return err
+}
+
+const deleteUserFollowsByUserID = `-- name: DeleteUserFollowsByUserID :exec
+DELETE FROM user_follows
+WHERE follower_id = ?
+OR followee_id = ?`
+
+func (s *Store) DeleteUserFollowsByUserID(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.q.ExecContext(ctx, deleteUserFollowsByUserID, userID, userID)
+	return err
+}
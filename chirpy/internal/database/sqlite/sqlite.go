@@ -0,0 +1,142 @@
+// Package sqlite is a SQLite implementation of the queries in internal/database,
+// for small deployments and local development. It returns the same sqlc model
+// types, so the server can't tell the backends apart.
+//
+// The driver is modernc.org/sqlite, which is pure Go, so the binary still
+// builds without cgo.
+//
+// Postgres fills in ids and timestamps with gen_random_uuid() and NOW(); here
+// the store generates them in Go. Timestamps are stored as Unix microseconds,
+// which compare and sort correctly as integers whatever the driver.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	_ "modernc.org/sqlite"
+)
+
+// DriverName is the database/sql driver Open uses.
+const DriverName = "sqlite"
+
+// Open opens the database at dsn, a file path or a driver-specific URI with
+// any "sqlite:" or "sqlite://" prefix removed.
+func Open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open(DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time; a single connection turns lock
+	// contention into queueing instead of SQLITE_BUSY errors.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// DSN strips the scheme from a DB_URL such as sqlite:///var/lib/chirpy.db or
+// sqlite:chirpy.db.
+func DSN(dbURL string) string {
+	if rest, ok := strings.CutPrefix(dbURL, "sqlite://"); ok {
+		return rest
+	}
+	return strings.TrimPrefix(dbURL, "sqlite:")
+}
+
+// Store has the same methods as database.Queries.
+type Store struct {
+	tx database.TxDB
+	q  database.DBTX
+}
+
+func New(db *sql.DB) *Store {
+	tx := database.NewTxDB(db)
+	return &Store{tx: tx, q: tx}
+}
+
+// NewTraced is New with a span around every query; see database.NewTraced.
+func NewTraced(db *sql.DB) *Store {
+	tx := database.NewTxDB(db)
+	return &Store{tx: tx, q: database.Traced(tx, DriverName)}
+}
+
+// InTx runs fn in a transaction; see database.TxDB.InTx. Open allows one
+// connection, so a query made inside fn without fn's context waits for the
+// transaction to finish.
+func (s *Store) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.tx.InTx(ctx, fn)
+}
+
+// now is the timestamp NOW() would have produced, at Postgres' precision.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func micros(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+func nullMicros(t sql.NullTime) any {
+	if !t.Valid {
+		return nil
+	}
+	return t.Time.UnixMicro()
+}
+
+// nullTime scans a nullable Unix microsecond column.
+type nullTime struct{ dst *sql.NullTime }
+
+func (n nullTime) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*n.dst = sql.NullTime{}
+	case int64:
+		*n.dst = sql.NullTime{Time: time.UnixMicro(v).UTC(), Valid: true}
+	default:
+		return fmt.Errorf("sqlite: timestamp column holds %T, want Unix microseconds", src)
+	}
+	return nil
+}
+
+// notNullTime scans a NOT NULL Unix microsecond column.
+type notNullTime struct{ dst *time.Time }
+
+func (n notNullTime) Scan(src any) error {
+	var t sql.NullTime
+	if err := (nullTime{&t}).Scan(src); err != nil {
+		return err
+	}
+	if !t.Valid {
+		return fmt.Errorf("sqlite: unexpected NULL timestamp")
+	}
+	*n.dst = t.Time
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// queryAll mirrors sqlc's :many methods, including returning nil for no rows.
+func queryAll[T any](ctx context.Context, q database.DBTX, scan func(scanner) (T, error), query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,47 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/djblackett/chirpy/internal/database/sqlite"
+	"github.com/djblackett/chirpy/internal/migrate"
+	"github.com/djblackett/chirpy/server"
+	"github.com/djblackett/chirpy/server/storetest"
+	"github.com/djblackett/chirpy/sql/sqlite/schema"
+)
+
+var _ server.Store = (*sqlite.Store)(nil)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) server.Store {
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "chirpy.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		migrator, err := migrate.New(db, migrate.SQLite, schema.FS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatalf("migrating: %v", err)
+		}
+		return sqlite.NewTraced(db)
+	})
+}
+
+func TestDSN(t *testing.T) {
+	for in, want := range map[string]string{
+		"sqlite:///var/lib/chirpy.db":          "/var/lib/chirpy.db",
+		"sqlite://chirpy.db":                   "chirpy.db",
+		"sqlite:chirpy.db":                     "chirpy.db",
+		"sqlite::memory:":                      ":memory:",
+		"sqlite:file:chirpy.db?_pragma=foo(1)": "file:chirpy.db?_pragma=foo(1)",
+	} {
+		if got := sqlite.DSN(in); got != want {
+			t.Errorf("DSN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
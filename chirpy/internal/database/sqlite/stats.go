@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+)
+
+const getStatsTotals = `-- name: GetStatsTotals :one
+SELECT
+    (SELECT COUNT(*) FROM users WHERE deleted_at IS NULL),
+    (SELECT COUNT(*) FROM users WHERE is_chirpy_red AND deleted_at IS NULL),
+    (SELECT COUNT(*) FROM chirps WHERE publish_at IS NULL),
+    (SELECT COUNT(*) FROM refresh_tokens WHERE revoked_at IS NULL AND expires_at > ?),
+    (SELECT COUNT(*) FROM chirp_reports WHERE status = 'open')`
+
+func (s *Store) GetStatsTotals(ctx context.Context) (database.GetStatsTotalsRow, error) {
+	var i database.GetStatsTotalsRow
+	err := s.q.QueryRowContext(ctx, getStatsTotals, micros(now())).Scan(
+		&i.Users,
+		&i.ChirpyRedUsers,
+		&i.Chirps,
+		&i.ActiveSessions,
+		&i.OpenReports,
+	)
+	return i, err
+}
+
+// The day queries truncate Unix microseconds to whole UTC days (86400000000
+// microseconds) in place of date_trunc('day', ...).
+
+const countSignupsByDay = `-- name: CountSignupsByDay :many
+SELECT (created_at / 86400000000) * 86400000000 AS day, COUNT(*)
+FROM users
+WHERE created_at >= ?
+GROUP BY day
+ORDER BY day`
+
+func (s *Store) CountSignupsByDay(ctx context.Context, since time.Time) ([]database.CountSignupsByDayRow, error) {
+	return queryAll(ctx, s.q, func(row scanner) (database.CountSignupsByDayRow, error) {
+		var i database.CountSignupsByDayRow
+		err := row.Scan(notNullTime{&i.Day}, &i.Count)
+		return i, err
+	}, countSignupsByDay, micros(since))
+}
+
+const countChirpsByDay = `-- name: CountChirpsByDay :many
+SELECT (created_at / 86400000000) * 86400000000 AS day, COUNT(*)
+FROM chirps
+WHERE created_at >= ?
+AND publish_at IS NULL
+GROUP BY day
+ORDER BY day`
+
+func (s *Store) CountChirpsByDay(ctx context.Context, since time.Time) ([]database.CountChirpsByDayRow, error) {
+	return queryAll(ctx, s.q, func(row scanner) (database.CountChirpsByDayRow, error) {
+		var i database.CountChirpsByDayRow
+		err := row.Scan(notNullTime{&i.Day}, &i.Count)
+		return i, err
+	}, countChirpsByDay, micros(since))
+}
+
+const listTopPosters = `-- name: ListTopPosters :many
+SELECT users.id, users.email, COUNT(chirps.id) AS chirp_count
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.publish_at IS NULL
+AND users.deleted_at IS NULL
+GROUP BY users.id, users.email
+ORDER BY chirp_count DESC, users.email
+LIMIT ?`
+
+func (s *Store) ListTopPosters(ctx context.Context, limit int32) ([]database.ListTopPostersRow, error) {
+	return queryAll(ctx, s.q, func(row scanner) (database.ListTopPostersRow, error) {
+		var i database.ListTopPostersRow
+		err := row.Scan(&i.ID, &i.Email, &i.ChirpCount)
+		return i, err
+	}, listTopPosters, limit)
+}
@@ -0,0 +1,289 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const userColumns = "id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio"
+
+func scanUser(row scanner) (database.User, error) {
+	var i database.User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		nullTime{&i.CreatedAt},
+		nullTime{&i.UpdatedAt},
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		nullTime{&i.SuspendedUntil},
+		nullTime{&i.BannedAt},
+		nullTime{&i.DeletedAt},
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+	)
+	return i, err
+}
+
+const countUsersByRole = `-- name: CountUsersByRole :one
+SELECT COUNT(*) FROM users
+WHERE role = ?`
+
+func (s *Store) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	var count int64
+	err := s.q.QueryRowContext(ctx, countUsersByRole, role).Scan(&count)
+	return count, err
+}
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+VALUES (?, ?, ?, ?, ?)
+RETURNING ` + userColumns
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	ts := micros(now())
+	return scanUser(s.q.QueryRowContext(ctx, createUser, uuid.New(), ts, ts, arg.Email, arg.HashedPassword))
+}
+
+// deleteUsers clears every table that references users, children first.
+var deleteUsers = []string{
+	"-- name: DeleteUsers :exec\nDELETE FROM user_relationships",
+	"-- name: DeleteUsers :exec\nDELETE FROM user_follows",
+	"-- name: DeleteUsers :exec\nDELETE FROM message_deletions",
+	"-- name: DeleteUsers :exec\nDELETE FROM messages",
+	"-- name: DeleteUsers :exec\nDELETE FROM conversation_participants",
+	"-- name: DeleteUsers :exec\nDELETE FROM conversations",
+	"-- name: DeleteUsers :exec\nDELETE FROM user_avatars",
+	"-- name: DeleteUsers :exec\nDELETE FROM webhook_deliveries",
+	"-- name: DeleteUsers :exec\nDELETE FROM webhook_endpoints",
+	"-- name: DeleteUsers :exec\nDELETE FROM chirp_reports",
+	"-- name: DeleteUsers :exec\nDELETE FROM data_export_chunks",
+	"-- name: DeleteUsers :exec\nDELETE FROM data_exports",
+	"-- name: DeleteUsers :exec\nDELETE FROM subscription_events",
+	"-- name: DeleteUsers :exec\nDELETE FROM refresh_tokens",
+	"-- name: DeleteUsers :exec\nDELETE FROM chirps",
+	"-- name: DeleteUsers :exec\nDELETE FROM users",
+}
+
+func (s *Store) DeleteUsers(ctx context.Context) error {
+	return s.InTx(ctx, func(ctx context.Context) error {
+		for _, query := range deleteUsers {
+			if _, err := s.q.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT ` + userColumns + ` FROM users
+WHERE email = ?`
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, getUserByEmail, email))
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT ` + userColumns + ` FROM users
+WHERE id = ?`
+
+func (s *Store) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, getUserByID, id))
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET updated_at = ?,
+    email = ?,
+    hashed_password = ?
+WHERE id = ?
+RETURNING ` + userColumns
+
+func (s *Store) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, updateUser, micros(now()), arg.Email, arg.HashedPassword, arg.ID))
+}
+
+const upgradeUserToRed = `-- name: UpgradeUserToRed :one
+UPDATE users
+SET updated_at = ?,
+    is_chirpy_red = 1
+WHERE id = ?
+RETURNING ` + userColumns
+
+func (s *Store) UpgradeUserToRed(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, upgradeUserToRed, micros(now()), id))
+}
+
+const setUserRoleByEmail = `-- name: SetUserRoleByEmail :one
+UPDATE users
+SET updated_at = ?,
+    role = ?
+WHERE email = ?
+RETURNING ` + userColumns
+
+func (s *Store) SetUserRoleByEmail(ctx context.Context, arg database.SetUserRoleByEmailParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, setUserRoleByEmail, micros(now()), arg.Role, arg.Email))
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET updated_at = ?,
+    role = ?
+WHERE id = ?
+RETURNING ` + userColumns
+
+func (s *Store) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, setUserRole, micros(now()), arg.Role, arg.ID))
+}
+
+// deleteUser removes one user and everything that references them, children first.
+var deleteUser = []string{
+	"-- name: DeleteUser :exec\nDELETE FROM chirp_reports WHERE reporter_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM chirp_reports WHERE chirp_id IN (SELECT id FROM chirps WHERE user_id = ?)",
+	"-- name: DeleteUser :exec\nDELETE FROM data_export_chunks WHERE export_id IN (SELECT id FROM data_exports WHERE user_id = ?)",
+	"-- name: DeleteUser :exec\nDELETE FROM data_exports WHERE user_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM user_avatars WHERE user_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM user_relationships WHERE user_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM user_relationships WHERE target_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM user_follows WHERE follower_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM user_follows WHERE followee_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM message_deletions WHERE user_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM message_deletions WHERE message_id IN (SELECT id FROM messages WHERE sender_id = ?)",
+	"-- name: DeleteUser :exec\nDELETE FROM messages WHERE sender_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM conversation_participants WHERE user_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM webhook_deliveries WHERE endpoint_id IN (SELECT id FROM webhook_endpoints WHERE user_id = ?)",
+	"-- name: DeleteUser :exec\nDELETE FROM webhook_endpoints WHERE user_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM subscription_events WHERE user_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM refresh_tokens WHERE user_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM chirps WHERE user_id = ?",
+	"-- name: DeleteUser :exec\nDELETE FROM users WHERE id = ?",
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return s.InTx(ctx, func(ctx context.Context) error {
+		for _, query := range deleteUser {
+			if _, err := s.q.ExecContext(ctx, query, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+const anonymizeUser = `-- name: AnonymizeUser :one
+UPDATE users
+SET updated_at = ?,
+    deleted_at = ?,
+    email = 'deleted-' || id || '@deleted.invalid',
+    hashed_password = '',
+    is_chirpy_red = 0,
+    role = 'user',
+    handle = NULL,
+    display_name = '',
+    bio = ''
+WHERE id = ?
+RETURNING ` + userColumns
+
+func (s *Store) AnonymizeUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	ts := micros(now())
+	return scanUser(s.q.QueryRowContext(ctx, anonymizeUser, ts, ts, id))
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT ` + userColumns + ` FROM users
+WHERE lower(handle) = lower(?)`
+
+func (s *Store) GetUserByHandle(ctx context.Context, handle string) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, getUserByHandle, handle))
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET updated_at = ?,
+    handle = ?,
+    display_name = ?,
+    bio = ?
+WHERE id = ?
+RETURNING ` + userColumns
+
+func (s *Store) UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.User, error) {
+	return scanUser(s.q.QueryRowContext(ctx, updateUserProfile, micros(now()), arg.Handle, arg.DisplayName, arg.Bio, arg.ID))
+}
+
+const getUserProfile = `-- name: GetUserProfile :one
+SELECT users.id, users.handle, users.display_name, users.bio, users.created_at,
+    (SELECT COUNT(*) FROM chirps
+     WHERE chirps.user_id = users.id
+     AND chirps.hidden_at IS NULL
+     AND chirps.publish_at IS NULL) AS chirp_count,
+    (SELECT COUNT(*) FROM user_follows
+     JOIN users followers ON followers.id = user_follows.follower_id
+     WHERE user_follows.followee_id = users.id
+     AND followers.deleted_at IS NULL
+     AND followers.banned_at IS NULL) AS follower_count,
+    user_avatars.updated_at AS avatar_updated_at
+FROM users
+LEFT JOIN user_avatars ON user_avatars.user_id = users.id
+WHERE lower(users.handle) = lower(?)
+AND users.deleted_at IS NULL
+AND users.banned_at IS NULL`
+
+func (s *Store) GetUserProfile(ctx context.Context, handle string) (database.GetUserProfileRow, error) {
+	var i database.GetUserProfileRow
+	err := s.q.QueryRowContext(ctx, getUserProfile, handle).Scan(
+		&i.ID,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		nullTime{&i.CreatedAt},
+		&i.ChirpCount,
+		&i.FollowerCount,
+		nullTime{&i.AvatarUpdatedAt},
+	)
+	return i, err
+}
+
+const setUserAvatar = `-- name: SetUserAvatar :exec
+INSERT INTO user_avatars (user_id, content_type, image, updated_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE
+SET content_type = excluded.content_type,
+    image = excluded.image,
+    updated_at = excluded.updated_at`
+
+func (s *Store) SetUserAvatar(ctx context.Context, arg database.SetUserAvatarParams) error {
+	_, err := s.q.ExecContext(ctx, setUserAvatar, arg.UserID, arg.ContentType, arg.Image, micros(now()))
+	return err
+}
+
+const getUserAvatar = `-- name: GetUserAvatar :one
+SELECT user_id, content_type, image, updated_at FROM user_avatars
+WHERE user_id = ?`
+
+func (s *Store) GetUserAvatar(ctx context.Context, userID uuid.UUID) (database.UserAvatar, error) {
+	var i database.UserAvatar
+	err := s.q.QueryRowContext(ctx, getUserAvatar, userID).Scan(
+		&i.UserID,
+		&i.ContentType,
+		&i.Image,
+		notNullTime{&i.UpdatedAt},
+	)
+	return i, err
+}
+
+const deleteUserAvatar = `-- name: DeleteUserAvatar :execrows
+DELETE FROM user_avatars
+WHERE user_id = ?`
+
+func (s *Store) DeleteUserAvatar(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := s.q.ExecContext(ctx, deleteUserAvatar, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
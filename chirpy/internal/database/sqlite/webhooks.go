@@ -0,0 +1,218 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const webhookEndpointColumns = "id, user_id, url, secret, events, all_users, created_at"
+
+// stringList scans a JSON array of strings, SQLite's stand-in for TEXT[].
+type stringList struct{ dst *[]string }
+
+func (l stringList) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), l.dst)
+	case []byte:
+		return json.Unmarshal(v, l.dst)
+	default:
+		return fmt.Errorf("sqlite: list column holds %T, want a JSON array", src)
+	}
+}
+
+func scanWebhookEndpoint(row scanner) (database.WebhookEndpoint, error) {
+	var i database.WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		stringList{&i.Events},
+		&i.AllUsers,
+		notNullTime{&i.CreatedAt},
+	)
+	return i, err
+}
+
+const webhookDeliveryColumns = "id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, last_error, created_at"
+
+func scanWebhookDelivery(row scanner) (database.WebhookDelivery, error) {
+	var i database.WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.EndpointID,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		notNullTime{&i.NextAttemptAt},
+		nullTime{&i.LastAttemptAt},
+		&i.ResponseStatus,
+		&i.LastError,
+		notNullTime{&i.CreatedAt},
+	)
+	return i, err
+}
+
+const createWebhookEndpoint = `-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, user_id, url, secret, events, all_users, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING ` + webhookEndpointColumns
+
+func (s *Store) CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	events, err := json.Marshal(arg.Events)
+	if err != nil {
+		return database.WebhookEndpoint{}, err
+	}
+	return scanWebhookEndpoint(s.q.QueryRowContext(ctx, createWebhookEndpoint,
+		uuid.New(), arg.UserID, arg.Url, arg.Secret, string(events), arg.AllUsers, micros(now())))
+}
+
+const listWebhookEndpoints = `-- name: ListWebhookEndpoints :many
+SELECT ` + webhookEndpointColumns + ` FROM webhook_endpoints
+WHERE user_id = ?
+ORDER BY created_at ASC`
+
+func (s *Store) ListWebhookEndpoints(ctx context.Context, userID uuid.UUID) ([]database.WebhookEndpoint, error) {
+	return queryAll(ctx, s.q, scanWebhookEndpoint, listWebhookEndpoints, userID)
+}
+
+const getWebhookEndpoint = `-- name: GetWebhookEndpoint :one
+SELECT ` + webhookEndpointColumns + ` FROM webhook_endpoints
+WHERE id = ?`
+
+func (s *Store) GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error) {
+	return scanWebhookEndpoint(s.q.QueryRowContext(ctx, getWebhookEndpoint, id))
+}
+
+const deleteWebhookDeliveriesByEndpointID = `-- name: DeleteWebhookEndpoint :exec
+DELETE FROM webhook_deliveries
+WHERE endpoint_id = ?`
+
+const deleteWebhookEndpoint = `-- name: DeleteWebhookEndpoint :exec
+DELETE FROM webhook_endpoints
+WHERE id = ?`
+
+func (s *Store) DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID) error {
+	return s.InTx(ctx, func(ctx context.Context) error {
+		if _, err := s.q.ExecContext(ctx, deleteWebhookDeliveriesByEndpointID, id); err != nil {
+			return err
+		}
+		_, err := s.q.ExecContext(ctx, deleteWebhookEndpoint, id)
+		return err
+	})
+}
+
+const deleteWebhookDeliveriesByUserID = `-- name: DeleteWebhookEndpointsByUserID :exec
+DELETE FROM webhook_deliveries
+WHERE endpoint_id IN (SELECT id FROM webhook_endpoints WHERE user_id = ?)`
+
+const deleteWebhookEndpointsByUserID = `-- name: DeleteWebhookEndpointsByUserID :exec
+DELETE FROM webhook_endpoints
+WHERE user_id = ?`
+
+func (s *Store) DeleteWebhookEndpointsByUserID(ctx context.Context, userID uuid.UUID) error {
+	return s.InTx(ctx, func(ctx context.Context) error {
+		if _, err := s.q.ExecContext(ctx, deleteWebhookDeliveriesByUserID, userID); err != nil {
+			return err
+		}
+		_, err := s.q.ExecContext(ctx, deleteWebhookEndpointsByUserID, userID)
+		return err
+	})
+}
+
+const listWebhookEndpointsForEvent = `-- name: ListWebhookEndpointsForEvent :many
+SELECT ` + webhookEndpointColumns + ` FROM webhook_endpoints
+WHERE EXISTS (SELECT 1 FROM json_each(events) WHERE value = ?)
+AND (user_id = ? OR all_users)`
+
+func (s *Store) ListWebhookEndpointsForEvent(ctx context.Context, arg database.ListWebhookEndpointsForEventParams) ([]database.WebhookEndpoint, error) {
+	return queryAll(ctx, s.q, scanWebhookEndpoint, listWebhookEndpointsForEvent, arg.EventType, arg.UserID)
+}
+
+const createWebhookDelivery = `-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, endpoint_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+VALUES (?, ?, ?, ?, ?, 'pending', ?, ?)`
+
+func (s *Store) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error {
+	ts := micros(now())
+	_, err := s.q.ExecContext(ctx, createWebhookDelivery, uuid.New(), arg.EndpointID, arg.EventID, arg.EventType, arg.Payload, ts, ts)
+	return err
+}
+
+// SQLite has one writer at a time, so the single UPDATE already claims its
+// rows the way FOR UPDATE SKIP LOCKED does on Postgres.
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+    next_attempt_at = ?
+WHERE id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending'
+    AND next_attempt_at <= ?
+    ORDER BY next_attempt_at
+    LIMIT ?
+)
+RETURNING ` + webhookDeliveryColumns
+
+func (s *Store) ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	ts := now()
+	lease := ts.Add(time.Duration(arg.LeaseSeconds) * time.Second)
+	return queryAll(ctx, s.q, scanWebhookDelivery, claimWebhookDeliveries, micros(lease), micros(ts), arg.BatchSize)
+}
+
+const recordWebhookAttempt = `-- name: RecordWebhookAttempt :exec
+UPDATE webhook_deliveries
+SET status = ?,
+    last_attempt_at = ?,
+    response_status = ?,
+    last_error = ?,
+    next_attempt_at = ?
+WHERE id = ?`
+
+func (s *Store) RecordWebhookAttempt(ctx context.Context, arg database.RecordWebhookAttemptParams) error {
+	ts := now()
+	next := ts.Add(time.Duration(arg.RetryInSeconds * float64(time.Second)))
+	_, err := s.q.ExecContext(ctx, recordWebhookAttempt, arg.Status, micros(ts), arg.ResponseStatus, arg.LastError, micros(next), arg.ID)
+	return err
+}
+
+const listWebhookDeliveries = `-- name: ListWebhookDeliveries :many
+SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+WHERE endpoint_id = ?
+AND (? IS NULL OR status = ?)
+ORDER BY created_at DESC
+LIMIT ?`
+
+func (s *Store) ListWebhookDeliveries(ctx context.Context, arg database.ListWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	return queryAll(ctx, s.q, scanWebhookDelivery, listWebhookDeliveries, arg.EndpointID, arg.Status, arg.Status, arg.PageSize)
+}
+
+const getWebhookDelivery = `-- name: GetWebhookDelivery :one
+SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+WHERE id = ?
+AND endpoint_id = ?`
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, arg database.GetWebhookDeliveryParams) (database.WebhookDelivery, error) {
+	return scanWebhookDelivery(s.q.QueryRowContext(ctx, getWebhookDelivery, arg.ID, arg.EndpointID))
+}
+
+const retryWebhookDelivery = `-- name: RetryWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending',
+    attempts = 0,
+    next_attempt_at = ?
+WHERE id = ?
+AND status <> 'pending'
+RETURNING ` + webhookDeliveryColumns
+
+func (s *Store) RetryWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	return scanWebhookDelivery(s.q.QueryRowContext(ctx, retryWebhookDelivery, micros(now()), id))
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/djblackett/chirpy/internal/tracing"
+)
+
+// NewTraced is New with a span around every query, named after the sqlc query.
+// Spans are only recorded when the context already carries one, e.g. inside
+// an HTTP request. Wrap a *sql.DB in NewTxDB first for InTx to work. Queries
+// from WithTx are not traced.
+func NewTraced(db DBTX) *Queries {
+	return New(Traced(db, "postgresql"))
+}
+
+// Traced wraps db so every query gets a span, for stores that don't use
+// Queries. system is the OpenTelemetry db.system.name, e.g. "sqlite".
+func Traced(db DBTX, system string) DBTX {
+	return tracedDB{db: db, system: system}
+}
+
+type tracedDB struct {
+	db     DBTX
+	system string
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, t.system, query)
+	defer span.End()
+	res, err := t.db.ExecContext(ctx, query, args...)
+	span.RecordError(err)
+	return res, err
+}
+
+func (t tracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := startQuerySpan(ctx, t.system, query)
+	defer span.End()
+	stmt, err := t.db.PrepareContext(ctx, query)
+	span.RecordError(err)
+	return stmt, err
+}
+
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, t.system, query)
+	defer span.End()
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	span.RecordError(err)
+	return rows, err
+}
+
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, t.system, query)
+	defer span.End()
+	row := t.db.QueryRowContext(ctx, query, args...)
+	span.RecordError(row.Err())
+	return row
+}
+
+// startQuerySpan names the span after the "-- name: GetChirp :one" header sqlc
+// puts at the top of every query and records the parameterised SQL.
+func startQuerySpan(ctx context.Context, system, query string) (context.Context, *tracing.Span) {
+	name, text := "query", query
+	if header, rest, ok := strings.Cut(query, "\n"); ok && strings.HasPrefix(header, "-- name: ") {
+		name, _, _ = strings.Cut(strings.TrimPrefix(header, "-- name: "), " ")
+		text = rest
+	}
+	return tracing.Start(ctx, name, tracing.KindClient,
+		slog.String("db.system.name", system),
+		slog.String("db.operation.name", name),
+		slog.String("db.query.text", strings.TrimSpace(text)),
+	)
+}
+
+// InTx forwards to the wrapped DBTX, so tracing doesn't hide TxDB.
+func (t tracedDB) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, ok := t.db.(Transactor)
+	if !ok {
+		return errors.New("database: transactions need Queries built on a TxDB")
+	}
+	return tx.InTx(ctx, fn)
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/djblackett/chirpy/internal/tracing"
+)
+
+type failingDB struct{ DBTX }
+
+func (failingDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestTracedQueries(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := tracing.NewTracer("chirpy-test", 1, tracing.NewWriterExporter(&buf))
+	ctx, root := tracer.Start(context.Background(), "request", tracing.KindServer)
+
+	q := NewTraced(failingDB{})
+	if err := q.DeleteUsers(ctx); err == nil {
+		t.Fatal("expected the query to fail")
+	}
+	if err := q.DeleteUsers(context.Background()); err == nil {
+		t.Fatal("expected the untraced query to fail too")
+	}
+	root.End()
+	tracer.Shutdown(context.Background())
+
+	out := buf.String()
+	for _, want := range []string{
+		`"name":"DeleteUsers"`,
+		`"parentSpanId":"` + root.SpanContext().SpanID.String() + `"`,
+		`{"key":"db.query.text","value":{"stringValue":"DELETE FROM users\nRETURNING`,
+		`"status":{"code":2,"message":"connection refused"}`,
+	} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("expected export to contain %s:\n%s", want, out)
+		}
+	}
+	if n := bytes.Count(buf.Bytes(), []byte(`"name":"DeleteUsers"`)); n != 1 {
+		t.Errorf("expected only the query inside a trace to get a span, got %d", n)
+	}
+}
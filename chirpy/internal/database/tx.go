@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type txKey struct{}
+
+// TxDB is a DBTX over a *sql.DB that runs each query in the transaction InTx
+// put on the query's context, if there is one. Queries built on a TxDB,
+// directly or through Traced, support InTx.
+type TxDB struct {
+	db *sql.DB
+}
+
+// NewTxDB wraps db so Queries built on it support InTx.
+func NewTxDB(db *sql.DB) TxDB {
+	return TxDB{db: db}
+}
+
+// Transactor is a DBTX that can run InTx.
+type Transactor interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+func (d TxDB) conn(ctx context.Context) DBTX {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return d.db
+}
+
+func (d TxDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return d.conn(ctx).ExecContext(ctx, query, args...)
+}
+
+func (d TxDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return d.conn(ctx).PrepareContext(ctx, query)
+}
+
+func (d TxDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return d.conn(ctx).QueryContext(ctx, query, args...)
+}
+
+func (d TxDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return d.conn(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// InTx runs fn in a transaction, committed if fn returns nil and rolled back
+// otherwise. Only queries made with the context fn is given take part. An
+// InTx inside another joins the outer transaction.
+func (d TxDB) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// InTx runs fn in a transaction; see TxDB.InTx. It fails if q wasn't built on
+// a TxDB.
+func (q *Queries) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	t, ok := q.db.(Transactor)
+	if !ok {
+		return errors.New("database: transactions need Queries built on a TxDB")
+	}
+	return t.InTx(ctx, fn)
+}
@@ -7,10 +7,59 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const anonymizeUser = `-- name: AnonymizeUser :one
+UPDATE users
+SET updated_at = NOW(),
+    deleted_at = NOW(),
+    email = 'deleted-' || id || '@deleted.invalid',
+    hashed_password = '',
+    is_chirpy_red = FALSE,
+    role = 'user',
+    handle = NULL,
+    display_name = '',
+    bio = ''
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio
+`
+
+func (q *Queries) AnonymizeUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, anonymizeUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+	)
+	return i, err
+}
+
+const countUsersByRole = `-- name: CountUsersByRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1
+`
+
+func (q *Queries) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersByRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password) 
 VALUES (
@@ -20,7 +69,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio
 `
 
 type CreateUserParams struct {
@@ -38,13 +87,43 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
 	)
 	return i, err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
+const deleteUserAvatar = `-- name: DeleteUserAvatar :execrows
+DELETE FROM user_avatars
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteUserAvatar(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserAvatar, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteUsers = `-- name: DeleteUsers :exec
 DELETE FROM users
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio
 `
 
 func (q *Queries) DeleteUsers(ctx context.Context) error {
@@ -52,8 +131,25 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const getUserAvatar = `-- name: GetUserAvatar :one
+SELECT user_id, content_type, image, updated_at FROM user_avatars
+WHERE user_id = $1
+`
+
+func (q *Queries) GetUserAvatar(ctx context.Context, userID uuid.UUID) (UserAvatar, error) {
+	row := q.db.QueryRowContext(ctx, getUserAvatar, userID)
+	var i UserAvatar
+	err := row.Scan(
+		&i.UserID,
+		&i.ContentType,
+		&i.Image,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red FROM users
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio FROM users
 WHERE email = $1
 `
 
@@ -67,12 +163,45 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio FROM users
+WHERE lower(handle) = lower($1::text)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red FROM users
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio FROM users
 WHERE id = $1
 `
 
@@ -86,6 +215,147 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+	)
+	return i, err
+}
+
+const getUserProfile = `-- name: GetUserProfile :one
+SELECT users.id, users.handle, users.display_name, users.bio, users.created_at,
+    (SELECT COUNT(*) FROM chirps
+     WHERE chirps.user_id = users.id
+     AND chirps.hidden_at IS NULL
+     AND chirps.publish_at IS NULL)::bigint AS chirp_count,
+    (SELECT COUNT(*) FROM user_follows
+     JOIN users followers ON followers.id = user_follows.follower_id
+     WHERE user_follows.followee_id = users.id
+     AND followers.deleted_at IS NULL
+     AND followers.banned_at IS NULL)::bigint AS follower_count,
+    user_avatars.updated_at AS avatar_updated_at
+FROM users
+LEFT JOIN user_avatars ON user_avatars.user_id = users.id
+WHERE lower(users.handle) = lower($1::text)
+AND users.deleted_at IS NULL
+AND users.banned_at IS NULL
+`
+
+type GetUserProfileRow struct {
+	ID              uuid.UUID
+	Handle          sql.NullString
+	DisplayName     string
+	Bio             string
+	CreatedAt       sql.NullTime
+	ChirpCount      int64
+	FollowerCount   int64
+	AvatarUpdatedAt sql.NullTime
+}
+
+func (q *Queries) GetUserProfile(ctx context.Context, handle string) (GetUserProfileRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfile, handle)
+	var i GetUserProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.CreatedAt,
+		&i.ChirpCount,
+		&i.FollowerCount,
+		&i.AvatarUpdatedAt,
+	)
+	return i, err
+}
+
+const setUserAvatar = `-- name: SetUserAvatar :exec
+INSERT INTO user_avatars (user_id, content_type, image, updated_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET content_type = EXCLUDED.content_type,
+    image = EXCLUDED.image,
+    updated_at = EXCLUDED.updated_at
+`
+
+type SetUserAvatarParams struct {
+	UserID      uuid.UUID
+	ContentType string
+	Image       []byte
+}
+
+func (q *Queries) SetUserAvatar(ctx context.Context, arg SetUserAvatarParams) error {
+	_, err := q.db.ExecContext(ctx, setUserAvatar, arg.UserID, arg.ContentType, arg.Image)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET updated_at = NOW(),
+    role = $1
+WHERE id = $2
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio
+`
+
+type SetUserRoleParams struct {
+	Role string
+	ID   uuid.UUID
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.Role, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+	)
+	return i, err
+}
+
+const setUserRoleByEmail = `-- name: SetUserRoleByEmail :one
+UPDATE users
+SET updated_at = NOW(),
+    role = $1
+WHERE email = $2
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio
+`
+
+type SetUserRoleByEmailParams struct {
+	Role  string
+	Email string
+}
+
+func (q *Queries) SetUserRoleByEmail(ctx context.Context, arg SetUserRoleByEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRoleByEmail, arg.Role, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
 	)
 	return i, err
 }
@@ -96,7 +366,7 @@ SET updated_at = NOW(),
     email = $1,
     hashed_password = $2
 WHERE id = $3
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio
 `
 
 type UpdateUserParams struct {
@@ -115,6 +385,51 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET updated_at = NOW(),
+    handle = $1::text,
+    display_name = $2,
+    bio = $3
+WHERE id = $4
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio
+`
+
+type UpdateUserProfileParams struct {
+	Handle      string
+	DisplayName string
+	Bio         string
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile, arg.Handle, arg.DisplayName, arg.Bio, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
 	)
 	return i, err
 }
@@ -124,7 +439,7 @@ UPDATE users
 SET updated_at = NOW(),
     is_chirpy_red = TRUE
 WHERE id = $1
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, suspended_until, banned_at, deleted_at, handle, display_name, bio
 `
 
 func (q *Queries) UpgradeUserToRed(ctx context.Context, id uuid.UUID) (User, error) {
@@ -137,6 +452,13 @@ func (q *Queries) UpgradeUserToRed(ctx context.Context, id uuid.UUID) (User, err
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.DeletedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
 	)
 	return i, err
 }
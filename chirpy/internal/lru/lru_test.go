@@ -0,0 +1,77 @@
+package lru
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestEviction(t *testing.T) {
+	c := New[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	// b is now the least recently used.
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if got, ok := c.Get(key); !ok || got != want {
+			t.Errorf("Get(%q) = %d, %v; want %d", key, got, ok, want)
+		}
+	}
+
+	c.Add("a", 10)
+	if got, _ := c.Get("a"); got != 10 || c.Len() != 2 {
+		t.Errorf("expected Add to replace a in place, got %d with %d entries", got, c.Len())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	c := New[int, string](10)
+	for i := range 6 {
+		c.Add(i, strconv.Itoa(i%2))
+	}
+	if !c.Remove(0) || c.Remove(0) {
+		t.Error("expected Remove to report whether the key was present")
+	}
+	if n := c.RemoveFunc(func(_ int, v string) bool { return v == "1" }); n != 3 {
+		t.Errorf("expected RemoveFunc to remove 3 entries, removed %d", n)
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected 2 entries left, got %d", c.Len())
+	}
+	c.Purge()
+	if _, ok := c.Get(2); ok || c.Len() != 0 {
+		t.Error("expected Purge to empty the cache")
+	}
+	c.Add(7, "x")
+	if got, ok := c.Get(7); !ok || got != "x" {
+		t.Error("expected the cache to work after Purge")
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	c := New[int, int](8)
+	var wg sync.WaitGroup
+	for g := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 1000 {
+				c.Add(i%16, g)
+				c.Get(i % 16)
+				if i%100 == 0 {
+					c.RemoveFunc(func(k, _ int) bool { return k%2 == 0 })
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if c.Len() > 8 {
+		t.Errorf("cache grew past its size: %d", c.Len())
+	}
+}
@@ -0,0 +1,348 @@
+// Package metrics is a small registry of counters, gauges and histograms that
+// renders the Prometheus text exposition format (version 0.0.4).
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are latency buckets in seconds suited to an HTTP API.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets are response size buckets in bytes.
+var SizeBuckets = []float64{100, 1000, 10_000, 100_000, 1_000_000, 10_000_000}
+
+type metric interface {
+	write(w io.Writer, name string)
+}
+
+type family struct {
+	name, help, typ string
+	metric          metric
+}
+
+// Registry holds metric families and renders them in registration order.
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register panics on a duplicate name, like prometheus.MustRegister: it is a
+// programming error that would otherwise produce an unscrapeable page.
+func (reg *Registry) register(name, help, typ string, m metric) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, f := range reg.families {
+		if f.name == name {
+			panic(fmt.Sprintf("metrics: %s registered twice", name))
+		}
+	}
+	reg.families = append(reg.families, family{name: name, help: help, typ: typ, metric: m})
+}
+
+func (reg *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	reg.register(name, help, "counter", c)
+	return c
+}
+
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{vec: newVec(labels, func() *Counter { return &Counter{} })}
+	reg.register(name, help, "counter", v)
+	return v
+}
+
+func (reg *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	reg.register(name, help, "gauge", g)
+	return g
+}
+
+// NewGaugeFunc exposes a value read at scrape time, such as connection pool stats.
+func (reg *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	reg.register(name, help, "gauge", valueFunc(fn))
+}
+
+// NewCounterFunc is NewGaugeFunc for values that only go up.
+func (reg *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	reg.register(name, help, "counter", valueFunc(fn))
+}
+
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	v := &HistogramVec{vec: newVec(labels, func() *Histogram { return newHistogram(buckets) })}
+	reg.register(name, help, "histogram", v)
+	return v
+}
+
+// WriteText renders every family in the Prometheus text format.
+func (reg *Registry) WriteText(w io.Writer) {
+	reg.mu.Lock()
+	families := slices.Clone(reg.families)
+	reg.mu.Unlock()
+
+	for _, f := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+		f.metric.write(w, f.name)
+	}
+}
+
+// Handler serves the registry for Prometheus to scrape.
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.WriteText(w)
+	})
+}
+
+// Counter is a float64 that only goes up.
+type Counter struct {
+	bits atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add panics if v is negative.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	addFloat(&c.bits, v)
+}
+
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+func (c *Counter) write(w io.Writer, name string) {
+	writeSample(w, name, "", c.Value())
+}
+
+// Gauge is a float64 that can go up and down.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+func (g *Gauge) Inc() {
+	addFloat(&g.bits, 1)
+}
+
+func (g *Gauge) Dec() {
+	addFloat(&g.bits, -1)
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func (g *Gauge) write(w io.Writer, name string) {
+	writeSample(w, name, "", g.Value())
+}
+
+type valueFunc func() float64
+
+func (fn valueFunc) write(w io.Writer, name string) {
+	writeSample(w, name, "", fn())
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) write(w io.Writer, name string) {
+	h.writeLabeled(w, name, "")
+}
+
+func (h *Histogram) writeLabeled(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	counts := slices.Clone(h.counts)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += counts[i]
+		writeSample(w, name+"_bucket", labels+sep+`le="`+formatFloat(le)+`"`, float64(cumulative))
+	}
+	writeSample(w, name+"_bucket", labels+sep+`le="+Inf"`, float64(count))
+	writeSample(w, name+"_sum", labels, sum)
+	writeSample(w, name+"_count", labels, float64(count))
+}
+
+// vec holds one child metric per distinct set of label values.
+type vec[T any] struct {
+	labels   []string
+	newChild func() T
+	mu       sync.RWMutex
+	children map[string]T
+	values   map[string][]string
+}
+
+func newVec[T any](labels []string, newChild func() T) vec[T] {
+	return vec[T]{labels: labels, newChild: newChild, children: map[string]T{}, values: map[string][]string{}}
+}
+
+func (v *vec[T]) with(values []string) T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(v.labels)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child
+	}
+	child = v.newChild()
+	v.children[key] = child
+	v.values[key] = slices.Clone(values)
+	return child
+}
+
+// each visits children sorted by label values so output is stable.
+func (v *vec[T]) each(fn func(labels string, child T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	type entry struct {
+		labels string
+		child  T
+	}
+	entries := make([]entry, len(keys))
+	for i, k := range keys {
+		pairs := make([]string, len(v.labels))
+		for j, name := range v.labels {
+			pairs[j] = name + `="` + escapeLabel(v.values[k][j]) + `"`
+		}
+		entries[i] = entry{strings.Join(pairs, ","), v.children[k]}
+	}
+	v.mu.RUnlock()
+
+	for _, e := range entries {
+		fn(e.labels, e.child)
+	}
+}
+
+type CounterVec struct {
+	vec vec[*Counter]
+}
+
+// WithLabelValues returns the counter for values, given in label order.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.vec.with(values)
+}
+
+func (v *CounterVec) write(w io.Writer, name string) {
+	v.vec.each(func(labels string, c *Counter) {
+		writeSample(w, name, labels, c.Value())
+	})
+}
+
+type HistogramVec struct {
+	vec vec[*Histogram]
+}
+
+// WithLabelValues returns the histogram for values, given in label order.
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.vec.with(values)
+}
+
+func (v *HistogramVec) write(w io.Writer, name string) {
+	v.vec.each(func(labels string, h *Histogram) {
+		h.writeLabeled(w, name, labels)
+	})
+}
+
+func addFloat(bits *atomic.Uint64, v float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func writeSample(w io.Writer, name, labels string, v float64) {
+	if labels != "" {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatFloat(v))
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(v))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+	hits := reg.NewCounter("hits_total", "Number of hits.")
+	requests := reg.NewCounterVec("requests_total", "Requests by route.", "route", "code")
+	inFlight := reg.NewGauge("in_flight", "Requests in flight.")
+	latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	reg.NewGaugeFunc("open_connections", "Open connections.", func() float64 { return 3 })
+
+	hits.Add(2)
+	requests.WithLabelValues("GET /b", "200").Inc()
+	requests.WithLabelValues("GET /a", "500").Inc()
+	requests.WithLabelValues("GET /a", "500").Inc()
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	latency.WithLabelValues(`say "hi"`).Observe(0.05)
+	latency.WithLabelValues(`say "hi"`).Observe(0.5)
+	latency.WithLabelValues(`say "hi"`).Observe(5)
+
+	want := `# HELP hits_total Number of hits.
+# TYPE hits_total counter
+hits_total 2
+# HELP requests_total Requests by route.
+# TYPE requests_total counter
+requests_total{route="GET /a",code="500"} 2
+requests_total{route="GET /b",code="200"} 1
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="say \"hi\"",le="0.1"} 1
+latency_seconds_bucket{route="say \"hi\"",le="1"} 2
+latency_seconds_bucket{route="say \"hi\"",le="+Inf"} 3
+latency_seconds_sum{route="say \"hi\""} 5.55
+latency_seconds_count{route="say \"hi\""} 3
+# HELP open_connections Open connections.
+# TYPE open_connections gauge
+open_connections 3
+`
+	var b strings.Builder
+	reg.WriteText(&b)
+	if b.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("hits_total", "Number of hits.").Inc()
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "hits_total 1\n") {
+		t.Errorf("unexpected body:\n%s", rec.Body)
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	reg := NewRegistry()
+	counter := reg.NewCounterVec("events_total", "Events.", "kind")
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				counter.WithLabelValues("a").Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	if got := counter.WithLabelValues("a").Value(); got != 8000 {
+		t.Errorf("expected 8000, got %v", got)
+	}
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("hits_total", "Number of hits.")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	reg.NewGauge("hits_total", "Again.")
+}
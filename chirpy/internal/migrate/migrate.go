@@ -0,0 +1,261 @@
+// Package migrate applies goose-format SQL migrations. It keeps goose's
+// goose_db_version bookkeeping table, so databases migrated with the goose CLI
+// and with chirpy are interchangeable.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// lockKey identifies chirpy's migration lock among Postgres advisory locks.
+const lockKey int64 = 0x636869727079 // "chirpy"
+
+// ErrNoCurrentVersion is returned by Down when nothing has been applied.
+var ErrNoCurrentVersion = errors.New("no migrations have been applied")
+
+// Dialect is the SQL flavour of the database being migrated.
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	// SQLite has no advisory locks. Each migration still runs in its own
+	// transaction, but concurrent instances may race to apply the same one;
+	// SQLite deployments are expected to run a single instance.
+	SQLite
+)
+
+// Status is a migration and when it was applied; AppliedAt is nil if it is pending.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// New loads the migrations in fsys; see Load.
+func New(db *sql.DB, dialect Dialect, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Up applies every pending migration in order and returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			if err := m.run(ctx, conn, migration, migration.Up, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the most recently applied migration and returns it.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	var rolledBack Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; ok {
+				rolledBack = migration
+				return m.run(ctx, conn, migration, migration.Down, false)
+			}
+		}
+		return ErrNoCurrentVersion
+	})
+	return rolledBack, err
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			s := Status{Migration: migration}
+			if at, ok := versions[migration.Version]; ok {
+				s.AppliedAt = &at
+			}
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// locked runs fn on one connection. On Postgres it holds a session advisory
+// lock throughout, so instances starting together apply each migration exactly once.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	defer conn.Close()
+
+	if m.dialect == Postgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+			return fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		defer func() {
+			// Use a fresh context so a cancelled ctx doesn't leave the lock held.
+			unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, unlockErr := conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1)", lockKey); unlockErr != nil {
+				err = errors.Join(err, fmt.Errorf("releasing migration lock: %w", unlockErr))
+			}
+		}()
+	}
+
+	if err := m.ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// versionTables are the goose_db_version definitions goose itself uses.
+var versionTables = map[Dialect]string{
+	Postgres: `CREATE TABLE IF NOT EXISTS goose_db_version (
+    id SERIAL PRIMARY KEY,
+    version_id BIGINT NOT NULL,
+    is_applied BOOLEAN NOT NULL,
+    tstamp TIMESTAMP DEFAULT now()
+)`,
+	SQLite: `CREATE TABLE IF NOT EXISTS goose_db_version (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    version_id INTEGER NOT NULL,
+    is_applied INTEGER NOT NULL,
+    tstamp TIMESTAMP DEFAULT (datetime('now'))
+)`,
+}
+
+func (m *Migrator) ensureVersionTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, versionTables[m.dialect])
+	if err != nil {
+		return fmt.Errorf("creating goose_db_version: %w", err)
+	}
+	// goose seeds the table with version 0; do the same so its CLI agrees with us.
+	_, err = conn.ExecContext(ctx, `INSERT INTO goose_db_version (version_id, is_applied)
+SELECT 0, true WHERE NOT EXISTS (SELECT 1 FROM goose_db_version)`)
+	if err != nil {
+		return fmt.Errorf("seeding goose_db_version: %w", err)
+	}
+	return nil
+}
+
+// appliedVersions maps each applied version to when it was applied. Like goose,
+// the latest row for a version decides whether it is applied.
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version_id, is_applied, tstamp
+FROM goose_db_version
+WHERE version_id > 0
+ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("reading goose_db_version: %w", err)
+	}
+	defer rows.Close()
+
+	versions := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var applied bool
+		var at any
+		if err := rows.Scan(&version, &applied, &at); err != nil {
+			return nil, err
+		}
+		if !applied {
+			delete(versions, version)
+			continue
+		}
+		versions[version], err = parseTimestamp(at)
+		if err != nil {
+			return nil, fmt.Errorf("reading goose_db_version: %w", err)
+		}
+	}
+	return versions, rows.Err()
+}
+
+// parseTimestamp accepts tstamp as either a time.Time or, from SQLite drivers
+// that don't convert TIMESTAMP columns, the text datetime('now') produces.
+func parseTimestamp(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v, nil
+	case []byte:
+		return parseTimestamp(string(v))
+	case string:
+		return time.Parse(time.DateTime, strings.TrimSpace(v))
+	default:
+		return time.Time{}, fmt.Errorf("unexpected tstamp type %T", v)
+	}
+}
+
+// insertVersion records a migration being applied or rolled back.
+var insertVersion = map[Dialect]string{
+	Postgres: "INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, $2)",
+	SQLite:   "INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)",
+}
+
+// run executes statements and records the result, in one transaction unless
+// the migration opts out.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, statements []string, up bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+	record := func(exec func(context.Context, string, ...any) (sql.Result, error)) error {
+		for _, stmt := range statements {
+			if _, err := exec(ctx, stmt); err != nil {
+				return fmt.Errorf("migration %s %s: %w", migration.Name, direction, err)
+			}
+		}
+		if _, err := exec(ctx, insertVersion[m.dialect], migration.Version, up); err != nil {
+			return fmt.Errorf("recording migration %s: %w", migration.Name, err)
+		}
+		return nil
+	}
+
+	if migration.NoTx {
+		return record(conn.ExecContext)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := record(tx.ExecContext); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
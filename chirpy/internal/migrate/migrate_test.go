@@ -0,0 +1,226 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/djblackett/chirpy/sql/schema"
+	sqliteschema "github.com/djblackett/chirpy/sql/sqlite/schema"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+func TestParse(t *testing.T) {
+	m, err := parse(`-- a leading comment is fine
+-- +goose Up
+CREATE TABLE t (
+    id INT
+);
+-- +goose StatementBegin
+CREATE FUNCTION f() RETURNS INT AS $$
+BEGIN
+    RETURN 1;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION f;
+DROP TABLE t;
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(m.Up) != 2 || !strings.HasPrefix(m.Up[1], "CREATE FUNCTION") || !strings.HasSuffix(m.Up[1], "plpgsql;") {
+		t.Errorf("unexpected up statements: %q", m.Up)
+	}
+	if len(m.Down) != 2 || m.Down[1] != "DROP TABLE t;" {
+		t.Errorf("unexpected down statements: %q", m.Down)
+	}
+	if m.NoTx {
+		t.Error("expected a transactional migration")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]struct {
+		src  string
+		want string
+	}{
+		"no up marker":       {"ALTER TABLE users ADD COLUMN x TEXT;\n", "before -- +goose Up"},
+		"empty":              {"-- just a comment\n", "missing -- +goose Up"},
+		"unterminated up":    {"-- +goose Up\nCREATE TABLE t (id INT)\n-- +goose Down\nDROP TABLE t;\n", "missing its terminating semicolon"},
+		"unterminated down":  {"-- +goose Up\nCREATE TABLE t (id INT);\n-- +goose Down\nDROP TABLE t\n", "missing its terminating semicolon"},
+		"unclosed block":     {"-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n", "StatementBegin without StatementEnd"},
+		"unknown directive":  {"-- +goose Up\n-- +goose Sideways\n", "unknown directive"},
+		"down before up":     {"-- +goose Down\nDROP TABLE t;\n", "Down before"},
+		"no up statements":   {"-- +goose Up\n-- +goose Down\nDROP TABLE t;\n", "no statements"},
+		"duplicate up block": {"-- +goose Up\nSELECT 1;\n-- +goose Up\nSELECT 2;\n", "duplicate"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parse(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	up := &fstest.MapFile{Data: []byte("-- +goose Up\nSELECT 1;\n")}
+	migrations, err := Load(fstest.MapFS{
+		"010_later.sql":  up,
+		"002_second.sql": up,
+		"README.md":      {Data: []byte("not a migration")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 2 || migrations[1].Name != "010_later" {
+		t.Errorf("unexpected migrations: %+v", migrations)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"bad name":          {"first.sql": up},
+		"duplicate version": {"001_a.sql": up, "1_b.sql": up},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestEmbeddedSchema keeps the shipped migrations applicable: every file must
+// parse and roll back.
+func TestEmbeddedSchema(t *testing.T) {
+	for dialect, fsys := range map[string]fs.FS{"postgres": schema.FS, "sqlite": sqliteschema.FS} {
+		migrations, err := Load(fsys)
+		if err != nil {
+			t.Fatalf("embedded %s migrations don't parse: %v", dialect, err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("no %s migrations embedded", dialect)
+		}
+		for _, m := range migrations {
+			if len(m.Down) == 0 {
+				t.Errorf("%s: %s has no -- +goose Down statements", dialect, m.Name)
+			}
+		}
+	}
+}
+
+// TestPostgres applies, inspects and rolls back the embedded migrations against
+// a scratch database named by CHIRPY_TEST_DB_URL. Everything in it is dropped.
+func TestPostgres(t *testing.T) {
+	dbURL := os.Getenv("CHIRPY_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("CHIRPY_TEST_DB_URL not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+		t.Fatalf("resetting database: %v", err)
+	}
+	migrator, err := New(db, Postgres, schema.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent instances must not apply anything twice.
+	var wg sync.WaitGroup
+	applied := make([][]Migration, 3)
+	errs := make([]error, 3)
+	for i := range applied {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied[i], errs[i] = migrator.Up(ctx)
+		}()
+	}
+	wg.Wait()
+	total := 0
+	for i := range applied {
+		if errs[i] != nil {
+			t.Fatalf("up: %v", errs[i])
+		}
+		total += len(applied[i])
+	}
+	if total != len(migrator.migrations) {
+		t.Errorf("applied %d migrations across instances, want %d", total, len(migrator.migrations))
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Errorf("%s still pending after up", s.Name)
+		}
+	}
+
+	for range migrator.migrations {
+		if _, err := migrator.Down(ctx); err != nil {
+			t.Fatalf("down: %v", err)
+		}
+	}
+	if _, err := migrator.Down(ctx); err != ErrNoCurrentVersion {
+		t.Errorf("expected ErrNoCurrentVersion, got %v", err)
+	}
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != len(migrator.migrations) {
+		t.Errorf("re-applying after a full rollback: applied %d, err %v", len(applied), err)
+	}
+}
+
+// TestSQLite applies, inspects and rolls back the embedded SQLite migrations
+// against a scratch file.
+func TestSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "chirpy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	migrator, err := New(db, SQLite, sqliteschema.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != len(migrator.migrations) {
+		t.Fatalf("up: applied %d, err %v", len(applied), err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Errorf("%s still pending after up", s.Name)
+		}
+	}
+
+	for range migrator.migrations {
+		if _, err := migrator.Down(ctx); err != nil {
+			t.Fatalf("down: %v", err)
+		}
+	}
+	if _, err := migrator.Down(ctx); err != ErrNoCurrentVersion {
+		t.Errorf("expected ErrNoCurrentVersion, got %v", err)
+	}
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != len(migrator.migrations) {
+		t.Errorf("re-applying after a full rollback: applied %d, err %v", len(applied), err)
+	}
+}
@@ -0,0 +1,145 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migration is one goose SQL file, split into statements.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []string
+	Down    []string
+	// NoTx is set by "-- +goose NO TRANSACTION", for statements such as
+	// CREATE INDEX CONCURRENTLY that can't run in a transaction.
+	NoTx bool
+}
+
+// Load reads every NNN_name.sql file at the root of fsys, ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := map[int64]string{}
+	for _, name := range names {
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must start with a positive version, e.g. 008_add_feeds.sql", name)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, name, version)
+		}
+		seen[version] = name
+
+		src, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		m, err := parse(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", name, err)
+		}
+		m.Version = version
+		m.Name = strings.TrimSuffix(path.Base(name), ".sql")
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// parse follows goose's rules: statements end at a line ending in ";" unless
+// they sit between StatementBegin and StatementEnd, and anything left
+// unterminated is an error rather than being silently dropped.
+func parse(src string) (Migration, error) {
+	var m Migration
+	var section *[]string
+	var stmt strings.Builder
+	inBlock, sawUp := false, false
+
+	flush := func() {
+		if s := strings.TrimSpace(stmt.String()); s != "" {
+			*section = append(*section, s)
+		}
+		stmt.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if directive, ok := strings.CutPrefix(trimmed, "-- +goose "); ok {
+			switch strings.TrimSpace(directive) {
+			case "Up":
+				if sawUp {
+					return m, fmt.Errorf("line %d: duplicate -- +goose Up", lineNo)
+				}
+				sawUp = true
+				section = &m.Up
+			case "Down":
+				if !sawUp {
+					return m, fmt.Errorf("line %d: -- +goose Down before -- +goose Up", lineNo)
+				}
+				if strings.TrimSpace(stmt.String()) != "" {
+					return m, fmt.Errorf("line %d: statement before -- +goose Down is missing its terminating semicolon", lineNo)
+				}
+				stmt.Reset()
+				section = &m.Down
+			case "StatementBegin":
+				inBlock = true
+			case "StatementEnd":
+				if !inBlock {
+					return m, fmt.Errorf("line %d: StatementEnd without StatementBegin", lineNo)
+				}
+				inBlock = false
+				flush()
+			case "NO TRANSACTION":
+				m.NoTx = true
+			default:
+				return m, fmt.Errorf("line %d: unknown directive %q", lineNo, trimmed)
+			}
+			continue
+		}
+
+		if section == nil {
+			if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return m, fmt.Errorf("line %d: SQL before -- +goose Up", lineNo)
+			}
+			continue
+		}
+		if !inBlock && stmt.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return m, err
+	}
+
+	switch {
+	case !sawUp:
+		return m, fmt.Errorf("missing -- +goose Up")
+	case inBlock:
+		return m, fmt.Errorf("StatementBegin without StatementEnd")
+	case strings.TrimSpace(stmt.String()) != "":
+		return m, fmt.Errorf("last statement is missing its terminating semicolon")
+	case len(m.Up) == 0:
+		return m, fmt.Errorf("no statements after -- +goose Up")
+	}
+	return m, nil
+}
@@ -0,0 +1,298 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter receives batches of spans encoded as an OTLP/JSON
+// ExportTraceServiceRequest.
+type Exporter interface {
+	Export(ctx context.Context, otlpJSON []byte) error
+	Shutdown(ctx context.Context) error
+}
+
+// writerExporter writes one request per line, the layout the OpenTelemetry
+// Collector's file exporter and otlpjsonfile receiver use.
+type writerExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+// NewWriterExporter writes spans to w, e.g. os.Stdout. Shutdown leaves w open.
+func NewWriterExporter(w io.Writer) Exporter {
+	return &writerExporter{w: w}
+}
+
+// NewFileExporter appends spans to the file at path, creating it if needed.
+func NewFileExporter(path string) (Exporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening trace file: %w", err)
+	}
+	return &writerExporter{w: f, c: f}, nil
+}
+
+func (e *writerExporter) Export(_ context.Context, otlpJSON []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(append(otlpJSON, '\n'))
+	return err
+}
+
+func (e *writerExporter) Shutdown(context.Context) error {
+	if e.c == nil {
+		return nil
+	}
+	return e.c.Close()
+}
+
+type otlpHTTPExporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewOTLPHTTPExporter sends spans to an OTLP/HTTP collector such as
+// http://localhost:4318, using the JSON encoding.
+func NewOTLPHTTPExporter(endpoint string) Exporter {
+	url := strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &otlpHTTPExporter{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (e *otlpHTTPExporter) Export(ctx context.Context, otlpJSON []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewReader(otlpJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *otlpHTTPExporter) Shutdown(context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+const (
+	maxQueuedSpans = 2048
+	maxBatchSize   = 512
+	batchInterval  = 5 * time.Second
+)
+
+// batcher exports finished spans in the background so ending a span never
+// waits on I/O. Spans are dropped, not blocked on, when the queue is full.
+type batcher struct {
+	exporter Exporter
+	encode   func([]*Span) []byte
+	queue    chan *Span
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newBatcher(exporter Exporter, encode func([]*Span) []byte) *batcher {
+	b := &batcher{
+		exporter: exporter,
+		encode:   encode,
+		queue:    make(chan *Span, maxQueuedSpans),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *batcher) add(s *Span) {
+	select {
+	case b.queue <- s:
+	default:
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := b.exporter.Export(ctx, b.encode(batch)); err != nil {
+			slog.Warn("Couldn't export spans", "spans", len(batch), "error", err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s := <-b.queue:
+			batch = append(batch, s)
+			if len(batch) >= maxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-b.stop:
+			for {
+				select {
+				case s := <-b.queue:
+					batch = append(batch, s)
+					if len(batch) >= maxBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *batcher) shutdown(ctx context.Context) error {
+	b.stopOnce.Do(func() { close(b.stop) })
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return fmt.Errorf("flushing spans: %w", ctx.Err())
+	}
+	return b.exporter.Shutdown(ctx)
+}
+
+// The otlp* types mirror the OTLP/JSON encoding of ExportTraceServiceRequest.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// otlpValue is an AnyValue; exactly one field is set. 64-bit integers are
+// strings in OTLP/JSON.
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+const scopeName = "github.com/djblackett/chirpy"
+
+func encodeOTLP(service string, spans []*Span) []byte {
+	out := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		s.mu.Lock()
+		out[i] = otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			TraceState:        s.sc.TraceState,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attrs),
+			Status:            otlpStatus{Code: s.status, Message: s.statusMsg},
+		}
+		s.mu.Unlock()
+		if s.parent.IsValid() {
+			out[i].ParentSpanID = s.parent.String()
+		}
+	}
+	req := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes([]slog.Attr{slog.String("service.name", service)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: out}},
+	}}}
+	data, _ := json.Marshal(req)
+	return data
+}
+
+func otlpAttributes(attrs []slog.Attr) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		v := a.Value.Resolve()
+		var value otlpValue
+		switch v.Kind() {
+		case slog.KindBool:
+			b := v.Bool()
+			value.BoolValue = &b
+		case slog.KindInt64:
+			n := strconv.FormatInt(v.Int64(), 10)
+			value.IntValue = &n
+		case slog.KindUint64:
+			n := strconv.FormatUint(v.Uint64(), 10)
+			value.IntValue = &n
+		case slog.KindFloat64:
+			f := v.Float64()
+			value.DoubleValue = &f
+		default:
+			s := v.String()
+			value.StringValue = &s
+		}
+		out = append(out, otlpKeyValue{Key: a.Key, Value: value})
+	}
+	return out
+}
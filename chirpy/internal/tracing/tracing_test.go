@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	h := http.Header{}
+	h.Set("traceparent", testTraceparent)
+	h.Set("tracestate", "vendor=value")
+	ctx := Extract(context.Background(), h)
+
+	sc := SpanContextFromContext(ctx)
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Fatalf("unexpected span context: %+v", sc)
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if out.Get("traceparent") != testTraceparent || out.Get("tracestate") != "vendor=value" {
+		t.Errorf("unexpected injected headers: %v", out)
+	}
+}
+
+func TestExtractIgnoresMalformedHeaders(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		h := http.Header{}
+		h.Set("traceparent", v)
+		if sc := SpanContextFromContext(Extract(context.Background(), h)); sc.IsValid() {
+			t.Errorf("expected %q to be rejected, got %+v", v, sc)
+		}
+	}
+
+	h := http.Header{}
+	h.Set("traceparent", "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future")
+	if !SpanContextFromContext(Extract(context.Background(), h)).IsValid() {
+		t.Error("expected a later version with extra fields to be accepted")
+	}
+}
+
+func TestSpansExportAsOTLP(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer("chirpy-test", 1, NewWriterExporter(&buf))
+
+	h := http.Header{}
+	h.Set("traceparent", testTraceparent)
+	ctx, root := tracer.Start(Extract(context.Background(), h), "GET /api/chirps", KindServer, slog.Int("http.response.status_code", 200))
+	_, child := Start(ctx, "GetChirps", KindClient, slog.String("db.system.name", "postgresql"))
+	child.SetStatus(StatusError, "boom")
+	child.End()
+	root.End()
+	root.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var req otlpRequest
+	if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+		t.Fatalf("export is not OTLP/JSON: %v\n%s", err, buf.String())
+	}
+	rs := req.ResourceSpans[0]
+	if *rs.Resource.Attributes[0].Value.StringValue != "chirpy-test" {
+		t.Errorf("unexpected resource: %+v", rs.Resource)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	dbSpan, httpSpan := spans[0], spans[1]
+	if httpSpan.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || httpSpan.ParentSpanID != "00f067aa0ba902b7" || httpSpan.Kind != KindServer {
+		t.Errorf("expected the server span to join the remote trace, got %+v", httpSpan)
+	}
+	if *httpSpan.Attributes[0].Value.IntValue != "200" {
+		t.Errorf("expected integer attribute, got %+v", httpSpan.Attributes)
+	}
+	if dbSpan.ParentSpanID != httpSpan.SpanID || dbSpan.TraceID != httpSpan.TraceID || dbSpan.Status.Code != StatusError {
+		t.Errorf("expected the query span to be a failed child of the server span, got %+v", dbSpan)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer("chirpy-test", 0, NewWriterExporter(&buf))
+	_, span := tracer.Start(context.Background(), "dropped", KindServer)
+	span.End()
+
+	h := http.Header{}
+	h.Set("traceparent", testTraceparent)
+	_, span = tracer.Start(Extract(context.Background(), h), "kept", KindServer)
+	span.End()
+
+	tracer.Shutdown(context.Background())
+	if bytes.Contains(buf.Bytes(), []byte("dropped")) || !bytes.Contains(buf.Bytes(), []byte("kept")) {
+		t.Errorf("expected only the sampled remote trace to be exported, got %s", buf.String())
+	}
+}
+
+func TestNilSpansAreNoOps(t *testing.T) {
+	ctx, span := Start(context.Background(), "orphan", KindInternal)
+	span.SetName("renamed")
+	span.SetAttributes(slog.String("k", "v"))
+	span.RecordError(io.EOF)
+	span.End()
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Error("expected no span without a parent")
+	}
+
+	var tracer *Tracer
+	if _, span := tracer.Start(ctx, "off", KindServer); span != nil {
+		t.Error("expected a nil tracer to start nil spans")
+	}
+}
+
+func TestOTLPHTTPExporter(t *testing.T) {
+	var got []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		got, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	tracer := NewTracer("chirpy-test", 1, NewOTLPHTTPExporter(collector.URL))
+	_, span := tracer.Start(context.Background(), "sent", KindServer)
+	span.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(got, []byte(`"name":"sent"`)) {
+		t.Errorf("expected the collector to receive the span, got %s", got)
+	}
+}
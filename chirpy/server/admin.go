@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// statsDays is how many days of signups and chirps the stats cover, today included.
+	statsDays       = 14
+	statsTopPosters = 10
+)
+
+// Stats is the operational snapshot behind the admin dashboard. Visits and
+// webhook events are counted by this process only.
+type Stats struct {
+	GeneratedAt         time.Time      `json:"generated_at"`
+	Visits              int64          `json:"visits"`
+	Users               int64          `json:"users"`
+	ChirpyRedUsers      int64          `json:"chirpy_red_users"`
+	ChirpyRedConversion float64        `json:"chirpy_red_conversion"`
+	Chirps              int64          `json:"chirps"`
+	ActiveSessions      int64          `json:"active_sessions"`
+	ModerationQueue     int64          `json:"moderation_queue"`
+	SignupsPerDay       []DailyCount   `json:"signups_per_day"`
+	ChirpsPerDay        []DailyCount   `json:"chirps_per_day"`
+	TopPosters          []TopPoster    `json:"top_posters"`
+	RecentWebhookEvents []WebhookEvent `json:"recent_webhook_events"`
+}
+
+// DailyCount is one UTC day, formatted as 2006-01-02.
+type DailyCount struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+type TopPoster struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+	Chirps int64     `json:"chirps"`
+}
+
+func (cfg *apiConfig) collectStats(ctx context.Context) (Stats, error) {
+	now := time.Now().UTC()
+	since := now.Truncate(24*time.Hour).AddDate(0, 0, -(statsDays - 1))
+
+	totals, err := cfg.dbQueries.GetStatsTotals(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	signups, err := cfg.dbQueries.CountSignupsByDay(ctx, since)
+	if err != nil {
+		return Stats{}, err
+	}
+	chirps, err := cfg.dbQueries.CountChirpsByDay(ctx, since)
+	if err != nil {
+		return Stats{}, err
+	}
+	posters, err := cfg.dbQueries.ListTopPosters(ctx, statsTopPosters)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{
+		GeneratedAt:         now,
+		Visits:              int64(cfg.metrics.fileserverHits.Value()),
+		Users:               totals.Users,
+		ChirpyRedUsers:      totals.ChirpyRedUsers,
+		Chirps:              totals.Chirps,
+		ActiveSessions:      totals.ActiveSessions,
+		ModerationQueue:     totals.OpenReports,
+		TopPosters:          []TopPoster{},
+		RecentWebhookEvents: cfg.webhookLog.recent(),
+	}
+	if totals.Users > 0 {
+		stats.ChirpyRedConversion = float64(totals.ChirpyRedUsers) / float64(totals.Users)
+	}
+	signupsByDay := map[string]int64{}
+	for _, row := range signups {
+		signupsByDay[row.Day.Format(time.DateOnly)] = row.Count
+	}
+	chirpsByDay := map[string]int64{}
+	for _, row := range chirps {
+		chirpsByDay[row.Day.Format(time.DateOnly)] = row.Count
+	}
+	for day := since; !day.After(now); day = day.AddDate(0, 0, 1) {
+		key := day.Format(time.DateOnly)
+		stats.SignupsPerDay = append(stats.SignupsPerDay, DailyCount{Day: key, Count: signupsByDay[key]})
+		stats.ChirpsPerDay = append(stats.ChirpsPerDay, DailyCount{Day: key, Count: chirpsByDay[key]})
+	}
+	for _, row := range posters {
+		stats.TopPosters = append(stats.TopPosters, TopPoster{UserID: row.ID, Email: row.Email, Chirps: row.ChirpCount})
+	}
+	return stats, nil
+}
+
+func (cfg *apiConfig) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := cfg.collectStats(r.Context())
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't collect stats", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"percent": func(f float64) string { return strconv.FormatFloat(f*100, 'f', 1, 64) + "%" },
+	// barWidth scales a day's count against the busiest day in days.
+	"barWidth": func(count int64, days []DailyCount) int64 {
+		var busiest int64
+		for _, day := range days {
+			busiest = max(busiest, day.Count)
+		}
+		if busiest == 0 {
+			return 0
+		}
+		return count * 100 / busiest
+	},
+}).Parse(dashboardHTML))
+
+// handleMetrics renders the admin dashboard; /admin/api/stats has the same numbers as JSON.
+func (cfg *apiConfig) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	stats, err := cfg.collectStats(r.Context())
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't collect stats", err)
+		return
+	}
+	var page bytes.Buffer
+	if err := dashboardTemplate.Execute(&page, stats); err != nil {
+		respondWithInternalError(w, r, "Couldn't render dashboard", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(page.Bytes())
+}
+
+// reset deletes every user. It needs an admin token and a dev platform, so a
+// leaked admin token can't wipe production.
+func (cfg *apiConfig) reset(w http.ResponseWriter, r *http.Request) {
+	if cfg.platform != "dev" {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Reset is only allowed on the dev platform", nil)
+		return
+	}
+	err := cfg.dbQueries.DeleteUsers(r.Context())
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't delete users", err)
+		return
+	}
+	cfg.chirpCache.purge()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *apiConfig) handleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	userID, ok := parseUUIDPathValue(w, r, "userID")
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+
+	role, err := auth.ParseRole(params.Role)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "role must be one of user, moderator or admin", nil)
+		return
+	}
+
+	user, err := cfg.dbQueries.SetUserRole(r.Context(), database.SetUserRoleParams{
+		Role: string(role),
+		ID:   userID,
+	})
+	if err != nil {
+		respondWithLookupError(w, r, "User", err)
+		return
+	}
+
+	loggerFromContext(r.Context()).Info("User role changed", "target_user_id", user.ID, "role", user.Role)
+
+	respondWithJSON(w, http.StatusOK, toUser(user))
+}
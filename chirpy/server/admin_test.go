@@ -0,0 +1,103 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+func TestAdminStats(t *testing.T) {
+	c := newTestClient(t)
+	expectStatus(t, c.do("GET", "/app/", "", nil), http.StatusOK)
+	alice := c.signUp("alice@example.com", "password")
+	bob := c.signUp("bob@example.com", "password")
+	admin := c.signUpWithRole("admin@example.com", "admin")
+	first := c.createChirp(alice, "one")
+	c.createChirp(alice, "two")
+	c.createChirp(bob, "three")
+	expectStatus(t, c.do("POST", "/api/chirps/"+first.ID.String()+"/report", bob.bearer(), map[string]string{"reason": "spam"}), http.StatusCreated)
+	polka := "ApiKey " + testPolkaKey
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": bob.ID.String()}}
+	expectStatus(t, c.do("POST", "/api/polka/webhooks", polka, upgrade), http.StatusNoContent)
+	unknown := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": uuid.NewString()}}
+	expectProblem(t, c.do("POST", "/api/polka/webhooks", polka, unknown), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("POST", "/api/polka/webhooks", "ApiKey wrong", upgrade), http.StatusUnauthorized, "unauthorized")
+
+	expectProblem(t, c.do("GET", "/admin/api/stats", "", nil), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("GET", "/admin/api/stats", alice.bearer(), nil), http.StatusForbidden, "forbidden")
+	resp := c.do("GET", "/admin/api/stats", admin.bearer(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	stats := decodeBody[server.Stats](t, resp)
+	if stats.Visits != 1 || stats.Users != 3 || stats.ChirpyRedUsers != 1 || stats.Chirps != 3 ||
+		stats.ActiveSessions != 4 || stats.ModerationQueue != 1 {
+		t.Errorf("unexpected totals: %+v", stats)
+	}
+	if stats.ChirpyRedConversion < 0.33 || stats.ChirpyRedConversion > 0.34 {
+		t.Errorf("expected a third of users on Chirpy Red, got %v", stats.ChirpyRedConversion)
+	}
+	today := time.Now().UTC().Format(time.DateOnly)
+	if len(stats.SignupsPerDay) != 14 || len(stats.ChirpsPerDay) != 14 {
+		t.Fatalf("expected 14 days of history, got %+v and %+v", stats.SignupsPerDay, stats.ChirpsPerDay)
+	}
+	if last := stats.SignupsPerDay[13]; last.Day != today || last.Count != 3 {
+		t.Errorf("expected 3 signups today, got %+v", last)
+	}
+	if last := stats.ChirpsPerDay[13]; last.Day != today || last.Count != 3 {
+		t.Errorf("expected 3 chirps today, got %+v", last)
+	}
+	if len(stats.TopPosters) != 2 || stats.TopPosters[0].UserID != alice.ID || stats.TopPosters[0].Chirps != 2 {
+		t.Errorf("unexpected top posters: %+v", stats.TopPosters)
+	}
+	events := stats.RecentWebhookEvents
+	if len(events) != 2 || events[0].Status != http.StatusNotFound || events[1].Status != http.StatusNoContent ||
+		events[1].UserID != bob.ID.String() || events[1].Event != "user.upgraded" {
+		t.Errorf("expected the two authenticated webhook events, newest first, got %+v", events)
+	}
+
+	resp = c.do("GET", "/admin/metrics", admin.bearer(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{"Chirpy has been visited 1 times!", "alice@example.com", "33.3%", today, "user.upgraded"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected the dashboard to contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestAdminRoutes(t *testing.T) {
+	c := newTestClient(t)
+	user := c.signUp("user@example.com", "password")
+	admin := c.signUpWithRole("admin@example.com", "admin")
+
+	expectProblem(t, c.do("PUT", "/admin/users/"+user.ID.String()+"/role", user.bearer(), map[string]string{"role": "admin"}),
+		http.StatusForbidden, "forbidden")
+	expectProblem(t, c.do("PUT", "/admin/users/"+user.ID.String()+"/role", admin.bearer(), map[string]string{"role": "king"}),
+		http.StatusBadRequest, "validation_failed")
+	expectProblem(t, c.do("PUT", "/admin/users/"+uuid.NewString()+"/role", admin.bearer(), map[string]string{"role": "moderator"}),
+		http.StatusNotFound, "not_found")
+
+	resp := c.do("PUT", "/admin/users/"+user.ID.String()+"/role", admin.bearer(), map[string]string{"role": "moderator"})
+	expectStatus(t, resp, http.StatusOK)
+	if got := decodeBody[server.User](t, resp); got.Role != "moderator" {
+		t.Errorf("expected moderator role, got %q", got.Role)
+	}
+	// roles are read from the store, so the change applies to tokens already issued
+	expectStatus(t, c.do("GET", "/api/moderation/reports", user.bearer(), nil), http.StatusOK)
+
+	expectProblem(t, c.do("POST", "/admin/reset", user.bearer(), nil), http.StatusForbidden, "forbidden")
+	// Only a dev platform can be reset, even by an admin.
+	expectProblem(t, c.do("POST", "/admin/reset", admin.bearer(), nil), http.StatusForbidden, "forbidden")
+	c.login("user@example.com", "password")
+
+	dev := newTestClient(t, func(cfg *server.Config) { cfg.Platform = "dev" })
+	dev.signUp("user@example.com", "password")
+	devAdmin := dev.signUpWithRole("admin@example.com", "admin")
+	expectStatus(t, dev.do("POST", "/admin/reset", devAdmin.bearer(), nil), http.StatusOK)
+	expectProblem(t, dev.do("POST", "/api/login", "", map[string]string{"email": "user@example.com", "password": "password"}),
+		http.StatusUnauthorized, "invalid_credentials")
+}
@@ -0,0 +1,322 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// importBatchSize is how many chirps go into each insert. A failed batch
+	// is rolled back on its own; earlier batches stay imported.
+	importBatchSize = 1000
+	// maxImportLine bounds one JSON line, well above any valid chirp.
+	maxImportLine = 1 << 20
+	// maxImportErrors caps the lines an ImportReport lists; Failed still
+	// counts them all.
+	maxImportErrors = 1000
+	exportPageSize  = 1000
+	// bulkIdleTimeout is how long an import or export may stall. The server's
+	// read and write timeouts would cut off large transfers, so the bulk
+	// handlers push their deadlines this far ahead whenever data moves.
+	bulkIdleTimeout = time.Minute
+)
+
+// ChirpRecord is one line of a JSON Lines chirp import or export. On import,
+// a missing id is generated, a missing created_at is now and a missing
+// updated_at is created_at.
+type ChirpRecord struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ImportOptions configures ImportChirps.
+type ImportOptions struct {
+	// MaxChirpLength defaults to 140 bytes, like Config.MaxChirpLength.
+	MaxChirpLength int
+}
+
+// ImportReport summarises an import. Lines that fail validation are listed
+// and skipped; the rest are imported.
+type ImportReport struct {
+	Imported int64 `json:"imported"`
+	// Skipped counts chirps whose id already existed.
+	Skipped int64             `json:"skipped"`
+	Failed  int               `json:"failed"`
+	Errors  []ImportLineError `json:"errors"`
+	// ErrorsTruncated is set when more lines failed than Errors lists.
+	ErrorsTruncated bool `json:"errors_truncated,omitempty"`
+}
+
+type ImportLineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+func (report *ImportReport) fail(line int, format string, args ...any) {
+	report.Failed++
+	if len(report.Errors) == maxImportErrors {
+		report.ErrorsTruncated = true
+		return
+	}
+	report.Errors = append(report.Errors, ImportLineError{Line: line, Error: fmt.Sprintf(format, args...)})
+}
+
+// ImportChirps loads JSON Lines chirp records from r in batches, keeping their
+// timestamps and filtering bodies as POST /api/chirps does. The error is for
+// problems that stop the import, such as an unreadable input or a failed
+// batch; the report covers what happened up to then.
+func ImportChirps(ctx context.Context, store Store, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	if opts.MaxChirpLength <= 0 {
+		opts.MaxChirpLength = 140
+	}
+	report := ImportReport{Errors: []ImportLineError{}}
+	users := map[uuid.UUID]bool{}
+	var batch database.ImportChirpsParams
+	batchStart := 0
+
+	flush := func() error {
+		if len(batch.Ids) == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := store.ImportChirps(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("importing the batch starting at line %d: %w", batchStart, err)
+		}
+		report.Imported += n
+		report.Skipped += int64(len(batch.Ids)) - n
+		batch = database.ImportChirpsParams{}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := scanner.Bytes()
+		if len(strings.TrimSpace(string(raw))) == 0 {
+			continue
+		}
+		var record ChirpRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			report.fail(line, "invalid JSON: %v", err)
+			continue
+		}
+		switch {
+		case record.UserID == uuid.Nil:
+			report.fail(line, "user_id is required")
+			continue
+		case record.Body == "":
+			report.fail(line, "body is required")
+			continue
+		case len(record.Body) > opts.MaxChirpLength:
+			report.fail(line, "body is longer than %d characters", opts.MaxChirpLength)
+			continue
+		}
+		known, checked := users[record.UserID]
+		if !checked {
+			_, err := store.GetUserByID(ctx, record.UserID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return report, fmt.Errorf("looking up user %s: %w", record.UserID, err)
+			}
+			known = err == nil
+			users[record.UserID] = known
+		}
+		if !known {
+			report.fail(line, "user %s does not exist", record.UserID)
+			continue
+		}
+
+		if record.ID == uuid.Nil {
+			record.ID = uuid.New()
+		}
+		if record.CreatedAt.IsZero() {
+			record.CreatedAt = time.Now()
+		}
+		if record.UpdatedAt.IsZero() {
+			record.UpdatedAt = record.CreatedAt
+		}
+		if len(batch.Ids) == 0 {
+			batchStart = line
+		}
+		batch.Ids = append(batch.Ids, record.ID)
+		batch.Bodies = append(batch.Bodies, strings.Join(replaceBadWords(ChirpParameters{Body: record.Body}), " "))
+		// timestamp columns have no zone; store UTC as NOW() does.
+		batch.CreatedAts = append(batch.CreatedAts, record.CreatedAt.UTC())
+		batch.UpdatedAts = append(batch.UpdatedAts, record.UpdatedAt.UTC())
+		batch.UserIds = append(batch.UserIds, record.UserID)
+		if len(batch.Ids) == importBatchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("reading line %d: %w", line+1, err)
+	}
+	return report, flush()
+}
+
+// ExportFilter narrows ExportChirps. Zero values don't filter.
+type ExportFilter struct {
+	UserID uuid.UUID
+	// Since is inclusive and Until exclusive, both on created_at.
+	Since time.Time
+	Until time.Time
+}
+
+// ExportChirps writes every visible chirp matching filter to w as JSON Lines,
+// oldest first, one page at a time. Hidden chirps are left out: imports
+// can't carry moderation state, so they'd come back visible. It flushes w
+// after each page if w is an http.Flusher.
+func ExportChirps(ctx context.Context, store Store, w io.Writer, filter ExportFilter) (int, error) {
+	params := database.ListChirpsForExportParams{
+		UserID:   uuid.NullUUID{UUID: filter.UserID, Valid: filter.UserID != uuid.Nil},
+		Since:    optionalTime(filter.Since),
+		Until:    optionalTime(filter.Until),
+		PageSize: exportPageSize,
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	exported := 0
+	for {
+		chirps, err := store.ListChirpsForExport(ctx, params)
+		if err != nil {
+			return exported, err
+		}
+		for _, chirp := range chirps {
+			err := enc.Encode(ChirpRecord{
+				ID:        chirp.ID,
+				UserID:    chirp.UserID,
+				Body:      chirp.Body,
+				CreatedAt: chirp.CreatedAt.Time,
+				UpdatedAt: chirp.UpdatedAt.Time,
+			})
+			if err != nil {
+				return exported, err
+			}
+			exported++
+		}
+		if err := bw.Flush(); err != nil {
+			return exported, err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		if len(chirps) < exportPageSize {
+			return exported, nil
+		}
+		last := chirps[len(chirps)-1]
+		params.AfterCreatedAt, params.AfterID = last.CreatedAt.Time, last.ID
+	}
+}
+
+// optionalTime treats the zero time as unset.
+func optionalTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// responseFlusher makes Flush reachable through the middleware's wrappers,
+// which only expose it to http.ResponseController, and moves the write
+// deadline bulkIdleTimeout ahead on every write.
+type responseFlusher struct {
+	http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (f responseFlusher) Write(p []byte) (int, error) {
+	// Not every connection supports deadlines; those keep the server's.
+	_ = f.rc.SetWriteDeadline(time.Now().Add(bulkIdleTimeout))
+	return f.ResponseWriter.Write(p)
+}
+
+func (f responseFlusher) Flush() {
+	_ = f.rc.Flush()
+}
+
+// deadlineReader moves the read deadline bulkIdleTimeout ahead on every read
+// of a request body.
+type deadlineReader struct {
+	io.Reader
+	rc *http.ResponseController
+}
+
+func (d deadlineReader) Read(p []byte) (int, error) {
+	_ = d.rc.SetReadDeadline(time.Now().Add(bulkIdleTimeout))
+	return d.Reader.Read(p)
+}
+
+func (cfg *apiConfig) handleImportChirps(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	body := deadlineReader{r.Body, rc}
+	report, err := ImportChirps(r.Context(), cfg.dbQueries, body, ImportOptions{MaxChirpLength: cfg.maxChirpLength})
+	// The write deadline started with the request, so a long upload has
+	// used it up before the response begins.
+	_ = rc.SetWriteDeadline(time.Now().Add(bulkIdleTimeout))
+	if errors.Is(err, bufio.ErrTooLong) {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation,
+			fmt.Sprintf("A line is longer than %d bytes; %d chirps were imported before it", maxImportLine, report.Imported), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal,
+			fmt.Sprintf("The import stopped after %d chirps were imported", report.Imported), err)
+		return
+	}
+	cfg.chirpCache.purge()
+	loggerFromContext(r.Context()).Info("Chirps imported", "imported", report.Imported, "skipped", report.Skipped, "failed", report.Failed)
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+func (cfg *apiConfig) handleExportChirps(w http.ResponseWriter, r *http.Request) {
+	var filter ExportFilter
+	query := r.URL.Query()
+	if authorID := query.Get("author_id"); authorID != "" {
+		id, err := uuid.Parse(authorID)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "author_id must be a UUID", err)
+			return
+		}
+		filter.UserID = id
+	}
+	for _, bound := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if v := query.Get(bound.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				respondWithError(w, r, http.StatusBadRequest, codeValidation, bound.name+" must be an RFC 3339 time", err)
+				return
+			}
+			*bound.dst = t
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	n, err := ExportChirps(r.Context(), cfg.dbQueries, responseFlusher{w, http.NewResponseController(w)}, filter)
+	if err != nil {
+		// The status has gone out; cutting the connection is the only way
+		// left to tell the client the export is incomplete.
+		loggerFromContext(r.Context()).Error("Chirp export failed", "exported", n, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+	loggerFromContext(r.Context()).Info("Chirps exported", "exported", n)
+}
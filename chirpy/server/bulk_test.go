@@ -0,0 +1,160 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+func TestBulkChirpImportExport(t *testing.T) {
+	c := newTestClient(t)
+	ada := c.signUp("ada@example.com", "password")
+	admin := c.signUpWithRole("admin@example.com", "admin")
+	existing := c.createChirp(ada, "already here")
+	hidden := c.createChirp(ada, "hidden")
+	if _, err := c.store.HideChirp(context.Background(), hidden.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := uuid.New()
+	lines := []string{
+		fmt.Sprintf(`{"id":%q,"user_id":%q,"body":"what a kerfuffle","created_at":"2020-01-02T03:04:05Z"}`, imported, ada.ID),
+		fmt.Sprintf(`{"user_id":%q,"body":"generated id","created_at":"2021-06-01T00:00:00Z","updated_at":"2021-06-02T00:00:00Z"}`, admin.ID),
+		"",
+		fmt.Sprintf(`{"id":%q,"user_id":%q,"body":"duplicate"}`, existing.ID, ada.ID),
+		`{"user_id":`,
+		fmt.Sprintf(`{"user_id":%q,"body":"nobody"}`, uuid.New()),
+		fmt.Sprintf(`{"user_id":%q,"body":%q}`, ada.ID, strings.Repeat("a", 141)),
+	}
+	body := strings.Join(lines, "\n") + "\n"
+
+	expectProblem(t, c.do("POST", "/admin/chirps/import", ada.bearer(), body), http.StatusForbidden, "forbidden")
+	resp := c.do("POST", "/admin/chirps/import", admin.bearer(), body)
+	expectStatus(t, resp, http.StatusOK)
+	report := decodeBody[server.ImportReport](t, resp)
+	if report.Imported != 2 || report.Skipped != 1 || report.Failed != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for i, line := range []int{5, 6, 7} {
+		if report.Errors[i].Line != line {
+			t.Errorf("expected error %d on line %d, got %+v", i, line, report.Errors[i])
+		}
+	}
+
+	resp = c.do("GET", "/api/chirps/"+imported.String(), "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	chirp := decodeBody[server.Chirp](t, resp)
+	if chirp.Body != "what a ****" || !chirp.CreatedAt.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) || !chirp.UpdatedAt.Equal(chirp.CreatedAt) {
+		t.Errorf("unexpected imported chirp %+v", chirp)
+	}
+
+	expectProblem(t, c.do("GET", "/admin/chirps/export", ada.bearer(), nil), http.StatusForbidden, "forbidden")
+	expectProblem(t, c.do("GET", "/admin/chirps/export?since=yesterday", admin.bearer(), nil), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, c.do("GET", "/admin/chirps/export?author_id=ada", admin.bearer(), nil), http.StatusBadRequest, "invalid_id")
+
+	export := func(query string) []server.ChirpRecord {
+		t.Helper()
+		resp := c.do("GET", "/admin/chirps/export"+query, admin.bearer(), nil)
+		expectStatus(t, resp, http.StatusOK)
+		if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("expected JSON Lines, got %q", ct)
+		}
+		var records []server.ChirpRecord
+		dec := json.NewDecoder(resp.Body)
+		for dec.More() {
+			var record server.ChirpRecord
+			if err := dec.Decode(&record); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+	all := export("")
+	if len(all) != 3 || all[0].ID != imported || all[1].UserID != admin.ID || all[2].ID != existing.ID {
+		t.Fatalf("expected the imported chirps oldest first, then the visible one, got %+v", all)
+	}
+	if got := export("?author_id=" + ada.ID.String() + "&until=2021-01-01T00:00:00Z"); len(got) != 1 || got[0].ID != imported {
+		t.Errorf("expected only the 2020 chirp by ada, got %+v", got)
+	}
+	if got := export("?since=2021-06-01T00:00:00Z&until=2021-06-01T00:00:01Z"); len(got) != 1 || got[0].UserID != admin.ID {
+		t.Errorf("expected since to be inclusive, got %+v", got)
+	}
+
+	// Exports are valid imports; re-importing one skips every chirp.
+	var buf bytes.Buffer
+	if _, err := server.ExportChirps(context.Background(), c.store, &buf, server.ExportFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	report, err := server.ImportChirps(context.Background(), c.store, &buf, server.ImportOptions{})
+	if err != nil || report.Imported != 0 || report.Skipped != 3 || report.Failed != 0 {
+		t.Errorf("expected re-importing the export to skip everything, got %+v, %v", report, err)
+	}
+}
+
+func TestBulkTransfersOutlastServerTimeouts(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	c := newTestClientWithHTTP(t, func(srv *http.Server) {
+		srv.ReadTimeout = timeout
+		srv.WriteTimeout = timeout
+	})
+	// Signing up hashes a password, which can outlast the timeouts under the
+	// race detector, so the admin is made directly.
+	user, err := c.store.CreateUser(context.Background(), database.CreateUserParams{Email: "admin@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.store.SetUserRole(context.Background(), database.SetUserRoleParams{Role: "admin", ID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeJWT(user.ID, auth.RoleAdmin, testJWTSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := session{User: server.User{ID: user.ID}, Token: token}
+
+	// The upload trickles in for well past the read timeout.
+	body, upload := io.Pipe()
+	go func() {
+		for i := range 5 {
+			time.Sleep(timeout / 2)
+			fmt.Fprintf(upload, `{"user_id":%q,"body":"line %d"}`+"\n", admin.ID, i)
+		}
+		upload.Close()
+	}()
+	resp := c.do("POST", "/admin/chirps/import", admin.bearer(), body)
+	expectStatus(t, resp, http.StatusOK)
+	if report := decodeBody[server.ImportReport](t, resp); report.Imported != 5 {
+		t.Fatalf("expected 5 chirps imported, got %+v", report)
+	}
+
+	// Three slow pages keep the export writing past the write timeout.
+	var lines strings.Builder
+	for i := range 2 * 1000 {
+		fmt.Fprintf(&lines, `{"user_id":%q,"body":"bulk %d"}`+"\n", admin.ID, i)
+	}
+	if _, err := server.ImportChirps(context.Background(), c.store, strings.NewReader(lines.String()), server.ImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	c.store.exportDelay = timeout / 2
+	resp = c.do("GET", "/admin/chirps/export", admin.bearer(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	exported, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading the export: %v", err)
+	}
+	if n := bytes.Count(exported, []byte("\n")); n != 2005 {
+		t.Errorf("expected 2005 chirps exported, got %d", n)
+	}
+}
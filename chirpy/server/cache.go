@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/lru"
+	"github.com/google/uuid"
+)
+
+// chirpCacheControl lets browsers and shared caches keep chirp reads but makes
+// them revalidate every time, since moderation can hide a chirp at any moment.
+const chirpCacheControl = "public, no-cache"
+
+// viewerCacheControl is for lists filtered by the signed-in viewer's blocks
+// and mutes, which shared caches mustn't keep. Public lists need no Vary:
+// every reuse is revalidated against an ETag computed for that request.
+const viewerCacheControl = "private, no-cache"
+
+// encodedChirps is a marshalled chirp read and its validators.
+type encodedChirps struct {
+	body []byte
+	etag string
+	// lastModified is zero for lists, where deleting the newest chirp would
+	// make the list older; their ETag covers removals.
+	lastModified time.Time
+	// private marks a list filtered for the signed-in viewer.
+	private bool
+}
+
+// encodeChirps marshals payload and derives a strong ETag from the id and
+// updated_at of every chirp in it, in order. The bodies are immutable, so two
+// reads with the same ETag are byte-identical.
+func encodeChirps(payload any, chirps ...Chirp) (encodedChirps, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return encodedChirps{}, err
+	}
+	h := sha256.New()
+	for _, chirp := range chirps {
+		h.Write(chirp.ID[:])
+		binary.Write(h, binary.BigEndian, chirp.UpdatedAt.UnixNano())
+	}
+	return encodedChirps{
+		body: body,
+		etag: `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`,
+	}, nil
+}
+
+// serveChirps writes a 200 with validators, or a 304 when the request's
+// If-None-Match or If-Modified-Since shows the client is up to date.
+func serveChirps(w http.ResponseWriter, r *http.Request, encoded encodedChirps) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", encoded.etag)
+	if encoded.private {
+		w.Header().Set("Cache-Control", viewerCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", chirpCacheControl)
+	}
+	http.ServeContent(w, r, "", encoded.lastModified, bytes.NewReader(encoded.body))
+}
+
+// chirpCache holds encoded single-chirp reads. A nil *chirpCache is disabled.
+// Entries are only invalidated by this process, so with several instances a
+// moderated chirp can be served until its entry expires after ttl.
+type chirpCache struct {
+	entries *lru.Cache[uuid.UUID, cachedChirp]
+	ttl     time.Duration
+	now     func() time.Time
+
+	// gen counts invalidations, so a read that raced with one doesn't put the
+	// stale chirp back.
+	mu  sync.Mutex
+	gen uint64
+}
+
+type cachedChirp struct {
+	encodedChirps
+	author  uuid.UUID
+	expires time.Time
+}
+
+func newChirpCache(size int, ttl time.Duration) *chirpCache {
+	if size <= 0 {
+		return nil
+	}
+	return &chirpCache{entries: lru.New[uuid.UUID, cachedChirp](size), ttl: ttl, now: time.Now}
+}
+
+// get returns the cached read for id, or the generation to pass to add.
+func (c *chirpCache) get(id uuid.UUID) (cachedChirp, uint64, bool) {
+	if c == nil {
+		return cachedChirp{}, 0, false
+	}
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+	cached, ok := c.entries.Get(id)
+	if ok && !c.now().Before(cached.expires) {
+		c.entries.Remove(id)
+		return cachedChirp{}, gen, false
+	}
+	return cached, gen, ok
+}
+
+func (c *chirpCache) add(id, author uuid.UUID, encoded encodedChirps, gen uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen == c.gen {
+		c.entries.Add(id, cachedChirp{encodedChirps: encoded, author: author, expires: c.now().Add(c.ttl)})
+	}
+}
+
+// invalidate drops a chirp that was deleted or hidden.
+func (c *chirpCache) invalidate(id uuid.UUID) {
+	c.invalidateFunc(func(chirpID uuid.UUID, _ cachedChirp) bool { return chirpID == id })
+}
+
+// invalidateAuthor drops every chirp by a user who was suspended or banned.
+func (c *chirpCache) invalidateAuthor(userID uuid.UUID) {
+	c.invalidateFunc(func(_ uuid.UUID, cached cachedChirp) bool { return cached.author == userID })
+}
+
+func (c *chirpCache) purge() {
+	c.invalidateFunc(func(uuid.UUID, cachedChirp) bool { return true })
+}
+
+func (c *chirpCache) invalidateFunc(match func(uuid.UUID, cachedChirp) bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.entries.RemoveFunc(match)
+}
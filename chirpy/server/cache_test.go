@@ -0,0 +1,30 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestChirpCacheExpires(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newChirpCache(10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	id := uuid.New()
+	_, gen, ok := c.get(id)
+	if ok {
+		t.Fatal("expected an empty cache")
+	}
+	c.add(id, uuid.New(), encodedChirps{etag: `"a"`}, gen)
+
+	now = now.Add(59 * time.Second)
+	if cached, _, ok := c.get(id); !ok || cached.etag != `"a"` {
+		t.Errorf("expected a hit before the TTL, got %+v, %v", cached, ok)
+	}
+	now = now.Add(time.Second)
+	if _, _, ok := c.get(id); ok {
+		t.Error("expected the entry to expire after the TTL")
+	}
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/internal/tracing"
+	"github.com/google/uuid"
+)
+
+type Chirp struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+	// PublishAt is only set while the chirp is scheduled.
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+}
+
+type ChirpParameters struct {
+	UserID uuid.UUID `json:"user_id"`
+	Body   string    `json:"body"`
+	// PublishAt schedules the chirp instead of posting it now.
+	PublishAt time.Time `json:"publish_at"`
+}
+
+func toChirp(chirp database.Chirp) Chirp {
+	returned := Chirp{
+		ID:        chirp.ID,
+		UserID:    chirp.UserID.String(),
+		CreatedAt: chirp.CreatedAt.Time,
+		UpdatedAt: chirp.UpdatedAt.Time,
+		Body:      chirp.Body,
+	}
+	if chirp.PublishAt.Valid {
+		returned.PublishAt = &chirp.PublishAt.Time
+	}
+	return returned
+}
+
+func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request) {
+	params := ChirpParameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if cfg.rejectRestrictedUser(w, r, userID) {
+		return
+	}
+
+	if len(params.Body) > cfg.maxChirpLength {
+		respondWithError(w, r, http.StatusBadRequest, codeChirpTooLong, fmt.Sprintf("Chirp is longer than %d characters", cfg.maxChirpLength), nil)
+		return
+	}
+	var publishAt sql.NullTime
+	if !params.PublishAt.IsZero() {
+		if !validPublishAt(w, r, params.PublishAt) {
+			return
+		}
+		publishAt = sql.NullTime{Time: params.PublishAt.UTC(), Valid: true}
+	}
+
+	_, span := tracing.Start(r.Context(), "filter chirp", tracing.KindInternal)
+	words := replaceBadWords(params)
+	span.End()
+
+	chirp, err := cfg.dbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
+		UserID:    userID,
+		Body:      strings.Join(words, " "),
+		PublishAt: publishAt,
+	})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't create chirp", err)
+		return
+	}
+
+	cfg.metrics.chirpsCreated.Inc()
+	if !chirp.PublishAt.Valid {
+		// Scheduled chirps are announced when the publisher gets to them.
+		cfg.publish(r.Context(), "chirp.created", userID, toChirp(chirp))
+	}
+	respondWithJSON(w, http.StatusCreated, toChirp(chirp))
+}
+
+// handleListChirps lists visible chirps, oldest first unless sort=desc. A
+// caller who sends an access token doesn't see chirps hidden from them by a
+// block or mute.
+func (cfg *apiConfig) handleListChirps(w http.ResponseWriter, r *http.Request) {
+	var chirps []database.Chirp
+	var err error
+	authorID := r.URL.Query().Get("author_id")
+	sortBy := r.URL.Query().Get("sort")
+
+	viewerID, ok := cfg.optionalViewer(w, r)
+	if !ok {
+		return
+	}
+
+	if authorID != "" {
+		authorUUID, err := uuid.Parse(authorID)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "author_id must be a UUID", err)
+			return
+		}
+		chirps, err = cfg.dbQueries.GetChirpsByUserID(r.Context(), database.GetChirpsByUserIDParams{UserID: authorUUID, ViewerID: viewerID})
+		if err != nil {
+			respondWithInternalError(w, r, "Couldn't get chirps", err)
+			return
+		}
+	} else {
+		chirps, err = cfg.dbQueries.GetChirps(r.Context(), viewerID)
+		if err != nil {
+			respondWithInternalError(w, r, "Couldn't get chirps", err)
+			return
+		}
+	}
+
+	var chirpList []Chirp
+	for _, chirp := range chirps {
+		chirpList = append(chirpList, toChirp(chirp))
+	}
+
+	if sortBy == "desc" {
+		sort.Slice(chirpList, func(i, j int) bool {
+			return chirpList[i].CreatedAt.After(chirpList[j].CreatedAt)
+		})
+	}
+
+	encoded, err := encodeChirps(chirpList, chirpList...)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't encode chirps", err)
+		return
+	}
+	encoded.private = viewerID.Valid
+	serveChirps(w, r, encoded)
+}
+
+func (cfg *apiConfig) handleGetChirp(w http.ResponseWriter, r *http.Request) {
+	chirpUUID, ok := parseUUIDPathValue(w, r, "chirpID")
+	if !ok {
+		return
+	}
+	viewerID, ok := cfg.optionalViewer(w, r)
+	if !ok {
+		return
+	}
+
+	cached, gen, ok := cfg.chirpCache.get(chirpUUID)
+	if ok {
+		cfg.metrics.chirpCacheRequests.WithLabelValues("hit").Inc()
+		cfg.serveChirpTo(w, r, viewerID, cached.author, cached.encodedChirps)
+		return
+	}
+	if cfg.chirpCache != nil {
+		cfg.metrics.chirpCacheRequests.WithLabelValues("miss").Inc()
+	}
+
+	chirp, err := cfg.dbQueries.GetVisibleChirp(r.Context(), chirpUUID)
+	if err != nil {
+		respondWithLookupError(w, r, "Chirp", err)
+		return
+	}
+	response := toChirp(chirp)
+	encoded, err := encodeChirps(response, response)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't encode chirp", err)
+		return
+	}
+	encoded.lastModified = response.UpdatedAt
+	cfg.chirpCache.add(chirp.ID, chirp.UserID, encoded, gen)
+	cfg.serveChirpTo(w, r, viewerID, chirp.UserID, encoded)
+}
+
+// serveChirpTo serves a single chirp by author. A signed-in viewer gets a 404
+// if either of them has blocked the other; the cache is shared by every
+// viewer, so this is checked on each read rather than cached.
+func (cfg *apiConfig) serveChirpTo(w http.ResponseWriter, r *http.Request, viewerID uuid.NullUUID, author uuid.UUID, encoded encodedChirps) {
+	if viewerID.Valid && viewerID.UUID != author {
+		blocked, err := cfg.dbQueries.IsBlockedBetween(r.Context(), database.IsBlockedBetweenParams{UserA: viewerID.UUID, UserB: author})
+		if err != nil {
+			respondWithInternalError(w, r, "Couldn't check blocks", err)
+			return
+		}
+		if blocked {
+			respondWithLookupError(w, r, "Chirp", sql.ErrNoRows)
+			return
+		}
+		encoded.private = true
+	}
+	serveChirps(w, r, encoded)
+}
+
+func (cfg *apiConfig) handleDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	chirpUUID, ok := parseUUIDPathValue(w, r, "chirpID")
+	if !ok {
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	chirp, err := cfg.dbQueries.GetChirp(r.Context(), chirpUUID)
+	if err != nil {
+		respondWithLookupError(w, r, "Chirp", err)
+		return
+	}
+	if userID != chirp.UserID {
+		// Other users only learn a chirp exists if they could read it.
+		if _, err := cfg.dbQueries.GetVisibleChirp(r.Context(), chirpUUID); err != nil {
+			respondWithLookupError(w, r, "Chirp", err)
+			return
+		}
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Chirp does not belong to you", nil)
+		return
+	}
+
+	if cfg.rejectRestrictedUser(w, r, userID) {
+		return
+	}
+
+	err = cfg.dbQueries.DeleteChirp(r.Context(), chirpUUID)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't delete chirp", err)
+		return
+	}
+	cfg.chirpCache.invalidate(chirpUUID)
+	// Nobody was told about a chirp still scheduled, so nobody is told it's gone.
+	if !chirp.PublishAt.Valid {
+		cfg.publish(r.Context(), "chirp.deleted", userID, ChirpDeleted{ChirpID: chirpUUID, UserID: userID})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func replaceBadWords(params ChirpParameters) []string {
+	words := strings.Split(params.Body, " ")
+	badWords := []string{"kerfuffle",
+		"sharbert",
+		"fornax"}
+	for i, word := range words {
+		for _, badWord := range badWords {
+			if strings.EqualFold(word, badWord) {
+				words[i] = "****"
+				continue
+			}
+		}
+	}
+	return words
+}
@@ -0,0 +1,134 @@
+package server_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+func TestChirpFlow(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signUp("alice@example.com", "password")
+	bob := c.signUp("bob@example.com", "password")
+
+	expectProblem(t, c.do("POST", "/api/chirps", "", map[string]string{"body": "hi"}), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("POST", "/api/chirps", alice.bearer(), "{"), http.StatusBadRequest, "invalid_json")
+	expectProblem(t, c.do("POST", "/api/chirps", alice.bearer(), map[string]string{"body": strings.Repeat("a", 141)}),
+		http.StatusBadRequest, "chirp_too_long")
+
+	first := c.createChirp(alice, "What a kerfuffle that was")
+	if first.Body != "What a **** that was" {
+		t.Errorf("expected profanity to be replaced, got %q", first.Body)
+	}
+	if first.UserID != alice.ID.String() {
+		t.Errorf("expected user_id %s, got %s", alice.ID, first.UserID)
+	}
+	second := c.createChirp(bob, "Hello from Bob")
+	third := c.createChirp(alice, "Another one")
+
+	resp := c.do("GET", "/api/chirps", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	all := decodeBody[[]server.Chirp](t, resp)
+	if len(all) != 3 || all[0].ID != first.ID || all[2].ID != third.ID {
+		t.Errorf("expected chirps in ascending order, got %+v", all)
+	}
+
+	resp = c.do("GET", "/api/chirps?sort=desc", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	desc := decodeBody[[]server.Chirp](t, resp)
+	if len(desc) != 3 || desc[0].ID != third.ID {
+		t.Errorf("expected newest chirp first, got %+v", desc)
+	}
+
+	resp = c.do("GET", "/api/chirps?author_id="+bob.ID.String(), "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	bobs := decodeBody[[]server.Chirp](t, resp)
+	if len(bobs) != 1 || bobs[0].ID != second.ID {
+		t.Errorf("expected only Bob's chirp, got %+v", bobs)
+	}
+	expectProblem(t, c.do("GET", "/api/chirps?author_id=nope", "", nil), http.StatusBadRequest, "invalid_id")
+
+	resp = c.do("GET", "/api/chirps/"+second.ID.String(), "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if got := decodeBody[server.Chirp](t, resp); got.Body != "Hello from Bob" {
+		t.Errorf("unexpected chirp: %+v", got)
+	}
+	expectProblem(t, c.do("GET", "/api/chirps/not-a-uuid", "", nil), http.StatusBadRequest, "invalid_id")
+	expectProblem(t, c.do("GET", "/api/chirps/"+uuid.NewString(), "", nil), http.StatusNotFound, "not_found")
+
+	expectProblem(t, c.do("DELETE", "/api/chirps/"+second.ID.String(), "", nil), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("DELETE", "/api/chirps/"+second.ID.String(), alice.bearer(), nil), http.StatusForbidden, "forbidden")
+	expectStatus(t, c.do("DELETE", "/api/chirps/"+second.ID.String(), bob.bearer(), nil), http.StatusNoContent)
+	expectProblem(t, c.do("GET", "/api/chirps/"+second.ID.String(), "", nil), http.StatusNotFound, "not_found")
+}
+
+func TestConditionalChirpReads(t *testing.T) {
+	for _, size := range []int{0, 16} {
+		t.Run(fmt.Sprintf("cache size %d", size), func(t *testing.T) {
+			c := newTestClient(t, func(cfg *server.Config) { cfg.ChirpCacheSize = size })
+			alice := c.signUp("alice@example.com", "password")
+			mod := c.signUpWithRole("mod@example.com", "moderator")
+			first := c.createChirp(alice, "First")
+			second := c.createChirp(alice, "Second")
+			firstPath := "/api/chirps/" + first.ID.String()
+
+			resp := c.do("GET", firstPath, "", nil)
+			expectStatus(t, resp, http.StatusOK)
+			etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+			if !strings.HasPrefix(etag, `"`) || lastModified == "" {
+				t.Fatalf("expected a strong ETag and Last-Modified, got %q and %q", etag, lastModified)
+			}
+			if cc := resp.Header.Get("Cache-Control"); cc != "public, no-cache" {
+				t.Errorf("unexpected Cache-Control %q", cc)
+			}
+
+			resp = c.get(firstPath, http.Header{"If-None-Match": {etag}})
+			expectStatus(t, resp, http.StatusNotModified)
+			if resp.Header.Get("ETag") != etag {
+				t.Errorf("expected the 304 to repeat the ETag, got %q", resp.Header.Get("ETag"))
+			}
+			expectStatus(t, c.get(firstPath, http.Header{"If-Modified-Since": {lastModified}}), http.StatusNotModified)
+			resp = c.get(firstPath, http.Header{"If-None-Match": {`"stale"`}})
+			expectStatus(t, resp, http.StatusOK)
+			if got := decodeBody[server.Chirp](t, resp); got.ID != first.ID {
+				t.Errorf("unexpected chirp: %+v", got)
+			}
+
+			resp = c.do("GET", "/api/chirps", "", nil)
+			expectStatus(t, resp, http.StatusOK)
+			listETag := resp.Header.Get("ETag")
+			if resp.Header.Get("Last-Modified") != "" {
+				t.Error("expected no Last-Modified on the list")
+			}
+			expectStatus(t, c.get("/api/chirps", http.Header{"If-None-Match": {listETag}}), http.StatusNotModified)
+
+			expectStatus(t, c.do("DELETE", "/api/chirps/"+second.ID.String(), alice.bearer(), nil), http.StatusNoContent)
+			resp = c.get("/api/chirps", http.Header{"If-None-Match": {listETag}})
+			expectStatus(t, resp, http.StatusOK)
+			if resp.Header.Get("ETag") == listETag {
+				t.Error("expected the list ETag to change after a delete")
+			}
+
+			expectStatus(t, c.do("POST", "/api/moderation/chirps/"+first.ID.String()+"/hide", mod.bearer(), map[string]string{"reason": "spam"}),
+				http.StatusNoContent)
+			expectProblem(t, c.get(firstPath, http.Header{"If-None-Match": {etag}}), http.StatusNotFound, "not_found")
+
+			resp = c.do("GET", "/metrics", "", nil)
+			expectStatus(t, resp, http.StatusOK)
+			body, _ := io.ReadAll(resp.Body)
+			hits := `chirpy_chirp_cache_requests_total{result="hit"} 3`
+			if size == 0 {
+				if strings.Contains(string(body), "chirpy_chirp_cache_requests_total{") {
+					t.Errorf("expected no cache metrics with the cache off:\n%s", body)
+				}
+			} else if !strings.Contains(string(body), hits) {
+				t.Errorf("expected metrics to contain %q:\n%s", hits, body)
+			}
+		})
+	}
+}
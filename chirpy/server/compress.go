@@ -0,0 +1,266 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// minCompressSize is the smallest body worth compressing; below it the
+// encoding's framing eats most of the saving.
+const minCompressSize = 1024
+
+// brotliLevel keeps per-request brotli about as cheap as gzip's default; the
+// higher levels are meant for compressing static files ahead of time.
+const brotliLevel = 5
+
+// encoder is what gzip.Writer and brotli.Writer have in common.
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+	Reset(io.Writer)
+}
+
+// encoders pools a writer per content coding, in order of preference when a
+// client accepts several equally.
+var encoders = []struct {
+	name string
+	pool *sync.Pool
+}{
+	{"br", &sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, brotliLevel) }}},
+	{"gzip", &sync.Pool{New: func() any { return gzip.NewWriter(nil) }}},
+}
+
+// middlewareCompress brotli- or gzip-encodes compressible responses, whichever
+// the client prefers. Bodies are buffered up to minCompressSize to decide; a
+// Flush decides early so event streams reach the client as they are written.
+func middlewareCompress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &compressWriter{
+			ResponseWriter: w,
+			coding:         negotiateEncoding(r.Header.Get("Accept-Encoding")),
+		}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter holds back the status and the start of the body until it knows
+// whether to compress them.
+type compressWriter struct {
+	http.ResponseWriter
+	// coding is the index in encoders of the negotiated coding, or -1.
+	coding int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if code < 200 || cw.status != 0 {
+		// Informational responses go straight out, and a second call gets
+		// net/http's superfluous WriteHeader warning.
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+	if !cw.eligible() {
+		cw.start(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case cw.enc != nil:
+		return cw.enc.Write(b)
+	case cw.decided:
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= minCompressSize {
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// FlushError is what http.ResponseController calls; it must not skip the
+// buffer or the encoder, so there's no Unwrap shortcut for it.
+func (cw *compressWriter) FlushError() error {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		if err := cw.start(true); err != nil {
+			return err
+		}
+	}
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Flush() {
+	_ = cw.FlushError()
+}
+
+// Unwrap lets http.ResponseController reach deadlines on the real writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// eligible reports whether the headers so far allow compression. A missing
+// Content-Type is sniffed from the body later.
+func (cw *compressWriter) eligible() bool {
+	h := cw.Header()
+	if !bodyAllowed(cw.status) || cw.status == http.StatusPartialContent {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	ct := h.Get("Content-Type")
+	return ct == "" || compressible(ct)
+}
+
+// start sends the headers and whatever is buffered, compressing from here on
+// if wantCompress and the response still qualifies.
+func (cw *compressWriter) start(wantCompress bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 && bodyAllowed(cw.status) {
+		// Sniff now, or net/http would sniff the compressed bytes.
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	eligible := cw.eligible() && h.Get("Content-Type") != ""
+	if eligible || cw.status == http.StatusNotModified {
+		// A 304 stands in for the full response, which may have been compressed.
+		addVary(h, "Accept-Encoding")
+	}
+
+	buf := cw.buf
+	cw.buf = nil
+	if !wantCompress || !eligible || cw.coding < 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+		if len(buf) == 0 {
+			return nil
+		}
+		_, err := cw.ResponseWriter.Write(buf)
+		return err
+	}
+
+	coding := encoders[cw.coding]
+	h.Set("Content-Encoding", coding.name)
+	h.Del("Content-Length")
+	h.Del("Accept-Ranges")
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		// The compressed bytes are a different representation, so a strong
+		// validator for the identity body no longer holds.
+		h.Set("ETag", "W/"+etag)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	cw.enc = coding.pool.Get().(encoder)
+	cw.enc.Reset(cw.ResponseWriter)
+	_, err := cw.enc.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided && cw.status != 0 {
+		cw.start(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		encoders[cw.coding].pool.Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// compressible reports whether a media type is text-like. Images other than
+// SVG, archives and fonts are already compressed.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// negotiateEncoding picks the entry in encoders with the highest quality in an
+// Accept-Encoding header, or returns -1 if the header allows none of them.
+func negotiateEncoding(header string) int {
+	best, bestQ := -1, 0.0
+	for i, coding := range encoders {
+		if q := encodingQuality(header, coding.name); q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// encodingQuality is the quality an Accept-Encoding header gives coding,
+// either by name or through "*". Zero means not acceptable.
+func encodingQuality(header, coding string) float64 {
+	wildcard := 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != coding && name != "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if name == coding {
+			return q
+		}
+		wildcard = q
+	}
+	return wildcard
+}
+
+func addVary(h http.Header, field string) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompressFlushesStreams(t *testing.T) {
+	for coding, newReader := range map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	} {
+		t.Run(coding, func(t *testing.T) {
+			next := make(chan struct{})
+			srv := httptest.NewServer(middlewareCompress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				rc := http.NewResponseController(w)
+				for _, event := range []string{"data: one\n\n", "data: two\n\n"} {
+					w.Write([]byte(event))
+					if err := rc.Flush(); err != nil {
+						t.Errorf("flushing: %v", err)
+					}
+					<-next
+				}
+			})))
+			defer srv.Close()
+
+			req, _ := http.NewRequest("GET", srv.URL, nil)
+			req.Header.Set("Accept-Encoding", coding)
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.Header.Get("Content-Encoding") != coding {
+				t.Fatalf("expected a %s stream, got headers %v", coding, resp.Header)
+			}
+			body, err := newReader(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := bufio.NewReader(body)
+			for _, want := range []string{"data: one\n", "data: two\n"} {
+				// The handler is blocked until we ask for the next event, so
+				// this only succeeds if the flush pushed the event through the
+				// encoder.
+				line, err := lines.ReadString('\n')
+				if err != nil || line != want {
+					t.Fatalf("expected %q, got %q (%v)", want, line, err)
+				}
+				lines.ReadString('\n')
+				next <- struct{}{}
+			}
+		})
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                     "",
+		"gzip":                 "gzip",
+		"deflate, GZIP;q=0.5":  "gzip",
+		"br;q=1.0, gzip;q=0":   "br",
+		"br;q=0, gzip;q=0":     "",
+		"gzip, br":             "br",
+		"gzip;q=1, br;q=0.5":   "gzip",
+		"br;q=0.8, gzip;q=0.9": "gzip",
+		"*":                    "br",
+		"*;q=0":                "",
+		"br;q=0, *":            "gzip",
+		"gzip;q=0, br;q=0, *":  "",
+		"identity":             "",
+	} {
+		got := ""
+		if i := negotiateEncoding(header); i >= 0 {
+			got = encoders[i].name
+		}
+		if got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
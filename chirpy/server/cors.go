@@ -0,0 +1,188 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig is the cross-origin policy for browser clients. With no
+// AllowedOrigins no CORS headers are sent, so browsers stay same-origin.
+type CORSConfig struct {
+	// AllowedOrigins are exact origins such as https://chirpy.example, "*" for
+	// any origin, or https://*.example.com for any subdomain of example.com.
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, POST, PUT and DELETE. They are matched
+	// case-insensitively.
+	AllowedMethods []string
+	// AllowedHeaders are request headers a preflight may ask for, or "*" for
+	// any. Defaults to Authorization and Content-Type.
+	AllowedHeaders []string
+	// AllowCredentials lets pages send cookies and read responses to
+	// credentialed requests. It can't be combined with a "*" origin.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight. 0 leaves it to them.
+	MaxAge time.Duration
+}
+
+// Validate reports a policy that would let any site make credentialed
+// requests: AllowCredentials together with a "*" origin.
+func (c CORSConfig) Validate() error {
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return errors.New("CORS: AllowCredentials can't be combined with a \"*\" origin; list the origins instead")
+	}
+	return nil
+}
+
+// corsExposedHeaders are response headers scripts may read beyond the safelisted ones.
+const corsExposedHeaders = "ETag, X-Request-ID"
+
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	// wildcards are the text either side of the "*" in https://*.example.com.
+	wildcards [][2]string
+
+	methods     []string
+	anyHeader   bool
+	headers     map[string]bool
+	credentials bool
+	maxAge      string
+}
+
+// newCORSPolicy returns nil, meaning no CORS, when no origins are allowed. It
+// panics if cfg fails Validate.
+func newCORSPolicy(cfg CORSConfig) *corsPolicy {
+	if err := cfg.Validate(); err != nil {
+		panic("server: " + err.Error())
+	}
+	if len(cfg.AllowedOrigins) == 0 {
+		return nil
+	}
+	p := &corsPolicy{
+		origins:     map[string]bool{},
+		headers:     map[string]bool{},
+		credentials: cfg.AllowCredentials,
+	}
+	for _, method := range cfg.AllowedMethods {
+		p.methods = append(p.methods, strings.ToUpper(method))
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			p.anyOrigin = true
+		} else if before, after, ok := strings.Cut(origin, "://*."); ok {
+			p.wildcards = append(p.wildcards, [2]string{before + "://", "." + after})
+		} else {
+			p.origins[origin] = true
+		}
+	}
+	if len(p.methods) == 0 {
+		p.methods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	}
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Authorization", "Content-Type"}
+	}
+	for _, header := range headers {
+		if header == "*" {
+			p.anyHeader = true
+		}
+		p.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge / time.Second))
+	}
+	return p
+}
+
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(origin) <= len(w[0])+len(w[1]) || !strings.HasPrefix(origin, w[0]) || !strings.HasSuffix(origin, w[1]) {
+			continue
+		}
+		if sub := origin[len(w[0]) : len(origin)-len(w[1])]; !strings.ContainsAny(sub, "/:@") {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders checks a preflight's comma-separated Access-Control-Request-Headers.
+func (p *corsPolicy) allowsHeaders(requested string) bool {
+	if p.anyHeader || requested == "" {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		if !p.headers[http.CanonicalHeaderKey(strings.TrimSpace(header))] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *corsPolicy) setAllowOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// middleware answers preflights itself and adds CORS headers to other
+// responses for allowed origins. A preflight that breaks the policy still gets
+// a 204, just without the headers, and the browser blocks the real request.
+func (p *corsPolicy) middleware(next http.Handler) http.Handler {
+	if p == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		origin := r.Header.Get("Origin")
+		method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+
+		if r.Method == http.MethodOptions && method != "" {
+			addVary(h, "Origin")
+			addVary(h, "Access-Control-Request-Method")
+			addVary(h, "Access-Control-Request-Headers")
+			requested := r.Header.Get("Access-Control-Request-Headers")
+			if p.allowsOrigin(origin) && slices.Contains(p.methods, method) && p.allowsHeaders(requested) {
+				p.setAllowOrigin(h, origin)
+				h.Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+				if requested != "" {
+					h.Set("Access-Control-Allow-Headers", requested)
+				}
+				if p.maxAge != "" {
+					h.Set("Access-Control-Max-Age", p.maxAge)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if !p.anyOrigin {
+			addVary(h, "Origin")
+		}
+		if p.allowsOrigin(origin) {
+			p.setAllowOrigin(h, origin)
+			h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSAllowsOrigin(t *testing.T) {
+	p := newCORSPolicy(CORSConfig{AllowedOrigins: []string{"https://chirpy.example", "https://*.chirpy.example", "http://*.local.test:3000"}})
+	for origin, want := range map[string]bool{
+		"":                                    false,
+		"https://chirpy.example":              true,
+		"HTTPS://Chirpy.Example":              true,
+		"http://chirpy.example":               false,
+		"https://app.chirpy.example":          true,
+		"https://a.b.chirpy.example":          true,
+		"https://.chirpy.example":             false,
+		"https://evilchirpy.example":          false,
+		"https://chirpy.example.evil":         false,
+		"https://app.chirpy.example:8443":     false,
+		"http://web.local.test:3000":          true,
+		"http://web.local.test":               false,
+		"http://evil.com:1@x.local.test:3000": false,
+	} {
+		if got := p.allowsOrigin(origin); got != want {
+			t.Errorf("allowsOrigin(%q) = %v, want %v", origin, got, want)
+		}
+	}
+
+	if newCORSPolicy(CORSConfig{}) != nil {
+		t.Error("expected no policy without allowed origins")
+	}
+	if p := newCORSPolicy(CORSConfig{AllowedOrigins: []string{"*"}}); !p.allowsOrigin("https://anything.example") {
+		t.Error("expected * to allow any origin")
+	}
+}
+
+func TestCORSConfigRejectsCredentialedWildcard(t *testing.T) {
+	cfg := CORSConfig{AllowedOrigins: []string{"https://chirpy.example", "*"}, AllowCredentials: true}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected * with credentials to be invalid")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected newCORSPolicy to panic on an invalid config")
+		}
+	}()
+	newCORSPolicy(cfg)
+}
+
+func TestCORSMethodsIgnoreCase(t *testing.T) {
+	p := newCORSPolicy(CORSConfig{AllowedOrigins: []string{"https://chirpy.example"}, AllowedMethods: []string{"get", "Patch"}})
+	handler := p.middleware(http.NotFoundHandler())
+	for _, method := range []string{"GET", "patch", "PATCH"} {
+		req := httptest.NewRequest("OPTIONS", "/api/chirps", nil)
+		req.Header.Set("Origin", "https://chirpy.example")
+		req.Header.Set("Access-Control-Request-Method", method)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Header().Get("Access-Control-Allow-Origin") == "" {
+			t.Errorf("expected a preflight for %s to be allowed", method)
+		}
+	}
+	if got := p.methods; len(got) != 2 || got[0] != "GET" || got[1] != "PATCH" {
+		t.Errorf("expected methods to be upper-cased, got %v", got)
+	}
+}
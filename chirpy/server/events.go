@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event tells downstream systems about a change. It is published once the
+// change is committed. ID is the same in every webhook delivery of the event.
+type Event struct {
+	ID         uuid.UUID `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// EventSink receives published events. Publish is called on the request's
+// goroutine, so anything slow belongs in the background.
+type EventSink interface {
+	Publish(ctx context.Context, event Event)
+}
+
+// EventSinkFunc adapts a function to EventSink.
+type EventSinkFunc func(ctx context.Context, event Event)
+
+func (f EventSinkFunc) Publish(ctx context.Context, event Event) {
+	f(ctx, event)
+}
+
+// WebhookEventTypes are the events webhook endpoints can subscribe to. The
+// data of chirp.created is the Chirp; the others have their own types below.
+var WebhookEventTypes = []string{"chirp.created", "chirp.deleted", "user.upgraded", "user.deleted"}
+
+// ChirpDeleted is the data of a chirp.deleted event.
+type ChirpDeleted struct {
+	ChirpID uuid.UUID `json:"chirp_id"`
+	UserID  uuid.UUID `json:"user_id"`
+}
+
+// UserUpgraded is the data of a user.upgraded event.
+type UserUpgraded struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// UserDeleted is the data of a user.deleted event. Chirps is "deleted" or
+// "anonymized", following Config.AnonymizeDeletedChirps.
+type UserDeleted struct {
+	UserID uuid.UUID `json:"user_id"`
+	Chirps string    `json:"chirps"`
+}
+
+// publish logs the event, hands it to the configured sink, if any, and queues
+// it for the webhooks of userID, the user it is about, and of admins watching
+// all users.
+func (cfg *apiConfig) publish(ctx context.Context, eventType string, userID uuid.UUID, data any) {
+	event := Event{ID: uuid.New(), Type: eventType, OccurredAt: time.Now().UTC(), Data: data}
+	loggerFromContext(ctx).Info("Event published", "event", eventType, "event_id", event.ID)
+	if cfg.events != nil {
+		cfg.events.Publish(ctx, event)
+	}
+	cfg.enqueueWebhooks(ctx, event, userID)
+}
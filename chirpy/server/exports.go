@@ -0,0 +1,487 @@
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// exportPurgeInterval is how often expired exports are deleted. Reads already
+// ignore them, so this only bounds how long their archives take up space.
+const exportPurgeInterval = time.Hour
+
+// exportStaleAfter is how long an export can stay pending before the purge
+// marks it failed, so one whose server died doesn't block its user's next.
+const exportStaleAfter = 6 * time.Hour
+
+// exportChunkSize is how much of an archive is stored per row, and so about
+// how much of it is in memory while it is built or downloaded.
+const exportChunkSize = 1 << 20
+
+// DataExport is the status of a user's data export. The archive itself is
+// downloaded from the same URL once Status is "ready".
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+func toDataExport(export database.DataExport) DataExport {
+	returned := DataExport{
+		ID:        export.ID,
+		Status:    export.Status,
+		CreatedAt: export.CreatedAt,
+		ExpiresAt: export.ExpiresAt,
+	}
+	if export.CompletedAt.Valid {
+		returned.CompletedAt = &export.CompletedAt.Time
+	}
+	return returned
+}
+
+// exportedChirp is a chirp in chirps.json. Unlike the public API it includes
+// chirps a moderator hid.
+type exportedChirp struct {
+	Chirp
+	HiddenAt *time.Time `json:"hidden_at,omitempty"`
+}
+
+// exportedSession is a refresh token in sessions.json, without the token.
+type exportedSession struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// exportedSubscription is subscription.json: the current plan and every Polka
+// event that changed it.
+type exportedSubscription struct {
+	IsChirpyRed bool                        `json:"is_chirpy_red"`
+	Events      []exportedSubscriptionEvent `json:"events"`
+}
+
+type exportedSubscriptionEvent struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exportedConversation is a conversation in messages.json with the messages
+// the user hasn't deleted, oldest first.
+type exportedConversation struct {
+	Conversation
+	Messages []Message `json:"messages"`
+}
+
+// exportedRelationships is relationships.json: who the user has blocked,
+// muted and follows.
+type exportedRelationships struct {
+	Blocks    []Relationship `json:"blocks"`
+	Mutes     []Relationship `json:"mutes"`
+	Following []Relationship `json:"following"`
+}
+
+func exportPath(id uuid.UUID) string {
+	return "/api/users/me/export/" + id.String()
+}
+
+// handleCreateExport starts building an archive of everything stored about the
+// caller. Restricted accounts may export too; the data is theirs either way.
+// A user has at most one export pending at a time.
+func (cfg *apiConfig) handleCreateExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := cfg.dbQueries.CreateDataExport(r.Context(), database.CreateDataExportParams{
+		UserID:           userID,
+		ExpiresInSeconds: int32(cfg.exportTTL.Seconds()),
+	})
+	if database.IsUniqueViolation(err) {
+		respondWithError(w, r, http.StatusConflict, codeConflict, "An export is already in progress", err)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't start export", err)
+		return
+	}
+
+	logger := loggerFromContext(r.Context()).With("export_id", export.ID)
+	started := cfg.goWorker(func(ctx context.Context) {
+		cfg.runExport(ctx, logger, export)
+	})
+	if !started {
+		if err := cfg.dbQueries.FailDataExport(r.Context(), export.ID); err != nil {
+			logger.Error("Couldn't mark data export failed", "error", err)
+		}
+		respondWithError(w, r, http.StatusServiceUnavailable, codeUnavailable, "Server is shutting down; try again shortly", nil)
+		return
+	}
+
+	w.Header().Set("Location", exportPath(export.ID))
+	respondWithJSON(w, http.StatusAccepted, toDataExport(export))
+}
+
+// handleGetExport reports an export's progress, or downloads the archive once
+// it is ready. Exports of other users and expired ones are not found.
+func (cfg *apiConfig) handleGetExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	exportID, ok := parseUUIDPathValue(w, r, "exportID")
+	if !ok {
+		return
+	}
+
+	export, err := cfg.dbQueries.GetDataExport(r.Context(), database.GetDataExportParams{ID: exportID, UserID: userID})
+	if err != nil {
+		respondWithLookupError(w, r, "Export", err)
+		return
+	}
+
+	switch export.Status {
+	case "pending":
+		w.Header().Set("Retry-After", "5")
+		respondWithJSON(w, http.StatusAccepted, toDataExport(export))
+	case "ready":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, export.CreatedAt.UTC().Format("2006-01-02")))
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("Last-Modified", export.CompletedAt.Time.UTC().Format(http.TimeFormat))
+		cfg.streamExport(w, r, export.ID)
+	default:
+		respondWithJSON(w, http.StatusOK, toDataExport(export))
+	}
+}
+
+// streamExport writes the archive of a ready export one chunk at a time. The
+// status line is sent with the first chunk, so a later failure can only abort
+// the response.
+func (cfg *apiConfig) streamExport(w http.ResponseWriter, r *http.Request, exportID uuid.UUID) {
+	for seq := int32(0); ; seq++ {
+		chunk, err := cfg.dbQueries.GetDataExportChunk(r.Context(), database.GetDataExportChunkParams{ExportID: exportID, Seq: seq})
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			if seq == 0 {
+				respondWithInternalError(w, r, "Couldn't read export", err)
+				return
+			}
+			loggerFromContext(r.Context()).Error("Couldn't read export chunk", "export_id", exportID, "seq", seq, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return
+		}
+	}
+}
+
+// runExport builds the archive for export and stores it, or marks the export
+// failed so clients stop polling. It waits for one of cfg.exportSlots first.
+func (cfg *apiConfig) runExport(ctx context.Context, logger *slog.Logger, export database.DataExport) {
+	var size int64
+	err := cfg.acquireExportSlot(ctx)
+	if err == nil {
+		defer func() { <-cfg.exportSlots }()
+		chunks := &exportChunkWriter{ctx: ctx, store: cfg.dbQueries, exportID: export.ID}
+		err = cfg.buildExport(ctx, export.UserID, chunks)
+		if err == nil {
+			err = chunks.flush()
+		}
+		size = chunks.size
+	}
+	if err == nil {
+		err = cfg.dbQueries.CompleteDataExport(ctx, database.CompleteDataExportParams{
+			ID:               export.ID,
+			ExpiresInSeconds: int32(cfg.exportTTL.Seconds()),
+		})
+	}
+	if err != nil {
+		logger.Error("Data export failed", "error", err)
+		// Shutdown cancels ctx, and the export still has to be marked.
+		err := cfg.dbQueries.InTx(context.WithoutCancel(ctx), func(ctx context.Context) error {
+			if err := cfg.dbQueries.FailDataExport(ctx, export.ID); err != nil {
+				return err
+			}
+			return cfg.dbQueries.DeleteDataExportChunks(ctx, export.ID)
+		})
+		if err != nil {
+			logger.Error("Couldn't mark data export failed", "error", err)
+		}
+		return
+	}
+	logger.Info("Data export ready", "bytes", size)
+}
+
+func (cfg *apiConfig) acquireExportSlot(ctx context.Context) error {
+	select {
+	case cfg.exportSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// exportChunkWriter stores what is written to it as the chunks of one export,
+// exportChunkSize bytes at a time.
+type exportChunkWriter struct {
+	ctx      context.Context
+	store    Store
+	exportID uuid.UUID
+	seq      int32
+	buf      []byte
+	size     int64
+}
+
+func (w *exportChunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.buf == nil {
+			w.buf = make([]byte, 0, exportChunkSize)
+		}
+		n := min(len(p), exportChunkSize-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(w.buf) == exportChunkSize {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush stores any buffered bytes as the next chunk.
+func (w *exportChunkWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.store.AppendDataExportChunk(w.ctx, database.AppendDataExportChunkParams{
+		ExportID: w.exportID,
+		Seq:      w.seq,
+		Data:     w.buf,
+	})
+	if err != nil {
+		return fmt.Errorf("storing chunk %d: %w", w.seq, err)
+	}
+	w.size += int64(len(w.buf))
+	w.seq++
+	w.buf = nil
+	return nil
+}
+
+// buildExport writes a zip of profile.json, chirps.json, sessions.json,
+// subscription.json, messages.json, webhooks.json, relationships.json,
+// reports.json and the avatar, if there is one, for userID to w.
+func (cfg *apiConfig) buildExport(ctx context.Context, userID uuid.UUID, w io.Writer) error {
+	user, err := cfg.dbQueries.GetUserByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("loading user: %w", err)
+	}
+	chirps, err := cfg.dbQueries.GetAllChirpsByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("loading chirps: %w", err)
+	}
+	tokens, err := cfg.dbQueries.ListRefreshTokensByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("loading sessions: %w", err)
+	}
+	events, err := cfg.dbQueries.ListSubscriptionEvents(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("loading subscription events: %w", err)
+	}
+	conversations, err := cfg.exportConversations(ctx, userID)
+	if err != nil {
+		return err
+	}
+	endpoints, err := cfg.dbQueries.ListWebhookEndpoints(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("loading webhooks: %w", err)
+	}
+	relationships, err := cfg.exportRelationships(ctx, userID)
+	if err != nil {
+		return err
+	}
+	reports, err := cfg.dbQueries.ListChirpReportsByReporter(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("loading reports: %w", err)
+	}
+	avatar, err := cfg.dbQueries.GetUserAvatar(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("loading avatar: %w", err)
+	}
+
+	exportedChirps := make([]exportedChirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		exported := exportedChirp{Chirp: toChirp(chirp)}
+		if chirp.HiddenAt.Valid {
+			exported.HiddenAt = &chirp.HiddenAt.Time
+		}
+		exportedChirps = append(exportedChirps, exported)
+	}
+	sessions := make([]exportedSession, 0, len(tokens))
+	for _, token := range tokens {
+		session := exportedSession{CreatedAt: token.CreatedAt.Time, ExpiresAt: token.ExpiresAt}
+		if token.RevokedAt.Valid {
+			session.RevokedAt = &token.RevokedAt.Time
+		}
+		sessions = append(sessions, session)
+	}
+	subscription := exportedSubscription{
+		IsChirpyRed: user.IsChirpyRed.Bool,
+		Events:      make([]exportedSubscriptionEvent, 0, len(events)),
+	}
+	for _, event := range events {
+		subscription.Events = append(subscription.Events, exportedSubscriptionEvent{Event: event.Event, CreatedAt: event.CreatedAt})
+	}
+	webhooks := make([]WebhookEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		webhooks = append(webhooks, toWebhookEndpoint(endpoint))
+	}
+	filed := make([]ChirpReport, 0, len(reports))
+	for _, report := range reports {
+		filed = append(filed, toChirpReport(report))
+	}
+
+	zw := zip.NewWriter(w)
+	for _, file := range []struct {
+		name    string
+		payload any
+	}{
+		{"profile.json", toUser(user)},
+		{"chirps.json", exportedChirps},
+		{"sessions.json", sessions},
+		{"subscription.json", subscription},
+		{"messages.json", conversations},
+		{"webhooks.json", webhooks},
+		{"relationships.json", relationships},
+		{"reports.json", filed},
+	} {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.payload); err != nil {
+			return fmt.Errorf("writing %s: %w", file.name, err)
+		}
+	}
+	if len(avatar.Image) > 0 {
+		f, err := zw.Create("avatar" + avatarTypes[avatar.ContentType])
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(avatar.Image); err != nil {
+			return fmt.Errorf("writing avatar: %w", err)
+		}
+	}
+	return zw.Close()
+}
+
+// exportConversations loads every conversation userID is in, with all the
+// messages they can see.
+func (cfg *apiConfig) exportConversations(ctx context.Context, userID uuid.UUID) ([]exportedConversation, error) {
+	rows, err := cfg.dbQueries.ListConversationsForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("loading conversations: %w", err)
+	}
+	conversations := conversationsFromRows(rows)
+	exported := make([]exportedConversation, 0, len(conversations))
+	for _, conversation := range conversations {
+		participants, err := cfg.dbQueries.ListConversationParticipants(ctx, conversation.ID)
+		if err != nil {
+			return nil, fmt.Errorf("loading participants: %w", err)
+		}
+		params := database.ListMessagesParams{ConversationID: conversation.ID, UserID: userID, PageSize: maxMessagePageSize}
+		var messages []Message
+		for {
+			page, err := cfg.dbQueries.ListMessages(ctx, params)
+			if err != nil {
+				return nil, fmt.Errorf("loading messages: %w", err)
+			}
+			for _, message := range page {
+				messages = append(messages, toMessage(message, participants))
+			}
+			if len(page) < int(params.PageSize) {
+				break
+			}
+			last := page[len(page)-1]
+			params.BeforeCreatedAt = sql.NullTime{Time: last.CreatedAt, Valid: true}
+			params.BeforeID = last.ID
+		}
+		// Pages come newest first.
+		slices.Reverse(messages)
+		if messages == nil {
+			messages = []Message{}
+		}
+		exported = append(exported, exportedConversation{Conversation: conversation, Messages: messages})
+	}
+	return exported, nil
+}
+
+// exportRelationships loads who userID has blocked, muted and follows.
+func (cfg *apiConfig) exportRelationships(ctx context.Context, userID uuid.UUID) (exportedRelationships, error) {
+	out := exportedRelationships{Blocks: []Relationship{}, Mutes: []Relationship{}, Following: []Relationship{}}
+	for kind, list := range map[string]*[]Relationship{relationshipBlock: &out.Blocks, relationshipMute: &out.Mutes} {
+		rows, err := cfg.dbQueries.ListUserRelationships(ctx, database.ListUserRelationshipsParams{UserID: userID, Kind: kind})
+		if err != nil {
+			return out, fmt.Errorf("loading %ss: %w", kind, err)
+		}
+		for _, row := range rows {
+			*list = append(*list, Relationship{UserID: row.TargetID, CreatedAt: row.CreatedAt})
+		}
+	}
+	follows, err := cfg.dbQueries.ListUserFollows(ctx, userID)
+	if err != nil {
+		return out, fmt.Errorf("loading follows: %w", err)
+	}
+	for _, follow := range follows {
+		out.Following = append(out.Following, Relationship{UserID: follow.FolloweeID, CreatedAt: follow.CreatedAt})
+	}
+	return out, nil
+}
+
+// purgeExpiredExports deletes expired exports, and fails ones pending longer
+// than exportStaleAfter, every exportPurgeInterval until ctx is done.
+func (cfg *apiConfig) purgeExpiredExports(ctx context.Context) {
+	ticker := time.NewTicker(exportPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stale, err := cfg.dbQueries.FailStaleDataExports(ctx, int32(exportStaleAfter.Seconds()))
+		if err != nil {
+			cfg.logger.Error("Couldn't fail stale data exports", "error", err)
+		} else if stale > 0 {
+			cfg.logger.Warn("Failed stale data exports", "count", stale)
+		}
+		n, err := cfg.dbQueries.DeleteExpiredDataExports(ctx)
+		if err != nil {
+			cfg.logger.Error("Couldn't delete expired data exports", "error", err)
+			continue
+		}
+		if n > 0 {
+			cfg.logger.Info("Deleted expired data exports", "count", n)
+		}
+	}
+}
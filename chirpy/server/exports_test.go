@@ -0,0 +1,190 @@
+package server_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+func TestDataExport(t *testing.T) {
+	c := newTestClient(t)
+	s := c.signUp("ada@example.com", "password")
+	other := c.signUp("bob@example.com", "password")
+	c.createChirp(s, "first")
+	hidden := c.createChirp(s, "second")
+	if _, err := c.store.HideChirp(context.Background(), hidden.ID); err != nil {
+		t.Fatal(err)
+	}
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": s.ID.String()}}
+	expectStatus(t, c.do("POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, upgrade), http.StatusNoContent)
+	png := "\x89PNG\r\n\x1a\n" + "not really a png"
+	expectStatus(t, c.do("PUT", "/api/users/me/avatar", s.bearer(), png), http.StatusNoContent)
+	resp := c.do("POST", "/api/conversations", s.bearer(), map[string]any{"participant_ids": []uuid.UUID{other.ID}})
+	expectStatus(t, resp, http.StatusCreated)
+	messagesPath := "/api/conversations/" + decodeBody[server.Conversation](t, resp).ID.String() + "/messages"
+	expectStatus(t, c.do("POST", messagesPath, s.bearer(), map[string]string{"body": "hi bob"}), http.StatusCreated)
+	expectStatus(t, c.do("POST", messagesPath, other.bearer(), map[string]string{"body": "hi ada"}), http.StatusCreated)
+	expectStatus(t, c.do("POST", "/api/webhooks", s.bearer(), map[string]any{"url": "https://example.com/hook", "events": []string{"chirp.created"}}),
+		http.StatusCreated)
+	expectStatus(t, c.do("PUT", "/api/users/"+other.ID.String()+"/follow", s.bearer(), nil), http.StatusNoContent)
+	expectStatus(t, c.do("PUT", "/api/users/"+other.ID.String()+"/mute", s.bearer(), nil), http.StatusNoContent)
+	bobs := c.createChirp(other, "from bob")
+	expectStatus(t, c.do("POST", "/api/chirps/"+bobs.ID.String()+"/report", s.bearer(), map[string]string{"reason": "spam"}), http.StatusCreated)
+
+	expectProblem(t, c.do("POST", "/api/users/me/export", "", nil), http.StatusUnauthorized, "unauthorized")
+	resp = c.do("POST", "/api/users/me/export", s.bearer(), nil)
+	expectStatus(t, resp, http.StatusAccepted)
+	export := decodeBody[server.DataExport](t, resp)
+	location := resp.Header.Get("Location")
+	if location != "/api/users/me/export/"+export.ID.String() || export.Status != "pending" {
+		t.Fatalf("unexpected export %+v at %q", export, location)
+	}
+
+	expectProblem(t, c.do("GET", location, other.bearer(), nil), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("GET", "/api/users/me/export/"+uuid.NewString(), s.bearer(), nil), http.StatusNotFound, "not_found")
+
+	waitFor(t, "the export to finish", &c.store.changed, func() bool {
+		resp = c.do("GET", location, s.bearer(), nil)
+		if resp.StatusCode == http.StatusAccepted && resp.Header.Get("Retry-After") == "" {
+			t.Error("expected Retry-After on a pending export")
+		}
+		return resp.StatusCode != http.StatusAccepted
+	})
+	expectStatus(t, resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/zip" {
+		t.Fatalf("expected a zip, got %q", ct)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") {
+		t.Errorf("expected an attachment, got %q", cd)
+	}
+	archive, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	var profile server.User
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil || profile.Email != "ada@example.com" || !profile.IsChirpyRed {
+		t.Errorf("unexpected profile.json: %s", files["profile.json"])
+	}
+	var chirps []struct {
+		Body     string     `json:"body"`
+		HiddenAt *time.Time `json:"hidden_at"`
+	}
+	if err := json.Unmarshal(files["chirps.json"], &chirps); err != nil || len(chirps) != 2 ||
+		chirps[0].HiddenAt != nil || chirps[1].Body != "second" || chirps[1].HiddenAt == nil {
+		t.Errorf("expected both chirps, the second hidden, got %s", files["chirps.json"])
+	}
+	var sessions []map[string]any
+	if err := json.Unmarshal(files["sessions.json"], &sessions); err != nil || len(sessions) != 1 {
+		t.Errorf("expected the login session, got %s", files["sessions.json"])
+	}
+	if bytes.Contains(files["sessions.json"], []byte(s.RefreshToken)) {
+		t.Error("sessions.json must not contain refresh tokens")
+	}
+	var subscription struct {
+		IsChirpyRed bool `json:"is_chirpy_red"`
+		Events      []struct {
+			Event string `json:"event"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(files["subscription.json"], &subscription); err != nil || !subscription.IsChirpyRed ||
+		len(subscription.Events) != 1 || subscription.Events[0].Event != "user.upgraded" {
+		t.Errorf("unexpected subscription.json: %s", files["subscription.json"])
+	}
+	var conversations []struct {
+		Participants []server.Participant `json:"participants"`
+		Messages     []server.Message     `json:"messages"`
+	}
+	if err := json.Unmarshal(files["messages.json"], &conversations); err != nil || len(conversations) != 1 ||
+		len(conversations[0].Participants) != 2 || len(conversations[0].Messages) != 2 || conversations[0].Messages[0].Body != "hi bob" {
+		t.Errorf("expected the conversation with bob, oldest message first, got %s", files["messages.json"])
+	}
+	var webhooks []server.WebhookEndpoint
+	if err := json.Unmarshal(files["webhooks.json"], &webhooks); err != nil || len(webhooks) != 1 || webhooks[0].Secret != "" {
+		t.Errorf("expected the webhook without its secret, got %s", files["webhooks.json"])
+	}
+	var relationships struct {
+		Blocks    []server.Relationship `json:"blocks"`
+		Mutes     []server.Relationship `json:"mutes"`
+		Following []server.Relationship `json:"following"`
+	}
+	if err := json.Unmarshal(files["relationships.json"], &relationships); err != nil || len(relationships.Blocks) != 0 ||
+		len(relationships.Mutes) != 1 || len(relationships.Following) != 1 || relationships.Following[0].UserID != other.ID {
+		t.Errorf("unexpected relationships.json: %s", files["relationships.json"])
+	}
+	var reports []server.ChirpReport
+	if err := json.Unmarshal(files["reports.json"], &reports); err != nil || len(reports) != 1 || reports[0].ChirpID != bobs.ID {
+		t.Errorf("expected the report ada filed, got %s", files["reports.json"])
+	}
+	if string(files["avatar.png"]) != png {
+		t.Errorf("expected the avatar, got %q", files["avatar.png"])
+	}
+}
+
+func TestDataExportOnePendingAtATime(t *testing.T) {
+	c := newTestClient(t)
+	s := c.signUp("ada@example.com", "password")
+	pending, err := c.store.CreateDataExport(context.Background(), database.CreateDataExportParams{UserID: s.ID, ExpiresInSeconds: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectProblem(t, c.do("POST", "/api/users/me/export", s.bearer(), nil), http.StatusConflict, "conflict")
+
+	if err := c.store.FailDataExport(context.Background(), pending.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, c.do("POST", "/api/users/me/export", s.bearer(), nil), http.StatusAccepted)
+}
+
+func TestDataExportsWaitForASlot(t *testing.T) {
+	c := newTestClient(t, func(cfg *server.Config) { cfg.MaxConcurrentExports = 1 })
+	var sessions []session
+	var locations []string
+	for _, email := range []string{"ada@example.com", "bob@example.com", "cy@example.com"} {
+		s := c.signUp(email, "password")
+		resp := c.do("POST", "/api/users/me/export", s.bearer(), nil)
+		expectStatus(t, resp, http.StatusAccepted)
+		sessions = append(sessions, s)
+		locations = append(locations, resp.Header.Get("Location"))
+	}
+
+	for i, s := range sessions {
+		var resp *http.Response
+		waitFor(t, "the export to finish", &c.store.changed, func() bool {
+			resp = c.do("GET", locations[i], s.bearer(), nil)
+			return resp.StatusCode != http.StatusAccepted
+		})
+		expectStatus(t, resp, http.StatusOK)
+		archive, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive))); err != nil {
+			t.Errorf("reading archive %d: %v", i, err)
+		}
+	}
+}
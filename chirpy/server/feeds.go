@@ -0,0 +1,232 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// feedSize is how many of the newest chirps a feed carries.
+const feedSize = 50
+
+const (
+	atomContentType = "application/atom+xml; charset=utf-8"
+	rssContentType  = "application/rss+xml; charset=utf-8"
+)
+
+// feed is what both formats are rendered from. Chirps are newest first.
+type feed struct {
+	title   string
+	self    string
+	chirps  []database.GetRecentChirpsRow
+	updated time.Time
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    atomAuthor  `xml:"author"`
+	Link      atomLink    `xml:"link"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// authorName is how a feed credits a chirp's author: their handle, if they
+// have claimed one.
+func authorName(handle sql.NullString) string {
+	if !handle.Valid {
+		return "a Chirpy user"
+	}
+	return "@" + handle.String
+}
+
+// newFeed wraps chirps from GetRecentChirps. An empty feed is dated since.
+func newFeed(title, self string, chirps []database.GetRecentChirpsRow, since time.Time) feed {
+	f := feed{title: title, self: self, chirps: chirps, updated: since}
+	for _, chirp := range chirps {
+		if chirp.UpdatedAt.Time.After(f.updated) {
+			f.updated = chirp.UpdatedAt.Time
+		}
+	}
+	return f
+}
+
+func (f feed) atom(base string) atomFeed {
+	out := atomFeed{
+		ID:      base + f.self,
+		Title:   f.title,
+		Updated: f.updated.UTC().Format(time.RFC3339),
+		Link:    atomLink{Rel: "self", Href: base + f.self},
+		Entries: []atomEntry{},
+	}
+	for _, chirp := range f.chirps {
+		out.Entries = append(out.Entries, atomEntry{
+			ID:        "urn:uuid:" + chirp.ID.String(),
+			Title:     chirp.Body,
+			Published: chirp.CreatedAt.Time.UTC().Format(time.RFC3339),
+			Updated:   chirp.UpdatedAt.Time.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: authorName(chirp.AuthorHandle)},
+			Link:      atomLink{Rel: "alternate", Href: base + "/api/chirps/" + chirp.ID.String()},
+			Content:   atomContent{Type: "text", Body: chirp.Body},
+		})
+	}
+	return out
+}
+
+func (f feed) rss(base string) rssFeed {
+	out := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         f.title,
+			Link:          base + f.self,
+			Description:   f.title,
+			LastBuildDate: f.updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+	for _, chirp := range f.chirps {
+		out.Channel.Items = append(out.Channel.Items, rssItem{
+			Title:       chirp.Body,
+			Link:        base + "/api/chirps/" + chirp.ID.String(),
+			Description: chirp.Body,
+			GUID:        rssGUID{Value: "urn:uuid:" + chirp.ID.String()},
+			PubDate:     chirp.CreatedAt.Time.UTC().Format(time.RFC1123Z),
+		})
+	}
+	return out
+}
+
+// serveFeed renders f as RSS for paths ending in .rss and as Atom otherwise,
+// with absolute links under the configured public URL. The strong ETag is a
+// hash of the document, so it changes with any chirp in it. There is no
+// Last-Modified: deleting the newest chirp makes a feed older. A private feed,
+// filtered for a signed-in reader, is kept out of shared caches.
+func (cfg *apiConfig) serveFeed(w http.ResponseWriter, r *http.Request, f feed, private bool) {
+	var doc any
+	contentType := atomContentType
+	if strings.HasSuffix(r.URL.Path, ".rss") {
+		doc, contentType = f.rss(cfg.publicURL), rssContentType
+	} else {
+		doc = f.atom(cfg.publicURL)
+	}
+	body, err := xml.Marshal(doc)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't encode feed", err)
+		return
+	}
+	body = append([]byte(xml.Header), body...)
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	if private {
+		w.Header().Set("Cache-Control", viewerCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", chirpCacheControl)
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+// handleChirpsFeed is the global timeline as a feed. Like the chirp list, it
+// leaves out users a signed-in reader has blocked or muted, or who blocked
+// them.
+func (cfg *apiConfig) handleChirpsFeed(w http.ResponseWriter, r *http.Request) {
+	viewerID, ok := cfg.optionalViewer(w, r)
+	if !ok {
+		return
+	}
+	chirps, err := cfg.dbQueries.GetRecentChirps(r.Context(), database.GetRecentChirpsParams{ViewerID: viewerID, PageSize: feedSize})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't get chirps", err)
+		return
+	}
+	cfg.serveFeed(w, r, newFeed("Chirpy", r.URL.Path, chirps, time.Unix(0, 0)), viewerID.Valid)
+}
+
+// handleUserFeed is one user's visible chirps as a feed. Deleted accounts are
+// not found, though anonymized chirps stay in the global feed.
+func (cfg *apiConfig) handleUserFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := parseUUIDPathValue(w, r, "userID")
+	if !ok {
+		return
+	}
+	viewerID, ok := cfg.optionalViewer(w, r)
+	if !ok {
+		return
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err == nil && user.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		respondWithLookupError(w, r, "User", err)
+		return
+	}
+	chirps, err := cfg.dbQueries.GetRecentChirps(r.Context(), database.GetRecentChirpsParams{
+		UserID:   uuid.NullUUID{UUID: user.ID, Valid: true},
+		ViewerID: viewerID,
+		PageSize: feedSize,
+	})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't get chirps", err)
+		return
+	}
+	cfg.serveFeed(w, r, newFeed("Chirps by "+authorName(user.Handle), r.URL.Path, chirps, user.CreatedAt.Time), viewerID.Valid)
+}
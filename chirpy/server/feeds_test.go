@@ -0,0 +1,106 @@
+package server_test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+func TestFeeds(t *testing.T) {
+	c := newTestClient(t, func(cfg *server.Config) { cfg.PublicURL = "https://chirpy.example/" })
+	ada := c.signUp("ada@example.com", "password")
+	bob := c.signUp("bob@example.com", "password")
+	expectStatus(t, c.do("PUT", "/api/users/me/profile", ada.bearer(), map[string]string{"handle": "ada"}), http.StatusOK)
+	first := c.createChirp(ada, `Fish & <chips> "tonight"`)
+	c.createChirp(bob, "bob's")
+	second := c.createChirp(ada, "second]]>")
+
+	type atomDoc struct {
+		ID    string `xml:"id"`
+		Links []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+		Title   string `xml:"title"`
+		Entries []struct {
+			ID      string `xml:"id"`
+			Author  string `xml:"author>name"`
+			Content string `xml:"content"`
+			Link    struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	fetch := func(path, contentType string, dst any) *http.Response {
+		t.Helper()
+		// The configured URL wins over whatever host the request names.
+		resp := c.get(path, http.Header{"X-Forwarded-Proto": {"http"}})
+		expectStatus(t, resp, http.StatusOK)
+		if got := resp.Header.Get("Content-Type"); got != contentType {
+			t.Errorf("%s: expected Content-Type %q, got %q", path, contentType, got)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if !strings.HasPrefix(string(body), "<?xml") {
+			t.Errorf("%s: expected an XML declaration, got %.40q", path, body)
+		}
+		if err := xml.Unmarshal(body, dst); err != nil {
+			t.Fatalf("%s is not valid XML: %v\n%s", path, err, body)
+		}
+		return resp
+	}
+
+	var atom atomDoc
+	userFeed := "/users/" + ada.ID.String() + "/feed.atom"
+	resp := fetch(userFeed, "application/atom+xml; charset=utf-8", &atom)
+	if len(atom.Entries) != 2 || atom.Entries[0].ID != "urn:uuid:"+second.ID.String() {
+		t.Fatalf("expected ada's two chirps newest first, got %+v", atom.Entries)
+	}
+	if atom.Title != "Chirps by @ada" || atom.Entries[0].Author != "@ada" {
+		t.Errorf("expected ada to be credited by handle, got %q and %q", atom.Title, atom.Entries[0].Author)
+	}
+	if got := atom.Entries[1].Content; got != first.Body {
+		t.Errorf("expected the body to survive escaping, got %q", got)
+	}
+	if href := atom.Entries[1].Link.Href; href != "https://chirpy.example/api/chirps/"+first.ID.String() {
+		t.Errorf("expected an absolute chirp link, got %q", href)
+	}
+
+	// The compression middleware weakens the ETag of the gzipped feed.
+	etag := resp.Header.Get("ETag")
+	if etag == "" || resp.Header.Get("Last-Modified") != "" {
+		t.Errorf("expected an ETag and no Last-Modified, got %q and %q", etag, resp.Header.Get("Last-Modified"))
+	}
+	expectStatus(t, c.get(userFeed, http.Header{"If-None-Match": {etag}}), http.StatusNotModified)
+	c.createChirp(ada, "third")
+	resp = c.get(userFeed, http.Header{"If-None-Match": {etag}})
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("ETag") == etag {
+		t.Error("expected the ETag to change with a new chirp")
+	}
+
+	var rss struct {
+		Version string `xml:"version,attr"`
+		Items   []struct {
+			Title       string `xml:"title"`
+			Description string `xml:"description"`
+			GUID        string `xml:"guid"`
+		} `xml:"channel>item"`
+	}
+	fetch("/chirps/feed.rss", "application/rss+xml; charset=utf-8", &rss)
+	if rss.Version != "2.0" || len(rss.Items) != 4 || rss.Items[0].Title != "third" || rss.Items[3].Description != first.Body {
+		t.Errorf("expected every chirp newest first, got %+v", rss)
+	}
+	var global atomDoc
+	fetch("/chirps/feed.atom", "application/atom+xml; charset=utf-8", &global)
+	if len(global.Entries) != 4 || global.ID != "https://chirpy.example/chirps/feed.atom" || global.Entries[2].Author != "a Chirpy user" {
+		t.Errorf("expected every chirp in the global Atom feed, got %+v", global)
+	}
+
+	expectProblem(t, c.do("GET", "/users/"+uuid.NewString()+"/feed.rss", "", nil), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("GET", "/users/nope/feed.atom", "", nil), http.StatusBadRequest, "invalid_id")
+}
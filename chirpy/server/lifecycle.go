@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"fmt"
+)
+
+// goWorker runs fn in the background until the server shuts down. fn must
+// return promptly once ctx is done; Shutdown waits for it. loggerFromContext
+// returns cfg.logger under ctx, so code shared with handlers logs there too.
+// Once Shutdown has begun it starts nothing and returns false.
+func (cfg *apiConfig) goWorker(fn func(ctx context.Context)) bool {
+	// Holding workersMu keeps Add from racing with the Wait in shutdown.
+	cfg.workersMu.Lock()
+	defer cfg.workersMu.Unlock()
+	if cfg.stopping {
+		return false
+	}
+	cfg.workers.Add(1)
+	ctx := context.WithValue(cfg.done, requestLogContextKey, &requestLog{logger: cfg.logger})
+	go func() {
+		defer cfg.workers.Done()
+		fn(ctx)
+	}()
+	return true
+}
+
+func (cfg *apiConfig) shutdown(ctx context.Context) error {
+	cfg.workersMu.Lock()
+	cfg.stopping = true
+	cfg.workersMu.Unlock()
+	cfg.stop()
+
+	finished := make(chan struct{})
+	go func() {
+		cfg.workers.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for background workers: %w", ctx.Err())
+	}
+}
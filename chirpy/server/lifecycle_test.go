@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdownStopsWorkers(t *testing.T) {
+	srv := New(Config{JWTSecret: "secret", PolkaKey: "key"}, nil)
+
+	stopped := make(chan struct{})
+	srv.api.goWorker(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("Shutdown returned before the worker exited")
+	}
+	if srv.api.goWorker(func(context.Context) { t.Error("worker started after Shutdown") }) {
+		t.Error("expected goWorker to refuse once shut down")
+	}
+}
+
+func TestGoWorkerDuringShutdown(t *testing.T) {
+	srv := New(Config{JWTSecret: "secret", PolkaKey: "key"}, nil)
+	var started sync.WaitGroup
+	for range 50 {
+		started.Add(1)
+		go func() {
+			defer started.Done()
+			srv.api.goWorker(func(ctx context.Context) { <-ctx.Done() })
+		}()
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	started.Wait()
+}
+
+func TestShutdownGivesUpOnStuckWorkers(t *testing.T) {
+	srv := New(Config{JWTSecret: "secret", PolkaKey: "key"}, nil)
+	release := make(chan struct{})
+	srv.api.goWorker(func(context.Context) { <-release })
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
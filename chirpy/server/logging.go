@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/logging"
+	"github.com/djblackett/chirpy/internal/tracing"
+	"github.com/google/uuid"
+)
+
+const logLevelHeader = "X-Log-Level"
+
+// requestLog is the per-request logging state. Handlers record the caller once
+// they've authenticated them, and the error code if they fail, so the access
+// log line carries both.
+type requestLog struct {
+	logger    *slog.Logger
+	userID    uuid.UUID
+	errorCode string
+}
+
+// middlewareAccessLog gives every request a logger tagged with its request ID
+// and writes one access log line when it finishes. It must run inside
+// middlewareRequestID.
+func (cfg *apiConfig) middlewareAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := cfg.logger.With("request_id", requestIDFromContext(r.Context()))
+		if sc := tracing.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID.String())
+		}
+		if cfg.logLevelHeader {
+			var level slog.Level
+			if err := level.UnmarshalText([]byte(r.Header.Get(logLevelHeader))); err == nil {
+				logger = logging.WithLevel(logger, level)
+			}
+		}
+		rl := &requestLog{logger: logger}
+		req, matched := trackRoute(r.WithContext(context.WithValue(r.Context(), requestLogContextKey, rl)))
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req)
+
+		status := rec.statusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", matched.pattern),
+			slog.Int("status", status),
+			slog.Int("bytes", rec.size),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		}
+		if rl.errorCode != "" {
+			attrs = append(attrs, slog.String("error_code", rl.errorCode))
+		}
+		// rl.logger carries user_id once the handler authenticated the caller.
+		rl.logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// loggerFromContext returns the request's logger, or the server-wide default
+// outside a request.
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if rl, ok := ctx.Value(requestLogContextKey).(*requestLog); ok {
+		return rl.logger
+	}
+	return slog.Default()
+}
+
+// setRequestUser tags the rest of the request's log lines with the caller's ID.
+func setRequestUser(ctx context.Context, userID uuid.UUID) {
+	if rl, ok := ctx.Value(requestLogContextKey).(*requestLog); ok && rl.userID != userID {
+		rl.userID = userID
+		rl.logger = rl.logger.With("user_id", userID)
+	}
+}
+
+func setRequestErrorCode(ctx context.Context, code string) {
+	if rl, ok := ctx.Value(requestLogContextKey).(*requestLog); ok {
+		rl.errorCode = code
+	}
+}
@@ -0,0 +1,101 @@
+package server_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	c := newTestClient(t)
+	req, err := http.NewRequest("GET", c.srv.URL+"/api/chirps/not-a-uuid", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-ID", "abc-123")
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	problem := expectProblem(t, resp, http.StatusBadRequest, "invalid_id")
+	if problem.RequestID != "abc-123" {
+		t.Errorf("expected propagated request ID, got %q", problem.RequestID)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	c := newTestClient(t)
+	s := c.signUp("walt@example.com", "cook")
+	chirp := c.createChirp(s, "Say my name")
+	resp := c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil)
+	requestID := resp.Header.Get("X-Request-ID")
+
+	var created, fetched map[string]any
+	for _, line := range c.logs.lines(t) {
+		if line["msg"] != "request" {
+			continue
+		}
+		switch line["route"] {
+		case "POST /api/chirps":
+			created = line
+		case "GET /api/chirps/{chirpID}":
+			fetched = line
+		}
+	}
+	if created == nil || fetched == nil {
+		t.Fatalf("expected access log lines for both requests, got %v", c.logs.lines(t))
+	}
+	if created["user_id"] != s.ID.String() || created["status"] != float64(http.StatusCreated) || created["level"] != "INFO" {
+		t.Errorf("unexpected access log line: %v", created)
+	}
+	if fetched["request_id"] != requestID || fetched["path"] != "/api/chirps/"+chirp.ID.String() {
+		t.Errorf("expected request ID %q and path, got %v", requestID, fetched)
+	}
+	if _, ok := fetched["user_id"]; ok {
+		t.Errorf("expected no user_id on an anonymous request, got %v", fetched)
+	}
+
+	logs := fmt.Sprint(c.logs.lines(t))
+	for _, secret := range []string{s.Token, s.RefreshToken, testPolkaKey} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("logs leak %q", secret)
+		}
+	}
+}
+
+func TestPerRequestLogLevel(t *testing.T) {
+	c := newTestClient(t)
+	send := func(level string) string {
+		req, err := http.NewRequest("POST", c.srv.URL+"/api/users", strings.NewReader("{not json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if level != "" {
+			req.Header.Set("X-Log-Level", level)
+		}
+		resp, err := c.srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		expectStatus(t, resp, http.StatusBadRequest)
+		return resp.Header.Get("X-Request-ID")
+	}
+	quiet := send("")
+	verbose := send("debug")
+
+	debugLines := map[any]bool{}
+	for _, line := range c.logs.lines(t) {
+		if line["level"] == "DEBUG" {
+			debugLines[line["request_id"]] = true
+		}
+		if line["msg"] == "request" && line["level"] != "WARN" {
+			t.Errorf("expected 4xx access log lines at WARN, got %v", line)
+		}
+	}
+	if debugLines[quiet] || !debugLines[verbose] {
+		t.Errorf("expected debug lines only for the X-Log-Level request, got %v", debugLines)
+	}
+}
@@ -0,0 +1,1666 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/server"
+	"github.com/djblackett/chirpy/server/storetest"
+	"github.com/google/uuid"
+)
+
+// memStore is an in-memory server.Store that mirrors the semantics of the SQL
+// queries closely enough for the end-to-end tests.
+type memStore struct {
+	mu sync.Mutex
+	memTables
+	// changed fires on writes, so tests can wait on background workers.
+	changed broadcast
+	// exportDelay slows each ListChirpsForExport page, for tests of long
+	// exports. Set it before serving.
+	exportDelay time.Duration
+}
+
+// uniqueViolation is the error Postgres returns for a duplicate key, down to
+// the SQLSTATE database.IsUniqueViolation checks.
+type uniqueViolation string
+
+func (e uniqueViolation) Error() string {
+	return `duplicate key value violates unique constraint "` + string(e) + `"`
+}
+
+func (uniqueViolation) SQLState() string { return "23505" }
+
+// exportChunkKey is the primary key of data_export_chunks.
+type exportChunkKey struct {
+	exportID uuid.UUID
+	seq      int32
+}
+
+// memTables is everything memStore holds, split out so InTx can copy it.
+type memTables struct {
+	now           time.Time
+	users         map[uuid.UUID]database.User
+	chirps        map[uuid.UUID]database.Chirp
+	refreshTokens map[string]database.RefreshToken
+	reports       map[uuid.UUID]database.ChirpReport
+	actions       []database.ModerationAction
+	exports       map[uuid.UUID]database.DataExport
+	exportChunks  map[exportChunkKey][]byte
+	subEvents     []database.SubscriptionEvent
+	endpoints     map[uuid.UUID]database.WebhookEndpoint
+	deliveries    map[uuid.UUID]database.WebhookDelivery
+	avatars       map[uuid.UUID]database.UserAvatar
+	conversations map[uuid.UUID]database.Conversation
+	participants  []database.ConversationParticipant
+	messages      map[uuid.UUID]database.Message
+	msgDeletions  map[[2]uuid.UUID]bool
+	relationships []database.UserRelationship
+	follows       []database.UserFollow
+}
+
+func (t memTables) clone() memTables {
+	t.users = maps.Clone(t.users)
+	t.chirps = maps.Clone(t.chirps)
+	t.refreshTokens = maps.Clone(t.refreshTokens)
+	t.reports = maps.Clone(t.reports)
+	t.actions = slices.Clone(t.actions)
+	t.exports = maps.Clone(t.exports)
+	t.exportChunks = maps.Clone(t.exportChunks)
+	t.subEvents = slices.Clone(t.subEvents)
+	t.endpoints = maps.Clone(t.endpoints)
+	t.deliveries = maps.Clone(t.deliveries)
+	t.avatars = maps.Clone(t.avatars)
+	t.conversations = maps.Clone(t.conversations)
+	t.participants = slices.Clone(t.participants)
+	t.messages = maps.Clone(t.messages)
+	t.msgDeletions = maps.Clone(t.msgDeletions)
+	t.relationships = slices.Clone(t.relationships)
+	t.follows = slices.Clone(t.follows)
+	return t
+}
+
+var _ server.Store = (*memStore)(nil)
+
+func newMemStore() *memStore {
+	return &memStore{memTables: memTables{
+		now:           time.Now().UTC().Truncate(time.Millisecond),
+		users:         map[uuid.UUID]database.User{},
+		chirps:        map[uuid.UUID]database.Chirp{},
+		refreshTokens: map[string]database.RefreshToken{},
+		reports:       map[uuid.UUID]database.ChirpReport{},
+		exports:       map[uuid.UUID]database.DataExport{},
+		exportChunks:  map[exportChunkKey][]byte{},
+		endpoints:     map[uuid.UUID]database.WebhookEndpoint{},
+		deliveries:    map[uuid.UUID]database.WebhookDelivery{},
+		avatars:       map[uuid.UUID]database.UserAvatar{},
+		conversations: map[uuid.UUID]database.Conversation{},
+		messages:      map[uuid.UUID]database.Message{},
+		msgDeletions:  map[[2]uuid.UUID]bool{},
+	}}
+}
+
+// InTx runs fn and, if it fails, puts everything back as it was. That also
+// undoes writes other goroutines made meanwhile, which no test relies on.
+func (s *memStore) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.mu.Lock()
+	saved := s.memTables.clone()
+	s.mu.Unlock()
+	if err := fn(ctx); err != nil {
+		s.mu.Lock()
+		now := s.now
+		s.memTables = saved
+		s.now = now
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// tick returns a strictly increasing timestamp so ordering by created_at is
+// deterministic. Every write that takes a timestamp goes through it, so it
+// also announces the change.
+func (s *memStore) tick() time.Time {
+	s.changed.notify()
+	s.now = s.now.Add(time.Millisecond)
+	return s.now
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: true}
+}
+
+func (s *memStore) isVisible(chirp database.Chirp) bool {
+	if chirp.HiddenAt.Valid || chirp.PublishAt.Valid {
+		return false
+	}
+	author := s.users[chirp.UserID]
+	if author.BannedAt.Valid {
+		return false
+	}
+	return !author.SuspendedUntil.Valid || !author.SuspendedUntil.Time.After(time.Now())
+}
+
+func (s *memStore) sortedChirps(keep func(database.Chirp) bool) []database.Chirp {
+	var chirps []database.Chirp
+	for _, chirp := range s.chirps {
+		if keep(chirp) {
+			chirps = append(chirps, chirp)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirps[i].CreatedAt.Time.Before(chirps[j].CreatedAt.Time)
+	})
+	return chirps
+}
+
+func (s *memStore) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.tick()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		Body:      arg.Body,
+		CreatedAt: nullTime(now),
+		UpdatedAt: nullTime(now),
+		UserID:    arg.UserID,
+		PublishAt: arg.PublishAt,
+	}
+	s.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+// hiddenFrom reports whether the viewer has blocked or muted the author, or
+// the author has blocked the viewer.
+func (s *memStore) hiddenFrom(viewerID uuid.NullUUID, authorID uuid.UUID) bool {
+	if !viewerID.Valid {
+		return false
+	}
+	for _, rel := range s.relationships {
+		if rel.UserID == viewerID.UUID && rel.TargetID == authorID {
+			return true
+		}
+		if rel.UserID == authorID && rel.TargetID == viewerID.UUID && rel.Kind == "block" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memStore) GetChirps(ctx context.Context, viewerID uuid.NullUUID) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedChirps(func(chirp database.Chirp) bool {
+		return s.isVisible(chirp) && !s.hiddenFrom(viewerID, chirp.UserID)
+	}), nil
+}
+
+func (s *memStore) GetChirpsByUserID(ctx context.Context, arg database.GetChirpsByUserIDParams) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedChirps(func(chirp database.Chirp) bool {
+		return chirp.UserID == arg.UserID && s.isVisible(chirp) && !s.hiddenFrom(arg.ViewerID, chirp.UserID)
+	}), nil
+}
+
+func (s *memStore) GetRecentChirps(ctx context.Context, arg database.GetRecentChirpsParams) ([]database.GetRecentChirpsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirps := s.sortedChirps(func(chirp database.Chirp) bool {
+		return (!arg.UserID.Valid || chirp.UserID == arg.UserID.UUID) && s.isVisible(chirp) && !s.hiddenFrom(arg.ViewerID, chirp.UserID)
+	})
+	slices.Reverse(chirps)
+	var rows []database.GetRecentChirpsRow
+	for _, chirp := range chirps[:min(len(chirps), int(arg.PageSize))] {
+		rows = append(rows, database.GetRecentChirpsRow{
+			ID:           chirp.ID,
+			Body:         chirp.Body,
+			CreatedAt:    chirp.CreatedAt,
+			UpdatedAt:    chirp.UpdatedAt,
+			UserID:       chirp.UserID,
+			HiddenAt:     chirp.HiddenAt,
+			PublishAt:    chirp.PublishAt,
+			AuthorHandle: s.users[chirp.UserID].Handle,
+		})
+	}
+	return rows, nil
+}
+
+func (s *memStore) GetAllChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedChirps(func(chirp database.Chirp) bool {
+		return chirp.UserID == userID
+	}), nil
+}
+
+func (s *memStore) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirp, ok := s.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (s *memStore) GetVisibleChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirp, ok := s.chirps[id]
+	if !ok || !s.isVisible(chirp) {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (s *memStore) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.chirps, id)
+	for reportID, report := range s.reports {
+		if report.ChirpID == id {
+			delete(s.reports, reportID)
+		}
+	}
+	return nil
+}
+
+func (s *memStore) ImportChirps(ctx context.Context, arg database.ImportChirpsParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, userID := range arg.UserIds {
+		if _, ok := s.users[userID]; !ok {
+			return 0, errors.New(`insert or update on table "chirps" violates foreign key constraint "chirps_user_id_fkey"`)
+		}
+	}
+	var inserted int64
+	for i, id := range arg.Ids {
+		if _, ok := s.chirps[id]; ok {
+			continue
+		}
+		s.chirps[id] = database.Chirp{
+			ID:        id,
+			Body:      arg.Bodies[i],
+			CreatedAt: nullTime(arg.CreatedAts[i]),
+			UpdatedAt: nullTime(arg.UpdatedAts[i]),
+			UserID:    arg.UserIds[i],
+		}
+		inserted++
+	}
+	return inserted, nil
+}
+
+func (s *memStore) ListChirpsForExport(ctx context.Context, arg database.ListChirpsForExportParams) ([]database.Chirp, error) {
+	time.Sleep(s.exportDelay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirps := s.sortedChirps(func(chirp database.Chirp) bool {
+		created := chirp.CreatedAt.Time
+		switch {
+		case chirp.HiddenAt.Valid,
+			chirp.PublishAt.Valid,
+			arg.UserID.Valid && chirp.UserID != arg.UserID.UUID,
+			arg.Since.Valid && created.Before(arg.Since.Time),
+			arg.Until.Valid && !created.Before(arg.Until.Time),
+			created.Before(arg.AfterCreatedAt),
+			created.Equal(arg.AfterCreatedAt) && bytes.Compare(chirp.ID[:], arg.AfterID[:]) <= 0:
+			return false
+		}
+		return true
+	})
+	sort.SliceStable(chirps, func(i, j int) bool {
+		a, b := chirps[i], chirps[j]
+		if !a.CreatedAt.Time.Equal(b.CreatedAt.Time) {
+			return a.CreatedAt.Time.Before(b.CreatedAt.Time)
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	})
+	if len(chirps) > int(arg.PageSize) {
+		chirps = chirps[:arg.PageSize]
+	}
+	return chirps, nil
+}
+
+func (s *memStore) ListScheduledChirps(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirps := s.sortedChirps(func(chirp database.Chirp) bool {
+		return chirp.UserID == userID && chirp.PublishAt.Valid
+	})
+	sort.SliceStable(chirps, func(i, j int) bool {
+		return chirps[i].PublishAt.Time.Before(chirps[j].PublishAt.Time)
+	})
+	return chirps, nil
+}
+
+func (s *memStore) RescheduleChirp(ctx context.Context, arg database.RescheduleChirpParams) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirp, ok := s.chirps[arg.ID]
+	if !ok || !chirp.PublishAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	chirp.PublishAt = nullTime(arg.PublishAt)
+	chirp.UpdatedAt = nullTime(s.tick())
+	s.chirps[arg.ID] = chirp
+	return chirp, nil
+}
+
+func (s *memStore) CancelScheduledChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirp, ok := s.chirps[id]
+	if !ok || !chirp.PublishAt.Valid {
+		return 0, nil
+	}
+	delete(s.chirps, id)
+	return 1, nil
+}
+
+// PublishDueChirps compares against the wall clock rather than tick, since
+// publish times come from the handlers.
+func (s *memStore) PublishDueChirps(ctx context.Context, batchSize int32) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var due []database.Chirp
+	for _, chirp := range s.chirps {
+		if chirp.PublishAt.Valid && !chirp.PublishAt.Time.After(now) {
+			due = append(due, chirp)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].PublishAt.Time.Before(due[j].PublishAt.Time)
+	})
+	if len(due) > int(batchSize) {
+		due = due[:batchSize]
+	}
+	for i, chirp := range due {
+		chirp.CreatedAt = chirp.PublishAt
+		chirp.UpdatedAt = chirp.PublishAt
+		chirp.PublishAt = sql.NullTime{}
+		s.chirps[chirp.ID] = chirp
+		due[i] = chirp
+	}
+	if len(due) > 0 {
+		s.changed.notify()
+	}
+	return due, nil
+}
+
+func (s *memStore) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Email == arg.Email {
+			return database.User{}, uniqueViolation("users_email_key")
+		}
+	}
+	now := s.tick()
+	user := database.User{
+		ID:             uuid.New(),
+		Email:          arg.Email,
+		CreatedAt:      nullTime(now),
+		UpdatedAt:      nullTime(now),
+		HashedPassword: arg.HashedPassword,
+		IsChirpyRed:    sql.NullBool{Bool: false, Valid: true},
+		Role:           "user",
+	}
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *memStore) DeleteUsers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = map[uuid.UUID]database.User{}
+	s.chirps = map[uuid.UUID]database.Chirp{}
+	s.refreshTokens = map[string]database.RefreshToken{}
+	s.reports = map[uuid.UUID]database.ChirpReport{}
+	s.exports = map[uuid.UUID]database.DataExport{}
+	s.exportChunks = map[exportChunkKey][]byte{}
+	s.subEvents = nil
+	s.endpoints = map[uuid.UUID]database.WebhookEndpoint{}
+	s.deliveries = map[uuid.UUID]database.WebhookDelivery{}
+	s.avatars = map[uuid.UUID]database.UserAvatar{}
+	s.conversations = map[uuid.UUID]database.Conversation{}
+	s.participants = nil
+	s.messages = map[uuid.UUID]database.Message{}
+	s.msgDeletions = map[[2]uuid.UUID]bool{}
+	s.relationships = nil
+	s.follows = nil
+	return nil
+}
+
+func (s *memStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, id)
+	for chirpID, chirp := range s.chirps {
+		if chirp.UserID == id {
+			delete(s.chirps, chirpID)
+		}
+	}
+	for reportID, report := range s.reports {
+		if _, ok := s.chirps[report.ChirpID]; !ok || report.ReporterID == id {
+			delete(s.reports, reportID)
+		}
+	}
+	for token, refreshToken := range s.refreshTokens {
+		if refreshToken.UserID == id {
+			delete(s.refreshTokens, token)
+		}
+	}
+	for exportID, export := range s.exports {
+		if export.UserID == id {
+			s.deleteExport(exportID)
+		}
+	}
+	s.subEvents = slices.DeleteFunc(s.subEvents, func(event database.SubscriptionEvent) bool {
+		return event.UserID == id
+	})
+	s.deleteWebhookEndpoints(func(endpoint database.WebhookEndpoint) bool { return endpoint.UserID == id })
+	delete(s.avatars, id)
+	s.participants = slices.DeleteFunc(s.participants, func(participant database.ConversationParticipant) bool {
+		return participant.UserID == id
+	})
+	for messageID, message := range s.messages {
+		if message.SenderID == id {
+			delete(s.messages, messageID)
+		}
+	}
+	for key := range s.msgDeletions {
+		if _, ok := s.messages[key[1]]; !ok || key[0] == id {
+			delete(s.msgDeletions, key)
+		}
+	}
+	s.relationships = slices.DeleteFunc(s.relationships, func(rel database.UserRelationship) bool {
+		return rel.UserID == id || rel.TargetID == id
+	})
+	s.follows = slices.DeleteFunc(s.follows, func(follow database.UserFollow) bool {
+		return follow.FollowerID == id || follow.FolloweeID == id
+	})
+	return nil
+}
+
+func (s *memStore) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *memStore) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+// updateUser applies fn to the stored user and bumps updated_at.
+func (s *memStore) updateUser(id uuid.UUID, fn func(*database.User)) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	fn(&user)
+	user.UpdatedAt = nullTime(s.tick())
+	s.users[id] = user
+	return user, nil
+}
+
+func (s *memStore) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	s.mu.Lock()
+	for _, user := range s.users {
+		if user.ID != arg.ID && user.Email == arg.Email {
+			s.mu.Unlock()
+			return database.User{}, uniqueViolation("users_email_key")
+		}
+	}
+	s.mu.Unlock()
+	return s.updateUser(arg.ID, func(user *database.User) {
+		user.Email = arg.Email
+		user.HashedPassword = arg.HashedPassword
+	})
+}
+
+func (s *memStore) UpgradeUserToRed(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return s.updateUser(id, func(user *database.User) {
+		user.IsChirpyRed = sql.NullBool{Bool: true, Valid: true}
+	})
+}
+
+func (s *memStore) AnonymizeUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return s.updateUser(id, func(user *database.User) {
+		user.DeletedAt = nullTime(s.now)
+		user.Email = "deleted-" + id.String() + "@deleted.invalid"
+		user.HashedPassword = ""
+		user.IsChirpyRed = sql.NullBool{Bool: false, Valid: true}
+		user.Role = "user"
+		user.Handle = sql.NullString{}
+		user.DisplayName = ""
+		user.Bio = ""
+	})
+}
+
+func (s *memStore) GetUserByHandle(ctx context.Context, handle string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Handle.Valid && strings.EqualFold(user.Handle.String, handle) {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *memStore) UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.User, error) {
+	s.mu.Lock()
+	for _, user := range s.users {
+		if user.ID != arg.ID && user.Handle.Valid && strings.EqualFold(user.Handle.String, arg.Handle) {
+			s.mu.Unlock()
+			return database.User{}, uniqueViolation("users_handle_key")
+		}
+	}
+	s.mu.Unlock()
+	return s.updateUser(arg.ID, func(user *database.User) {
+		user.Handle = sql.NullString{String: arg.Handle, Valid: true}
+		user.DisplayName = arg.DisplayName
+		user.Bio = arg.Bio
+	})
+}
+
+func (s *memStore) GetUserProfile(ctx context.Context, handle string) (database.GetUserProfileRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if !user.Handle.Valid || !strings.EqualFold(user.Handle.String, handle) || user.DeletedAt.Valid || user.BannedAt.Valid {
+			continue
+		}
+		profile := database.GetUserProfileRow{
+			ID:          user.ID,
+			Handle:      user.Handle,
+			DisplayName: user.DisplayName,
+			Bio:         user.Bio,
+			CreatedAt:   user.CreatedAt,
+		}
+		for _, chirp := range s.chirps {
+			if chirp.UserID == user.ID && s.isVisible(chirp) {
+				profile.ChirpCount++
+			}
+		}
+		for _, follow := range s.follows {
+			follower := s.users[follow.FollowerID]
+			if follow.FolloweeID == user.ID && !follower.DeletedAt.Valid && !follower.BannedAt.Valid {
+				profile.FollowerCount++
+			}
+		}
+		if avatar, ok := s.avatars[user.ID]; ok {
+			profile.AvatarUpdatedAt = nullTime(avatar.UpdatedAt)
+		}
+		return profile, nil
+	}
+	return database.GetUserProfileRow{}, sql.ErrNoRows
+}
+
+func (s *memStore) SetUserAvatar(ctx context.Context, arg database.SetUserAvatarParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.avatars[arg.UserID] = database.UserAvatar{
+		UserID:      arg.UserID,
+		ContentType: arg.ContentType,
+		Image:       slices.Clone(arg.Image),
+		UpdatedAt:   s.tick(),
+	}
+	return nil
+}
+
+func (s *memStore) GetUserAvatar(ctx context.Context, userID uuid.UUID) (database.UserAvatar, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	avatar, ok := s.avatars[userID]
+	if !ok {
+		return database.UserAvatar{}, sql.ErrNoRows
+	}
+	return avatar, nil
+}
+
+func (s *memStore) DeleteUserAvatar(ctx context.Context, userID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.avatars[userID]; !ok {
+		return 0, nil
+	}
+	delete(s.avatars, userID)
+	return 1, nil
+}
+
+func (s *memStore) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.User, error) {
+	return s.updateUser(arg.ID, func(user *database.User) {
+		user.Role = arg.Role
+	})
+}
+
+func (s *memStore) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.tick()
+	s.refreshTokens[arg.Token] = database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: nullTime(now),
+		UpdatedAt: nullTime(now),
+		UserID:    arg.UserID,
+		ExpiresAt: now.Add(time.Duration(arg.ExpiresInSeconds) * time.Second),
+	}
+	return nil
+}
+
+func (s *memStore) GetUserByRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, ok := s.refreshTokens[token]
+	if !ok || refreshToken.RevokedAt.Valid || !refreshToken.ExpiresAt.After(time.Now()) {
+		return uuid.Nil, sql.ErrNoRows
+	}
+	return refreshToken.UserID, nil
+}
+
+func (s *memStore) RevokeRefreshToken(ctx context.Context, token string) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken, ok := s.refreshTokens[token]
+	if !ok {
+		return uuid.Nil, sql.ErrNoRows
+	}
+	now := s.tick()
+	refreshToken.RevokedAt = nullTime(now)
+	refreshToken.UpdatedAt = nullTime(now)
+	s.refreshTokens[token] = refreshToken
+	return refreshToken.UserID, nil
+}
+
+func (s *memStore) ListRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tokens []database.RefreshToken
+	for _, refreshToken := range s.refreshTokens {
+		if refreshToken.UserID == userID {
+			tokens = append(tokens, refreshToken)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Time.Before(tokens[j].CreatedAt.Time)
+	})
+	return tokens, nil
+}
+
+func (s *memStore) RevokeRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.tick()
+	for token, refreshToken := range s.refreshTokens {
+		if refreshToken.UserID == userID && !refreshToken.RevokedAt.Valid {
+			refreshToken.RevokedAt = nullTime(now)
+			refreshToken.UpdatedAt = nullTime(now)
+			s.refreshTokens[token] = refreshToken
+		}
+	}
+	return nil
+}
+
+func (s *memStore) CreateChirpReport(ctx context.Context, arg database.CreateChirpReportParams) (database.ChirpReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, report := range s.reports {
+		if report.ChirpID == arg.ChirpID && report.ReporterID == arg.ReporterID {
+			return database.ChirpReport{}, uniqueViolation("chirp_reports_chirp_id_reporter_id_key")
+		}
+	}
+	report := database.ChirpReport{
+		ID:         uuid.New(),
+		ChirpID:    arg.ChirpID,
+		ReporterID: arg.ReporterID,
+		Reason:     arg.Reason,
+		Details:    arg.Details,
+		Status:     "open",
+		CreatedAt:  s.tick(),
+	}
+	s.reports[report.ID] = report
+	return report, nil
+}
+
+func (s *memStore) ListOpenChirpReports(ctx context.Context) ([]database.ChirpReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reports []database.ChirpReport
+	for _, report := range s.reports {
+		if report.Status == "open" {
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].CreatedAt.Before(reports[j].CreatedAt)
+	})
+	return reports, nil
+}
+
+func (s *memStore) ListChirpReportsByReporter(ctx context.Context, reporterID uuid.UUID) ([]database.ChirpReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reports []database.ChirpReport
+	for _, report := range s.reports {
+		if report.ReporterID == reporterID {
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].CreatedAt.Before(reports[j].CreatedAt)
+	})
+	return reports, nil
+}
+
+func (s *memStore) ResolveChirpReports(ctx context.Context, arg database.ResolveChirpReportsParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.tick()
+	for id, report := range s.reports {
+		if report.ChirpID == arg.ChirpID && report.Status == "open" {
+			report.Status = "resolved"
+			report.ResolvedAt = nullTime(now)
+			report.ResolvedBy = arg.ResolvedBy
+			s.reports[id] = report
+		}
+	}
+	return nil
+}
+
+func (s *memStore) DismissChirpReport(ctx context.Context, arg database.DismissChirpReportParams) (database.ChirpReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report, ok := s.reports[arg.ID]
+	if !ok || report.Status != "open" {
+		return database.ChirpReport{}, sql.ErrNoRows
+	}
+	report.Status = "dismissed"
+	report.ResolvedAt = nullTime(s.tick())
+	report.ResolvedBy = arg.ResolvedBy
+	s.reports[arg.ID] = report
+	return report, nil
+}
+
+func (s *memStore) HideChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chirp, ok := s.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	now := s.tick()
+	chirp.HiddenAt = nullTime(now)
+	chirp.UpdatedAt = nullTime(now)
+	s.chirps[id] = chirp
+	return chirp, nil
+}
+
+func (s *memStore) SuspendUser(ctx context.Context, arg database.SuspendUserParams) (database.User, error) {
+	return s.updateUser(arg.ID, func(user *database.User) {
+		user.SuspendedUntil = arg.SuspendedUntil
+	})
+}
+
+func (s *memStore) BanUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return s.updateUser(id, func(user *database.User) {
+		user.BannedAt = nullTime(time.Now())
+	})
+}
+
+func (s *memStore) CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationAction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	action := database.ModerationAction{
+		ID:            uuid.New(),
+		ActorID:       arg.ActorID,
+		Action:        arg.Action,
+		TargetUserID:  arg.TargetUserID,
+		TargetChirpID: arg.TargetChirpID,
+		Reason:        arg.Reason,
+		ExpiresAt:     arg.ExpiresAt,
+		CreatedAt:     s.tick(),
+	}
+	s.actions = append(s.actions, action)
+	return action, nil
+}
+
+func (s *memStore) ListModerationActions(ctx context.Context, limit int32) ([]database.ModerationAction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var actions []database.ModerationAction
+	for i := len(s.actions) - 1; i >= 0 && len(actions) < int(limit); i-- {
+		actions = append(actions, s.actions[i])
+	}
+	return actions, nil
+}
+
+func (s *memStore) GetStatsTotals(ctx context.Context) (database.GetStatsTotalsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var totals database.GetStatsTotalsRow
+	for _, user := range s.users {
+		if user.DeletedAt.Valid {
+			continue
+		}
+		totals.Users++
+		if user.IsChirpyRed.Valid && user.IsChirpyRed.Bool {
+			totals.ChirpyRedUsers++
+		}
+	}
+	for _, chirp := range s.chirps {
+		if !chirp.PublishAt.Valid {
+			totals.Chirps++
+		}
+	}
+	for _, token := range s.refreshTokens {
+		if !token.RevokedAt.Valid && token.ExpiresAt.After(time.Now()) {
+			totals.ActiveSessions++
+		}
+	}
+	for _, report := range s.reports {
+		if report.Status == "open" {
+			totals.OpenReports++
+		}
+	}
+	return totals, nil
+}
+
+// countByDay buckets timestamps at or after since into UTC days, oldest first.
+func countByDay(times []sql.NullTime, since time.Time) (days []time.Time, counts map[time.Time]int64) {
+	counts = map[time.Time]int64{}
+	for _, t := range times {
+		if !t.Valid || t.Time.Before(since) {
+			continue
+		}
+		day := t.Time.UTC().Truncate(24 * time.Hour)
+		if counts[day] == 0 {
+			days = append(days, day)
+		}
+		counts[day]++
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, counts
+}
+
+func (s *memStore) CountSignupsByDay(ctx context.Context, since time.Time) ([]database.CountSignupsByDayRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var times []sql.NullTime
+	for _, user := range s.users {
+		times = append(times, user.CreatedAt)
+	}
+	days, counts := countByDay(times, since)
+	var rows []database.CountSignupsByDayRow
+	for _, day := range days {
+		rows = append(rows, database.CountSignupsByDayRow{Day: day, Count: counts[day]})
+	}
+	return rows, nil
+}
+
+func (s *memStore) CountChirpsByDay(ctx context.Context, since time.Time) ([]database.CountChirpsByDayRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var times []sql.NullTime
+	for _, chirp := range s.chirps {
+		if !chirp.PublishAt.Valid {
+			times = append(times, chirp.CreatedAt)
+		}
+	}
+	days, counts := countByDay(times, since)
+	var rows []database.CountChirpsByDayRow
+	for _, day := range days {
+		rows = append(rows, database.CountChirpsByDayRow{Day: day, Count: counts[day]})
+	}
+	return rows, nil
+}
+
+func (s *memStore) ListTopPosters(ctx context.Context, limit int32) ([]database.ListTopPostersRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := map[uuid.UUID]int64{}
+	for _, chirp := range s.chirps {
+		if !chirp.PublishAt.Valid && !s.users[chirp.UserID].DeletedAt.Valid {
+			counts[chirp.UserID]++
+		}
+	}
+	var rows []database.ListTopPostersRow
+	for userID, count := range counts {
+		rows = append(rows, database.ListTopPostersRow{ID: userID, Email: s.users[userID].Email, ChirpCount: count})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].ChirpCount != rows[j].ChirpCount {
+			return rows[i].ChirpCount > rows[j].ChirpCount
+		}
+		return rows[i].Email < rows[j].Email
+	})
+	if len(rows) > int(limit) {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+func (s *memStore) CreateDataExport(ctx context.Context, arg database.CreateDataExportParams) (database.DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, export := range s.exports {
+		if export.UserID == arg.UserID && export.Status == "pending" {
+			return database.DataExport{}, uniqueViolation("data_exports_pending_idx")
+		}
+	}
+	now := s.tick()
+	export := database.DataExport{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		Status:    "pending",
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(arg.ExpiresInSeconds) * time.Second),
+	}
+	s.exports[export.ID] = export
+	return export, nil
+}
+
+func (s *memStore) GetDataExport(ctx context.Context, arg database.GetDataExportParams) (database.DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	export, ok := s.exports[arg.ID]
+	if !ok || export.UserID != arg.UserID || !export.ExpiresAt.After(time.Now()) {
+		return database.DataExport{}, sql.ErrNoRows
+	}
+	return export, nil
+}
+
+func (s *memStore) CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	export, ok := s.exports[arg.ID]
+	if !ok || export.Status != "pending" {
+		return nil
+	}
+	now := s.tick()
+	export.Status = "ready"
+	export.CompletedAt = nullTime(now)
+	export.ExpiresAt = now.Add(time.Duration(arg.ExpiresInSeconds) * time.Second)
+	s.exports[arg.ID] = export
+	return nil
+}
+
+func (s *memStore) FailDataExport(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	export, ok := s.exports[id]
+	if !ok || export.Status != "pending" {
+		return nil
+	}
+	export.Status = "failed"
+	export.CompletedAt = nullTime(s.tick())
+	s.exports[id] = export
+	return nil
+}
+
+func (s *memStore) FailStaleDataExports(ctx context.Context, olderThanSeconds int32) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := s.tick().Add(-time.Duration(olderThanSeconds) * time.Second)
+	var n int64
+	for id, export := range s.exports {
+		if export.Status == "pending" && !export.CreatedAt.After(cutoff) {
+			export.Status = "failed"
+			export.CompletedAt = nullTime(s.now)
+			s.exports[id] = export
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memStore) AppendDataExportChunk(ctx context.Context, arg database.AppendDataExportChunkParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := exportChunkKey{arg.ExportID, arg.Seq}
+	if _, ok := s.exportChunks[key]; ok {
+		return uniqueViolation("data_export_chunks_pkey")
+	}
+	s.exportChunks[key] = bytes.Clone(arg.Data)
+	return nil
+}
+
+func (s *memStore) GetDataExportChunk(ctx context.Context, arg database.GetDataExportChunkParams) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.exportChunks[exportChunkKey{arg.ExportID, arg.Seq}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return data, nil
+}
+
+func (s *memStore) DeleteDataExportChunks(ctx context.Context, exportID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	maps.DeleteFunc(s.exportChunks, func(key exportChunkKey, _ []byte) bool { return key.exportID == exportID })
+	return nil
+}
+
+// deleteExport deletes an export and its chunks. s.mu must be held.
+func (s *memStore) deleteExport(id uuid.UUID) {
+	delete(s.exports, id)
+	maps.DeleteFunc(s.exportChunks, func(key exportChunkKey, _ []byte) bool { return key.exportID == id })
+}
+
+func (s *memStore) DeleteExpiredDataExports(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, export := range s.exports {
+		if !export.ExpiresAt.After(time.Now()) {
+			s.deleteExport(id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memStore) DeleteDataExportsByUserID(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, export := range s.exports {
+		if export.UserID == userID {
+			s.deleteExport(id)
+		}
+	}
+	return nil
+}
+
+func (s *memStore) CreateSubscriptionEvent(ctx context.Context, arg database.CreateSubscriptionEventParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subEvents = append(s.subEvents, database.SubscriptionEvent{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		Event:     arg.Event,
+		CreatedAt: s.tick(),
+	})
+	return nil
+}
+
+func (s *memStore) ListSubscriptionEvents(ctx context.Context, userID uuid.UUID) ([]database.SubscriptionEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []database.SubscriptionEvent
+	for _, event := range s.subEvents {
+		if event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *memStore) CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoint := database.WebhookEndpoint{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		Url:       arg.Url,
+		Secret:    arg.Secret,
+		Events:    slices.Clone(arg.Events),
+		AllUsers:  arg.AllUsers,
+		CreatedAt: s.tick(),
+	}
+	s.endpoints[endpoint.ID] = endpoint
+	return endpoint, nil
+}
+
+func (s *memStore) ListWebhookEndpoints(ctx context.Context, userID uuid.UUID) ([]database.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var endpoints []database.WebhookEndpoint
+	for _, endpoint := range s.endpoints {
+		if endpoint.UserID == userID {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].CreatedAt.Before(endpoints[j].CreatedAt)
+	})
+	return endpoints, nil
+}
+
+func (s *memStore) GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	endpoint, ok := s.endpoints[id]
+	if !ok {
+		return database.WebhookEndpoint{}, sql.ErrNoRows
+	}
+	return endpoint, nil
+}
+
+// deleteWebhookEndpoints removes matching endpoints and their deliveries, as
+// the foreign key cascade does. The caller holds s.mu.
+func (s *memStore) deleteWebhookEndpoints(match func(database.WebhookEndpoint) bool) {
+	for id, endpoint := range s.endpoints {
+		if match(endpoint) {
+			delete(s.endpoints, id)
+		}
+	}
+	for id, delivery := range s.deliveries {
+		if _, ok := s.endpoints[delivery.EndpointID]; !ok {
+			delete(s.deliveries, id)
+		}
+	}
+}
+
+func (s *memStore) DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteWebhookEndpoints(func(endpoint database.WebhookEndpoint) bool { return endpoint.ID == id })
+	return nil
+}
+
+func (s *memStore) DeleteWebhookEndpointsByUserID(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteWebhookEndpoints(func(endpoint database.WebhookEndpoint) bool { return endpoint.UserID == userID })
+	return nil
+}
+
+func (s *memStore) ListWebhookEndpointsForEvent(ctx context.Context, arg database.ListWebhookEndpointsForEventParams) ([]database.WebhookEndpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var endpoints []database.WebhookEndpoint
+	for _, endpoint := range s.endpoints {
+		if slices.Contains(endpoint.Events, arg.EventType) && (endpoint.UserID == arg.UserID || endpoint.AllUsers) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints, nil
+}
+
+// Delivery due times compare against the wall clock rather than tick, like
+// PublishDueChirps, since the worker waits on real time.
+func (s *memStore) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery := database.WebhookDelivery{
+		ID:            uuid.New(),
+		EndpointID:    arg.EndpointID,
+		EventID:       arg.EventID,
+		EventType:     arg.EventType,
+		Payload:       arg.Payload,
+		Status:        "pending",
+		NextAttemptAt: time.Now(),
+		CreatedAt:     s.tick(),
+	}
+	s.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (s *memStore) ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var due []database.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status == "pending" && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if len(due) > int(arg.BatchSize) {
+		due = due[:arg.BatchSize]
+	}
+	for i, delivery := range due {
+		delivery.Attempts++
+		delivery.NextAttemptAt = now.Add(time.Duration(arg.LeaseSeconds) * time.Second)
+		s.deliveries[delivery.ID] = delivery
+		due[i] = delivery
+	}
+	return due, nil
+}
+
+func (s *memStore) RecordWebhookAttempt(ctx context.Context, arg database.RecordWebhookAttemptParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := s.deliveries[arg.ID]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	delivery.Status = arg.Status
+	delivery.LastAttemptAt = nullTime(now)
+	delivery.ResponseStatus = arg.ResponseStatus
+	delivery.LastError = arg.LastError
+	delivery.NextAttemptAt = now.Add(time.Duration(arg.RetryInSeconds * float64(time.Second)))
+	s.deliveries[arg.ID] = delivery
+	s.changed.notify()
+	return nil
+}
+
+func (s *memStore) ListWebhookDeliveries(ctx context.Context, arg database.ListWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deliveries []database.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.EndpointID == arg.EndpointID && (!arg.Status.Valid || delivery.Status == arg.Status.String) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if len(deliveries) > int(arg.PageSize) {
+		deliveries = deliveries[:arg.PageSize]
+	}
+	return deliveries, nil
+}
+
+func (s *memStore) GetWebhookDelivery(ctx context.Context, arg database.GetWebhookDeliveryParams) (database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := s.deliveries[arg.ID]
+	if !ok || delivery.EndpointID != arg.EndpointID {
+		return database.WebhookDelivery{}, sql.ErrNoRows
+	}
+	return delivery, nil
+}
+
+func (s *memStore) RetryWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok || delivery.Status == "pending" {
+		return database.WebhookDelivery{}, sql.ErrNoRows
+	}
+	delivery.Status = "pending"
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	s.deliveries[id] = delivery
+	return delivery, nil
+}
+
+func (s *memStore) CreateConversation(ctx context.Context, participantKey string) (database.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conversation := range s.conversations {
+		if conversation.ParticipantKey.String == participantKey {
+			return database.Conversation{}, sql.ErrNoRows
+		}
+	}
+	now := s.tick()
+	conversation := database.Conversation{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		ParticipantKey: sql.NullString{String: participantKey, Valid: true},
+	}
+	s.conversations[conversation.ID] = conversation
+	return conversation, nil
+}
+
+func (s *memStore) AddConversationParticipant(ctx context.Context, arg database.AddConversationParticipantParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, participant := range s.participants {
+		if participant.ConversationID == arg.ConversationID && participant.UserID == arg.UserID {
+			return uniqueViolation("conversation_participants_pkey")
+		}
+	}
+	s.participants = append(s.participants, database.ConversationParticipant{
+		ConversationID: arg.ConversationID,
+		UserID:         arg.UserID,
+		JoinedAt:       s.tick(),
+	})
+	return nil
+}
+
+func (s *memStore) GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversation, ok := s.conversations[id]
+	if !ok {
+		return database.Conversation{}, sql.ErrNoRows
+	}
+	return conversation, nil
+}
+
+func (s *memStore) participantsOf(conversationID uuid.UUID) []database.ConversationParticipant {
+	var participants []database.ConversationParticipant
+	for _, participant := range s.participants {
+		if participant.ConversationID == conversationID {
+			participants = append(participants, participant)
+		}
+	}
+	return participants
+}
+
+func (s *memStore) GetConversationByParticipantKey(ctx context.Context, participantKey string) (database.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conversation := range s.conversations {
+		if conversation.ParticipantKey.Valid && conversation.ParticipantKey.String == participantKey {
+			return conversation, nil
+		}
+	}
+	return database.Conversation{}, sql.ErrNoRows
+}
+
+func (s *memStore) ListConversationsForUser(ctx context.Context, userID uuid.UUID) ([]database.ListConversationsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var conversations []database.ListConversationsForUserRow
+	for _, participant := range s.participants {
+		if participant.UserID != userID {
+			continue
+		}
+		conversation := s.conversations[participant.ConversationID]
+		row := database.ListConversationsForUserRow{ID: conversation.ID, CreatedAt: conversation.CreatedAt, UpdatedAt: conversation.UpdatedAt}
+		for _, message := range s.messages {
+			if message.ConversationID == conversation.ID && message.SenderID != userID &&
+				(!participant.LastReadAt.Valid || message.CreatedAt.After(participant.LastReadAt.Time)) &&
+				!s.msgDeletions[[2]uuid.UUID{userID, message.ID}] {
+				row.UnreadCount++
+			}
+		}
+		conversations = append(conversations, row)
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		if !conversations[i].UpdatedAt.Equal(conversations[j].UpdatedAt) {
+			return conversations[i].UpdatedAt.After(conversations[j].UpdatedAt)
+		}
+		return conversations[i].ID.String() < conversations[j].ID.String()
+	})
+	var rows []database.ListConversationsForUserRow
+	for _, conversation := range conversations {
+		for _, participant := range s.participantsOf(conversation.ID) {
+			row := conversation
+			row.ParticipantID = participant.UserID
+			row.ParticipantLastReadAt = participant.LastReadAt
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (s *memStore) ListConversationParticipants(ctx context.Context, conversationID uuid.UUID) ([]database.ConversationParticipant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.participantsOf(conversationID), nil
+}
+
+func (s *memStore) TouchConversation(ctx context.Context, arg database.TouchConversationParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if conversation, ok := s.conversations[arg.ID]; ok {
+		conversation.UpdatedAt = arg.UpdatedAt
+		s.conversations[arg.ID] = conversation
+	}
+	return nil
+}
+
+func (s *memStore) CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message := database.Message{
+		ID:             uuid.New(),
+		ConversationID: arg.ConversationID,
+		SenderID:       arg.SenderID,
+		Body:           arg.Body,
+		CreatedAt:      s.tick(),
+	}
+	s.messages[message.ID] = message
+	return message, nil
+}
+
+func (s *memStore) GetMessage(ctx context.Context, arg database.GetMessageParams) (database.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message, ok := s.messages[arg.ID]
+	if !ok || message.ConversationID != arg.ConversationID {
+		return database.Message{}, sql.ErrNoRows
+	}
+	return message, nil
+}
+
+func (s *memStore) ListMessages(ctx context.Context, arg database.ListMessagesParams) ([]database.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var messages []database.Message
+	for _, message := range s.messages {
+		if message.ConversationID != arg.ConversationID || s.msgDeletions[[2]uuid.UUID{arg.UserID, message.ID}] {
+			continue
+		}
+		if arg.BeforeCreatedAt.Valid && !message.CreatedAt.Before(arg.BeforeCreatedAt.Time) {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].CreatedAt.After(messages[j].CreatedAt) })
+	if len(messages) > int(arg.PageSize) {
+		messages = messages[:arg.PageSize]
+	}
+	return messages, nil
+}
+
+func (s *memStore) MarkConversationRead(ctx context.Context, arg database.MarkConversationReadParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, participant := range s.participants {
+		if participant.ConversationID == arg.ConversationID && participant.UserID == arg.UserID &&
+			(!participant.LastReadAt.Valid || arg.ReadAt.After(participant.LastReadAt.Time)) {
+			s.participants[i].LastReadAt = nullTime(arg.ReadAt)
+		}
+	}
+	return nil
+}
+
+func (s *memStore) DeleteMessageForUser(ctx context.Context, arg database.DeleteMessageForUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgDeletions[[2]uuid.UUID{arg.UserID, arg.MessageID}] = true
+	return nil
+}
+
+func (s *memStore) DeleteMessagesBySenderID(ctx context.Context, senderID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for messageID, message := range s.messages {
+		if message.SenderID == senderID {
+			delete(s.messages, messageID)
+		}
+	}
+	for key := range s.msgDeletions {
+		if _, ok := s.messages[key[1]]; !ok {
+			delete(s.msgDeletions, key)
+		}
+	}
+	return nil
+}
+
+func (s *memStore) DeleteMessageDeletionsByUserID(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.msgDeletions {
+		if key[0] == userID {
+			delete(s.msgDeletions, key)
+		}
+	}
+	return nil
+}
+
+func (s *memStore) DeleteConversationParticipantsByUserID(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.participants = slices.DeleteFunc(s.participants, func(participant database.ConversationParticipant) bool {
+		return participant.UserID == userID
+	})
+	return nil
+}
+
+func (s *memStore) CreateUserRelationship(ctx context.Context, arg database.CreateUserRelationshipParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rel := range s.relationships {
+		if rel.UserID == arg.UserID && rel.TargetID == arg.TargetID && rel.Kind == arg.Kind {
+			return nil
+		}
+	}
+	s.relationships = append(s.relationships, database.UserRelationship{
+		UserID:    arg.UserID,
+		TargetID:  arg.TargetID,
+		Kind:      arg.Kind,
+		CreatedAt: s.tick(),
+	})
+	return nil
+}
+
+func (s *memStore) DeleteUserRelationship(ctx context.Context, arg database.DeleteUserRelationshipParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := len(s.relationships)
+	s.relationships = slices.DeleteFunc(s.relationships, func(rel database.UserRelationship) bool {
+		return rel.UserID == arg.UserID && rel.TargetID == arg.TargetID && rel.Kind == arg.Kind
+	})
+	return int64(before - len(s.relationships)), nil
+}
+
+func (s *memStore) ListUserRelationships(ctx context.Context, arg database.ListUserRelationshipsParams) ([]database.UserRelationship, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []database.UserRelationship
+	for _, rel := range s.relationships {
+		if rel.UserID == arg.UserID && rel.Kind == arg.Kind {
+			out = append(out, rel)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].TargetID.String() < out[j].TargetID.String()
+	})
+	return out, nil
+}
+
+func (s *memStore) IsBlockedBetween(ctx context.Context, arg database.IsBlockedBetweenParams) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rel := range s.relationships {
+		if rel.Kind == "block" &&
+			(rel.UserID == arg.UserA && rel.TargetID == arg.UserB || rel.UserID == arg.UserB && rel.TargetID == arg.UserA) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memStore) DeleteUserRelationshipsByUserID(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.relationships = slices.DeleteFunc(s.relationships, func(rel database.UserRelationship) bool {
+		return rel.UserID == userID || rel.TargetID == userID
+	})
+	return nil
+}
+
+func (s *memStore) FollowUser(ctx context.Context, arg database.FollowUserParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rel := range s.relationships {
+		if rel.Kind == "block" &&
+			(rel.UserID == arg.FollowerID && rel.TargetID == arg.FolloweeID || rel.UserID == arg.FolloweeID && rel.TargetID == arg.FollowerID) {
+			return 0, nil
+		}
+	}
+	for _, follow := range s.follows {
+		if follow.FollowerID == arg.FollowerID && follow.FolloweeID == arg.FolloweeID {
+			return 1, nil
+		}
+	}
+	s.follows = append(s.follows, database.UserFollow{
+		FollowerID: arg.FollowerID,
+		FolloweeID: arg.FolloweeID,
+		CreatedAt:  s.tick(),
+	})
+	return 1, nil
+}
+
+func (s *memStore) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := len(s.follows)
+	s.follows = slices.DeleteFunc(s.follows, func(follow database.UserFollow) bool {
+		return follow.FollowerID == arg.FollowerID && follow.FolloweeID == arg.FolloweeID
+	})
+	return int64(before - len(s.follows)), nil
+}
+
+func (s *memStore) ListUserFollows(ctx context.Context, followerID uuid.UUID) ([]database.UserFollow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []database.UserFollow
+	for _, follow := range s.follows {
+		if follow.FollowerID == followerID {
+			out = append(out, follow)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].FolloweeID.String() < out[j].FolloweeID.String()
+	})
+	return out, nil
+}
+
+func (s *memStore) DeleteFollowsBetween(ctx context.Context, arg database.DeleteFollowsBetweenParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.follows = slices.DeleteFunc(s.follows, func(follow database.UserFollow) bool {
+		return follow.FollowerID == arg.UserA && follow.FolloweeID == arg.UserB ||
+			follow.FollowerID == arg.UserB && follow.FolloweeID == arg.UserA
+	})
+	return nil
+}
+
+func (s *memStore) DeleteUserFollowsByUserID(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.follows = slices.DeleteFunc(s.follows, func(follow database.UserFollow) bool {
+		return follow.FollowerID == userID || follow.FolloweeID == userID
+	})
+	return nil
+}
+
+func TestMemStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) server.Store { return newMemStore() })
+}
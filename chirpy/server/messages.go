@@ -0,0 +1,432 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxMessageLength = 2000
+	// maxConversationSize counts the creator too.
+	maxConversationSize = 10
+	messagePageSize     = 50
+	maxMessagePageSize  = 100
+)
+
+type Participant struct {
+	UserID     uuid.UUID  `json:"user_id"`
+	LastReadAt *time.Time `json:"last_read_at,omitempty"`
+}
+
+type Conversation struct {
+	ID           uuid.UUID     `json:"id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	Participants []Participant `json:"participants"`
+	UnreadCount  int64         `json:"unread_count"`
+}
+
+// Message is a direct message. ReadBy lists the other participants whose read
+// receipt has reached it.
+type Message struct {
+	ID             uuid.UUID   `json:"id"`
+	ConversationID uuid.UUID   `json:"conversation_id"`
+	SenderID       uuid.UUID   `json:"sender_id"`
+	Body           string      `json:"body"`
+	CreatedAt      time.Time   `json:"created_at"`
+	ReadBy         []uuid.UUID `json:"read_by"`
+}
+
+func toConversation(conversation database.Conversation, participants []database.ConversationParticipant, unread int64) Conversation {
+	out := Conversation{
+		ID:           conversation.ID,
+		CreatedAt:    conversation.CreatedAt,
+		UpdatedAt:    conversation.UpdatedAt,
+		Participants: []Participant{},
+		UnreadCount:  unread,
+	}
+	for _, participant := range participants {
+		p := Participant{UserID: participant.UserID}
+		if participant.LastReadAt.Valid {
+			p.LastReadAt = &participant.LastReadAt.Time
+		}
+		out.Participants = append(out.Participants, p)
+	}
+	return out
+}
+
+func toMessage(message database.Message, participants []database.ConversationParticipant) Message {
+	out := Message{
+		ID:             message.ID,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		Body:           message.Body,
+		CreatedAt:      message.CreatedAt,
+		ReadBy:         []uuid.UUID{},
+	}
+	for _, participant := range participants {
+		if participant.UserID != message.SenderID && participant.LastReadAt.Valid &&
+			!participant.LastReadAt.Time.Before(message.CreatedAt) {
+			out.ReadBy = append(out.ReadBy, participant.UserID)
+		}
+	}
+	return out
+}
+
+// conversationFor loads the conversation in the path along with its
+// participants. Anyone outside it gets the same 404 as for a conversation that
+// doesn't exist.
+func (cfg *apiConfig) conversationFor(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.Conversation, []database.ConversationParticipant, bool) {
+	conversationID, ok := parseUUIDPathValue(w, r, "conversationID")
+	if !ok {
+		return database.Conversation{}, nil, false
+	}
+	conversation, err := cfg.dbQueries.GetConversation(r.Context(), conversationID)
+	if err != nil {
+		respondWithLookupError(w, r, "Conversation", err)
+		return database.Conversation{}, nil, false
+	}
+	participants, err := cfg.dbQueries.ListConversationParticipants(r.Context(), conversationID)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't get participants", err)
+		return database.Conversation{}, nil, false
+	}
+	if !slices.ContainsFunc(participants, func(p database.ConversationParticipant) bool { return p.UserID == userID }) {
+		respondWithLookupError(w, r, "Conversation", sql.ErrNoRows)
+		return database.Conversation{}, nil, false
+	}
+	return conversation, participants, true
+}
+
+// handleCreateConversation starts a conversation between the caller and
+// participant_ids, none of whom may have a block with the caller. Asking for a
+// conversation with exactly the same participants as an existing one returns
+// it instead of starting another.
+func (cfg *apiConfig) handleCreateConversation(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ParticipantIDs []uuid.UUID `json:"participant_ids"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if cfg.rejectRestrictedUser(w, r, userID) {
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	var others []uuid.UUID
+	for _, id := range params.ParticipantIDs {
+		if id != userID && !slices.Contains(others, id) {
+			others = append(others, id)
+		}
+	}
+	if len(others) == 0 {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "participant_ids must name at least one other user", nil)
+		return
+	}
+	if len(others) >= maxConversationSize {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation,
+			fmt.Sprintf("participant_ids can name at most %d other users", maxConversationSize-1), nil)
+		return
+	}
+	for _, id := range others {
+		user, err := cfg.dbQueries.GetUserByID(r.Context(), id)
+		if err == nil && (user.DeletedAt.Valid || user.BannedAt.Valid) {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			respondWithLookupError(w, r, "User", err)
+			return
+		}
+		if cfg.rejectBlocked(w, r, userID, id) {
+			return
+		}
+	}
+
+	var (
+		conversation database.Conversation
+		participants []database.ConversationParticipant
+		created      bool
+	)
+	key := participantKey(append([]uuid.UUID{userID}, others...))
+	err := cfg.dbQueries.InTx(r.Context(), func(ctx context.Context) error {
+		var err error
+		conversation, err = cfg.dbQueries.CreateConversation(ctx, key)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			conversation, err = cfg.dbQueries.GetConversationByParticipantKey(ctx, key)
+			if err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			created = true
+			for _, id := range append([]uuid.UUID{userID}, others...) {
+				err := cfg.dbQueries.AddConversationParticipant(ctx, database.AddConversationParticipantParams{
+					ConversationID: conversation.ID,
+					UserID:         id,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		participants, err = cfg.dbQueries.ListConversationParticipants(ctx, conversation.ID)
+		return err
+	})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't create conversation", err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	respondWithJSON(w, status, toConversation(conversation, participants, 0))
+}
+
+// participantKey identifies a set of users regardless of order, so each set
+// has at most one conversation.
+func participantKey(ids []uuid.UUID) string {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = id.String()
+	}
+	slices.Sort(keys)
+	return strings.Join(keys, ",")
+}
+
+// handleListConversations is the caller's inbox, most recently active first.
+func (cfg *apiConfig) handleListConversations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.dbQueries.ListConversationsForUser(r.Context(), userID)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't list conversations", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, conversationsFromRows(rows))
+}
+
+// conversationsFromRows folds ListConversationsForUser's row per participant
+// into one Conversation each.
+func conversationsFromRows(rows []database.ListConversationsForUserRow) []Conversation {
+	conversations := []Conversation{}
+	for _, row := range rows {
+		if n := len(conversations); n == 0 || conversations[n-1].ID != row.ID {
+			conversation := database.Conversation{ID: row.ID, CreatedAt: row.CreatedAt, UpdatedAt: row.UpdatedAt}
+			conversations = append(conversations, toConversation(conversation, nil, row.UnreadCount))
+		}
+		p := Participant{UserID: row.ParticipantID}
+		if row.ParticipantLastReadAt.Valid {
+			p.LastReadAt = &row.ParticipantLastReadAt.Time
+		}
+		last := &conversations[len(conversations)-1]
+		last.Participants = append(last.Participants, p)
+	}
+	return conversations
+}
+
+// handleSendMessage posts to a conversation. Sending counts as reading
+// everything up to the new message. A block between the sender and anyone
+// else in the conversation stops it.
+func (cfg *apiConfig) handleSendMessage(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if cfg.rejectRestrictedUser(w, r, userID) {
+		return
+	}
+	conversation, participants, ok := cfg.conversationFor(w, r, userID)
+	if !ok {
+		return
+	}
+	for _, participant := range participants {
+		if participant.UserID != userID && cfg.rejectBlocked(w, r, userID, participant.UserID) {
+			return
+		}
+	}
+
+	params := parameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	if strings.TrimSpace(params.Body) == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "body is required", nil)
+		return
+	}
+	if utf8.RuneCountInString(params.Body) > maxMessageLength {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "body must be at most 2000 characters", nil)
+		return
+	}
+
+	var message database.Message
+	err := cfg.dbQueries.InTx(r.Context(), func(ctx context.Context) error {
+		var err error
+		message, err = cfg.dbQueries.CreateMessage(ctx, database.CreateMessageParams{
+			ConversationID: conversation.ID,
+			SenderID:       userID,
+			Body:           params.Body,
+		})
+		if err != nil {
+			return err
+		}
+		err = cfg.dbQueries.TouchConversation(ctx, database.TouchConversationParams{UpdatedAt: message.CreatedAt, ID: conversation.ID})
+		if err != nil {
+			return err
+		}
+		return cfg.dbQueries.MarkConversationRead(ctx, database.MarkConversationReadParams{
+			ReadAt:         message.CreatedAt,
+			ConversationID: conversation.ID,
+			UserID:         userID,
+		})
+	})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't send message", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, toMessage(message, participants))
+}
+
+// handleListMessages pages through a conversation newest first. Pass the id
+// of the last message on a page as before to get the next one. Messages the
+// caller deleted are left out.
+func (cfg *apiConfig) handleListMessages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	conversation, participants, ok := cfg.conversationFor(w, r, userID)
+	if !ok {
+		return
+	}
+
+	params := database.ListMessagesParams{
+		ConversationID: conversation.ID,
+		UserID:         userID,
+		PageSize:       messagePageSize,
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 || parsed > maxMessagePageSize {
+			respondWithError(w, r, http.StatusBadRequest, codeValidation, "limit must be between 1 and 100", nil)
+			return
+		}
+		params.PageSize = int32(parsed)
+	}
+	if b := r.URL.Query().Get("before"); b != "" {
+		beforeID, err := uuid.Parse(b)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "before must be a UUID", err)
+			return
+		}
+		before, err := cfg.dbQueries.GetMessage(r.Context(), database.GetMessageParams{ID: beforeID, ConversationID: conversation.ID})
+		if err != nil {
+			respondWithLookupError(w, r, "Message", err)
+			return
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: before.CreatedAt, Valid: true}
+		params.BeforeID = before.ID
+	}
+
+	messages, err := cfg.dbQueries.ListMessages(r.Context(), params)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't list messages", err)
+		return
+	}
+	out := []Message{}
+	for _, message := range messages {
+		out = append(out, toMessage(message, participants))
+	}
+	respondWithJSON(w, http.StatusOK, out)
+}
+
+// handleMarkConversationRead moves the caller's read receipt up to
+// message_id. Receipts never move backwards.
+func (cfg *apiConfig) handleMarkConversationRead(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MessageID uuid.UUID `json:"message_id"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	conversation, _, ok := cfg.conversationFor(w, r, userID)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	message, err := cfg.dbQueries.GetMessage(r.Context(), database.GetMessageParams{ID: params.MessageID, ConversationID: conversation.ID})
+	if err != nil {
+		respondWithLookupError(w, r, "Message", err)
+		return
+	}
+	if err := cfg.dbQueries.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ReadAt:         message.CreatedAt,
+		ConversationID: conversation.ID,
+		UserID:         userID,
+	}); err != nil {
+		respondWithInternalError(w, r, "Couldn't update read receipt", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteMessage removes a message from the caller's view of the
+// conversation only; the other participants still see it.
+func (cfg *apiConfig) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	conversation, _, ok := cfg.conversationFor(w, r, userID)
+	if !ok {
+		return
+	}
+	messageID, ok := parseUUIDPathValue(w, r, "messageID")
+	if !ok {
+		return
+	}
+
+	message, err := cfg.dbQueries.GetMessage(r.Context(), database.GetMessageParams{ID: messageID, ConversationID: conversation.ID})
+	if err != nil {
+		respondWithLookupError(w, r, "Message", err)
+		return
+	}
+	if err := cfg.dbQueries.DeleteMessageForUser(r.Context(), database.DeleteMessageForUserParams{MessageID: message.ID, UserID: userID}); err != nil {
+		respondWithInternalError(w, r, "Couldn't delete message", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
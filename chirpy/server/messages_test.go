@@ -0,0 +1,116 @@
+package server_test
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+func TestDirectMessages(t *testing.T) {
+	c := newTestClient(t)
+	ada := c.signUp("ada@example.com", "password")
+	bob := c.signUp("bob@example.com", "password")
+	eve := c.signUp("eve@example.com", "password")
+	start := func(s session, ids ...uuid.UUID) *http.Response {
+		t.Helper()
+		return c.do("POST", "/api/conversations", s.bearer(), map[string]any{"participant_ids": ids})
+	}
+
+	expectProblem(t, c.do("POST", "/api/conversations", "", map[string]any{"participant_ids": []uuid.UUID{bob.ID}}), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, start(ada, ada.ID), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, start(ada, uuid.New()), http.StatusNotFound, "not_found")
+	resp := start(ada, bob.ID, bob.ID)
+	expectStatus(t, resp, http.StatusCreated)
+	direct := decodeBody[server.Conversation](t, resp)
+	if len(direct.Participants) != 2 || direct.Participants[0].UserID != ada.ID || direct.Participants[1].UserID != bob.ID {
+		t.Fatalf("unexpected conversation: %+v", direct)
+	}
+	resp = start(bob, ada.ID)
+	expectStatus(t, resp, http.StatusOK)
+	if got := decodeBody[server.Conversation](t, resp); got.ID != direct.ID {
+		t.Errorf("expected the existing conversation back, got %+v", got)
+	}
+
+	messagesPath := "/api/conversations/" + direct.ID.String() + "/messages"
+	send := func(s session, body string) server.Message {
+		t.Helper()
+		resp := c.do("POST", messagesPath, s.bearer(), map[string]string{"body": body})
+		expectStatus(t, resp, http.StatusCreated)
+		return decodeBody[server.Message](t, resp)
+	}
+	expectProblem(t, c.do("POST", messagesPath, ada.bearer(), map[string]string{"body": "  "}), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, c.do("POST", messagesPath, ada.bearer(), map[string]string{"body": strings.Repeat("a", 2001)}), http.StatusBadRequest, "validation_failed")
+	first := send(ada, "hi bob")
+	send(bob, "hi ada")
+	third := send(ada, "how are you?")
+	if first.SenderID != ada.ID || len(first.ReadBy) != 0 {
+		t.Errorf("unexpected message: %+v", first)
+	}
+
+	// Outsiders can't tell the conversation exists.
+	expectProblem(t, c.do("GET", messagesPath, eve.bearer(), nil), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("POST", messagesPath, eve.bearer(), map[string]string{"body": "let me in"}), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("GET", messagesPath, "", nil), http.StatusUnauthorized, "unauthorized")
+
+	inbox := decodeBody[[]server.Conversation](t, c.do("GET", "/api/conversations", bob.bearer(), nil))
+	// Replying read the first message, so only the last is unread.
+	if len(inbox) != 1 || inbox[0].UnreadCount != 1 {
+		t.Errorf("expected bob to have one unread message, got %+v", inbox)
+	}
+	if got := decodeBody[[]server.Conversation](t, c.do("GET", "/api/conversations", eve.bearer(), nil)); len(got) != 0 {
+		t.Errorf("expected eve's inbox to be empty, got %+v", got)
+	}
+
+	page := decodeBody[[]server.Message](t, c.do("GET", messagesPath+"?limit=2", bob.bearer(), nil))
+	if len(page) != 2 || page[0].ID != third.ID {
+		t.Fatalf("expected the two newest messages, got %+v", page)
+	}
+	rest := decodeBody[[]server.Message](t, c.do("GET", messagesPath+"?limit=2&before="+page[1].ID.String(), bob.bearer(), nil))
+	if len(rest) != 1 || rest[0].ID != first.ID {
+		t.Errorf("expected the oldest message on the second page, got %+v", rest)
+	}
+	expectProblem(t, c.do("GET", messagesPath+"?limit=101", bob.bearer(), nil), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, c.do("GET", messagesPath+"?before="+uuid.NewString(), bob.bearer(), nil), http.StatusNotFound, "not_found")
+
+	readPath := "/api/conversations/" + direct.ID.String() + "/read"
+	expectStatus(t, c.do("POST", readPath, bob.bearer(), map[string]any{"message_id": third.ID}), http.StatusNoContent)
+	expectStatus(t, c.do("POST", readPath, bob.bearer(), map[string]any{"message_id": first.ID}), http.StatusNoContent)
+	page = decodeBody[[]server.Message](t, c.do("GET", messagesPath, ada.bearer(), nil))
+	if !slices.Equal(page[0].ReadBy, []uuid.UUID{bob.ID}) || !slices.Equal(page[2].ReadBy, []uuid.UUID{bob.ID}) {
+		t.Errorf("expected bob's read receipt on ada's messages, got %+v", page)
+	}
+	inbox = decodeBody[[]server.Conversation](t, c.do("GET", "/api/conversations", bob.bearer(), nil))
+	if inbox[0].UnreadCount != 0 {
+		t.Errorf("expected bob to have read everything, got %+v", inbox)
+	}
+
+	expectStatus(t, c.do("DELETE", messagesPath+"/"+first.ID.String(), bob.bearer(), nil), http.StatusNoContent)
+	if got := decodeBody[[]server.Message](t, c.do("GET", messagesPath, bob.bearer(), nil)); len(got) != 2 {
+		t.Errorf("expected the deleted message to be gone for bob, got %+v", got)
+	}
+	if got := decodeBody[[]server.Message](t, c.do("GET", messagesPath, ada.bearer(), nil)); len(got) != 3 {
+		t.Errorf("expected ada to still see every message, got %+v", got)
+	}
+	expectProblem(t, c.do("DELETE", messagesPath+"/"+first.ID.String(), eve.bearer(), nil), http.StatusNotFound, "not_found")
+
+	resp = start(eve, ada.ID, bob.ID)
+	expectStatus(t, resp, http.StatusCreated)
+	group := decodeBody[server.Conversation](t, resp)
+	resp = start(bob, eve.ID, ada.ID)
+	expectStatus(t, resp, http.StatusOK)
+	if got := decodeBody[server.Conversation](t, resp); got.ID != group.ID {
+		t.Errorf("expected the same participants to get the existing group back, got %+v", got)
+	}
+	c.do("POST", "/api/conversations/"+group.ID.String()+"/messages", eve.bearer(), map[string]string{"body": "group hello"})
+	inbox = decodeBody[[]server.Conversation](t, c.do("GET", "/api/conversations", ada.bearer(), nil))
+	if len(inbox) != 2 || inbox[0].ID != group.ID || len(inbox[0].Participants) != 3 || inbox[0].UnreadCount != 1 {
+		t.Errorf("expected the group first in ada's inbox, got %+v", inbox)
+	}
+	if got := inbox[1].Participants; len(got) != 2 || got[0].UserID != ada.ID || got[0].LastReadAt == nil || got[1].UserID != bob.ID {
+		t.Errorf("expected the direct conversation's participants with their read receipts, got %+v", got)
+	}
+}
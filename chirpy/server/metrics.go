@@ -0,0 +1,104 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/metrics"
+)
+
+// serverMetrics are the instruments served at /metrics. The admin metrics page
+// reads from the same registry.
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	requests     *metrics.CounterVec
+	duration     *metrics.HistogramVec
+	responseSize *metrics.HistogramVec
+	inFlight     *metrics.Gauge
+
+	fileserverHits *metrics.Counter
+	chirpsCreated  *metrics.Counter
+	logins         *metrics.CounterVec
+	webhookEvents  *metrics.CounterVec
+
+	chirpCacheRequests *metrics.CounterVec
+	webhookDeliveries  *metrics.CounterVec
+}
+
+func newServerMetrics(dbStats func() sql.DBStats) *serverMetrics {
+	reg := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: reg,
+		requests: reg.NewCounterVec("chirpy_http_requests_total",
+			"HTTP requests by route pattern and status code.", "route", "code"),
+		duration: reg.NewHistogramVec("chirpy_http_request_duration_seconds",
+			"Time to serve HTTP requests by route pattern.", metrics.DefBuckets, "route"),
+		responseSize: reg.NewHistogramVec("chirpy_http_response_size_bytes",
+			"HTTP response body sizes by route pattern.", metrics.SizeBuckets, "route"),
+		inFlight: reg.NewGauge("chirpy_http_requests_in_flight",
+			"HTTP requests currently being served."),
+		fileserverHits: reg.NewCounter("chirpy_fileserver_hits_total",
+			"Requests for files under /app/."),
+		chirpsCreated: reg.NewCounter("chirpy_chirps_created_total",
+			"Chirps created."),
+		logins: reg.NewCounterVec("chirpy_logins_total",
+			"Login attempts by result (success or failure).", "result"),
+		webhookEvents: reg.NewCounterVec("chirpy_webhook_events_total",
+			"Polka webhook events received, by event type.", "event"),
+		chirpCacheRequests: reg.NewCounterVec("chirpy_chirp_cache_requests_total",
+			"Single-chirp reads by cache result (hit or miss), when the cache is enabled.", "result"),
+		webhookDeliveries: reg.NewCounterVec("chirpy_webhook_deliveries_total",
+			"Outbound webhook delivery attempts by result (delivered, retry or dead).", "result"),
+	}
+	if dbStats != nil {
+		registerDBStats(reg, dbStats)
+	}
+	return m
+}
+
+func registerDBStats(reg *metrics.Registry, dbStats func() sql.DBStats) {
+	reg.NewGaugeFunc("chirpy_db_open_connections", "Open database connections, in use or idle.",
+		func() float64 { return float64(dbStats().OpenConnections) })
+	reg.NewGaugeFunc("chirpy_db_in_use_connections", "Database connections currently in use.",
+		func() float64 { return float64(dbStats().InUse) })
+	reg.NewGaugeFunc("chirpy_db_idle_connections", "Idle database connections.",
+		func() float64 { return float64(dbStats().Idle) })
+	reg.NewGaugeFunc("chirpy_db_max_open_connections", "Maximum open database connections; 0 is unlimited.",
+		func() float64 { return float64(dbStats().MaxOpenConnections) })
+	reg.NewCounterFunc("chirpy_db_wait_count_total", "Times a query waited for a free connection.",
+		func() float64 { return float64(dbStats().WaitCount) })
+	reg.NewCounterFunc("chirpy_db_wait_duration_seconds_total", "Time spent waiting for a free connection.",
+		func() float64 { return dbStats().WaitDuration.Seconds() })
+}
+
+// middlewareMetrics records every request under the mux pattern that served it,
+// so path parameters such as chirp IDs don't explode the label set.
+func (m *serverMetrics) middlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		r, matched := trackRoute(r)
+		next.ServeHTTP(rec, r)
+
+		route := matched.pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		m.requests.WithLabelValues(route, strconv.Itoa(rec.statusCode())).Inc()
+		m.duration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+		m.responseSize.WithLabelValues(route).Observe(float64(rec.size))
+	})
+}
+
+func (m *serverMetrics) middlewareFileserverHits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.fileserverHits.Inc()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,45 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	c := newTestClient(t)
+	expectStatus(t, c.do("GET", "/app/", "", nil), http.StatusOK)
+	s := c.signUp("walt@example.com", "cook")
+	c.do("POST", "/api/login", "", map[string]string{"email": "walt@example.com", "password": "wrong"})
+	c.createChirp(s, "Say my name")
+	c.do("GET", "/api/chirps/"+uuid.NewString(), "", nil)
+	c.do("GET", "/no/such/route", "", nil)
+	c.do("POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, map[string]any{"event": "user.payment_failed"})
+
+	resp := c.do("GET", "/metrics", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`chirpy_http_requests_total{route="GET /api/chirps/{chirpID}",code="404"} 1`,
+		`chirpy_http_requests_total{route="POST /api/users",code="201"} 1`,
+		`chirpy_http_requests_total{route="unmatched",code="404"} 1`,
+		`chirpy_http_request_duration_seconds_count{route="POST /api/chirps"} 1`,
+		`chirpy_http_response_size_bytes_bucket{route="/app/",le="+Inf"} 1`,
+		"chirpy_http_requests_in_flight 1\n",
+		"chirpy_fileserver_hits_total 1\n",
+		"chirpy_chirps_created_total 1\n",
+		`chirpy_logins_total{result="failure"} 1`,
+		`chirpy_logins_total{result="success"} 1`,
+		`chirpy_webhook_events_total{event="ignored"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected metrics to contain %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+type contextKey string
+
+const (
+	userIDContextKey     contextKey = "userID"
+	roleContextKey       contextKey = "role"
+	requestIDContextKey  contextKey = "requestID"
+	requestLogContextKey contextKey = "requestLog"
+	routeContextKey      contextKey = "route"
+)
+
+// middlewareRequireRole only lets requests through from active users who hold
+// at least the given role. The role is read from the store rather than the
+// token, so demotions, suspensions and bans apply at once. The caller's ID and
+// role are stored on the request context.
+func (cfg *apiConfig) middlewareRequireRole(role auth.Role, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := cfg.authenticate(w, r)
+		if !ok {
+			return
+		}
+		user, ok := cfg.activeUser(w, r, userID)
+		if !ok {
+			return
+		}
+
+		userRole := auth.Role(user.Role)
+		if !userRole.Allows(role) {
+			respondWithError(w, r, http.StatusForbidden, codeForbidden, fmt.Sprintf("This action requires the %s role", role), nil)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDContextKey, userID)
+		ctx = context.WithValue(ctx, roleContextKey, userRole)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func userIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(userIDContextKey).(uuid.UUID)
+	return userID, ok
+}
+
+func roleFromContext(ctx context.Context) (auth.Role, bool) {
+	role, ok := ctx.Value(roleContextKey).(auth.Role)
+	return role, ok
+}
+
+// matchedRoute carries the mux pattern that served a request back out to
+// middleware that only sees an earlier copy of the request.
+type matchedRoute struct {
+	pattern string
+}
+
+// trackRoute makes sure r can report its matched pattern once served; the
+// returned request must be the one passed on.
+func trackRoute(r *http.Request) (*http.Request, *matchedRoute) {
+	if route, ok := r.Context().Value(routeContextKey).(*matchedRoute); ok {
+		return r, route
+	}
+	route := &matchedRoute{}
+	return r.WithContext(context.WithValue(r.Context(), routeContextKey, route)), route
+}
+
+// middlewareRecordRoute wraps the mux, the only place r.Pattern is set.
+func middlewareRecordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if route, ok := r.Context().Value(routeContextKey).(*matchedRoute); ok {
+			route.pattern = r.Pattern
+		}
+	})
+}
+
+// statusRecorder captures the status code and body size written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += n
+	return n, err
+}
+
+func (rec *statusRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// Unwrap lets http.ResponseController reach Flush and deadlines on the real writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
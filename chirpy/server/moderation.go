@@ -0,0 +1,429 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var reportReasons = map[string]bool{
+	"spam":           true,
+	"harassment":     true,
+	"hate":           true,
+	"misinformation": true,
+	"other":          true,
+}
+
+type ChirpReport struct {
+	ID         uuid.UUID  `json:"id"`
+	ChirpID    uuid.UUID  `json:"chirp_id"`
+	ReporterID uuid.UUID  `json:"reporter_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+type ModerationAction struct {
+	ID            uuid.UUID  `json:"id"`
+	ActorID       uuid.UUID  `json:"actor_id"`
+	Action        string     `json:"action"`
+	TargetUserID  *uuid.UUID `json:"target_user_id,omitempty"`
+	TargetChirpID *uuid.UUID `json:"target_chirp_id,omitempty"`
+	Reason        string     `json:"reason"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func toChirpReport(report database.ChirpReport) ChirpReport {
+	returned := ChirpReport{
+		ID:         report.ID,
+		ChirpID:    report.ChirpID,
+		ReporterID: report.ReporterID,
+		Reason:     report.Reason,
+		Details:    report.Details,
+		Status:     report.Status,
+		CreatedAt:  report.CreatedAt,
+	}
+	if report.ResolvedAt.Valid {
+		returned.ResolvedAt = &report.ResolvedAt.Time
+	}
+	return returned
+}
+
+func toModerationAction(action database.ModerationAction) ModerationAction {
+	returned := ModerationAction{
+		ID:        action.ID,
+		ActorID:   action.ActorID,
+		Action:    action.Action,
+		Reason:    action.Reason,
+		CreatedAt: action.CreatedAt,
+	}
+	if action.TargetUserID.Valid {
+		returned.TargetUserID = &action.TargetUserID.UUID
+	}
+	if action.TargetChirpID.Valid {
+		returned.TargetChirpID = &action.TargetChirpID.UUID
+	}
+	if action.ExpiresAt.Valid {
+		returned.ExpiresAt = &action.ExpiresAt.Time
+	}
+	return returned
+}
+
+// isUserRestricted reports whether the user is banned or currently suspended.
+func isUserRestricted(user database.User) bool {
+	if user.BannedAt.Valid {
+		return true
+	}
+	return user.SuspendedUntil.Valid && user.SuspendedUntil.Time.After(time.Now())
+}
+
+// activeUser loads the caller. It writes a 401 and returns false if the
+// account is gone, and a 403 if it is suspended or banned.
+func (cfg *apiConfig) activeUser(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.User, bool) {
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.DeletedAt.Valid) {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "User no longer exists", nil)
+		return user, false
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't get user", err)
+		return user, false
+	}
+	if isUserRestricted(user) {
+		respondWithError(w, r, http.StatusForbidden, codeAccountLimited, "Your account is suspended or banned", nil)
+		return user, false
+	}
+	return user, true
+}
+
+// rejectRestrictedUser writes a 403 and returns true when the user may not write.
+func (cfg *apiConfig) rejectRestrictedUser(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	_, ok := cfg.activeUser(w, r, userID)
+	return !ok
+}
+
+// rejectOutranked writes a 403 and returns true unless the caller's role is
+// above the target's, so moderators can't act against each other or admins.
+func rejectOutranked(w http.ResponseWriter, r *http.Request, target database.User) bool {
+	role, _ := roleFromContext(r.Context())
+	if !role.Outranks(auth.Role(target.Role)) {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "You can't moderate a user whose role is equal to or above yours", nil)
+		return true
+	}
+	return false
+}
+
+// logModerationAction records an action in the audit log. Call it with the
+// context of the transaction that made the change, so neither happens alone.
+func (cfg *apiConfig) logModerationAction(ctx context.Context, params database.CreateModerationActionParams) error {
+	action, err := cfg.dbQueries.CreateModerationAction(ctx, params)
+	if err != nil {
+		return err
+	}
+	loggerFromContext(ctx).Info("Moderation action",
+		"action", action.Action,
+		"actor_id", action.ActorID,
+		"target_user_id", action.TargetUserID.UUID,
+		"target_chirp_id", action.TargetChirpID.UUID,
+		"reason", action.Reason)
+	return nil
+}
+
+func (cfg *apiConfig) handleReportChirp(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	userID, _ := userIDFromContext(r.Context())
+	chirpID, ok := parseUUIDPathValue(w, r, "chirpID")
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	if !reportReasons[params.Reason] {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "reason must be one of spam, harassment, hate, misinformation or other", nil)
+		return
+	}
+
+	_, err := cfg.dbQueries.GetVisibleChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithLookupError(w, r, "Chirp", err)
+		return
+	}
+
+	report, err := cfg.dbQueries.CreateChirpReport(r.Context(), database.CreateChirpReportParams{
+		ChirpID:    chirpID,
+		ReporterID: userID,
+		Reason:     params.Reason,
+		Details:    params.Details,
+	})
+	// the unique (chirp_id, reporter_id) constraint means this user already reported it
+	if database.IsUniqueViolation(err) {
+		respondWithError(w, r, http.StatusConflict, codeConflict, "You have already reported this chirp", err)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't create report", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, toChirpReport(report))
+}
+
+func (cfg *apiConfig) handleListReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := cfg.dbQueries.ListOpenChirpReports(r.Context())
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't list reports", err)
+		return
+	}
+
+	reportList := []ChirpReport{}
+	for _, report := range reports {
+		reportList = append(reportList, toChirpReport(report))
+	}
+
+	respondWithJSON(w, http.StatusOK, reportList)
+}
+
+func (cfg *apiConfig) handleDismissReport(w http.ResponseWriter, r *http.Request) {
+	actorID, _ := userIDFromContext(r.Context())
+	reportID, ok := parseUUIDPathValue(w, r, "reportID")
+	if !ok {
+		return
+	}
+
+	params, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.dbQueries.InTx(r.Context(), func(ctx context.Context) error {
+		report, err := cfg.dbQueries.DismissChirpReport(ctx, database.DismissChirpReportParams{
+			ResolvedBy: uuid.NullUUID{UUID: actorID, Valid: true},
+			ID:         reportID,
+		})
+		if err != nil {
+			return err
+		}
+		return cfg.logModerationAction(ctx, database.CreateModerationActionParams{
+			ActorID:       actorID,
+			Action:        "dismiss_report",
+			TargetChirpID: uuid.NullUUID{UUID: report.ChirpID, Valid: true},
+			Reason:        params.Reason,
+		})
+	})
+	if err != nil {
+		respondWithLookupError(w, r, "Open report", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleHideChirp(w http.ResponseWriter, r *http.Request) {
+	actorID, _ := userIDFromContext(r.Context())
+	chirpID, ok := parseUUIDPathValue(w, r, "chirpID")
+	if !ok {
+		return
+	}
+
+	params, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.dbQueries.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithLookupError(w, r, "Chirp", err)
+		return
+	}
+	author, err := cfg.dbQueries.GetUserByID(r.Context(), chirp.UserID)
+	if err != nil {
+		respondWithLookupError(w, r, "Chirp", err)
+		return
+	}
+	if rejectOutranked(w, r, author) {
+		return
+	}
+
+	err = cfg.dbQueries.InTx(r.Context(), func(ctx context.Context) error {
+		if _, err := cfg.dbQueries.HideChirp(ctx, chirp.ID); err != nil {
+			return err
+		}
+		err := cfg.dbQueries.ResolveChirpReports(ctx, database.ResolveChirpReportsParams{
+			ResolvedBy: uuid.NullUUID{UUID: actorID, Valid: true},
+			ChirpID:    chirp.ID,
+		})
+		if err != nil {
+			return err
+		}
+		return cfg.logModerationAction(ctx, database.CreateModerationActionParams{
+			ActorID:       actorID,
+			Action:        "hide_chirp",
+			TargetUserID:  uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+			TargetChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			Reason:        params.Reason,
+		})
+	})
+	if err != nil {
+		respondWithLookupError(w, r, "Chirp", err)
+		return
+	}
+	cfg.chirpCache.invalidate(chirp.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleSuspendUser(w http.ResponseWriter, r *http.Request) {
+	actorID, _ := userIDFromContext(r.Context())
+	userID, ok := parseUUIDPathValue(w, r, "userID")
+	if !ok {
+		return
+	}
+
+	params, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	duration, err := time.ParseDuration(params.Duration)
+	if err != nil || duration <= 0 {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "duration must be a positive duration such as \"72h\"", nil)
+		return
+	}
+	until := time.Now().Add(duration)
+
+	target, ok := cfg.moderationTarget(w, r, userID)
+	if !ok {
+		return
+	}
+	err = cfg.dbQueries.InTx(r.Context(), func(ctx context.Context) error {
+		_, err := cfg.dbQueries.SuspendUser(ctx, database.SuspendUserParams{
+			SuspendedUntil: sql.NullTime{Time: until, Valid: true},
+			ID:             target.ID,
+		})
+		if err != nil {
+			return err
+		}
+		return cfg.logModerationAction(ctx, database.CreateModerationActionParams{
+			ActorID:      actorID,
+			Action:       "suspend_user",
+			TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+			Reason:       params.Reason,
+			ExpiresAt:    sql.NullTime{Time: until, Valid: true},
+		})
+	})
+	if err != nil {
+		respondWithLookupError(w, r, "User", err)
+		return
+	}
+	cfg.chirpCache.invalidateAuthor(target.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleBanUser(w http.ResponseWriter, r *http.Request) {
+	actorID, _ := userIDFromContext(r.Context())
+	userID, ok := parseUUIDPathValue(w, r, "userID")
+	if !ok {
+		return
+	}
+
+	params, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	target, ok := cfg.moderationTarget(w, r, userID)
+	if !ok {
+		return
+	}
+	err := cfg.dbQueries.InTx(r.Context(), func(ctx context.Context) error {
+		if _, err := cfg.dbQueries.BanUser(ctx, target.ID); err != nil {
+			return err
+		}
+		return cfg.logModerationAction(ctx, database.CreateModerationActionParams{
+			ActorID:      actorID,
+			Action:       "ban_user",
+			TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+			Reason:       params.Reason,
+		})
+	})
+	if err != nil {
+		respondWithLookupError(w, r, "User", err)
+		return
+	}
+	cfg.chirpCache.invalidateAuthor(target.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// moderationTarget loads the user a suspension or ban is aimed at, writing a
+// 404 if there is none and a 403 if the caller doesn't outrank them.
+func (cfg *apiConfig) moderationTarget(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.User, bool) {
+	target, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err == nil && target.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		respondWithLookupError(w, r, "User", err)
+		return target, false
+	}
+	return target, !rejectOutranked(w, r, target)
+}
+
+func (cfg *apiConfig) handleListModerationActions(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			respondWithError(w, r, http.StatusBadRequest, codeValidation, "limit must be between 1 and 1000", nil)
+			return
+		}
+		limit = parsed
+	}
+
+	actions, err := cfg.dbQueries.ListModerationActions(r.Context(), int32(limit))
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't list moderation actions", err)
+		return
+	}
+
+	actionList := []ModerationAction{}
+	for _, action := range actions {
+		actionList = append(actionList, toModerationAction(action))
+	}
+
+	respondWithJSON(w, http.StatusOK, actionList)
+}
+
+type moderationRequest struct {
+	Reason string `json:"reason"`
+	// Duration is a Go duration string such as "72h", only used for suspensions.
+	Duration string `json:"duration"`
+}
+
+// decodeModerationRequest rejects the request with 400 when the body is malformed
+// or the reason is empty: every moderator action needs a reason.
+func decodeModerationRequest(w http.ResponseWriter, r *http.Request) (moderationRequest, bool) {
+	params := moderationRequest{}
+	if !decodeJSONBody(w, r, &params) {
+		return params, false
+	}
+	if params.Reason == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "reason is required", nil)
+		return params, false
+	}
+	return params, true
+}
@@ -0,0 +1,168 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+func TestModerationFlow(t *testing.T) {
+	c := newTestClient(t)
+	author := c.signUp("author@example.com", "password")
+	reporter := c.signUp("reporter@example.com", "password")
+	mod := c.signUpWithRole("mod@example.com", "moderator")
+
+	chirp := c.createChirp(author, "something objectionable")
+	other := c.createChirp(author, "something fine")
+
+	reportPath := "/api/chirps/" + chirp.ID.String() + "/report"
+	expectProblem(t, c.do("POST", reportPath, "", map[string]string{"reason": "spam"}), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("POST", reportPath, reporter.bearer(), map[string]string{"reason": "boring"}), http.StatusBadRequest, "validation_failed")
+	expectStatus(t, c.do("POST", reportPath, reporter.bearer(), map[string]string{"reason": "spam", "details": "ads"}), http.StatusCreated)
+	expectProblem(t, c.do("POST", reportPath, reporter.bearer(), map[string]string{"reason": "spam"}), http.StatusConflict, "conflict")
+
+	expectProblem(t, c.do("GET", "/api/moderation/reports", reporter.bearer(), nil), http.StatusForbidden, "forbidden")
+	resp := c.do("GET", "/api/moderation/reports", mod.bearer(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	reports := decodeBody[[]struct {
+		ID      uuid.UUID `json:"id"`
+		ChirpID uuid.UUID `json:"chirp_id"`
+		Reason  string    `json:"reason"`
+	}](t, resp)
+	if len(reports) != 1 || reports[0].ChirpID != chirp.ID || reports[0].Reason != "spam" {
+		t.Fatalf("unexpected report queue: %+v", reports)
+	}
+
+	hidePath := "/api/moderation/chirps/" + chirp.ID.String() + "/hide"
+	expectProblem(t, c.do("POST", hidePath, mod.bearer(), map[string]string{}), http.StatusBadRequest, "validation_failed")
+	expectStatus(t, c.do("POST", hidePath, mod.bearer(), map[string]string{"reason": "spam"}), http.StatusNoContent)
+	expectProblem(t, c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil), http.StatusNotFound, "not_found")
+	resp = c.do("GET", "/api/moderation/reports", mod.bearer(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	if open := decodeBody[[]json.RawMessage](t, resp); len(open) != 0 {
+		t.Errorf("expected hiding to resolve the report, %d still open", len(open))
+	}
+
+	suspendPath := "/api/moderation/users/" + author.ID.String() + "/suspend"
+	expectProblem(t, c.do("POST", suspendPath, mod.bearer(), map[string]string{"reason": "spam", "duration": "forever"}),
+		http.StatusBadRequest, "validation_failed")
+	expectStatus(t, c.do("POST", suspendPath, mod.bearer(), map[string]string{"reason": "spam", "duration": "72h"}), http.StatusNoContent)
+	expectProblem(t, c.do("POST", "/api/chirps", author.bearer(), map[string]string{"body": "let me out"}),
+		http.StatusForbidden, "account_restricted")
+	expectProblem(t, c.do("DELETE", "/api/chirps/"+other.ID.String(), author.bearer(), nil), http.StatusForbidden, "account_restricted")
+	resp = c.do("GET", "/api/chirps", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if visible := decodeBody[[]server.Chirp](t, resp); len(visible) != 0 {
+		t.Errorf("expected suspended user's chirps to be filtered, got %+v", visible)
+	}
+
+	expectStatus(t, c.do("POST", "/api/moderation/users/"+reporter.ID.String()+"/ban", mod.bearer(), map[string]string{"reason": "abuse"}),
+		http.StatusNoContent)
+	expectProblem(t, c.do("PUT", "/api/users", reporter.bearer(), map[string]string{"email": "x@example.com", "password": "x"}),
+		http.StatusForbidden, "account_restricted")
+
+	resp = c.do("GET", "/api/moderation/actions", mod.bearer(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	actions := decodeBody[[]struct {
+		ActorID uuid.UUID `json:"actor_id"`
+		Action  string    `json:"action"`
+		Reason  string    `json:"reason"`
+	}](t, resp)
+	wantActions := []string{"ban_user", "suspend_user", "hide_chirp"}
+	if len(actions) != len(wantActions) {
+		t.Fatalf("expected %d logged actions, got %+v", len(wantActions), actions)
+	}
+	for i, want := range wantActions {
+		if actions[i].Action != want || actions[i].ActorID != mod.ID || actions[i].Reason == "" {
+			t.Errorf("action %d: expected %s by %s with a reason, got %+v", i, want, mod.ID, actions[i])
+		}
+	}
+}
+
+func TestDismissReport(t *testing.T) {
+	c := newTestClient(t)
+	author := c.signUp("author@example.com", "password")
+	reporter := c.signUp("reporter@example.com", "password")
+	mod := c.signUpWithRole("mod@example.com", "moderator")
+	chirp := c.createChirp(author, "totally fine")
+
+	resp := c.do("POST", "/api/chirps/"+chirp.ID.String()+"/report", reporter.bearer(), map[string]string{"reason": "other"})
+	expectStatus(t, resp, http.StatusCreated)
+	report := decodeBody[struct {
+		ID uuid.UUID `json:"id"`
+	}](t, resp)
+
+	dismissPath := "/api/moderation/reports/" + report.ID.String() + "/dismiss"
+	expectStatus(t, c.do("POST", dismissPath, mod.bearer(), map[string]string{"reason": "not a violation"}), http.StatusNoContent)
+	expectProblem(t, c.do("POST", dismissPath, mod.bearer(), map[string]string{"reason": "again"}), http.StatusNotFound, "not_found")
+	expectStatus(t, c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil), http.StatusOK)
+}
+
+func TestRoleChangesApplyImmediately(t *testing.T) {
+	c := newTestClient(t)
+	admin := c.signUpWithRole("admin@example.com", "admin")
+	other := c.signUpWithRole("other@example.com", "admin")
+
+	rolePath := "/admin/users/" + other.ID.String() + "/role"
+	expectStatus(t, c.do("PUT", rolePath, admin.bearer(), map[string]string{"role": "user"}), http.StatusOK)
+	expectProblem(t, c.do("PUT", "/admin/users/"+admin.ID.String()+"/role", other.bearer(), map[string]string{"role": "user"}),
+		http.StatusForbidden, "forbidden")
+	expectProblem(t, c.do("GET", "/api/moderation/reports", other.bearer(), nil), http.StatusForbidden, "forbidden")
+}
+
+func TestRestrictedUsersLoseAccess(t *testing.T) {
+	c := newTestClient(t)
+	admin := c.signUpWithRole("admin@example.com", "admin")
+	mod := c.signUpWithRole("mod@example.com", "moderator")
+	user := c.signUp("user@example.com", "password")
+
+	expectStatus(t, c.do("POST", "/api/moderation/users/"+mod.ID.String()+"/ban", admin.bearer(), map[string]string{"reason": "abuse"}),
+		http.StatusNoContent)
+	expectProblem(t, c.do("GET", "/api/moderation/reports", mod.bearer(), nil), http.StatusForbidden, "account_restricted")
+	expectProblem(t, c.do("POST", "/api/login", "", map[string]string{"email": "mod@example.com", "password": "password"}),
+		http.StatusForbidden, "account_restricted")
+	expectProblem(t, c.do("POST", "/api/refresh", "Bearer "+mod.RefreshToken, nil), http.StatusForbidden, "account_restricted")
+
+	expectStatus(t, c.do("POST", "/api/moderation/users/"+user.ID.String()+"/suspend", admin.bearer(),
+		map[string]string{"reason": "spam", "duration": "24h"}), http.StatusNoContent)
+	expectProblem(t, c.do("POST", "/api/login", "", map[string]string{"email": "user@example.com", "password": "password"}),
+		http.StatusForbidden, "account_restricted")
+	expectProblem(t, c.do("POST", "/api/refresh", "Bearer "+user.RefreshToken, nil), http.StatusForbidden, "account_restricted")
+	chirp := c.createChirp(admin, "hello")
+	expectProblem(t, c.do("POST", "/api/chirps/"+chirp.ID.String()+"/report", user.bearer(), map[string]string{"reason": "spam"}),
+		http.StatusForbidden, "account_restricted")
+	expectProblem(t, c.do("PUT", "/api/users/"+admin.ID.String()+"/block", user.bearer(), nil), http.StatusForbidden, "account_restricted")
+}
+
+func TestModeratorsCantActAgainstPeers(t *testing.T) {
+	c := newTestClient(t)
+	admin := c.signUpWithRole("admin@example.com", "admin")
+	mod := c.signUpWithRole("mod@example.com", "moderator")
+	peer := c.signUpWithRole("peer@example.com", "moderator")
+
+	for _, target := range []session{admin, peer, mod} {
+		usersPath := "/api/moderation/users/" + target.ID.String()
+		expectProblem(t, c.do("POST", usersPath+"/suspend", mod.bearer(), map[string]string{"reason": "spam", "duration": "1h"}),
+			http.StatusForbidden, "forbidden")
+		expectProblem(t, c.do("POST", usersPath+"/ban", mod.bearer(), map[string]string{"reason": "spam"}),
+			http.StatusForbidden, "forbidden")
+		chirp := c.createChirp(target, "still here")
+		expectProblem(t, c.do("POST", "/api/moderation/chirps/"+chirp.ID.String()+"/hide", mod.bearer(), map[string]string{"reason": "spam"}),
+			http.StatusForbidden, "forbidden")
+		expectStatus(t, c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil), http.StatusOK)
+	}
+
+	resp := c.do("GET", "/api/moderation/actions", admin.bearer(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	if actions := decodeBody[[]any](t, resp); len(actions) != 0 {
+		t.Errorf("refused actions were logged: %+v", actions)
+	}
+
+	expectStatus(t, c.do("POST", "/api/moderation/users/"+peer.ID.String()+"/suspend", admin.bearer(),
+		map[string]string{"reason": "spam", "duration": "1h"}), http.StatusNoContent)
+	expectProblem(t, c.do("POST", "/api/moderation/users/"+admin.ID.String()+"/ban", admin.bearer(), map[string]string{"reason": "oops"}),
+		http.StatusForbidden, "forbidden")
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type openAPIDoc struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components map[string]map[string]json.RawMessage `json:"components"`
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("expected OpenAPI 3.1.0, got %q", doc.OpenAPI)
+	}
+
+	srv := New(Config{JWTSecret: "secret", PolkaKey: "key"}, nil)
+	registered := map[string]bool{}
+	for _, pattern := range srv.routes {
+		// Patterns without a method, like the /app/ fileserver, are documented as GET.
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			method, path = "GET", pattern
+		}
+		method = strings.ToLower(method)
+		registered[method+" "+path] = true
+		if _, ok := doc.Paths[path][method]; !ok {
+			t.Errorf("route %q is missing from openapi.json", pattern)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			if !registered[method+" "+path] {
+				t.Errorf("openapi.json documents %s %s, which is not registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIReferencesResolve(t *testing.T) {
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var refs []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				refs = append(refs, ref)
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	var raw any
+	json.Unmarshal(openAPISpec, &raw)
+	walk(raw)
+
+	slices.Sort(refs)
+	for _, ref := range slices.Compact(refs) {
+		parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+		if len(parts) != 2 || doc.Components[parts[0]][parts[1]] == nil {
+			t.Errorf("unresolved reference %q", ref)
+		}
+	}
+}
+
+func TestDocsPagePinsSwaggerUI(t *testing.T) {
+	if !regexp.MustCompile(`swagger-ui-dist@\d+\.\d+\.\d+$`).MatchString(swaggerUI) {
+		t.Errorf("expected an exact Swagger UI version, got %q", swaggerUI)
+	}
+	for _, src := range regexp.MustCompile(`(?:src|href)="([^"]+)"`).FindAllStringSubmatch(docsPage, -1) {
+		if !strings.HasPrefix(src[1], swaggerUI+"/") || !strings.Contains(docsCSP, src[1]) {
+			t.Errorf("docs page loads %q, which the CSP doesn't pin", src[1])
+		}
+	}
+
+	inline := regexp.MustCompile(`(?s)<script>(.*?)</script>`).FindAllStringSubmatch(docsPage, -1)
+	if len(inline) != 1 {
+		t.Fatalf("expected one inline script, got %d", len(inline))
+	}
+	sum := sha256.Sum256([]byte(inline[0][1]))
+	if hash := "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"; !strings.Contains(docsCSP, hash) {
+		t.Errorf("CSP %q doesn't allow the inline script %s", docsCSP, hash)
+	}
+}
@@ -0,0 +1,541 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// webhookBatchSize is how many deliveries one claim takes; they are
+	// attempted concurrently.
+	webhookBatchSize = 20
+	// webhookLeaseSeconds must outlast webhookTimeout. An instance that dies
+	// mid-attempt leaves the delivery to be retried once the lease runs out.
+	webhookLeaseSeconds = 60
+	webhookTimeout      = 10 * time.Second
+	// maxWebhookBackoff caps the doubling delay between attempts.
+	maxWebhookBackoff = time.Hour
+	// webhookDeliveriesPage is how many deliveries the log lists, newest first.
+	webhookDeliveriesPage = 100
+)
+
+// errWebhookAddressForbidden is returned when a webhook would reach an
+// address on the server's own network.
+var errWebhookAddressForbidden = errors.New("webhook: address not allowed")
+
+// webhookStatusError is a delivery the endpoint answered with a non-2xx status.
+type webhookStatusError struct{ status int }
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("endpoint answered %d", e.status)
+}
+
+// forbiddenWebhookPrefixes are the ranges a user's webhook has no business
+// reaching: this host, private and shared networks, multicast, reserved space,
+// and the IPv6 encodings that can carry any of those IPv4 addresses.
+var forbiddenWebhookPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link-local, cloud metadata
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved and broadcast
+	netip.MustParsePrefix("::/96"),           // unspecified, loopback, IPv4-compatible
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("2001::/32"),       // Teredo
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+	netip.MustParsePrefix("fe80::/10"),       // link-local
+	netip.MustParsePrefix("fec0::/10"),       // site-local
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+}
+
+// forbiddenWebhookAddr reports whether ip is in forbiddenWebhookPrefixes.
+// IPv4-mapped IPv6 addresses are checked as the IPv4 address they carry.
+func forbiddenWebhookAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range forbiddenWebhookPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// newWebhookClient returns the client deliveries are sent with. Unless
+// allowPrivate is set, it refuses forbidden addresses at dial time, after DNS
+// resolution, so neither a hostname nor a rebinding DNS server can point it
+// at one. It never follows redirects: a delivery goes to the registered URL
+// or nowhere.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if forbiddenWebhookAddr(addrPort.Addr()) {
+				return errWebhookAddressForbidden
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the connection on our behalf, past the check.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// deliveryError describes a failed attempt for the delivery log, which the
+// endpoint's owner reads. Transport errors name addresses and ports on the
+// server's side, so only their kind is recorded; the full error is logged.
+func deliveryError(err error) string {
+	var answered *webhookStatusError
+	switch {
+	case errors.As(err, &answered):
+		return answered.Error()
+	case errors.Is(err, errWebhookAddressForbidden):
+		return "endpoint address is not allowed"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return "endpoint timed out"
+	default:
+		return "couldn't connect to endpoint"
+	}
+}
+
+// WebhookEndpoint is a URL that receives signed events. Secret is only
+// returned when the endpoint is created.
+type WebhookEndpoint struct {
+	ID        uuid.UUID `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	AllUsers  bool      `json:"all_users"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toWebhookEndpoint(endpoint database.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		ID:        endpoint.ID,
+		URL:       endpoint.Url,
+		Events:    endpoint.Events,
+		AllUsers:  endpoint.AllUsers,
+		CreatedAt: endpoint.CreatedAt,
+	}
+}
+
+type WebhookEndpointParameters struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// AllUsers subscribes to every user's events. Admins only.
+	AllUsers bool `json:"all_users"`
+}
+
+// WebhookDelivery is one event sent, or being sent, to an endpoint. Status is
+// pending until it is delivered or runs out of attempts and is dead.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int32          `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+func toWebhookDelivery(delivery database.WebhookDelivery) WebhookDelivery {
+	returned := WebhookDelivery{
+		ID:        delivery.ID,
+		EventID:   delivery.EventID,
+		EventType: delivery.EventType,
+		Status:    delivery.Status,
+		Attempts:  delivery.Attempts,
+		LastError: delivery.LastError,
+		CreatedAt: delivery.CreatedAt,
+		Payload:   json.RawMessage(delivery.Payload),
+	}
+	if delivery.Status == "pending" {
+		returned.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.LastAttemptAt.Valid {
+		returned.LastAttemptAt = &delivery.LastAttemptAt.Time
+	}
+	if delivery.ResponseStatus.Valid {
+		returned.ResponseStatus = &delivery.ResponseStatus.Int32
+	}
+	return returned
+}
+
+func (cfg *apiConfig) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+	role, _ := roleFromContext(r.Context())
+	params := WebhookEndpointParameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	if cfg.rejectRestrictedUser(w, r, userID) {
+		return
+	}
+
+	target, err := url.Parse(params.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "url must be an absolute http or https URL", err)
+		return
+	}
+	// Hostnames are checked when they are resolved, at each delivery.
+	if ip, err := netip.ParseAddr(target.Hostname()); err == nil && !cfg.webhookPrivate && forbiddenWebhookAddr(ip) {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "url must not point at a private address", nil)
+		return
+	}
+	if len(params.Events) == 0 {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "events must list at least one event", nil)
+		return
+	}
+	for _, event := range params.Events {
+		if !slices.Contains(WebhookEventTypes, event) {
+			respondWithError(w, r, http.StatusBadRequest, codeValidation, fmt.Sprintf("Unknown event %q", event), nil)
+			return
+		}
+	}
+	if params.AllUsers && !role.Allows(auth.RoleAdmin) {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Only admins can subscribe to all users' events", nil)
+		return
+	}
+
+	events := slices.Clone(params.Events)
+	slices.Sort(events)
+	endpoint, err := cfg.dbQueries.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID:   userID,
+		Url:      target.String(),
+		Secret:   auth.MakeWebhookSecret(),
+		Events:   slices.Compact(events),
+		AllUsers: params.AllUsers,
+	})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't create webhook", err)
+		return
+	}
+	returned := toWebhookEndpoint(endpoint)
+	returned.Secret = endpoint.Secret
+	respondWithJSON(w, http.StatusCreated, returned)
+}
+
+func (cfg *apiConfig) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, _ := userIDFromContext(r.Context())
+	endpoints, err := cfg.dbQueries.ListWebhookEndpoints(r.Context(), userID)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't get webhooks", err)
+		return
+	}
+	returned := make([]WebhookEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		returned = append(returned, toWebhookEndpoint(endpoint))
+	}
+	respondWithJSON(w, http.StatusOK, returned)
+}
+
+// ownWebhook looks up {webhookID}. Other users' endpoints are not found.
+func (cfg *apiConfig) ownWebhook(w http.ResponseWriter, r *http.Request) (database.WebhookEndpoint, bool) {
+	endpointID, ok := parseUUIDPathValue(w, r, "webhookID")
+	if !ok {
+		return database.WebhookEndpoint{}, false
+	}
+	userID, _ := userIDFromContext(r.Context())
+	endpoint, err := cfg.dbQueries.GetWebhookEndpoint(r.Context(), endpointID)
+	if err == nil && endpoint.UserID != userID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		respondWithLookupError(w, r, "Webhook", err)
+		return database.WebhookEndpoint{}, false
+	}
+	return endpoint, true
+}
+
+func (cfg *apiConfig) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, toWebhookEndpoint(endpoint))
+}
+
+// handleDeleteWebhook removes the endpoint and its delivery log. Attempts
+// already in flight still go out.
+func (cfg *apiConfig) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.dbQueries.DeleteWebhookEndpoint(r.Context(), endpoint.ID); err != nil {
+		respondWithInternalError(w, r, "Couldn't delete webhook", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListWebhookDeliveries is the endpoint's delivery log, newest first,
+// optionally narrowed with ?status=pending|delivered|dead.
+func (cfg *apiConfig) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	var status sql.NullString
+	if s := r.URL.Query().Get("status"); s != "" {
+		if !slices.Contains([]string{"pending", "delivered", "dead"}, s) {
+			respondWithError(w, r, http.StatusBadRequest, codeValidation, "status must be pending, delivered or dead", nil)
+			return
+		}
+		status = sql.NullString{String: s, Valid: true}
+	}
+
+	deliveries, err := cfg.dbQueries.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+		EndpointID: endpoint.ID,
+		Status:     status,
+		PageSize:   webhookDeliveriesPage,
+	})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't get deliveries", err)
+		return
+	}
+	returned := make([]WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		returned = append(returned, toWebhookDelivery(delivery))
+	}
+	respondWithJSON(w, http.StatusOK, returned)
+}
+
+// handleRetryWebhookDelivery sends a dead or delivered event again, with a
+// fresh set of attempts.
+func (cfg *apiConfig) handleRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.ownWebhook(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseUUIDPathValue(w, r, "deliveryID")
+	if !ok {
+		return
+	}
+	delivery, err := cfg.dbQueries.GetWebhookDelivery(r.Context(), database.GetWebhookDeliveryParams{ID: deliveryID, EndpointID: endpoint.ID})
+	if err != nil {
+		respondWithLookupError(w, r, "Delivery", err)
+		return
+	}
+
+	delivery, err = cfg.dbQueries.RetryWebhookDelivery(r.Context(), delivery.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, http.StatusConflict, codeConflict, "Delivery is already pending", nil)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't retry delivery", err)
+		return
+	}
+	cfg.wakeDeliverer()
+	respondWithJSON(w, http.StatusAccepted, toWebhookDelivery(delivery))
+}
+
+// enqueueWebhooks records a pending delivery of event for each endpoint
+// subscribed to it. The change the event reports is already committed, so
+// failures are logged rather than failing the request.
+func (cfg *apiConfig) enqueueWebhooks(ctx context.Context, event Event, userID uuid.UUID) {
+	logger := loggerFromContext(ctx).With("event", event.Type, "event_id", event.ID)
+	endpoints, err := cfg.dbQueries.ListWebhookEndpointsForEvent(ctx, database.ListWebhookEndpointsForEventParams{
+		EventType: event.Type,
+		UserID:    userID,
+	})
+	if err != nil {
+		logger.Error("Couldn't find webhooks for event", "error", err)
+		return
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Couldn't encode event", "error", err)
+		return
+	}
+	for _, endpoint := range endpoints {
+		err := cfg.dbQueries.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			EndpointID: endpoint.ID,
+			EventID:    event.ID,
+			EventType:  event.Type,
+			Payload:    string(payload),
+		})
+		if err != nil {
+			logger.Error("Couldn't queue webhook delivery", "webhook_id", endpoint.ID, "error", err)
+		}
+	}
+	cfg.wakeDeliverer()
+}
+
+// wakeDeliverer gets deliverWebhooks to look for work now rather than at its
+// next tick.
+func (cfg *apiConfig) wakeDeliverer() {
+	select {
+	case cfg.deliveryWake <- struct{}{}:
+	default:
+	}
+}
+
+// retryDelay is the wait after the given failed attempt: webhookBackoff,
+// doubling with each attempt, up to maxWebhookBackoff.
+func (cfg *apiConfig) retryDelay(attempts int32) time.Duration {
+	delay := cfg.webhookBackoff
+	for i := int32(1); i < attempts && delay < maxWebhookBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxWebhookBackoff)
+}
+
+// deliverWebhooks sends due deliveries until ctx is done. It polls every
+// second, or every backoff step if that is shorter, and whenever an event is
+// queued. ClaimWebhookDeliveries uses FOR UPDATE SKIP LOCKED, so any number
+// of instances can run this side by side.
+func (cfg *apiConfig) deliverWebhooks(ctx context.Context) {
+	ticker := time.NewTicker(min(time.Second, cfg.webhookBackoff))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-cfg.deliveryWake:
+		}
+		for ctx.Err() == nil {
+			deliveries, err := cfg.dbQueries.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+				LeaseSeconds: webhookLeaseSeconds,
+				BatchSize:    webhookBatchSize,
+			})
+			if err != nil {
+				cfg.logger.Error("Couldn't claim webhook deliveries", "error", err)
+				break
+			}
+			var wg sync.WaitGroup
+			for _, delivery := range deliveries {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					cfg.attemptDelivery(ctx, delivery)
+				}()
+			}
+			wg.Wait()
+			if len(deliveries) < webhookBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// attemptDelivery makes one attempt and records the outcome: delivered, due
+// again after a backoff, or dead once the attempts run out.
+func (cfg *apiConfig) attemptDelivery(ctx context.Context, delivery database.WebhookDelivery) {
+	logger := cfg.logger.With("delivery_id", delivery.ID, "webhook_id", delivery.EndpointID, "event", delivery.EventType, "attempt", delivery.Attempts)
+	endpoint, err := cfg.dbQueries.GetWebhookEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		// A deleted endpoint takes its deliveries with it.
+		if !errors.Is(err, sql.ErrNoRows) {
+			logger.Error("Couldn't load webhook", "error", err)
+		}
+		return
+	}
+
+	status, err := cfg.sendWebhook(ctx, endpoint, delivery)
+	if ctx.Err() != nil {
+		// Shutting down: the lease runs out and another attempt follows.
+		return
+	}
+	params := database.RecordWebhookAttemptParams{ID: delivery.ID, Status: "delivered"}
+	if status != 0 {
+		params.ResponseStatus = sql.NullInt32{Int32: int32(status), Valid: true}
+	}
+	result := "delivered"
+	if err != nil {
+		params.LastError = deliveryError(err)
+		if delivery.Attempts >= int32(cfg.webhookAttempts) {
+			params.Status, result = "dead", "dead"
+			logger.Warn("Webhook delivery failed for the last time", "error", err)
+		} else {
+			delay := cfg.retryDelay(delivery.Attempts)
+			params.Status, result = "pending", "retry"
+			params.RetryInSeconds = delay.Seconds()
+			logger.Info("Webhook delivery failed; will retry", "error", err, "retry_in", delay)
+		}
+	}
+	cfg.metrics.webhookDeliveries.WithLabelValues(result).Inc()
+	if err := cfg.dbQueries.RecordWebhookAttempt(ctx, params); err != nil {
+		logger.Error("Couldn't record webhook attempt", "error", err)
+	}
+}
+
+// sendWebhook POSTs the delivery's payload, signed with the endpoint's secret.
+// Any 2xx is success. status is 0 if no response came back.
+func (cfg *apiConfig) sendWebhook(ctx context.Context, endpoint database.WebhookEndpoint, delivery database.WebhookDelivery) (status int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks")
+	req.Header.Set("X-Chirpy-Event", delivery.EventType)
+	req.Header.Set("X-Chirpy-Delivery", delivery.ID.String())
+	req.Header.Set(auth.WebhookSignatureHeader, auth.SignWebhook(endpoint.Secret, time.Now(), body))
+
+	resp, err := cfg.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, &webhookStatusError{status: resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,266 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+// webhookReceiver records the events POSTed to it, failing them while fail is set.
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	secret   string
+	fail     bool
+	received []server.Event
+	errs     []error
+	// changed fires after every request.
+	changed broadcast
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	rcv := &webhookReceiver{}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		defer rcv.changed.notify()
+		if err := auth.VerifyWebhookSignature(rcv.secret, r.Header.Get(auth.WebhookSignatureHeader), body, time.Now(), time.Minute); err != nil {
+			rcv.errs = append(rcv.errs, err)
+		}
+		var event server.Event
+		if err := json.Unmarshal(body, &event); err != nil || event.Type != r.Header.Get("X-Chirpy-Event") {
+			rcv.errs = append(rcv.errs, fmt.Errorf("unexpected body %s for %s: %v", body, r.Header.Get("X-Chirpy-Event"), err))
+		}
+		if rcv.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rcv.received = append(rcv.received, event)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *webhookReceiver) events() []server.Event {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return slices.Clone(rcv.received)
+}
+
+func (rcv *webhookReceiver) setFail(fail bool) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.fail = fail
+}
+
+func TestOutboundWebhooks(t *testing.T) {
+	c := newTestClient(t, func(cfg *server.Config) {
+		cfg.WebhookMaxAttempts = 2
+		cfg.WebhookBackoff = 10 * time.Millisecond
+		cfg.WebhookAllowPrivateNetworks = true
+	})
+	ada := c.signUp("ada@example.com", "password")
+	bob := c.signUp("bob@example.com", "password")
+	admin := c.signUpWithRole("admin@example.com", "admin")
+	adas, watcher := newWebhookReceiver(t), newWebhookReceiver(t)
+
+	subscribe := func(s session, body map[string]any) *http.Response {
+		return c.do("POST", "/api/webhooks", s.bearer(), body)
+	}
+	expectProblem(t, subscribe(ada, map[string]any{"url": "ftp://example.com", "events": []string{"chirp.created"}}), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, subscribe(ada, map[string]any{"url": adas.URL, "events": []string{}}), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, subscribe(ada, map[string]any{"url": adas.URL, "events": []string{"chirp.liked"}}), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, subscribe(ada, map[string]any{"url": adas.URL, "events": []string{"chirp.created"}, "all_users": true}), http.StatusForbidden, "forbidden")
+	expectProblem(t, subscribe(session{}, map[string]any{"url": adas.URL, "events": []string{"chirp.created"}}), http.StatusUnauthorized, "unauthorized")
+
+	resp := subscribe(ada, map[string]any{"url": adas.URL, "events": []string{"chirp.deleted", "chirp.created"}})
+	expectStatus(t, resp, http.StatusCreated)
+	endpoint := decodeBody[server.WebhookEndpoint](t, resp)
+	if !strings.HasPrefix(endpoint.Secret, "whsec_") || !slices.Equal(endpoint.Events, []string{"chirp.created", "chirp.deleted"}) {
+		t.Fatalf("expected a secret and sorted events, got %+v", endpoint)
+	}
+	adas.secret = endpoint.Secret
+	resp = subscribe(admin, map[string]any{"url": watcher.URL, "events": []string{"chirp.created"}, "all_users": true})
+	expectStatus(t, resp, http.StatusCreated)
+	watcher.secret = decodeBody[server.WebhookEndpoint](t, resp).Secret
+
+	resp = c.do("GET", "/api/webhooks", ada.bearer(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	if got := decodeBody[[]server.WebhookEndpoint](t, resp); len(got) != 1 || got[0].ID != endpoint.ID || got[0].Secret != "" {
+		t.Errorf("expected ada's endpoint without its secret, got %+v", got)
+	}
+	path := "/api/webhooks/" + endpoint.ID.String()
+	expectProblem(t, c.do("GET", path, bob.bearer(), nil), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("GET", path+"/deliveries", bob.bearer(), nil), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("DELETE", path, bob.bearer(), nil), http.StatusNotFound, "not_found")
+
+	// Ada hears about her own chirps; the admin's all-users endpoint about everyone's.
+	c.createChirp(bob, "bob's")
+	chirp := c.createChirp(ada, "ada's")
+	waitFor(t, "both chirps to reach the all-users endpoint", &watcher.changed, func() bool { return len(watcher.events()) == 2 })
+	waitFor(t, "ada's chirp to reach her endpoint", &adas.changed, func() bool { return len(adas.events()) == 1 })
+	got := adas.events()[0]
+	if got.Type != "chirp.created" || got.ID == uuid.Nil {
+		t.Errorf("unexpected event %+v", got)
+	}
+	if data, _ := got.Data.(map[string]any); data["id"] != chirp.ID.String() || data["body"] != "ada's" {
+		t.Errorf("expected the chirp as the event data, got %+v", got.Data)
+	}
+
+	// Failures are retried until the attempts run out.
+	adas.setFail(true)
+	expectStatus(t, c.do("DELETE", "/api/chirps/"+chirp.ID.String(), ada.bearer(), nil), http.StatusNoContent)
+	deliveries := func(query string) []server.WebhookDelivery {
+		t.Helper()
+		resp := c.do("GET", path+"/deliveries"+query, ada.bearer(), nil)
+		expectStatus(t, resp, http.StatusOK)
+		return decodeBody[[]server.WebhookDelivery](t, resp)
+	}
+	waitFor(t, "the failing delivery to die", &c.store.changed, func() bool { return len(deliveries("?status=dead")) == 1 })
+	dead := deliveries("?status=dead")[0]
+	if dead.EventType != "chirp.deleted" || dead.Attempts != 2 || dead.ResponseStatus == nil || *dead.ResponseStatus != 500 ||
+		dead.LastError != "endpoint answered 500" || dead.NextAttemptAt != nil {
+		t.Errorf("unexpected dead delivery %+v", dead)
+	}
+	if all := deliveries(""); len(all) != 2 || all[0].ID != dead.ID || all[1].Status != "delivered" {
+		t.Errorf("expected the dead delivery before the delivered one, got %+v", all)
+	}
+	expectProblem(t, c.do("GET", path+"/deliveries?status=lost", ada.bearer(), nil), http.StatusBadRequest, "validation_failed")
+
+	adas.setFail(false)
+	retry := path + "/deliveries/" + dead.ID.String() + "/retry"
+	expectProblem(t, c.do("POST", path+"/deliveries/"+uuid.NewString()+"/retry", ada.bearer(), nil), http.StatusNotFound, "not_found")
+	expectStatus(t, c.do("POST", retry, ada.bearer(), nil), http.StatusAccepted)
+	waitFor(t, "the retried delivery", &adas.changed, func() bool { return len(adas.events()) == 2 })
+	if got := adas.events()[1]; got.Type != "chirp.deleted" || got.ID != dead.EventID {
+		t.Errorf("expected the same chirp.deleted event again, got %+v", got)
+	}
+	waitFor(t, "the retry to be recorded", &c.store.changed, func() bool { return len(deliveries("?status=delivered")) == 2 })
+
+	expectStatus(t, c.do("DELETE", path, ada.bearer(), nil), http.StatusNoContent)
+	expectProblem(t, c.do("GET", path, ada.bearer(), nil), http.StatusNotFound, "not_found")
+	for _, rcv := range []*webhookReceiver{adas, watcher} {
+		rcv.mu.Lock()
+		if len(rcv.errs) != 0 {
+			t.Errorf("receiver saw bad requests: %v", rcv.errs)
+		}
+		rcv.mu.Unlock()
+	}
+}
+
+func TestWebhooksRefusePrivateAddresses(t *testing.T) {
+	c := newTestClient(t, func(cfg *server.Config) { cfg.WebhookMaxAttempts = 1 })
+	ada := c.signUp("ada@example.com", "password")
+	rcv := newWebhookReceiver(t)
+
+	for _, tc := range []struct {
+		name, host string
+		forbidden  bool
+	}{
+		{"this network", "0.1.2.3", true},
+		{"private 10/8", "10.0.0.1", true},
+		{"carrier-grade NAT", "100.64.0.1", true},
+		{"loopback", "127.0.0.1", true},
+		{"link-local", "169.254.169.254", true},
+		{"private 172.16/12", "172.31.255.255", true},
+		{"IETF protocol assignments", "192.0.0.8", true},
+		{"documentation", "192.0.2.1", true},
+		{"private 192.168/16", "192.168.1.1", true},
+		{"benchmarking", "198.19.0.1", true},
+		{"multicast", "239.255.255.250", true},
+		{"broadcast", "255.255.255.255", true},
+		{"IPv6 unspecified", "[::]", true},
+		{"IPv6 loopback", "[::1]", true},
+		{"IPv4-mapped loopback", "[::ffff:127.0.0.1]", true},
+		{"IPv4-compatible loopback", "[::127.0.0.1]", true},
+		{"NAT64 loopback", "[64:ff9b::7f00:1]", true},
+		{"local-use NAT64", "[64:ff9b:1::a00:1]", true},
+		{"discard", "[100::1]", true},
+		{"Teredo", "[2001:0:4136:e378:8000:63bf:3fff:fdd2]", true},
+		{"6to4 private", "[2002:a00:1::1]", true},
+		{"unique local", "[fd00::1]", true},
+		{"IPv6 link-local", "[fe80::1]", true},
+		{"site-local", "[fec0::1]", true},
+		{"interface-local multicast", "[ff01::1]", true},
+		{"IPv6 multicast", "[ff02::1]", true},
+		{"public IPv4", "93.184.216.34", false},
+		{"public IPv6", "[2606:4700::1111]", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body := map[string]any{"url": "http://" + tc.host + ":8080/hook", "events": []string{"chirp.created"}}
+			resp := c.do("POST", "/api/webhooks", ada.bearer(), body)
+			if tc.forbidden {
+				expectProblem(t, resp, http.StatusBadRequest, "validation_failed")
+				return
+			}
+			expectStatus(t, resp, http.StatusCreated)
+			// Deleted straight away so the chirp below isn't sent out.
+			endpoint := decodeBody[server.WebhookEndpoint](t, resp)
+			expectStatus(t, c.do("DELETE", "/api/webhooks/"+endpoint.ID.String(), ada.bearer(), nil), http.StatusNoContent)
+		})
+	}
+	body := map[string]any{"url": rcv.URL, "events": []string{"chirp.created"}}
+	expectProblem(t, c.do("POST", "/api/webhooks", ada.bearer(), body), http.StatusBadRequest, "validation_failed")
+
+	// A hostname is only resolved when the delivery is made.
+	_, port, _ := strings.Cut(strings.TrimPrefix(rcv.URL, "http://"), ":")
+	body = map[string]any{"url": "http://localhost:" + port, "events": []string{"chirp.created"}}
+	resp := c.do("POST", "/api/webhooks", ada.bearer(), body)
+	expectStatus(t, resp, http.StatusCreated)
+	path := "/api/webhooks/" + decodeBody[server.WebhookEndpoint](t, resp).ID.String()
+	c.createChirp(ada, "hello")
+
+	var dead []server.WebhookDelivery
+	waitFor(t, "the delivery to die", &c.store.changed, func() bool {
+		resp := c.do("GET", path+"/deliveries?status=dead", ada.bearer(), nil)
+		dead = decodeBody[[]server.WebhookDelivery](t, resp)
+		return len(dead) == 1
+	})
+	if dead[0].LastError != "endpoint address is not allowed" || dead[0].ResponseStatus != nil {
+		t.Errorf("unexpected dead delivery %+v", dead[0])
+	}
+	if len(rcv.events()) != 0 {
+		t.Error("the private endpoint was reached")
+	}
+}
+
+func TestWebhooksDoNotFollowRedirects(t *testing.T) {
+	c := newTestClient(t, func(cfg *server.Config) {
+		cfg.WebhookMaxAttempts = 1
+		cfg.WebhookAllowPrivateNetworks = true
+	})
+	ada := c.signUp("ada@example.com", "password")
+	rcv := newWebhookReceiver(t)
+	redirect := httptest.NewServer(http.RedirectHandler(rcv.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+
+	resp := c.do("POST", "/api/webhooks", ada.bearer(), map[string]any{"url": redirect.URL, "events": []string{"chirp.created"}})
+	expectStatus(t, resp, http.StatusCreated)
+	path := "/api/webhooks/" + decodeBody[server.WebhookEndpoint](t, resp).ID.String()
+	c.createChirp(ada, "hello")
+
+	var dead []server.WebhookDelivery
+	waitFor(t, "the delivery to die", &c.store.changed, func() bool {
+		resp := c.do("GET", path+"/deliveries?status=dead", ada.bearer(), nil)
+		dead = decodeBody[[]server.WebhookDelivery](t, resp)
+		return len(dead) == 1
+	})
+	if dead[0].ResponseStatus == nil || *dead[0].ResponseStatus != http.StatusTemporaryRedirect {
+		t.Errorf("expected the redirect to be recorded, got %+v", dead[0])
+	}
+	if len(rcv.events()) != 0 {
+		t.Error("the redirect was followed")
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarBytes       = 1 << 20
+)
+
+// handlePattern is what a handle may look like. Keeping to ASCII word
+// characters means a handle can sit in a URL path or after an @ unescaped.
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// reservedHandles can't be claimed, case-insensitively: they would shadow a
+// route, impersonate the service or read as a placeholder.
+var reservedHandles = map[string]bool{
+	"admin": true, "administrator": true, "anonymous": true, "api": true,
+	"app": true, "chirpy": true, "deleted": true, "docs": true,
+	"everyone": true, "feed": true, "help": true, "here": true,
+	"login": true, "logout": true, "me": true, "metrics": true,
+	"mod": true, "moderator": true, "null": true, "root": true,
+	"settings": true, "signup": true, "staff": true, "support": true,
+	"system": true, "undefined": true, "webhooks": true,
+}
+
+// avatarTypes maps the sniffed content types accepted as avatars to the file
+// extension data exports use for them.
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Profile is the public view of a user. It never carries the email.
+type Profile struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+	ChirpCount  int64     `json:"chirp_count"`
+	// FollowerCount leaves out deleted and banned followers.
+	FollowerCount int64     `json:"follower_count"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func toProfile(profile database.GetUserProfileRow) Profile {
+	out := Profile{
+		ID:            profile.ID,
+		Handle:        profile.Handle.String,
+		DisplayName:   profile.DisplayName,
+		Bio:           profile.Bio,
+		ChirpCount:    profile.ChirpCount,
+		FollowerCount: profile.FollowerCount,
+		CreatedAt:     profile.CreatedAt.Time,
+	}
+	if profile.AvatarUpdatedAt.Valid {
+		out.AvatarURL = "/api/users/" + profile.Handle.String + "/avatar"
+	}
+	return out
+}
+
+// validateHandle returns why handle can't be claimed, or "" if it can.
+func validateHandle(handle string) string {
+	if !handlePattern.MatchString(handle) {
+		return "handle must be 3 to 30 letters, digits or underscores"
+	}
+	if reservedHandles[strings.ToLower(handle)] {
+		return "handle is reserved"
+	}
+	return ""
+}
+
+// handleUpdateProfile sets the caller's handle, display name and bio. The
+// handle is required and unique regardless of case; a user may change the
+// case of their own. The unique index settles two users claiming the same
+// handle at once.
+func (cfg *apiConfig) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if cfg.rejectRestrictedUser(w, r, userID) {
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	if msg := validateHandle(params.Handle); msg != "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, msg, nil)
+		return
+	}
+	params.DisplayName = strings.TrimSpace(params.DisplayName)
+	if utf8.RuneCountInString(params.DisplayName) > maxDisplayNameLength {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "display_name must be at most 50 characters", nil)
+		return
+	}
+	params.Bio = strings.TrimSpace(params.Bio)
+	if utf8.RuneCountInString(params.Bio) > maxBioLength {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "bio must be at most 160 characters", nil)
+		return
+	}
+
+	user, err := cfg.dbQueries.UpdateUserProfile(r.Context(), database.UpdateUserProfileParams{
+		Handle:      params.Handle,
+		DisplayName: params.DisplayName,
+		Bio:         params.Bio,
+		ID:          userID,
+	})
+	if database.IsUniqueViolation(err) {
+		respondWithError(w, r, http.StatusConflict, codeConflict, "handle is already taken", err)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't update profile", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, toUser(user))
+}
+
+// handleGetProfile is the public profile for a handle. Deleted, anonymized
+// and banned accounts are not found.
+func (cfg *apiConfig) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := cfg.dbQueries.GetUserProfile(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		respondWithLookupError(w, r, "User", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, toProfile(profile))
+}
+
+// handleSetAvatar replaces the caller's avatar with the raw request body. The
+// type is sniffed from the bytes rather than trusted from Content-Type, since
+// the image is served back to browsers.
+func (cfg *apiConfig) handleSetAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if cfg.rejectRestrictedUser(w, r, userID) {
+		return
+	}
+
+	image, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAvatarBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, r, http.StatusRequestEntityTooLarge, codeValidation, "avatar must be at most 1 MiB", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "Couldn't read avatar", err)
+		return
+	}
+	contentType := http.DetectContentType(image)
+	if len(image) == 0 || avatarTypes[contentType] == "" {
+		respondWithError(w, r, http.StatusUnsupportedMediaType, codeValidation, "avatar must be a PNG, JPEG, GIF or WebP image", nil)
+		return
+	}
+
+	if err := cfg.dbQueries.SetUserAvatar(r.Context(), database.SetUserAvatarParams{
+		UserID:      userID,
+		ContentType: contentType,
+		Image:       image,
+	}); err != nil {
+		respondWithInternalError(w, r, "Couldn't save avatar", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleDeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := cfg.dbQueries.DeleteUserAvatar(r.Context(), userID)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't delete avatar", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, r, http.StatusNotFound, codeNotFound, "Avatar not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGetAvatar serves the avatar for a handle, revalidated against the
+// time it was uploaded.
+func (cfg *apiConfig) handleGetAvatar(w http.ResponseWriter, r *http.Request) {
+	profile, err := cfg.dbQueries.GetUserProfile(r.Context(), r.PathValue("handle"))
+	if err == nil && !profile.AvatarUpdatedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		respondWithLookupError(w, r, "Avatar", err)
+		return
+	}
+	avatar, err := cfg.dbQueries.GetUserAvatar(r.Context(), profile.ID)
+	if err != nil {
+		respondWithLookupError(w, r, "Avatar", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", avatar.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", chirpCacheControl)
+	http.ServeContent(w, r, "", avatar.UpdatedAt, bytes.NewReader(avatar.Image))
+}
@@ -0,0 +1,115 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+func TestProfiles(t *testing.T) {
+	c := newTestClient(t)
+	ada := c.signUp("ada@example.com", "password")
+	bob := c.signUp("bob@example.com", "password")
+	c.createChirp(ada, "hello")
+	c.createChirp(ada, "again")
+
+	expectProblem(t, c.do("PUT", "/api/users/me/profile", "", map[string]string{"handle": "ada"}), http.StatusUnauthorized, "unauthorized")
+	for _, handle := range []string{"", "ab", "ada lovelace", "ada!", strings.Repeat("a", 31), "Admin", "ME"} {
+		expectProblem(t, c.do("PUT", "/api/users/me/profile", ada.bearer(), map[string]string{"handle": handle}), http.StatusBadRequest, "validation_failed")
+	}
+	expectProblem(t, c.do("PUT", "/api/users/me/profile", ada.bearer(), map[string]string{"handle": "ada", "bio": strings.Repeat("é", 161)}),
+		http.StatusBadRequest, "validation_failed")
+
+	resp := c.do("PUT", "/api/users/me/profile", ada.bearer(), map[string]string{"handle": "Ada", "display_name": " Ada Lovelace ", "bio": "Poetical science"})
+	expectStatus(t, resp, http.StatusOK)
+	if user := decodeBody[server.User](t, resp); user.Handle != "Ada" || user.DisplayName != "Ada Lovelace" || user.Bio != "Poetical science" {
+		t.Errorf("unexpected user after setting a profile: %+v", user)
+	}
+	expectProblem(t, c.do("PUT", "/api/users/me/profile", bob.bearer(), map[string]string{"handle": "ADA"}), http.StatusConflict, "conflict")
+	expectStatus(t, c.do("PUT", "/api/users/me/profile", ada.bearer(), map[string]string{"handle": "ada", "display_name": "Ada Lovelace"}), http.StatusOK)
+
+	resp = c.do("GET", "/api/users/ADA", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "ada@example.com") {
+		t.Errorf("expected the public profile to leave out the email, got %s", body)
+	}
+	var profile server.Profile
+	if err := json.Unmarshal(body, &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.ID != ada.ID || profile.Handle != "ada" || profile.DisplayName != "Ada Lovelace" || profile.Bio != "" ||
+		profile.ChirpCount != 2 || profile.AvatarURL != "" {
+		t.Errorf("unexpected profile: %+v", profile)
+	}
+	expectProblem(t, c.do("GET", "/api/users/nobody", "", nil), http.StatusNotFound, "not_found")
+
+	expectProblem(t, c.do("GET", "/api/users/ada/avatar", "", nil), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("PUT", "/api/users/me/avatar", ada.bearer(), "<svg onload=alert(1)>"), http.StatusUnsupportedMediaType, "validation_failed")
+	expectProblem(t, c.do("PUT", "/api/users/me/avatar", ada.bearer(), strings.Repeat("\x00", 1<<20+1)),
+		http.StatusRequestEntityTooLarge, "validation_failed")
+	png := "\x89PNG\r\n\x1a\n" + "not really a png"
+	expectStatus(t, c.do("PUT", "/api/users/me/avatar", ada.bearer(), png), http.StatusNoContent)
+
+	profile = decodeBody[server.Profile](t, c.do("GET", "/api/users/ada", "", nil))
+	if profile.AvatarURL != "/api/users/ada/avatar" {
+		t.Fatalf("expected an avatar URL, got %q", profile.AvatarURL)
+	}
+	resp = c.do("GET", profile.AvatarURL, "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if got := resp.Header.Get("Content-Type"); got != "image/png" || resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("expected a nosniff image/png, got %q", got)
+	}
+	if got, _ := io.ReadAll(resp.Body); string(got) != png {
+		t.Errorf("expected the uploaded bytes back, got %q", got)
+	}
+	lastModified := resp.Header.Get("Last-Modified")
+	expectStatus(t, c.get(profile.AvatarURL, http.Header{"If-Modified-Since": {lastModified}}), http.StatusNotModified)
+
+	expectStatus(t, c.do("DELETE", "/api/users/me/avatar", ada.bearer(), nil), http.StatusNoContent)
+	expectProblem(t, c.do("DELETE", "/api/users/me/avatar", ada.bearer(), nil), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("GET", profile.AvatarURL, "", nil), http.StatusNotFound, "not_found")
+
+	expectStatus(t, c.do("DELETE", "/api/users/me", ada.bearer(), map[string]string{"password": "password"}), http.StatusNoContent)
+	expectProblem(t, c.do("GET", "/api/users/ada", "", nil), http.StatusNotFound, "not_found")
+	// The handle is free again.
+	expectStatus(t, c.do("PUT", "/api/users/me/profile", bob.bearer(), map[string]string{"handle": "ada"}), http.StatusOK)
+}
+
+func TestFollows(t *testing.T) {
+	c := newTestClient(t)
+	ada := c.signUp("ada@example.com", "password")
+	bob := c.signUp("bob@example.com", "password")
+	cy := c.signUp("cy@example.com", "password")
+	expectStatus(t, c.do("PUT", "/api/users/me/profile", ada.bearer(), map[string]string{"handle": "ada"}), http.StatusOK)
+	follow := "/api/users/" + ada.ID.String() + "/follow"
+	followers := func() int64 {
+		t.Helper()
+		return decodeBody[server.Profile](t, c.do("GET", "/api/users/ada", "", nil)).FollowerCount
+	}
+
+	expectProblem(t, c.do("PUT", follow, "", nil), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("PUT", follow, ada.bearer(), nil), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, c.do("PUT", "/api/users/"+uuid.NewString()+"/follow", bob.bearer(), nil), http.StatusNotFound, "not_found")
+	expectStatus(t, c.do("PUT", follow, bob.bearer(), nil), http.StatusNoContent)
+	expectStatus(t, c.do("PUT", follow, bob.bearer(), nil), http.StatusNoContent)
+	expectStatus(t, c.do("PUT", follow, cy.bearer(), nil), http.StatusNoContent)
+	if n := followers(); n != 2 {
+		t.Errorf("expected two followers, got %d", n)
+	}
+
+	expectStatus(t, c.do("DELETE", follow, bob.bearer(), nil), http.StatusNoContent)
+	expectProblem(t, c.do("DELETE", follow, bob.bearer(), nil), http.StatusNotFound, "not_found")
+
+	// A block ends the follow and stops it coming back.
+	expectStatus(t, c.do("PUT", "/api/users/"+cy.ID.String()+"/block", ada.bearer(), nil), http.StatusNoContent)
+	if n := followers(); n != 0 {
+		t.Errorf("expected the block to remove cy's follow, got %d followers", n)
+	}
+	expectProblem(t, c.do("PUT", follow, cy.bearer(), nil), http.StatusForbidden, "forbidden")
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Blocks hide chirps both ways and stop the two users messaging each other.
+// Mutes only hide the target's chirps from the muter, who stays reachable.
+const (
+	relationshipBlock = "block"
+	relationshipMute  = "mute"
+)
+
+var relationshipPastTense = map[string]string{
+	relationshipBlock: "blocked",
+	relationshipMute:  "muted",
+}
+
+// Relationship is a user the caller has blocked, muted or followed.
+type Relationship struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// optionalViewer authenticates the caller if they sent an Authorization
+// header. Without one the request is anonymous; with a bad one it fails, so
+// a client whose token has expired isn't silently shown unfiltered chirps.
+func (cfg *apiConfig) optionalViewer(w http.ResponseWriter, r *http.Request) (uuid.NullUUID, bool) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}, true
+	}
+	userID, ok := cfg.authenticate(w, r)
+	return uuid.NullUUID{UUID: userID, Valid: ok}, ok
+}
+
+// rejectBlocked responds with a 403 and returns true when either user has
+// blocked the other. It doesn't say which.
+func (cfg *apiConfig) rejectBlocked(w http.ResponseWriter, r *http.Request, userID, otherID uuid.UUID) bool {
+	blocked, err := cfg.dbQueries.IsBlockedBetween(r.Context(), database.IsBlockedBetweenParams{UserA: userID, UserB: otherID})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't check blocks", err)
+		return true
+	}
+	if blocked {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "You can't message this user", nil)
+		return true
+	}
+	return false
+}
+
+// handleAddRelationship blocks or mutes the user in the path. Doing it twice
+// is not an error.
+func (cfg *apiConfig) handleAddRelationship(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := cfg.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if cfg.rejectRestrictedUser(w, r, userID) {
+			return
+		}
+		targetID, ok := parseUUIDPathValue(w, r, "userID")
+		if !ok {
+			return
+		}
+		if targetID == userID {
+			respondWithError(w, r, http.StatusBadRequest, codeValidation, "You can't "+kind+" yourself", nil)
+			return
+		}
+		target, err := cfg.dbQueries.GetUserByID(r.Context(), targetID)
+		if err == nil && target.DeletedAt.Valid {
+			err = sql.ErrNoRows
+		}
+		if err != nil {
+			respondWithLookupError(w, r, "User", err)
+			return
+		}
+
+		// A block also ends any follows between the two.
+		err = cfg.dbQueries.InTx(r.Context(), func(ctx context.Context) error {
+			if kind == relationshipBlock {
+				if err := cfg.dbQueries.DeleteFollowsBetween(ctx, database.DeleteFollowsBetweenParams{UserA: userID, UserB: target.ID}); err != nil {
+					return err
+				}
+			}
+			return cfg.dbQueries.CreateUserRelationship(ctx, database.CreateUserRelationshipParams{
+				UserID:   userID,
+				TargetID: target.ID,
+				Kind:     kind,
+			})
+		})
+		if err != nil {
+			respondWithInternalError(w, r, "Couldn't save "+kind, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (cfg *apiConfig) handleRemoveRelationship(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := cfg.authenticate(w, r)
+		if !ok {
+			return
+		}
+		targetID, ok := parseUUIDPathValue(w, r, "userID")
+		if !ok {
+			return
+		}
+
+		n, err := cfg.dbQueries.DeleteUserRelationship(r.Context(), database.DeleteUserRelationshipParams{
+			UserID:   userID,
+			TargetID: targetID,
+			Kind:     kind,
+		})
+		if err != nil {
+			respondWithInternalError(w, r, "Couldn't remove "+kind, err)
+			return
+		}
+		if n == 0 {
+			respondWithError(w, r, http.StatusNotFound, codeNotFound, "You haven't "+relationshipPastTense[kind]+" this user", nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleListRelationships lists whom the caller has blocked or muted, most
+// recent first.
+func (cfg *apiConfig) handleListRelationships(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := cfg.authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		rows, err := cfg.dbQueries.ListUserRelationships(r.Context(), database.ListUserRelationshipsParams{UserID: userID, Kind: kind})
+		if err != nil {
+			respondWithInternalError(w, r, "Couldn't list "+kind+"s", err)
+			return
+		}
+		relationships := []Relationship{}
+		for _, row := range rows {
+			relationships = append(relationships, Relationship{UserID: row.TargetID, CreatedAt: row.CreatedAt})
+		}
+		respondWithJSON(w, http.StatusOK, relationships)
+	}
+}
+
+// handleFollowUser follows the user in the path. Doing it twice is not an
+// error; following someone either of you has blocked is.
+func (cfg *apiConfig) handleFollowUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if cfg.rejectRestrictedUser(w, r, userID) {
+		return
+	}
+	targetID, ok := parseUUIDPathValue(w, r, "userID")
+	if !ok {
+		return
+	}
+	if targetID == userID {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "You can't follow yourself", nil)
+		return
+	}
+	target, err := cfg.dbQueries.GetUserByID(r.Context(), targetID)
+	if err == nil && target.DeletedAt.Valid {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		respondWithLookupError(w, r, "User", err)
+		return
+	}
+
+	// The insert checks for a block itself, so one made concurrently can't
+	// slip between a check and the follow. An existing follow still counts
+	// as a row.
+	n, err := cfg.dbQueries.FollowUser(r.Context(), database.FollowUserParams{FollowerID: userID, FolloweeID: target.ID})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't follow user", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "You can't follow this user", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	targetID, ok := parseUUIDPathValue(w, r, "userID")
+	if !ok {
+		return
+	}
+
+	n, err := cfg.dbQueries.UnfollowUser(r.Context(), database.UnfollowUserParams{FollowerID: userID, FolloweeID: targetID})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't unfollow user", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, r, http.StatusNotFound, codeNotFound, "You don't follow this user", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,111 @@
+package server_test
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+func TestBlocksAndMutes(t *testing.T) {
+	c := newTestClient(t, func(cfg *server.Config) { cfg.ChirpCacheSize = 16 })
+	ada := c.signUp("ada@example.com", "password")
+	bob := c.signUp("bob@example.com", "password")
+	cy := c.signUp("cy@example.com", "password")
+	adas := c.createChirp(ada, "from ada")
+	bobs := c.createChirp(bob, "from bob")
+	c.createChirp(cy, "from cy")
+	seenBy := func(s session, query string) []string {
+		t.Helper()
+		resp := c.do("GET", "/api/chirps"+query, s.bearer(), nil)
+		expectStatus(t, resp, http.StatusOK)
+		if cc := resp.Header.Get("Cache-Control"); cc != "private, no-cache" {
+			t.Errorf("expected a filtered list to be cached privately, got %q", cc)
+		}
+		var bodies []string
+		for _, chirp := range decodeBody[[]server.Chirp](t, resp) {
+			bodies = append(bodies, chirp.Body)
+		}
+		return bodies
+	}
+
+	expectProblem(t, c.do("PUT", "/api/users/"+ada.ID.String()+"/block", ada.bearer(), nil), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, c.do("PUT", "/api/users/"+uuid.NewString()+"/block", ada.bearer(), nil), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("PUT", "/api/users/"+bob.ID.String()+"/block", "", nil), http.StatusUnauthorized, "unauthorized")
+	expectStatus(t, c.do("PUT", "/api/users/"+bob.ID.String()+"/block", ada.bearer(), nil), http.StatusNoContent)
+	expectStatus(t, c.do("PUT", "/api/users/"+bob.ID.String()+"/block", ada.bearer(), nil), http.StatusNoContent)
+	expectStatus(t, c.do("PUT", "/api/users/"+cy.ID.String()+"/mute", bob.bearer(), nil), http.StatusNoContent)
+
+	if got := seenBy(ada, ""); !slices.Equal(got, []string{"from ada", "from cy"}) {
+		t.Errorf("expected ada not to see bob, got %v", got)
+	}
+	if got := seenBy(bob, ""); !slices.Equal(got, []string{"from bob"}) {
+		t.Errorf("expected bob not to see the user who blocked them or the user they muted, got %v", got)
+	}
+	if got := seenBy(cy, "?author_id="+bob.ID.String()); !slices.Equal(got, []string{"from bob"}) {
+		t.Errorf("expected a mute to be one-way, got %v", got)
+	}
+	if got := seenBy(bob, "?author_id="+ada.ID.String()); len(got) != 0 {
+		t.Errorf("expected the blocker's chirps to be hidden by author too, got %v", got)
+	}
+	resp := c.do("GET", "/api/chirps", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if got := decodeBody[[]server.Chirp](t, resp); len(got) != 3 || resp.Header.Get("Cache-Control") != "public, no-cache" {
+		t.Errorf("expected anonymous listings to be unfiltered and public, got %d chirps, %q", len(got), resp.Header.Get("Cache-Control"))
+	}
+	expectProblem(t, c.do("GET", "/api/chirps", "Bearer nonsense", nil), http.StatusUnauthorized, "unauthorized")
+
+	// Single reads check blocks even when the chirp is already cached.
+	expectStatus(t, c.do("GET", "/api/chirps/"+adas.ID.String(), "", nil), http.StatusOK)
+	expectProblem(t, c.do("GET", "/api/chirps/"+adas.ID.String(), bob.bearer(), nil), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("GET", "/api/chirps/"+bobs.ID.String(), ada.bearer(), nil), http.StatusNotFound, "not_found")
+	resp = c.do("GET", "/api/chirps/"+bobs.ID.String(), cy.bearer(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	if cc := resp.Header.Get("Cache-Control"); cc != "private, no-cache" {
+		t.Errorf("expected a chirp read by a signed-in viewer to be cached privately, got %q", cc)
+	}
+	for _, path := range []string{"/chirps/feed.atom", "/users/" + ada.ID.String() + "/feed.rss"} {
+		resp := c.do("GET", path, bob.bearer(), nil)
+		expectStatus(t, resp, http.StatusOK)
+		body, _ := io.ReadAll(resp.Body)
+		if strings.Contains(string(body), "from ada") || resp.Header.Get("Cache-Control") != "private, no-cache" {
+			t.Errorf("expected %s to leave out the user who blocked bob, privately, got %q: %s", path, resp.Header.Get("Cache-Control"), body)
+		}
+	}
+
+	// Blocks stop conversations either way; mutes don't.
+	expectProblem(t, c.do("POST", "/api/conversations", bob.bearer(), map[string]any{"participant_ids": []uuid.UUID{ada.ID}}), http.StatusForbidden, "forbidden")
+	expectProblem(t, c.do("POST", "/api/conversations", ada.bearer(), map[string]any{"participant_ids": []uuid.UUID{cy.ID, bob.ID}}), http.StatusForbidden, "forbidden")
+	resp = c.do("POST", "/api/conversations", cy.bearer(), map[string]any{"participant_ids": []uuid.UUID{ada.ID, bob.ID}})
+	expectStatus(t, resp, http.StatusCreated)
+	group := decodeBody[server.Conversation](t, resp)
+	// cy could start the group, but ada and bob can't talk in it.
+	groupPath := "/api/conversations/" + group.ID.String() + "/messages"
+	expectProblem(t, c.do("POST", groupPath, bob.bearer(), map[string]string{"body": "hi all"}), http.StatusForbidden, "forbidden")
+	expectStatus(t, c.do("DELETE", "/api/users/"+bob.ID.String()+"/block", ada.bearer(), nil), http.StatusNoContent)
+	expectStatus(t, c.do("POST", groupPath, bob.bearer(), map[string]string{"body": "hi all"}), http.StatusCreated)
+	expectProblem(t, c.do("DELETE", "/api/users/"+bob.ID.String()+"/block", ada.bearer(), nil), http.StatusNotFound, "not_found")
+	if got := seenBy(ada, ""); len(got) != 3 {
+		t.Errorf("expected unblocking to show bob's chirps again, got %v", got)
+	}
+
+	expectStatus(t, c.do("PUT", "/api/users/"+ada.ID.String()+"/block", cy.bearer(), nil), http.StatusNoContent)
+	blocks := decodeBody[[]server.Relationship](t, c.do("GET", "/api/users/me/blocks", cy.bearer(), nil))
+	if len(blocks) != 1 || blocks[0].UserID != ada.ID || blocks[0].CreatedAt.IsZero() {
+		t.Errorf("unexpected blocks: %+v", blocks)
+	}
+	if mutes := decodeBody[[]server.Relationship](t, c.do("GET", "/api/users/me/mutes", bob.bearer(), nil)); len(mutes) != 1 || mutes[0].UserID != cy.ID {
+		t.Errorf("unexpected mutes: %+v", mutes)
+	}
+	if mutes := decodeBody[[]server.Relationship](t, c.do("GET", "/api/users/me/mutes", cy.bearer(), nil)); len(mutes) != 0 {
+		t.Errorf("expected cy's mutes to be empty, got %+v", mutes)
+	}
+	expectStatus(t, c.do("DELETE", "/api/users/"+cy.ID.String()+"/mute", bob.bearer(), nil), http.StatusNoContent)
+	if got := seenBy(bob, ""); len(got) != 3 {
+		t.Errorf("expected unmuting to show cy's chirps again, got %v", got)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/djblackett/chirpy/internal/tracing"
+	"github.com/google/uuid"
+)
+
+// Stable, machine-readable error codes returned in the "code" member of every problem body.
+const (
+	codeInvalidJSON    = "invalid_json"
+	codeInvalidID      = "invalid_id"
+	codeValidation     = "validation_failed"
+	codeChirpTooLong   = "chirp_too_long"
+	codeUnauthorized   = "unauthorized"
+	codeInvalidLogin   = "invalid_credentials"
+	codeForbidden      = "forbidden"
+	codeAccountLimited = "account_restricted"
+	codeNotFound       = "not_found"
+	codeConflict       = "conflict"
+	codeInternal       = "internal_error"
+	codeUnavailable    = "unavailable"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	problemContentType = "application/problem+json"
+)
+
+// Problem is an RFC 7807 problem details body, extended with a stable error code
+// and the ID of the request that produced it.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func respondWithJSON(w http.ResponseWriter, status int, payload any) {
+	bytes, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Error marshalling JSON", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bytes)
+}
+
+// respondWithError logs err (if any) and writes a problem+json body. The message is
+// shown to clients, so it must never include err itself or anything secret.
+func respondWithError(w http.ResponseWriter, r *http.Request, status int, code, message string, err error) {
+	requestID := requestIDFromContext(r.Context())
+	setRequestErrorCode(r.Context(), code)
+	// Client errors are already visible in the access log; their cause is only
+	// interesting when debugging.
+	level := slog.LevelDebug
+	if status >= 500 {
+		level = slog.LevelError
+	}
+	attrs := []slog.Attr{slog.Int("status", status), slog.String("code", code)}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	loggerFromContext(r.Context()).LogAttrs(r.Context(), level, message, attrs...)
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    message,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: requestID,
+	}
+	bytes, marshalErr := json.Marshal(problem)
+	if marshalErr != nil {
+		slog.Error("Error marshalling problem", "error", marshalErr)
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(status)
+	w.Write(bytes)
+}
+
+func respondWithInternalError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	respondWithError(w, r, http.StatusInternalServerError, codeInternal, message, err)
+}
+
+// respondWithLookupError maps a failed single-row lookup to 404 when nothing matched
+// and to 500 for anything else.
+func respondWithLookupError(w http.ResponseWriter, r *http.Request, what string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, http.StatusNotFound, codeNotFound, what+" not found", nil)
+		return
+	}
+	respondWithInternalError(w, r, "Couldn't get "+what, err)
+}
+
+// decodeJSONBody decodes the request body into dst and reports malformed JSON as a 400.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) bool {
+	_, span := tracing.Start(r.Context(), "decode JSON body", tracing.KindInternal)
+	err := json.NewDecoder(r.Body).Decode(dst)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidJSON, "Request body is not valid JSON", err)
+		return false
+	}
+	return true
+}
+
+// parseUUIDPathValue reads a UUID path parameter and reports a malformed one as a 400.
+func parseUUIDPathValue(w http.ResponseWriter, r *http.Request, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue(name))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, name+" must be a UUID", err)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// middlewareRequestID propagates the caller's X-Request-ID or generates one, and
+// echoes it back so clients can quote it when reporting a problem.
+func middlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveProblem runs handler behind the request ID middleware and decodes the
+// problem it writes.
+func serveProblem(t *testing.T, req *http.Request, handler http.HandlerFunc) (*httptest.ResponseRecorder, Problem) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	middlewareRequestID(handler).ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != problemContentType {
+		t.Fatalf("expected %s, got %q", problemContentType, ct)
+	}
+	var problem Problem
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("decoding problem: %v", err)
+	}
+	return rec, problem
+}
+
+func TestRespondWithError(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/things/1", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	rec, problem := serveProblem(t, req, func(w http.ResponseWriter, r *http.Request) {
+		respondWithError(w, r, http.StatusConflict, codeConflict, "Thing already exists", errors.New("duplicate key"))
+	})
+
+	want := Problem{
+		Type:      "about:blank",
+		Title:     "Conflict",
+		Status:    http.StatusConflict,
+		Detail:    "Thing already exists",
+		Instance:  "/api/things/1",
+		Code:      codeConflict,
+		RequestID: "req-1",
+	}
+	if rec.Code != http.StatusConflict || problem != want {
+		t.Errorf("got %d %+v, want %+v", rec.Code, problem, want)
+	}
+	if got := rec.Header().Get(requestIDHeader); got != "req-1" {
+		t.Errorf("expected the request ID to be echoed, got %q", got)
+	}
+}
+
+func TestRespondWithInternalErrorHidesCause(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	rec, problem := serveProblem(t, req, func(w http.ResponseWriter, r *http.Request) {
+		respondWithInternalError(w, r, "Couldn't get thing", errors.New("pq: password authentication failed"))
+	})
+	if rec.Code != http.StatusInternalServerError || problem.Code != codeInternal {
+		t.Errorf("got %d %q, want 500 %q", rec.Code, problem.Code, codeInternal)
+	}
+	if strings.Contains(problem.Detail, "pq") {
+		t.Errorf("internal error leaked into the body: %q", problem.Detail)
+	}
+	if problem.RequestID == "" || problem.RequestID != rec.Header().Get(requestIDHeader) {
+		t.Errorf("expected a generated request ID matching the header, got %q and %q", problem.RequestID, rec.Header().Get(requestIDHeader))
+	}
+}
+
+func TestRespondWithLookupError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{sql.ErrNoRows, http.StatusNotFound, codeNotFound},
+		{errors.New("connection refused"), http.StatusInternalServerError, codeInternal},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		rec, problem := serveProblem(t, req, func(w http.ResponseWriter, r *http.Request) {
+			respondWithLookupError(w, r, "Thing", tt.err)
+		})
+		if rec.Code != tt.status || problem.Code != tt.code {
+			t.Errorf("%v: got %d %q, want %d %q", tt.err, rec.Code, problem.Code, tt.status, tt.code)
+		}
+	}
+}
+
+func TestDecodeJSONBody(t *testing.T) {
+	for _, body := range []string{"", "{", `{"n": "one"}`} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		rec, problem := serveProblem(t, req, func(w http.ResponseWriter, r *http.Request) {
+			var dst struct{ N int }
+			if decodeJSONBody(w, r, &dst) {
+				t.Errorf("%q: expected decoding to fail", body)
+			}
+		})
+		if rec.Code != http.StatusBadRequest || problem.Code != codeInvalidJSON {
+			t.Errorf("%q: got %d %q, want 400 %q", body, rec.Code, problem.Code, codeInvalidJSON)
+		}
+	}
+}
+
+func TestParseUUIDPathValue(t *testing.T) {
+	req := httptest.NewRequest("GET", "/things/nope", nil)
+	req.SetPathValue("thingID", "nope")
+	rec, problem := serveProblem(t, req, func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := parseUUIDPathValue(w, r, "thingID"); ok {
+			t.Error("expected parsing to fail")
+		}
+	})
+	if rec.Code != http.StatusBadRequest || problem.Code != codeInvalidID || problem.Detail != "thingID must be a UUID" {
+		t.Errorf("got %d %+v", rec.Code, problem)
+	}
+}
+
+func TestMiddlewareRequestIDReplacesOversizedIDs(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(requestIDHeader, strings.Repeat("x", 129))
+	_, problem := serveProblem(t, req, func(w http.ResponseWriter, r *http.Request) {
+		respondWithError(w, r, http.StatusNotFound, codeNotFound, "Nothing here", nil)
+	})
+	if len(problem.RequestID) > 128 {
+		t.Errorf("expected an oversized request ID to be replaced, got %q", problem.RequestID)
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+)
+
+// publishBatchSize bounds each PublishDueChirps call so one instance doesn't
+// hold row locks on a large backlog while the others wait for work.
+const publishBatchSize = 100
+
+type RescheduleParameters struct {
+	PublishAt time.Time `json:"publish_at"`
+}
+
+// validPublishAt writes a 400 and returns false unless t is in the future.
+func validPublishAt(w http.ResponseWriter, r *http.Request, t time.Time) bool {
+	if !t.After(time.Now()) {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "publish_at must be in the future", nil)
+		return false
+	}
+	return true
+}
+
+// handleListScheduledChirps lists the caller's scheduled chirps, soonest first.
+func (cfg *apiConfig) handleListScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	chirps, err := cfg.dbQueries.ListScheduledChirps(r.Context(), userID)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't get scheduled chirps", err)
+		return
+	}
+	scheduled := make([]Chirp, 0, len(chirps))
+	for _, chirp := range chirps {
+		scheduled = append(scheduled, toChirp(chirp))
+	}
+	respondWithJSON(w, http.StatusOK, scheduled)
+}
+
+// scheduledChirp looks up the {chirpID} the caller wants to change. Other
+// users' chirps are not found, as they can't see them; a chirp that has
+// already gone out is a conflict.
+func (cfg *apiConfig) scheduledChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+	chirpID, ok := parseUUIDPathValue(w, r, "chirpID")
+	if !ok {
+		return database.Chirp{}, false
+	}
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return database.Chirp{}, false
+	}
+	if cfg.rejectRestrictedUser(w, r, userID) {
+		return database.Chirp{}, false
+	}
+
+	chirp, err := cfg.dbQueries.GetChirp(r.Context(), chirpID)
+	if err == nil && chirp.UserID != userID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		respondWithLookupError(w, r, "Scheduled chirp", err)
+		return database.Chirp{}, false
+	}
+	if !chirp.PublishAt.Valid {
+		respondWithError(w, r, http.StatusConflict, codeConflict, "Chirp has already been published", nil)
+		return database.Chirp{}, false
+	}
+	return chirp, true
+}
+
+func (cfg *apiConfig) handleRescheduleChirp(w http.ResponseWriter, r *http.Request) {
+	chirp, ok := cfg.scheduledChirp(w, r)
+	if !ok {
+		return
+	}
+	params := RescheduleParameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	if !validPublishAt(w, r, params.PublishAt) {
+		return
+	}
+
+	chirp, err := cfg.dbQueries.RescheduleChirp(r.Context(), database.RescheduleChirpParams{
+		ID:        chirp.ID,
+		PublishAt: params.PublishAt.UTC(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// The publisher got to it after the lookup.
+		respondWithError(w, r, http.StatusConflict, codeConflict, "Chirp has already been published", nil)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't reschedule chirp", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, toChirp(chirp))
+}
+
+// handleCancelScheduledChirp deletes a chirp that hasn't been published yet.
+func (cfg *apiConfig) handleCancelScheduledChirp(w http.ResponseWriter, r *http.Request) {
+	chirp, ok := cfg.scheduledChirp(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := cfg.dbQueries.CancelScheduledChirp(r.Context(), chirp.ID)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't cancel chirp", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, r, http.StatusConflict, codeConflict, "Chirp has already been published", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishScheduledChirps publishes due chirps every publishInterval until ctx
+// is done. PublishDueChirps claims rows with FOR UPDATE SKIP LOCKED, so every
+// instance can run this against the same database without publishing a chirp
+// twice.
+func (cfg *apiConfig) publishScheduledChirps(ctx context.Context) {
+	ticker := time.NewTicker(cfg.publishInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for ctx.Err() == nil {
+			published, err := cfg.dbQueries.PublishDueChirps(ctx, publishBatchSize)
+			if err != nil {
+				cfg.logger.Error("Couldn't publish scheduled chirps", "error", err)
+				break
+			}
+			if len(published) > 0 {
+				cfg.logger.Info("Published scheduled chirps", "count", len(published))
+			}
+			for _, chirp := range published {
+				cfg.publish(ctx, "chirp.created", chirp.UserID, toChirp(chirp))
+			}
+			if len(published) < publishBatchSize {
+				break
+			}
+		}
+	}
+}
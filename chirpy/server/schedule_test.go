@@ -0,0 +1,103 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/djblackett/chirpy/server"
+)
+
+func TestScheduledChirps(t *testing.T) {
+	c := newTestClient(t, func(cfg *server.Config) { cfg.ScheduleInterval = 10 * time.Millisecond })
+	ada := c.signUp("ada@example.com", "password")
+	bob := c.signUp("bob@example.com", "password")
+
+	schedule := func(at time.Time) *http.Response {
+		return c.do("POST", "/api/chirps", ada.bearer(), map[string]any{"body": "from the future", "publish_at": at})
+	}
+	expectProblem(t, schedule(time.Now().Add(-time.Minute)), http.StatusBadRequest, "validation_failed")
+	resp := schedule(time.Now().Add(time.Hour))
+	expectStatus(t, resp, http.StatusCreated)
+	chirp := decodeBody[server.Chirp](t, resp)
+	if chirp.PublishAt == nil {
+		t.Fatalf("expected publish_at on a scheduled chirp, got %+v", chirp)
+	}
+	resp = schedule(time.Now().Add(2 * time.Hour))
+	expectStatus(t, resp, http.StatusCreated)
+	cancelled := decodeBody[server.Chirp](t, resp)
+
+	expectProblem(t, c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil), http.StatusNotFound, "not_found")
+	resp = c.do("GET", "/api/chirps", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if chirps := decodeBody[[]server.Chirp](t, resp); len(chirps) != 0 {
+		t.Errorf("expected scheduled chirps to stay out of listings, got %+v", chirps)
+	}
+	listScheduled := func(s session) []server.Chirp {
+		t.Helper()
+		resp := c.do("GET", "/api/chirps/scheduled", s.bearer(), nil)
+		expectStatus(t, resp, http.StatusOK)
+		return decodeBody[[]server.Chirp](t, resp)
+	}
+	if got := listScheduled(ada); len(got) != 2 || got[0].ID != chirp.ID {
+		t.Errorf("expected ada's two scheduled chirps soonest first, got %+v", got)
+	}
+	if got := listScheduled(bob); len(got) != 0 {
+		t.Errorf("expected bob to see none of ada's scheduled chirps, got %+v", got)
+	}
+	expectProblem(t, c.do("GET", "/api/chirps/scheduled", "", nil), http.StatusUnauthorized, "unauthorized")
+
+	path := "/api/chirps/scheduled/" + chirp.ID.String()
+	expectProblem(t, c.do("PUT", path, bob.bearer(), map[string]any{"publish_at": time.Now().Add(time.Minute)}), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("DELETE", path, bob.bearer(), nil), http.StatusNotFound, "not_found")
+	expectProblem(t, c.do("PUT", path, ada.bearer(), map[string]any{"publish_at": time.Now()}), http.StatusBadRequest, "validation_failed")
+
+	expectStatus(t, c.do("DELETE", "/api/chirps/scheduled/"+cancelled.ID.String(), ada.bearer(), nil), http.StatusNoContent)
+	if got := listScheduled(ada); len(got) != 1 || got[0].ID != chirp.ID {
+		t.Errorf("expected only the first chirp left after cancelling, got %+v", got)
+	}
+
+	publishAt := time.Now().Add(50 * time.Millisecond)
+	resp = c.do("PUT", path, ada.bearer(), map[string]any{"publish_at": publishAt})
+	expectStatus(t, resp, http.StatusOK)
+	if got := decodeBody[server.Chirp](t, resp); got.PublishAt == nil || !got.PublishAt.Equal(publishAt) {
+		t.Fatalf("expected publish_at %s, got %+v", publishAt, got)
+	}
+
+	waitFor(t, "the scheduled chirp to be published", &c.store.changed, func() bool {
+		resp = c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil)
+		return resp.StatusCode != http.StatusNotFound
+	})
+	expectStatus(t, resp, http.StatusOK)
+	if published := decodeBody[server.Chirp](t, resp); published.PublishAt != nil || !published.CreatedAt.Equal(publishAt) {
+		t.Errorf("expected the chirp to be dated when it was due, got %+v", published)
+	}
+	if got := listScheduled(ada); len(got) != 0 {
+		t.Errorf("expected no scheduled chirps left, got %+v", got)
+	}
+	expectProblem(t, c.do("PUT", path, ada.bearer(), map[string]any{"publish_at": time.Now().Add(time.Hour)}), http.StatusConflict, "conflict")
+	expectProblem(t, c.do("DELETE", path, ada.bearer(), nil), http.StatusConflict, "conflict")
+}
+
+func TestDeleteScheduledChirp(t *testing.T) {
+	var events []string
+	c := newTestClient(t, func(cfg *server.Config) {
+		cfg.Events = server.EventSinkFunc(func(ctx context.Context, event server.Event) {
+			events = append(events, event.Type)
+		})
+	})
+	ada := c.signUp("ada@example.com", "password")
+	bob := c.signUp("bob@example.com", "password")
+	resp := c.do("POST", "/api/chirps", ada.bearer(), map[string]any{"body": "not yet", "publish_at": time.Now().Add(time.Hour)})
+	expectStatus(t, resp, http.StatusCreated)
+	path := "/api/chirps/" + decodeBody[server.Chirp](t, resp).ID.String()
+
+	// Other users can't tell the chirp exists until it's published.
+	expectProblem(t, c.do("DELETE", path, bob.bearer(), nil), http.StatusNotFound, "not_found")
+	expectStatus(t, c.do("DELETE", path, ada.bearer(), nil), http.StatusNoContent)
+	if slices.Contains(events, "chirp.deleted") {
+		t.Errorf("expected no chirp.deleted event for a chirp never published, got %v", events)
+	}
+}
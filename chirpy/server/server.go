@@ -0,0 +1,309 @@
+// Package server implements the Chirpy HTTP API. New returns a self-contained
+// http.Handler so it can be served directly or mounted inside another mux;
+// Start runs the background work it depends on.
+package server
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/djblackett/chirpy/internal/tracing"
+)
+
+// Config holds the settings the handlers need. Zero values fall back to the defaults noted on each field.
+type Config struct {
+	JWTSecret string
+	PolkaKey  string
+	// Platform names the deployment. POST /admin/reset refuses to run unless
+	// it is "dev", whatever the caller's role.
+	Platform string
+	// PublicURL is the scheme, host and any path prefix clients reach the API
+	// on, for the absolute links in feeds. Defaults to http://localhost:8080.
+	PublicURL string
+	// FileserverRoot is the directory served under /app/. Defaults to ".".
+	FileserverRoot string
+	// AccessTokenTTL defaults to one hour.
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL defaults to 60 days.
+	RefreshTokenTTL time.Duration
+	// MaxChirpLength defaults to 140 bytes.
+	MaxChirpLength int
+	// DBStats, when set, exposes connection pool stats at /metrics. Pass (*sql.DB).Stats.
+	DBStats func() sql.DBStats
+	// Logger receives access logs and handler errors. Defaults to slog.Default().
+	Logger *slog.Logger
+	// LogLevelHeader honours X-Log-Level to change the log level for one request.
+	LogLevelHeader bool
+	// Tracer, when set, records a span per request. Wrap the store with
+	// database.NewTraced to add query spans.
+	Tracer *tracing.Tracer
+	// ChirpCacheSize is how many encoded chirps GET /api/chirps/{chirpID} keeps
+	// in memory. 0 disables the cache.
+	ChirpCacheSize int
+	// ChirpCacheTTL is how long a cached chirp is served. Invalidation only
+	// reaches this process, so it bounds how long other instances serve a
+	// hidden or deleted chirp. Defaults to 30 seconds.
+	ChirpCacheTTL time.Duration
+	// CORS is the cross-origin policy. The zero value sends no CORS headers.
+	CORS CORSConfig
+	// ExportTTL is how long a data export can be downloaded. Defaults to 7 days.
+	ExportTTL time.Duration
+	// MaxConcurrentExports is how many data exports are built at once; the
+	// rest wait for a turn. Defaults to 2.
+	MaxConcurrentExports int
+	// AnonymizeDeletedChirps keeps the chirps of users who delete their account,
+	// under a scrubbed account, instead of deleting them too.
+	AnonymizeDeletedChirps bool
+	// Events, when set, receives events such as user.deleted. They are logged
+	// either way.
+	Events EventSink
+	// ScheduleInterval is how often scheduled chirps that are due get
+	// published. Defaults to 10 seconds.
+	ScheduleInterval time.Duration
+	// WebhookMaxAttempts is how many times a webhook delivery is tried before
+	// it is marked dead. Defaults to 8.
+	WebhookMaxAttempts int
+	// WebhookBackoff is the delay after the first failed delivery attempt; it
+	// doubles after each further failure, up to an hour. Defaults to 30 seconds.
+	WebhookBackoff time.Duration
+	// WebhookAllowPrivateNetworks lets webhooks reach loopback, private and
+	// link-local addresses, which are otherwise refused. For development only.
+	WebhookAllowPrivateNetworks bool
+}
+
+type apiConfig struct {
+	metrics         *serverMetrics
+	dbQueries       Store
+	jwtSecret       string
+	polkaKey        string
+	platform        string
+	publicURL       string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	maxChirpLength  int
+	exportTTL       time.Duration
+	// exportSlots holds a token for each export being built.
+	exportSlots     chan struct{}
+	publishInterval time.Duration
+	anonymizeChirps bool
+	events          EventSink
+	logger          *slog.Logger
+	logLevelHeader  bool
+	tracer          *tracing.Tracer
+	chirpCache      *chirpCache
+	webhookLog      webhookLog
+	webhookAttempts int
+	webhookBackoff  time.Duration
+	webhookClient   *http.Client
+	// webhookPrivate lets webhook URLs name private addresses.
+	webhookPrivate bool
+	// deliveryWake tells deliverWebhooks that deliveries were queued.
+	deliveryWake chan struct{}
+
+	// done is cancelled by Shutdown to stop background workers.
+	done    context.Context
+	stop    context.CancelFunc
+	workers sync.WaitGroup
+	// workersMu guards stopping, which Shutdown sets before waiting on workers.
+	workersMu sync.Mutex
+	stopping  bool
+}
+
+// Server is the Chirpy API. It owns the background workers Start launches and
+// any other work started on its behalf, which Shutdown stops.
+type Server struct {
+	handler http.Handler
+	api     *apiConfig
+	routes  []string
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Start launches the background workers that purge expired exports, publish
+// scheduled chirps and deliver outbound webhooks. Call it once, before serving.
+func (s *Server) Start() {
+	s.api.goWorker(s.api.purgeExpiredExports)
+	s.api.goWorker(s.api.publishScheduledChirps)
+	s.api.goWorker(s.api.deliverWebhooks)
+}
+
+// Shutdown stops background workers, then waits for them to exit or ctx to
+// expire. It does not close the store.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.api.shutdown(ctx)
+}
+
+// New builds the Chirpy API on top of store. It panics if cfg.CORS is invalid;
+// check it with CORSConfig.Validate first.
+func New(cfg Config, store Store) *Server {
+	apiCfg := &apiConfig{
+		metrics:         newServerMetrics(cfg.DBStats),
+		dbQueries:       store,
+		jwtSecret:       cfg.JWTSecret,
+		polkaKey:        cfg.PolkaKey,
+		platform:        cfg.Platform,
+		publicURL:       strings.TrimSuffix(cfg.PublicURL, "/"),
+		accessTokenTTL:  cfg.AccessTokenTTL,
+		refreshTokenTTL: cfg.RefreshTokenTTL,
+		maxChirpLength:  cfg.MaxChirpLength,
+		exportTTL:       cfg.ExportTTL,
+		publishInterval: cfg.ScheduleInterval,
+		anonymizeChirps: cfg.AnonymizeDeletedChirps,
+		events:          cfg.Events,
+		logger:          cfg.Logger,
+		logLevelHeader:  cfg.LogLevelHeader,
+		tracer:          cfg.Tracer,
+		webhookAttempts: cfg.WebhookMaxAttempts,
+		webhookBackoff:  cfg.WebhookBackoff,
+		webhookClient:   newWebhookClient(cfg.WebhookAllowPrivateNetworks),
+		webhookPrivate:  cfg.WebhookAllowPrivateNetworks,
+		deliveryWake:    make(chan struct{}, 1),
+	}
+	if apiCfg.logger == nil {
+		apiCfg.logger = slog.Default()
+	}
+	if apiCfg.publicURL == "" {
+		apiCfg.publicURL = "http://localhost:8080"
+	}
+	if apiCfg.accessTokenTTL <= 0 {
+		apiCfg.accessTokenTTL = time.Hour
+	}
+	if apiCfg.refreshTokenTTL <= 0 {
+		apiCfg.refreshTokenTTL = 60 * 24 * time.Hour
+	}
+	if apiCfg.maxChirpLength <= 0 {
+		apiCfg.maxChirpLength = 140
+	}
+	if apiCfg.exportTTL <= 0 {
+		apiCfg.exportTTL = 7 * 24 * time.Hour
+	}
+	maxExports := cfg.MaxConcurrentExports
+	if maxExports <= 0 {
+		maxExports = 2
+	}
+	apiCfg.exportSlots = make(chan struct{}, maxExports)
+	if apiCfg.publishInterval <= 0 {
+		apiCfg.publishInterval = 10 * time.Second
+	}
+	if apiCfg.webhookAttempts <= 0 {
+		apiCfg.webhookAttempts = 8
+	}
+	if apiCfg.webhookBackoff <= 0 {
+		apiCfg.webhookBackoff = 30 * time.Second
+	}
+	chirpCacheTTL := cfg.ChirpCacheTTL
+	if chirpCacheTTL <= 0 {
+		chirpCacheTTL = 30 * time.Second
+	}
+	apiCfg.chirpCache = newChirpCache(cfg.ChirpCacheSize, chirpCacheTTL)
+	apiCfg.done, apiCfg.stop = context.WithCancel(context.Background())
+	root := cfg.FileserverRoot
+	if root == "" {
+		root = "."
+	}
+
+	serveMux := &router{ServeMux: http.NewServeMux()}
+	serveMux.Handle("/app/", apiCfg.metrics.middlewareFileserverHits(http.StripPrefix("/app", http.FileServer(http.Dir(root)))))
+	serveMux.HandleFunc("GET /api/healthz", handleHealthz)
+	serveMux.Handle("GET /metrics", apiCfg.metrics.registry.Handler())
+	serveMux.HandleFunc("GET /api/openapi.json", handleOpenAPI)
+	serveMux.HandleFunc("GET /api/docs", handleDocs)
+
+	// Feeds sit outside /api so readers get short, stable URLs.
+	serveMux.HandleFunc("GET /chirps/feed.atom", apiCfg.handleChirpsFeed)
+	serveMux.HandleFunc("GET /chirps/feed.rss", apiCfg.handleChirpsFeed)
+	serveMux.HandleFunc("GET /users/{userID}/feed.atom", apiCfg.handleUserFeed)
+	serveMux.HandleFunc("GET /users/{userID}/feed.rss", apiCfg.handleUserFeed)
+
+	serveMux.HandleFunc("POST /api/chirps", apiCfg.handleCreateChirp)
+	serveMux.HandleFunc("GET /api/chirps", apiCfg.handleListChirps)
+	serveMux.HandleFunc("GET /api/chirps/scheduled", apiCfg.handleListScheduledChirps)
+	serveMux.HandleFunc("PUT /api/chirps/scheduled/{chirpID}", apiCfg.handleRescheduleChirp)
+	serveMux.HandleFunc("DELETE /api/chirps/scheduled/{chirpID}", apiCfg.handleCancelScheduledChirp)
+	serveMux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handleGetChirp)
+	serveMux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handleDeleteChirp)
+	serveMux.Handle("POST /api/chirps/{chirpID}/report", apiCfg.middlewareRequireRole(auth.RoleUser, apiCfg.handleReportChirp))
+
+	serveMux.HandleFunc("POST /api/users", apiCfg.handleCreateUser)
+	serveMux.HandleFunc("PUT /api/users", apiCfg.handleUpdateUser)
+	serveMux.HandleFunc("DELETE /api/users/me", apiCfg.handleDeleteUser)
+	serveMux.HandleFunc("POST /api/users/me/export", apiCfg.handleCreateExport)
+	serveMux.HandleFunc("GET /api/users/me/export/{exportID}", apiCfg.handleGetExport)
+	serveMux.HandleFunc("PUT /api/users/me/profile", apiCfg.handleUpdateProfile)
+	serveMux.HandleFunc("PUT /api/users/me/avatar", apiCfg.handleSetAvatar)
+	serveMux.HandleFunc("DELETE /api/users/me/avatar", apiCfg.handleDeleteAvatar)
+	serveMux.HandleFunc("GET /api/users/{handle}", apiCfg.handleGetProfile)
+	serveMux.HandleFunc("GET /api/users/{handle}/avatar", apiCfg.handleGetAvatar)
+	serveMux.HandleFunc("GET /api/users/me/blocks", apiCfg.handleListRelationships(relationshipBlock))
+	serveMux.HandleFunc("PUT /api/users/{userID}/block", apiCfg.handleAddRelationship(relationshipBlock))
+	serveMux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.handleRemoveRelationship(relationshipBlock))
+	serveMux.HandleFunc("GET /api/users/me/mutes", apiCfg.handleListRelationships(relationshipMute))
+	serveMux.HandleFunc("PUT /api/users/{userID}/mute", apiCfg.handleAddRelationship(relationshipMute))
+	serveMux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.handleRemoveRelationship(relationshipMute))
+	serveMux.HandleFunc("PUT /api/users/{userID}/follow", apiCfg.handleFollowUser)
+	serveMux.HandleFunc("DELETE /api/users/{userID}/follow", apiCfg.handleUnfollowUser)
+
+	serveMux.HandleFunc("POST /api/conversations", apiCfg.handleCreateConversation)
+	serveMux.HandleFunc("GET /api/conversations", apiCfg.handleListConversations)
+	serveMux.HandleFunc("POST /api/conversations/{conversationID}/messages", apiCfg.handleSendMessage)
+	serveMux.HandleFunc("GET /api/conversations/{conversationID}/messages", apiCfg.handleListMessages)
+	serveMux.HandleFunc("DELETE /api/conversations/{conversationID}/messages/{messageID}", apiCfg.handleDeleteMessage)
+	serveMux.HandleFunc("POST /api/conversations/{conversationID}/read", apiCfg.handleMarkConversationRead)
+
+	serveMux.HandleFunc("POST /api/login", apiCfg.handleLogin)
+	serveMux.HandleFunc("POST /api/refresh", apiCfg.handleRefresh)
+	serveMux.HandleFunc("POST /api/revoke", apiCfg.handleRevoke)
+
+	serveMux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlePolkaWebhook)
+
+	serveMux.Handle("POST /api/webhooks", apiCfg.middlewareRequireRole(auth.RoleUser, apiCfg.handleCreateWebhook))
+	serveMux.Handle("GET /api/webhooks", apiCfg.middlewareRequireRole(auth.RoleUser, apiCfg.handleListWebhooks))
+	serveMux.Handle("GET /api/webhooks/{webhookID}", apiCfg.middlewareRequireRole(auth.RoleUser, apiCfg.handleGetWebhook))
+	serveMux.Handle("DELETE /api/webhooks/{webhookID}", apiCfg.middlewareRequireRole(auth.RoleUser, apiCfg.handleDeleteWebhook))
+	serveMux.Handle("GET /api/webhooks/{webhookID}/deliveries", apiCfg.middlewareRequireRole(auth.RoleUser, apiCfg.handleListWebhookDeliveries))
+	serveMux.Handle("POST /api/webhooks/{webhookID}/deliveries/{deliveryID}/retry", apiCfg.middlewareRequireRole(auth.RoleUser, apiCfg.handleRetryWebhookDelivery))
+
+	serveMux.Handle("GET /api/moderation/reports", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handleListReports))
+	serveMux.Handle("POST /api/moderation/reports/{reportID}/dismiss", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handleDismissReport))
+	serveMux.Handle("POST /api/moderation/chirps/{chirpID}/hide", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handleHideChirp))
+	serveMux.Handle("POST /api/moderation/users/{userID}/suspend", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handleSuspendUser))
+	serveMux.Handle("POST /api/moderation/users/{userID}/ban", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handleBanUser))
+	serveMux.Handle("GET /api/moderation/actions", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handleListModerationActions))
+
+	serveMux.Handle("GET /admin/metrics", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handleMetrics))
+	serveMux.Handle("GET /admin/api/stats", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handleStats))
+	serveMux.Handle("POST /admin/reset", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.reset))
+	serveMux.Handle("PUT /admin/users/{userID}/role", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handleSetUserRole))
+	serveMux.Handle("POST /admin/chirps/import", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handleImportChirps))
+	serveMux.Handle("GET /admin/chirps/export", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handleExportChirps))
+
+	// Listed innermost first.
+	var handler http.Handler = middlewareRecordRoute(serveMux)
+	handler = middlewareCompress(handler)
+	handler = newCORSPolicy(cfg.CORS).middleware(handler)
+	handler = apiCfg.metrics.middlewareMetrics(handler)
+	handler = apiCfg.middlewareAccessLog(handler)
+	handler = apiCfg.middlewareTracing(handler)
+	handler = middlewareRequestID(handler)
+
+	return &Server{
+		handler: handler,
+		api:     apiCfg,
+		routes:  serveMux.patterns,
+	}
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	bytes := []byte("OK")
+	w.Write(bytes)
+}
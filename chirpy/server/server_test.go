@@ -0,0 +1,472 @@
+package server_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/internal/logging"
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+const (
+	testJWTSecret = "test-secret"
+	testPolkaKey  = "test-polka-key"
+)
+
+type testClient struct {
+	t     *testing.T
+	srv   *httptest.Server
+	store *memStore
+	logs  *syncBuffer
+}
+
+// syncBuffer collects log output written from handler goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// lines decodes every JSON log line written so far.
+func (b *syncBuffer) lines(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var lines []map[string]any
+	for _, raw := range bytes.Split(bytes.TrimSpace(b.buf.Bytes()), []byte("\n")) {
+		line := map[string]any{}
+		if err := json.Unmarshal(raw, &line); err != nil {
+			t.Fatalf("log line is not JSON: %v: %s", err, raw)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func newTestClient(t *testing.T, options ...func(*server.Config)) *testClient {
+	t.Helper()
+	return newTestClientWithHTTP(t, nil, options...)
+}
+
+// newTestClientWithHTTP is newTestClient with configureHTTP, if set, applied
+// to the http.Server before it starts, for tests of its timeouts.
+func newTestClientWithHTTP(t *testing.T, configureHTTP func(*http.Server), options ...func(*server.Config)) *testClient {
+	t.Helper()
+	root := t.TempDir()
+	err := os.WriteFile(filepath.Join(root, "index.html"), []byte("<h1>Welcome to Chirpy</h1>"), 0o644)
+	if err != nil {
+		t.Fatalf("writing index.html: %v", err)
+	}
+
+	store := newMemStore()
+	logs := &syncBuffer{}
+	cfg := server.Config{
+		JWTSecret:      testJWTSecret,
+		PolkaKey:       testPolkaKey,
+		FileserverRoot: root,
+		Logger:         logging.New(logs, slog.LevelInfo),
+		LogLevelHeader: true,
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+	handler := server.New(cfg, store)
+	handler.Start()
+	srv := httptest.NewUnstartedServer(handler)
+	if configureHTTP != nil {
+		configureHTTP(srv.Config)
+	}
+	srv.Start()
+	t.Cleanup(func() {
+		srv.Close()
+		if err := handler.Shutdown(context.Background()); err != nil {
+			t.Errorf("shutting down: %v", err)
+		}
+	})
+	return &testClient{t: t, srv: srv, store: store, logs: logs}
+}
+
+// do sends body as JSON (or verbatim if it is a string or io.Reader) with an optional Authorization header.
+func (c *testClient) do(method, path, authorization string, body any) *http.Response {
+	c.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	case io.Reader:
+		reader = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			c.t.Fatalf("marshalling body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.srv.URL+path, reader)
+	if err != nil {
+		c.t.Fatalf("building request: %v", err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func expectStatus(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+	if resp.StatusCode != want {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: expected status %d, got %d: %s", resp.Request.Method, resp.Request.URL.Path, want, resp.StatusCode, body)
+	}
+}
+
+func decodeBody[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("decoding response body: %v", err)
+	}
+	return v
+}
+
+func expectProblem(t *testing.T, resp *http.Response, status int, code string) server.Problem {
+	t.Helper()
+	expectStatus(t, resp, status)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("expected problem+json content type, got %q", ct)
+	}
+	problem := decodeBody[server.Problem](t, resp)
+	if problem.Code != code {
+		t.Errorf("expected error code %q, got %q (%s)", code, problem.Code, problem.Detail)
+	}
+	if problem.RequestID == "" || problem.RequestID != resp.Header.Get("X-Request-ID") {
+		t.Errorf("expected request_id %q to match X-Request-ID header %q", problem.RequestID, resp.Header.Get("X-Request-ID"))
+	}
+	return problem
+}
+
+type session struct {
+	server.User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// get sends a GET with extra headers, such as If-None-Match.
+func (c *testClient) get(path string, header http.Header) *http.Response {
+	c.t.Helper()
+	return c.send("GET", path, header)
+}
+
+// send makes a bodiless request with exactly the given headers.
+func (c *testClient) send(method, path string, header http.Header) *http.Response {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.srv.URL+path, nil)
+	if err != nil {
+		c.t.Fatalf("building request: %v", err)
+	}
+	req.Header = header
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (s session) bearer() string {
+	return "Bearer " + s.Token
+}
+
+func (c *testClient) signUp(email, password string) session {
+	c.t.Helper()
+	resp := c.do("POST", "/api/users", "", map[string]string{"email": email, "password": password})
+	expectStatus(c.t, resp, http.StatusCreated)
+	return c.login(email, password)
+}
+
+func (c *testClient) login(email, password string) session {
+	c.t.Helper()
+	resp := c.do("POST", "/api/login", "", map[string]string{"email": email, "password": password})
+	expectStatus(c.t, resp, http.StatusOK)
+	return decodeBody[session](c.t, resp)
+}
+
+// signUpWithRole creates a user, grants the role directly in the store and logs in
+// again so the access token carries it.
+func (c *testClient) signUpWithRole(email, role string) session {
+	c.t.Helper()
+	s := c.signUp(email, "password")
+	_, err := c.store.SetUserRole(context.Background(), database.SetUserRoleParams{Role: role, ID: s.ID})
+	if err != nil {
+		c.t.Fatalf("setting role: %v", err)
+	}
+	return c.login(email, "password")
+}
+
+func (c *testClient) createChirp(s session, body string) server.Chirp {
+	c.t.Helper()
+	resp := c.do("POST", "/api/chirps", s.bearer(), map[string]string{"body": body})
+	expectStatus(c.t, resp, http.StatusCreated)
+	return decodeBody[server.Chirp](c.t, resp)
+}
+
+// broadcast wakes everyone waiting on it each time notify is called.
+type broadcast struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// wait returns a channel that is closed by the next notify.
+func (b *broadcast) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch == nil {
+		b.ch = make(chan struct{})
+	}
+	return b.ch
+}
+
+func (b *broadcast) notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch != nil {
+		close(b.ch)
+		b.ch = nil
+	}
+}
+
+// waitFor rechecks cond each time changed fires, until it holds or a few
+// seconds pass.
+func waitFor(t *testing.T, what string, changed *broadcast, cond func() bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		next := changed.wait()
+		if cond() {
+			return
+		}
+		select {
+		case <-next:
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	c := newTestClient(t)
+	resp := c.do("GET", "/api/healthz", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "OK" {
+		t.Errorf("expected OK, got %q", body)
+	}
+}
+
+func TestFileserverAndMetrics(t *testing.T) {
+	c := newTestClient(t)
+	for range 3 {
+		resp := c.do("GET", "/app/", "", nil)
+		expectStatus(t, resp, http.StatusOK)
+	}
+
+	expectProblem(t, c.do("GET", "/admin/metrics", "", nil), http.StatusUnauthorized, "unauthorized")
+	user := c.signUp("user@example.com", "password")
+	expectProblem(t, c.do("GET", "/admin/metrics", user.bearer(), nil), http.StatusForbidden, "forbidden")
+
+	admin := c.signUpWithRole("admin@example.com", "admin")
+	resp := c.do("GET", "/admin/metrics", admin.bearer(), nil)
+	expectStatus(t, resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "Chirpy has been visited 3 times!") {
+		t.Errorf("unexpected metrics page: %s", body)
+	}
+}
+
+func TestOpenAPIDocs(t *testing.T) {
+	c := newTestClient(t)
+	resp := c.do("GET", "/api/openapi.json", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	spec := decodeBody[map[string]any](t, resp)
+	if spec["openapi"] != "3.1.0" {
+		t.Errorf("unexpected spec: %v", spec["openapi"])
+	}
+
+	resp = c.do("GET", "/api/docs", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `url: "openapi.json"`) {
+		t.Errorf("expected the docs page to load the spec, got %s", body)
+	}
+	if csp := resp.Header.Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") {
+		t.Errorf("expected a restrictive Content-Security-Policy, got %q", csp)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	root := t.TempDir()
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 4096)...)
+	if err := os.WriteFile(filepath.Join(root, "logo.png"), png, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, func(cfg *server.Config) { cfg.FileserverRoot = root })
+	alice := c.signUp("alice@example.com", "password")
+	var chirp server.Chirp
+	for i := range 20 {
+		chirp = c.createChirp(alice, fmt.Sprintf("Chirp number %d, padded out a little", i))
+	}
+	gzipped := http.Header{"Accept-Encoding": {"gzip"}}
+
+	resp := c.get("/api/chirps", gzipped)
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("Content-Encoding") != "gzip" || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("expected a gzipped list with Vary, got %v", resp.Header)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chirps []server.Chirp
+	if err := json.NewDecoder(gz).Decode(&chirps); err != nil || len(chirps) != 20 {
+		t.Fatalf("expected 20 chirps, got %d (%v)", len(chirps), err)
+	}
+	etag := resp.Header.Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Errorf("expected the gzipped list to have a weak ETag, got %q", etag)
+	}
+	expectStatus(t, c.get("/api/chirps", http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {etag}}), http.StatusNotModified)
+
+	resp = c.get("/api/chirps", http.Header{"Accept-Encoding": {"gzip;q=0.5, br"}})
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("Content-Encoding") != "br" || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("expected the preferred brotli encoding with Vary, got %v", resp.Header)
+	}
+	chirps = nil
+	if err := json.NewDecoder(brotli.NewReader(resp.Body)).Decode(&chirps); err != nil || len(chirps) != 20 {
+		t.Fatalf("expected 20 chirps, got %d (%v)", len(chirps), err)
+	}
+
+	resp = c.get("/api/chirps", http.Header{"Accept-Encoding": {"gzip;q=0"}})
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected an identity list with Vary, got %v", resp.Header)
+	}
+
+	resp = c.get("/api/chirps/"+chirp.ID.String(), gzipped)
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("Content-Encoding") != "" || resp.ContentLength <= 0 {
+		t.Errorf("expected a small chirp to be sent as is, got %v", resp.Header)
+	}
+
+	resp = c.get("/app/logo.png", gzipped)
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Vary") != "" || resp.ContentLength != int64(len(png)) {
+		t.Errorf("expected the PNG to be sent as is, got %v", resp.Header)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	c := newTestClient(t, func(cfg *server.Config) {
+		cfg.CORS = server.CORSConfig{
+			AllowedOrigins:   []string{"https://*.chirpy.example"},
+			AllowCredentials: true,
+			MaxAge:           time.Hour,
+		}
+	})
+	const origin = "https://web.chirpy.example"
+
+	resp := c.do("GET", "/api/openapi.json", "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	spec := decodeBody[struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}](t, resp)
+	params := regexp.MustCompile(`\{[^}]+\}`)
+	for template, item := range spec.Paths {
+		path := params.ReplaceAllString(template, uuid.NewString())
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			method = strings.ToUpper(method)
+
+			resp := c.send("OPTIONS", path, http.Header{
+				"Origin":                         {origin},
+				"Access-Control-Request-Method":  {method},
+				"Access-Control-Request-Headers": {"authorization,content-type"},
+			})
+			expectStatus(t, resp, http.StatusNoContent)
+			h := resp.Header
+			if h.Get("Access-Control-Allow-Origin") != origin || h.Get("Access-Control-Allow-Credentials") != "true" ||
+				!strings.Contains(h.Get("Access-Control-Allow-Methods"), method) ||
+				h.Get("Access-Control-Allow-Headers") != "authorization,content-type" || h.Get("Access-Control-Max-Age") != "3600" {
+				t.Errorf("preflight for %s %s: unexpected headers %v", method, path, h)
+			}
+
+			resp = c.send(method, path, http.Header{"Origin": {origin}})
+			h = resp.Header
+			if h.Get("Access-Control-Allow-Origin") != origin || !strings.Contains(h.Get("Vary"), "Origin") ||
+				!strings.Contains(h.Get("Access-Control-Expose-Headers"), "X-Request-ID") {
+				t.Errorf("%s %s: unexpected CORS headers %v", method, path, h)
+			}
+		}
+	}
+
+	for name, header := range map[string]http.Header{
+		"unknown origin": {"Origin": {"https://evil.example"}, "Access-Control-Request-Method": {"GET"}},
+		"bare domain":    {"Origin": {"https://chirpy.example"}, "Access-Control-Request-Method": {"GET"}},
+		"method":         {"Origin": {origin}, "Access-Control-Request-Method": {"PATCH"}},
+		"header":         {"Origin": {origin}, "Access-Control-Request-Method": {"GET"}, "Access-Control-Request-Headers": {"X-Debug"}},
+	} {
+		resp := c.send("OPTIONS", "/api/chirps", header)
+		expectStatus(t, resp, http.StatusNoContent)
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("%s: expected the preflight to be refused, got Access-Control-Allow-Origin %q", name, got)
+		}
+	}
+
+	resp = c.send("GET", "/api/chirps", http.Header{"Origin": {"https://evil.example"}})
+	expectStatus(t, resp, http.StatusOK)
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" || resp.Header.Get("Vary") == "" {
+		t.Errorf("expected no CORS grant but a Vary for an unknown origin, got %v", resp.Header)
+	}
+}
+
+func TestCORSDisabled(t *testing.T) {
+	c := newTestClient(t)
+	resp := c.send("OPTIONS", "/api/chirps", http.Header{"Origin": {"https://web.chirpy.example"}, "Access-Control-Request-Method": {"GET"}})
+	if resp.StatusCode == http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected no CORS handling by default, got %d %v", resp.StatusCode, resp.Header)
+	}
+}
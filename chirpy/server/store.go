@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Store is the persistence the handlers need. *database.Queries satisfies it.
+type Store interface {
+	// InTx runs fn in a transaction: the writes fn makes with the context it
+	// is given commit together if it returns nil, and not at all otherwise.
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	GetChirps(ctx context.Context, viewerID uuid.NullUUID) ([]database.Chirp, error)
+	GetChirpsByUserID(ctx context.Context, arg database.GetChirpsByUserIDParams) ([]database.Chirp, error)
+	GetRecentChirps(ctx context.Context, arg database.GetRecentChirpsParams) ([]database.GetRecentChirpsRow, error)
+	GetAllChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	GetVisibleChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	DeleteChirp(ctx context.Context, id uuid.UUID) error
+	ImportChirps(ctx context.Context, arg database.ImportChirpsParams) (int64, error)
+	ListChirpsForExport(ctx context.Context, arg database.ListChirpsForExportParams) ([]database.Chirp, error)
+	ListScheduledChirps(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	RescheduleChirp(ctx context.Context, arg database.RescheduleChirpParams) (database.Chirp, error)
+	CancelScheduledChirp(ctx context.Context, id uuid.UUID) (int64, error)
+	PublishDueChirps(ctx context.Context, batchSize int32) ([]database.Chirp, error)
+
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error)
+	DeleteUsers(ctx context.Context) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	AnonymizeUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error)
+	UpgradeUserToRed(ctx context.Context, id uuid.UUID) (database.User, error)
+	SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (database.User, error)
+	GetUserByHandle(ctx context.Context, handle string) (database.User, error)
+	UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.User, error)
+	GetUserProfile(ctx context.Context, handle string) (database.GetUserProfileRow, error)
+	SetUserAvatar(ctx context.Context, arg database.SetUserAvatarParams) error
+	GetUserAvatar(ctx context.Context, userID uuid.UUID) (database.UserAvatar, error)
+	DeleteUserAvatar(ctx context.Context, userID uuid.UUID) (int64, error)
+
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error
+	GetUserByRefreshToken(ctx context.Context, token string) (uuid.UUID, error)
+	RevokeRefreshToken(ctx context.Context, token string) (uuid.UUID, error)
+	ListRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error)
+	RevokeRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) error
+
+	CreateChirpReport(ctx context.Context, arg database.CreateChirpReportParams) (database.ChirpReport, error)
+	ListOpenChirpReports(ctx context.Context) ([]database.ChirpReport, error)
+	ListChirpReportsByReporter(ctx context.Context, reporterID uuid.UUID) ([]database.ChirpReport, error)
+	ResolveChirpReports(ctx context.Context, arg database.ResolveChirpReportsParams) error
+	DismissChirpReport(ctx context.Context, arg database.DismissChirpReportParams) (database.ChirpReport, error)
+	HideChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	SuspendUser(ctx context.Context, arg database.SuspendUserParams) (database.User, error)
+	BanUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationAction, error)
+	ListModerationActions(ctx context.Context, limit int32) ([]database.ModerationAction, error)
+
+	GetStatsTotals(ctx context.Context) (database.GetStatsTotalsRow, error)
+	CountSignupsByDay(ctx context.Context, since time.Time) ([]database.CountSignupsByDayRow, error)
+	CountChirpsByDay(ctx context.Context, since time.Time) ([]database.CountChirpsByDayRow, error)
+	ListTopPosters(ctx context.Context, limit int32) ([]database.ListTopPostersRow, error)
+
+	CreateDataExport(ctx context.Context, arg database.CreateDataExportParams) (database.DataExport, error)
+	GetDataExport(ctx context.Context, arg database.GetDataExportParams) (database.DataExport, error)
+	CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error
+	FailDataExport(ctx context.Context, id uuid.UUID) error
+	FailStaleDataExports(ctx context.Context, olderThanSeconds int32) (int64, error)
+	AppendDataExportChunk(ctx context.Context, arg database.AppendDataExportChunkParams) error
+	GetDataExportChunk(ctx context.Context, arg database.GetDataExportChunkParams) ([]byte, error)
+	DeleteDataExportChunks(ctx context.Context, exportID uuid.UUID) error
+	DeleteExpiredDataExports(ctx context.Context) (int64, error)
+	DeleteDataExportsByUserID(ctx context.Context, userID uuid.UUID) error
+	CreateSubscriptionEvent(ctx context.Context, arg database.CreateSubscriptionEventParams) error
+	ListSubscriptionEvents(ctx context.Context, userID uuid.UUID) ([]database.SubscriptionEvent, error)
+
+	CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error)
+	ListWebhookEndpoints(ctx context.Context, userID uuid.UUID) ([]database.WebhookEndpoint, error)
+	GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID) error
+	DeleteWebhookEndpointsByUserID(ctx context.Context, userID uuid.UUID) error
+	ListWebhookEndpointsForEvent(ctx context.Context, arg database.ListWebhookEndpointsForEventParams) ([]database.WebhookEndpoint, error)
+	CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error
+	ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, arg database.RecordWebhookAttemptParams) error
+	ListWebhookDeliveries(ctx context.Context, arg database.ListWebhookDeliveriesParams) ([]database.WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, arg database.GetWebhookDeliveryParams) (database.WebhookDelivery, error)
+	RetryWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error)
+
+	CreateConversation(ctx context.Context, participantKey string) (database.Conversation, error)
+	AddConversationParticipant(ctx context.Context, arg database.AddConversationParticipantParams) error
+	GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error)
+	GetConversationByParticipantKey(ctx context.Context, participantKey string) (database.Conversation, error)
+	ListConversationsForUser(ctx context.Context, userID uuid.UUID) ([]database.ListConversationsForUserRow, error)
+	ListConversationParticipants(ctx context.Context, conversationID uuid.UUID) ([]database.ConversationParticipant, error)
+	TouchConversation(ctx context.Context, arg database.TouchConversationParams) error
+	CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error)
+	GetMessage(ctx context.Context, arg database.GetMessageParams) (database.Message, error)
+	ListMessages(ctx context.Context, arg database.ListMessagesParams) ([]database.Message, error)
+	MarkConversationRead(ctx context.Context, arg database.MarkConversationReadParams) error
+	DeleteMessageForUser(ctx context.Context, arg database.DeleteMessageForUserParams) error
+	DeleteMessagesBySenderID(ctx context.Context, senderID uuid.UUID) error
+	DeleteMessageDeletionsByUserID(ctx context.Context, userID uuid.UUID) error
+	DeleteConversationParticipantsByUserID(ctx context.Context, userID uuid.UUID) error
+
+	CreateUserRelationship(ctx context.Context, arg database.CreateUserRelationshipParams) error
+	DeleteUserRelationship(ctx context.Context, arg database.DeleteUserRelationshipParams) (int64, error)
+	ListUserRelationships(ctx context.Context, arg database.ListUserRelationshipsParams) ([]database.UserRelationship, error)
+	IsBlockedBetween(ctx context.Context, arg database.IsBlockedBetweenParams) (bool, error)
+	DeleteUserRelationshipsByUserID(ctx context.Context, userID uuid.UUID) error
+	FollowUser(ctx context.Context, arg database.FollowUserParams) (int64, error)
+	UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) (int64, error)
+	ListUserFollows(ctx context.Context, followerID uuid.UUID) ([]database.UserFollow, error)
+	DeleteFollowsBetween(ctx context.Context, arg database.DeleteFollowsBetweenParams) error
+	DeleteUserFollowsByUserID(ctx context.Context, userID uuid.UUID) error
+}
+
+var _ Store = (*database.Queries)(nil)
@@ -0,0 +1,1597 @@
+// Package storetest is a conformance suite for server.Store implementations.
+// Every backend, and the in-memory fake the server tests use, runs the same
+// checks so they can't drift apart on the semantics the handlers depend on.
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+// Run runs the suite. newStore must return an empty store for each subtest.
+func Run(t *testing.T, newStore func(t *testing.T) server.Store) {
+	tests := []struct {
+		name string
+		fn   func(*testing.T, server.Store)
+	}{
+		{"Users", testUsers},
+		{"Chirps", testChirps},
+		{"ChirpVisibility", testChirpVisibility},
+		{"ImportExport", testImportExport},
+		{"ScheduledChirps", testScheduledChirps},
+		{"RefreshTokens", testRefreshTokens},
+		{"Reports", testReports},
+		{"ModerationActions", testModerationActions},
+		{"DeleteUsers", testDeleteUsers},
+		{"DeleteUser", testDeleteUser},
+		{"AnonymizeUser", testAnonymizeUser},
+		{"Stats", testStats},
+		{"DataExports", testDataExports},
+		{"Webhooks", testWebhooks},
+		{"Profiles", testProfiles},
+		{"Messages", testMessages},
+		{"Relationships", testRelationships},
+		{"Transactions", testTransactions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func createUser(t *testing.T, store server.Store, email string) database.User {
+	t.Helper()
+	user, err := store.CreateUser(context.Background(), database.CreateUserParams{Email: email, HashedPassword: "hash"})
+	if err != nil {
+		t.Fatalf("creating %s: %v", email, err)
+	}
+	return user
+}
+
+func createChirp(t *testing.T, store server.Store, userID uuid.UUID, body string) database.Chirp {
+	t.Helper()
+	chirp, err := store.CreateChirp(context.Background(), database.CreateChirpParams{UserID: userID, Body: body})
+	if err != nil {
+		t.Fatalf("creating chirp %q: %v", body, err)
+	}
+	return chirp
+}
+
+func wantNoRows(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("%s: expected sql.ErrNoRows, got %v", what, err)
+	}
+}
+
+func chirpBodies(chirps []database.Chirp) []string {
+	var bodies []string
+	for _, chirp := range chirps {
+		bodies = append(bodies, chirp.Body)
+	}
+	return bodies
+}
+
+func testUsers(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	user := createUser(t, store, "ada@example.com")
+	if user.ID == uuid.Nil || !user.CreatedAt.Valid || !user.UpdatedAt.Valid {
+		t.Errorf("expected an id and timestamps, got %+v", user)
+	}
+	if user.Role != "user" || user.IsChirpyRed.Bool || user.SuspendedUntil.Valid || user.BannedAt.Valid {
+		t.Errorf("unexpected defaults: %+v", user)
+	}
+	if _, err := store.CreateUser(ctx, database.CreateUserParams{Email: "ada@example.com", HashedPassword: "other"}); !database.IsUniqueViolation(err) {
+		t.Errorf("expected a duplicate email to be a unique violation, got %v", err)
+	}
+
+	byEmail, err := store.GetUserByEmail(ctx, "ada@example.com")
+	if err != nil || byEmail.ID != user.ID || byEmail.HashedPassword != "hash" {
+		t.Errorf("GetUserByEmail: %+v, %v", byEmail, err)
+	}
+	byID, err := store.GetUserByID(ctx, user.ID)
+	if err != nil || byID.Email != user.Email || !byID.CreatedAt.Time.Equal(user.CreatedAt.Time) {
+		t.Errorf("GetUserByID: %+v, %v", byID, err)
+	}
+	_, err = store.GetUserByEmail(ctx, "nobody@example.com")
+	wantNoRows(t, "GetUserByEmail", err)
+	_, err = store.GetUserByID(ctx, uuid.New())
+	wantNoRows(t, "GetUserByID", err)
+
+	updated, err := store.UpdateUser(ctx, database.UpdateUserParams{ID: user.ID, Email: "lovelace@example.com", HashedPassword: "new"})
+	if err != nil || updated.Email != "lovelace@example.com" || updated.HashedPassword != "new" {
+		t.Errorf("UpdateUser: %+v, %v", updated, err)
+	}
+	if updated.UpdatedAt.Time.Before(user.UpdatedAt.Time) {
+		t.Errorf("updated_at went backwards: %s -> %s", user.UpdatedAt.Time, updated.UpdatedAt.Time)
+	}
+	_, err = store.UpdateUser(ctx, database.UpdateUserParams{ID: uuid.New(), Email: "x@example.com"})
+	wantNoRows(t, "UpdateUser", err)
+	other := createUser(t, store, "other@example.com")
+	if _, err := store.UpdateUser(ctx, database.UpdateUserParams{ID: other.ID, Email: "lovelace@example.com", HashedPassword: "new"}); !database.IsUniqueViolation(err) {
+		t.Errorf("expected taking another user's email to be a unique violation, got %v", err)
+	}
+
+	red, err := store.UpgradeUserToRed(ctx, user.ID)
+	if err != nil || !red.IsChirpyRed.Valid || !red.IsChirpyRed.Bool {
+		t.Errorf("UpgradeUserToRed: %+v, %v", red, err)
+	}
+	_, err = store.UpgradeUserToRed(ctx, uuid.New())
+	wantNoRows(t, "UpgradeUserToRed", err)
+
+	mod, err := store.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: "moderator"})
+	if err != nil || mod.Role != "moderator" {
+		t.Errorf("SetUserRole: %+v, %v", mod, err)
+	}
+	_, err = store.SetUserRole(ctx, database.SetUserRoleParams{ID: uuid.New(), Role: "admin"})
+	wantNoRows(t, "SetUserRole", err)
+}
+
+func testChirps(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	bob := createUser(t, store, "bob@example.com")
+
+	first := createChirp(t, store, ada.ID, "first")
+	createChirp(t, store, bob.ID, "second")
+	createChirp(t, store, ada.ID, "third")
+	if first.ID == uuid.Nil || first.UserID != ada.ID || !first.CreatedAt.Valid || first.HiddenAt.Valid {
+		t.Errorf("unexpected chirp: %+v", first)
+	}
+
+	all, err := store.GetChirps(ctx, uuid.NullUUID{})
+	if err != nil || !slices.Equal(chirpBodies(all), []string{"first", "second", "third"}) {
+		t.Errorf("GetChirps: %v, %v", chirpBodies(all), err)
+	}
+	byAda, err := store.GetChirpsByUserID(ctx, database.GetChirpsByUserIDParams{UserID: ada.ID})
+	if err != nil || !slices.Equal(chirpBodies(byAda), []string{"first", "third"}) {
+		t.Errorf("GetChirpsByUserID: %v, %v", chirpBodies(byAda), err)
+	}
+	if _, err := store.UpdateUserProfile(ctx, database.UpdateUserProfileParams{ID: ada.ID, Handle: "ada"}); err != nil {
+		t.Fatalf("UpdateUserProfile: %v", err)
+	}
+	recent, err := store.GetRecentChirps(ctx, database.GetRecentChirpsParams{PageSize: 2})
+	if err != nil || len(recent) != 2 || recent[0].Body != "third" || recent[1].Body != "second" ||
+		recent[0].AuthorHandle.String != "ada" || recent[1].AuthorHandle.Valid {
+		t.Errorf("GetRecentChirps: %+v, %v", recent, err)
+	}
+	recent, err = store.GetRecentChirps(ctx, database.GetRecentChirpsParams{UserID: uuid.NullUUID{UUID: ada.ID, Valid: true}, PageSize: 10})
+	if err != nil || len(recent) != 2 || recent[0].Body != "third" || recent[1].Body != "first" {
+		t.Errorf("GetRecentChirps for ada: %+v, %v", recent, err)
+	}
+	none, err := store.GetChirpsByUserID(ctx, database.GetChirpsByUserIDParams{UserID: uuid.New()})
+	if err != nil || len(none) != 0 {
+		t.Errorf("GetChirpsByUserID for an unknown user: %v, %v", none, err)
+	}
+
+	got, err := store.GetChirp(ctx, first.ID)
+	if err != nil || got.Body != "first" || !got.CreatedAt.Time.Equal(first.CreatedAt.Time) {
+		t.Errorf("GetChirp: %+v, %v", got, err)
+	}
+	_, err = store.GetChirp(ctx, uuid.New())
+	wantNoRows(t, "GetChirp", err)
+
+	if err := store.DeleteChirp(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteChirp: %v", err)
+	}
+	_, err = store.GetChirp(ctx, first.ID)
+	wantNoRows(t, "GetChirp after delete", err)
+	if err := store.DeleteChirp(ctx, uuid.New()); err != nil {
+		t.Errorf("deleting a missing chirp should be a no-op, got %v", err)
+	}
+}
+
+func testChirpVisibility(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	author := createUser(t, store, "author@example.com")
+	chirp := createChirp(t, store, author.ID, "hello")
+
+	visible := func(want bool, when string) {
+		t.Helper()
+		_, err := store.GetVisibleChirp(ctx, chirp.ID)
+		if want && err != nil {
+			t.Errorf("%s: GetVisibleChirp: %v", when, err)
+		}
+		if !want {
+			wantNoRows(t, when+": GetVisibleChirp", err)
+		}
+		for name, list := range map[string]func() ([]database.Chirp, error){
+			"GetChirps": func() ([]database.Chirp, error) { return store.GetChirps(ctx, uuid.NullUUID{}) },
+			"GetChirpsByUserID": func() ([]database.Chirp, error) {
+				return store.GetChirpsByUserID(ctx, database.GetChirpsByUserIDParams{UserID: author.ID})
+			},
+		} {
+			chirps, err := list()
+			if err != nil || (len(chirps) == 1) != want {
+				t.Errorf("%s: %s returned %v, %v", when, name, chirpBodies(chirps), err)
+			}
+		}
+		// GetChirp ignores visibility; owners and moderators still need it.
+		if _, err := store.GetChirp(ctx, chirp.ID); err != nil {
+			t.Errorf("%s: GetChirp: %v", when, err)
+		}
+	}
+	visible(true, "new chirp")
+
+	suspend := func(until sql.NullTime) {
+		t.Helper()
+		user, err := store.SuspendUser(ctx, database.SuspendUserParams{ID: author.ID, SuspendedUntil: until})
+		if err != nil || user.SuspendedUntil.Valid != until.Valid {
+			t.Fatalf("SuspendUser: %+v, %v", user, err)
+		}
+	}
+	suspend(sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true})
+	visible(false, "author suspended")
+	suspend(sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true})
+	visible(true, "suspension expired")
+	suspend(sql.NullTime{})
+	visible(true, "suspension lifted")
+
+	hidden, err := store.HideChirp(ctx, chirp.ID)
+	if err != nil || !hidden.HiddenAt.Valid {
+		t.Fatalf("HideChirp: %+v, %v", hidden, err)
+	}
+	visible(false, "chirp hidden")
+	// GetAllChirpsByUserID is for the author's own data export.
+	if all, err := store.GetAllChirpsByUserID(ctx, author.ID); err != nil || len(all) != 1 || all[0].ID != chirp.ID {
+		t.Errorf("expected GetAllChirpsByUserID to include hidden chirps, got %v, %v", chirpBodies(all), err)
+	}
+	_, err = store.HideChirp(ctx, uuid.New())
+	wantNoRows(t, "HideChirp", err)
+
+	other := createUser(t, store, "other@example.com")
+	chirp = createChirp(t, store, other.ID, "still here")
+	author = other
+	visible(true, "second author")
+	banned, err := store.BanUser(ctx, other.ID)
+	if err != nil || !banned.BannedAt.Valid {
+		t.Fatalf("BanUser: %+v, %v", banned, err)
+	}
+	visible(false, "author banned")
+	_, err = store.BanUser(ctx, uuid.New())
+	wantNoRows(t, "BanUser", err)
+}
+
+func testImportExport(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	bob := createUser(t, store, "bob@example.com")
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New(), uuid.New()}
+	params := database.ImportChirpsParams{
+		Ids:        ids,
+		Bodies:     []string{"one", "two", "three", "four"},
+		CreatedAts: []time.Time{base, base.Add(time.Hour), base.Add(time.Hour), base.Add(48 * time.Hour)},
+		UpdatedAts: []time.Time{base, base.Add(time.Hour), base.Add(2 * time.Hour), base.Add(48 * time.Hour)},
+		UserIds:    []uuid.UUID{ada.ID, ada.ID, bob.ID, ada.ID},
+	}
+	n, err := store.ImportChirps(ctx, params)
+	if err != nil || n != 4 {
+		t.Fatalf("ImportChirps: %d, %v", n, err)
+	}
+	got, err := store.GetChirp(ctx, ids[2])
+	if err != nil || got.Body != "three" || !got.CreatedAt.Time.Equal(base.Add(time.Hour)) || !got.UpdatedAt.Time.Equal(base.Add(2*time.Hour)) {
+		t.Errorf("expected the original timestamps to be kept, got %+v, %v", got, err)
+	}
+	// Ids already present are skipped rather than failing the batch.
+	n, err = store.ImportChirps(ctx, database.ImportChirpsParams{
+		Ids:        []uuid.UUID{ids[0], uuid.New()},
+		Bodies:     []string{"again", "five"},
+		CreatedAts: []time.Time{base, base.Add(72 * time.Hour)},
+		UpdatedAts: []time.Time{base, base.Add(72 * time.Hour)},
+		UserIds:    []uuid.UUID{ada.ID, bob.ID},
+	})
+	if err != nil || n != 1 {
+		t.Errorf("expected one new chirp, got %d, %v", n, err)
+	}
+	if got, err := store.GetChirp(ctx, ids[0]); err != nil || got.Body != "one" {
+		t.Errorf("expected the existing chirp to be untouched, got %+v, %v", got, err)
+	}
+	if _, err := store.HideChirp(ctx, ids[3]); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(arg database.ListChirpsForExportParams) []string {
+		t.Helper()
+		chirps, err := store.ListChirpsForExport(ctx, arg)
+		if err != nil {
+			t.Fatalf("ListChirpsForExport: %v", err)
+		}
+		return chirpBodies(chirps)
+	}
+	all := list(database.ListChirpsForExportParams{PageSize: 10})
+	if len(all) != 4 || all[0] != "one" || all[3] != "five" || slices.Contains(all, "four") {
+		t.Errorf("expected every visible chirp oldest first, got %v", all)
+	}
+	if got := list(database.ListChirpsForExportParams{UserID: uuid.NullUUID{UUID: ada.ID, Valid: true}, PageSize: 10}); !slices.Equal(got, []string{"one", "two"}) {
+		t.Errorf("expected ada's visible chirps, got %v", got)
+	}
+	window := database.ListChirpsForExportParams{
+		Since:    sql.NullTime{Time: base.Add(time.Hour), Valid: true},
+		Until:    sql.NullTime{Time: base.Add(72 * time.Hour), Valid: true},
+		PageSize: 10,
+	}
+	if got := list(window); len(got) != 2 || slices.Contains(got, "one") || slices.Contains(got, "five") {
+		t.Errorf("expected since to be inclusive and until exclusive, got %v", got)
+	}
+
+	// Paging by the last row's (created_at, id) visits every chirp once, even
+	// when two share a created_at.
+	var paged []string
+	page := database.ListChirpsForExportParams{PageSize: 1}
+	for {
+		chirps, err := store.ListChirpsForExport(ctx, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chirps) == 0 {
+			break
+		}
+		paged = append(paged, chirps[0].Body)
+		page.AfterCreatedAt, page.AfterID = chirps[0].CreatedAt.Time, chirps[0].ID
+	}
+	if !slices.Equal(paged, all) {
+		t.Errorf("expected paging to match %v, got %v", all, paged)
+	}
+}
+
+func testScheduledChirps(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	bob := createUser(t, store, "bob@example.com")
+	schedule := func(userID uuid.UUID, body string, at time.Time) database.Chirp {
+		t.Helper()
+		chirp, err := store.CreateChirp(ctx, database.CreateChirpParams{
+			UserID:    userID,
+			Body:      body,
+			PublishAt: sql.NullTime{Time: at.UTC(), Valid: true},
+		})
+		if err != nil || !chirp.PublishAt.Valid {
+			t.Fatalf("scheduling %q: %+v, %v", body, chirp, err)
+		}
+		return chirp
+	}
+	later := schedule(ada.ID, "later", time.Now().Add(2*time.Hour))
+	soon := schedule(ada.ID, "soon", time.Now().Add(time.Hour))
+	schedule(bob.ID, "bob's", time.Now().Add(time.Hour))
+	createChirp(t, store, ada.ID, "now")
+
+	// Scheduled chirps are invisible everywhere but to their author.
+	if chirps, err := store.GetChirps(ctx, uuid.NullUUID{}); err != nil || !slices.Equal(chirpBodies(chirps), []string{"now"}) {
+		t.Errorf("expected only the published chirp, got %v, %v", chirpBodies(chirps), err)
+	}
+	if chirps, err := store.GetChirpsByUserID(ctx, database.GetChirpsByUserIDParams{UserID: ada.ID}); err != nil || len(chirps) != 1 {
+		t.Errorf("expected only the published chirp, got %v, %v", chirpBodies(chirps), err)
+	}
+	_, err := store.GetVisibleChirp(ctx, soon.ID)
+	wantNoRows(t, "GetVisibleChirp on a scheduled chirp", err)
+	if chirps, err := store.ListChirpsForExport(ctx, database.ListChirpsForExportParams{PageSize: 10}); err != nil || len(chirps) != 1 {
+		t.Errorf("expected exports to leave out scheduled chirps, got %v, %v", chirpBodies(chirps), err)
+	}
+	if chirps, err := store.ListScheduledChirps(ctx, ada.ID); err != nil || !slices.Equal(chirpBodies(chirps), []string{"soon", "later"}) {
+		t.Errorf("expected ada's scheduled chirps by publish time, got %v, %v", chirpBodies(chirps), err)
+	}
+
+	// Nothing is due yet.
+	if published, err := store.PublishDueChirps(ctx, 10); err != nil || len(published) != 0 {
+		t.Errorf("expected nothing to publish, got %v, %v", chirpBodies(published), err)
+	}
+
+	due := time.Now().Add(-time.Minute).UTC().Truncate(time.Microsecond)
+	rescheduled, err := store.RescheduleChirp(ctx, database.RescheduleChirpParams{ID: later.ID, PublishAt: due})
+	if err != nil || !rescheduled.PublishAt.Time.Equal(due) {
+		t.Fatalf("RescheduleChirp: %+v, %v", rescheduled, err)
+	}
+	published, err := store.PublishDueChirps(ctx, 10)
+	if err != nil || len(published) != 1 || published[0].ID != later.ID {
+		t.Fatalf("expected the rescheduled chirp to be published, got %v, %v", chirpBodies(published), err)
+	}
+	if p := published[0]; p.PublishAt.Valid || !p.CreatedAt.Time.Equal(due) {
+		t.Errorf("expected the chirp to be dated when it was due, got %+v", p)
+	}
+	if _, err := store.GetVisibleChirp(ctx, later.ID); err != nil {
+		t.Errorf("expected the published chirp to be visible: %v", err)
+	}
+	if published, err := store.PublishDueChirps(ctx, 10); err != nil || len(published) != 0 {
+		t.Errorf("expected a chirp to be published once, got %v, %v", chirpBodies(published), err)
+	}
+	// Published chirps can no longer be rescheduled or cancelled.
+	_, err = store.RescheduleChirp(ctx, database.RescheduleChirpParams{ID: later.ID, PublishAt: due})
+	wantNoRows(t, "RescheduleChirp on a published chirp", err)
+	if n, err := store.CancelScheduledChirp(ctx, later.ID); err != nil || n != 0 {
+		t.Errorf("expected cancelling a published chirp to do nothing, got %d, %v", n, err)
+	}
+
+	if n, err := store.CancelScheduledChirp(ctx, soon.ID); err != nil || n != 1 {
+		t.Errorf("CancelScheduledChirp: %d, %v", n, err)
+	}
+	_, err = store.GetChirp(ctx, soon.ID)
+	wantNoRows(t, "GetChirp after cancelling", err)
+	if chirps, err := store.ListScheduledChirps(ctx, ada.ID); err != nil || len(chirps) != 0 {
+		t.Errorf("expected no scheduled chirps left, got %v, %v", chirpBodies(chirps), err)
+	}
+}
+
+func testRefreshTokens(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	user := createUser(t, store, "ada@example.com")
+
+	create := func(token string, expiresIn time.Duration) {
+		t.Helper()
+		err := store.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			UserID:           user.ID,
+			Token:            token,
+			ExpiresInSeconds: int32(expiresIn / time.Second),
+		})
+		if err != nil {
+			t.Fatalf("CreateRefreshToken: %v", err)
+		}
+	}
+	create("live", time.Hour)
+	create("expired", -time.Minute)
+
+	userID, err := store.GetUserByRefreshToken(ctx, "live")
+	if err != nil || userID != user.ID {
+		t.Errorf("GetUserByRefreshToken: %s, %v", userID, err)
+	}
+	_, err = store.GetUserByRefreshToken(ctx, "expired")
+	wantNoRows(t, "GetUserByRefreshToken for an expired token", err)
+	_, err = store.GetUserByRefreshToken(ctx, "unknown")
+	wantNoRows(t, "GetUserByRefreshToken for an unknown token", err)
+
+	userID, err = store.RevokeRefreshToken(ctx, "live")
+	if err != nil || userID != user.ID {
+		t.Errorf("RevokeRefreshToken: %s, %v", userID, err)
+	}
+	_, err = store.GetUserByRefreshToken(ctx, "live")
+	wantNoRows(t, "GetUserByRefreshToken after revoking", err)
+	_, err = store.RevokeRefreshToken(ctx, "unknown")
+	wantNoRows(t, "RevokeRefreshToken", err)
+
+	tokens, err := store.ListRefreshTokensByUserID(ctx, user.ID)
+	if err != nil || len(tokens) != 2 || tokens[0].Token != "live" || !tokens[0].RevokedAt.Valid || tokens[1].Token != "expired" {
+		t.Errorf("ListRefreshTokensByUserID: %+v, %v", tokens, err)
+	}
+	if tokens, err := store.ListRefreshTokensByUserID(ctx, uuid.New()); err != nil || len(tokens) != 0 {
+		t.Errorf("expected no tokens for an unknown user, got %+v, %v", tokens, err)
+	}
+}
+
+func testReports(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	author := createUser(t, store, "author@example.com")
+	reporter := createUser(t, store, "reporter@example.com")
+	moderator := createUser(t, store, "mod@example.com")
+	spam := createChirp(t, store, author.ID, "buy now")
+	rude := createChirp(t, store, author.ID, "rude")
+
+	report := func(chirpID uuid.UUID, reporterID uuid.UUID, reason string) database.ChirpReport {
+		t.Helper()
+		r, err := store.CreateChirpReport(ctx, database.CreateChirpReportParams{
+			ChirpID: chirpID, ReporterID: reporterID, Reason: reason, Details: "see chirp",
+		})
+		if err != nil {
+			t.Fatalf("CreateChirpReport: %v", err)
+		}
+		return r
+	}
+	first := report(spam.ID, reporter.ID, "spam")
+	if first.Status != "open" || first.Details != "see chirp" || first.CreatedAt.IsZero() || first.ResolvedAt.Valid || first.ResolvedBy.Valid {
+		t.Errorf("unexpected report: %+v", first)
+	}
+	second := report(spam.ID, moderator.ID, "spam")
+	third := report(rude.ID, reporter.ID, "harassment")
+	if _, err := store.CreateChirpReport(ctx, database.CreateChirpReportParams{
+		ChirpID: spam.ID, ReporterID: reporter.ID, Reason: "other",
+	}); !database.IsUniqueViolation(err) {
+		t.Errorf("expected a second report of the same chirp by the same user to be a unique violation, got %v", err)
+	}
+
+	open := func() []uuid.UUID {
+		t.Helper()
+		reports, err := store.ListOpenChirpReports(ctx)
+		if err != nil {
+			t.Fatalf("ListOpenChirpReports: %v", err)
+		}
+		var ids []uuid.UUID
+		for _, r := range reports {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	if ids := open(); len(ids) != 3 || ids[0] != first.ID || ids[1] != second.ID || ids[2] != third.ID {
+		t.Errorf("expected the three reports oldest first, got %v", ids)
+	}
+	filed, err := store.ListChirpReportsByReporter(ctx, reporter.ID)
+	if err != nil || len(filed) != 2 || filed[0].ID != first.ID || filed[1].ID != third.ID {
+		t.Errorf("expected the reporter's two reports oldest first, got %+v, %v", filed, err)
+	}
+
+	resolver := uuid.NullUUID{UUID: moderator.ID, Valid: true}
+	dismissed, err := store.DismissChirpReport(ctx, database.DismissChirpReportParams{ID: third.ID, ResolvedBy: resolver})
+	if err != nil || dismissed.Status != "dismissed" || !dismissed.ResolvedAt.Valid || dismissed.ResolvedBy != resolver {
+		t.Errorf("DismissChirpReport: %+v, %v", dismissed, err)
+	}
+	_, err = store.DismissChirpReport(ctx, database.DismissChirpReportParams{ID: third.ID, ResolvedBy: resolver})
+	wantNoRows(t, "dismissing a closed report", err)
+
+	if err := store.ResolveChirpReports(ctx, database.ResolveChirpReportsParams{ChirpID: spam.ID, ResolvedBy: resolver}); err != nil {
+		t.Fatalf("ResolveChirpReports: %v", err)
+	}
+	if ids := open(); len(ids) != 0 {
+		t.Errorf("expected no open reports, got %v", ids)
+	}
+
+	// Postgres cascades the delete to the chirp's reports.
+	report(rude.ID, moderator.ID, "other")
+	if err := store.DeleteChirp(ctx, rude.ID); err != nil {
+		t.Fatalf("DeleteChirp: %v", err)
+	}
+	if ids := open(); len(ids) != 0 {
+		t.Errorf("expected reports on a deleted chirp to go with it, got %v", ids)
+	}
+}
+
+func testModerationActions(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	moderator := createUser(t, store, "mod@example.com")
+	target := createUser(t, store, "target@example.com")
+
+	expires := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	suspend, err := store.CreateModerationAction(ctx, database.CreateModerationActionParams{
+		ActorID:      moderator.ID,
+		Action:       "suspend_user",
+		TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+		Reason:       "cooling off",
+		ExpiresAt:    sql.NullTime{Time: expires, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateModerationAction: %v", err)
+	}
+	if suspend.ID == uuid.Nil || suspend.CreatedAt.IsZero() || suspend.TargetChirpID.Valid || !suspend.ExpiresAt.Time.Equal(expires) {
+		t.Errorf("unexpected action: %+v", suspend)
+	}
+	ban, err := store.CreateModerationAction(ctx, database.CreateModerationActionParams{
+		ActorID:      moderator.ID,
+		Action:       "ban_user",
+		TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+		Reason:       "repeat offender",
+	})
+	if err != nil {
+		t.Fatalf("CreateModerationAction: %v", err)
+	}
+
+	actions, err := store.ListModerationActions(ctx, 10)
+	if err != nil || len(actions) != 2 || actions[0].ID != ban.ID || actions[1].ID != suspend.ID {
+		t.Errorf("expected newest first, got %+v, %v", actions, err)
+	}
+	actions, err = store.ListModerationActions(ctx, 1)
+	if err != nil || len(actions) != 1 || actions[0].ID != ban.ID {
+		t.Errorf("expected the limit to apply, got %+v, %v", actions, err)
+	}
+}
+
+func testDeleteUsers(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	user := createUser(t, store, "ada@example.com")
+	reporter := createUser(t, store, "bob@example.com")
+	chirp := createChirp(t, store, user.ID, "hello")
+	if _, err := store.CreateChirpReport(ctx, database.CreateChirpReportParams{ChirpID: chirp.ID, ReporterID: reporter.ID, Reason: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{UserID: user.ID, Token: "token", ExpiresInSeconds: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	export, err := store.CreateDataExport(ctx, database.CreateDataExportParams{UserID: user.ID, ExpiresInSeconds: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{UserID: user.ID, Event: "upgraded"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.DeleteUsers(ctx); err != nil {
+		t.Fatalf("DeleteUsers: %v", err)
+	}
+	_, err = store.GetUserByID(ctx, user.ID)
+	wantNoRows(t, "GetUserByID", err)
+	_, err = store.GetDataExport(ctx, database.GetDataExportParams{ID: export.ID, UserID: user.ID})
+	wantNoRows(t, "GetDataExport", err)
+	if events, err := store.ListSubscriptionEvents(ctx, user.ID); err != nil || len(events) != 0 {
+		t.Errorf("expected subscription events to be deleted with their users, got %+v, %v", events, err)
+	}
+	_, err = store.GetChirp(ctx, chirp.ID)
+	wantNoRows(t, "GetChirp", err)
+	_, err = store.GetUserByRefreshToken(ctx, "token")
+	wantNoRows(t, "GetUserByRefreshToken", err)
+	if reports, err := store.ListOpenChirpReports(ctx); err != nil || len(reports) != 0 {
+		t.Errorf("expected reports to be deleted with their users, got %v, %v", reports, err)
+	}
+	// The email is free again.
+	createUser(t, store, "ada@example.com")
+}
+
+func testDeleteUser(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	bob := createUser(t, store, "bob@example.com")
+	adaChirp := createChirp(t, store, ada.ID, "mine")
+	bobChirp := createChirp(t, store, bob.ID, "theirs")
+	for _, report := range []database.CreateChirpReportParams{
+		{ChirpID: adaChirp.ID, ReporterID: bob.ID, Reason: "spam"},
+		{ChirpID: bobChirp.ID, ReporterID: ada.ID, Reason: "spam"},
+	} {
+		if _, err := store.CreateChirpReport(ctx, report); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{UserID: ada.ID, Token: "ada", ExpiresInSeconds: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateDataExport(ctx, database.CreateDataExportParams{UserID: ada.ID, ExpiresInSeconds: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{UserID: ada.ID, Event: "upgraded"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.DeleteUser(ctx, ada.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	_, err := store.GetUserByID(ctx, ada.ID)
+	wantNoRows(t, "GetUserByID", err)
+	_, err = store.GetChirp(ctx, adaChirp.ID)
+	wantNoRows(t, "GetChirp", err)
+	_, err = store.GetUserByRefreshToken(ctx, "ada")
+	wantNoRows(t, "GetUserByRefreshToken", err)
+	if reports, err := store.ListOpenChirpReports(ctx); err != nil || len(reports) != 0 {
+		t.Errorf("expected reports by and about the user to go, got %+v, %v", reports, err)
+	}
+	if _, err := store.GetUserByID(ctx, bob.ID); err != nil {
+		t.Errorf("expected other users to survive, got %v", err)
+	}
+	if chirps, err := store.GetChirps(ctx, uuid.NullUUID{}); err != nil || !slices.Equal(chirpBodies(chirps), []string{"theirs"}) {
+		t.Errorf("expected only the other user's chirp, got %v, %v", chirpBodies(chirps), err)
+	}
+	// The email is free again.
+	createUser(t, store, "ada@example.com")
+}
+
+func testAnonymizeUser(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	chirp := createChirp(t, store, ada.ID, "kept")
+	if _, err := store.UpgradeUserToRed(ctx, ada.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.UpdateUserProfile(ctx, database.UpdateUserProfileParams{Handle: "ada", DisplayName: "Ada", Bio: "hi", ID: ada.ID}); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"one", "two"} {
+		if err := store.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{UserID: ada.ID, Token: token, ExpiresInSeconds: 3600}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	export, err := store.CreateDataExport(ctx, database.CreateDataExportParams{UserID: ada.ID, ExpiresInSeconds: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.RevokeRefreshTokensByUserID(ctx, ada.ID); err != nil {
+		t.Fatalf("RevokeRefreshTokensByUserID: %v", err)
+	}
+	for _, token := range []string{"one", "two"} {
+		_, err := store.GetUserByRefreshToken(ctx, token)
+		wantNoRows(t, "GetUserByRefreshToken after revoking all", err)
+	}
+	if err := store.DeleteDataExportsByUserID(ctx, ada.ID); err != nil {
+		t.Fatalf("DeleteDataExportsByUserID: %v", err)
+	}
+	_, err = store.GetDataExport(ctx, database.GetDataExportParams{ID: export.ID, UserID: ada.ID})
+	wantNoRows(t, "GetDataExport after deleting the user's exports", err)
+
+	bob := createUser(t, store, "bob@example.com")
+	conversation, err := store.CreateConversation(ctx, ada.ID.String()+","+bob.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range []uuid.UUID{ada.ID, bob.ID} {
+		if err := store.AddConversationParticipant(ctx, database.AddConversationParticipantParams{ConversationID: conversation.ID, UserID: userID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send := func(senderID uuid.UUID, body string) database.Message {
+		t.Helper()
+		message, err := store.CreateMessage(ctx, database.CreateMessageParams{ConversationID: conversation.ID, SenderID: senderID, Body: body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	fromAda := send(ada.ID, "from ada")
+	fromBob := send(bob.ID, "from bob")
+	for _, deletion := range []database.DeleteMessageForUserParams{{MessageID: fromBob.ID, UserID: ada.ID}, {MessageID: fromAda.ID, UserID: bob.ID}} {
+		if err := store.DeleteMessageForUser(ctx, deletion); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, rel := range []database.CreateUserRelationshipParams{{UserID: ada.ID, TargetID: bob.ID, Kind: "mute"}, {UserID: bob.ID, TargetID: ada.ID, Kind: "block"}} {
+		if err := store.CreateUserRelationship(ctx, rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listMessages := func(userID uuid.UUID) []database.Message {
+		t.Helper()
+		messages, err := store.ListMessages(ctx, database.ListMessagesParams{ConversationID: conversation.ID, UserID: userID, PageSize: 10})
+		if err != nil {
+			t.Fatalf("ListMessages: %v", err)
+		}
+		return messages
+	}
+
+	if err := store.DeleteMessagesBySenderID(ctx, ada.ID); err != nil {
+		t.Fatalf("DeleteMessagesBySenderID: %v", err)
+	}
+	if messages := listMessages(bob.ID); len(messages) != 1 || messages[0].ID != fromBob.ID {
+		t.Errorf("expected only bob's message to remain, got %+v", messages)
+	}
+	if err := store.DeleteMessageDeletionsByUserID(ctx, ada.ID); err != nil {
+		t.Fatalf("DeleteMessageDeletionsByUserID: %v", err)
+	}
+	if messages := listMessages(ada.ID); len(messages) != 1 {
+		t.Errorf("expected ada's deletions to be gone, got %+v", messages)
+	}
+	if err := store.DeleteConversationParticipantsByUserID(ctx, ada.ID); err != nil {
+		t.Fatalf("DeleteConversationParticipantsByUserID: %v", err)
+	}
+	participants, err := store.ListConversationParticipants(ctx, conversation.ID)
+	if err != nil || len(participants) != 1 || participants[0].UserID != bob.ID {
+		t.Errorf("expected ada to have left the conversation, got %+v, %v", participants, err)
+	}
+	if err := store.DeleteUserRelationshipsByUserID(ctx, ada.ID); err != nil {
+		t.Fatalf("DeleteUserRelationshipsByUserID: %v", err)
+	}
+	for _, arg := range []database.ListUserRelationshipsParams{{UserID: ada.ID, Kind: "mute"}, {UserID: bob.ID, Kind: "block"}} {
+		if rows, err := store.ListUserRelationships(ctx, arg); err != nil || len(rows) != 0 {
+			t.Errorf("expected relationships both ways to be gone, got %+v, %v", rows, err)
+		}
+	}
+
+	user, err := store.AnonymizeUser(ctx, ada.ID)
+	if err != nil {
+		t.Fatalf("AnonymizeUser: %v", err)
+	}
+	if !user.DeletedAt.Valid || user.Email == "ada@example.com" || user.HashedPassword != "" || user.IsChirpyRed.Bool ||
+		user.Handle.Valid || user.DisplayName != "" || user.Bio != "" {
+		t.Errorf("expected a scrubbed user, got %+v", user)
+	}
+	if got, err := store.GetUserByID(ctx, ada.ID); err != nil || got.Email != user.Email || !got.DeletedAt.Valid {
+		t.Errorf("GetUserByID after anonymizing: %+v, %v", got, err)
+	}
+	if _, err := store.GetVisibleChirp(ctx, chirp.ID); err != nil {
+		t.Errorf("expected the chirp to stay visible, got %v", err)
+	}
+	_, err = store.AnonymizeUser(ctx, uuid.New())
+	wantNoRows(t, "AnonymizeUser", err)
+	// The email is free again.
+	createUser(t, store, "ada@example.com")
+}
+
+func testStats(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	bob := createUser(t, store, "bob@example.com")
+	createUser(t, store, "cy@example.com")
+	if _, err := store.UpgradeUserToRed(ctx, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	chirp := createChirp(t, store, ada.ID, "one")
+	createChirp(t, store, ada.ID, "two")
+	createChirp(t, store, ada.ID, "three")
+	createChirp(t, store, bob.ID, "hello")
+	if _, err := store.CreateChirpReport(ctx, database.CreateChirpReportParams{ChirpID: chirp.ID, ReporterID: bob.ID, Reason: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+	for token, expiresIn := range map[string]int32{"live": 3600, "expired": -60, "revoked": 3600} {
+		if err := store.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{UserID: ada.ID, Token: token, ExpiresInSeconds: expiresIn}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.RevokeRefreshToken(ctx, "revoked"); err != nil {
+		t.Fatal(err)
+	}
+	// Neither a scheduled chirp nor an anonymized account counts.
+	_, err := store.CreateChirp(ctx, database.CreateChirpParams{
+		UserID:    bob.ID,
+		Body:      "later",
+		PublishAt: sql.NullTime{Time: time.Now().Add(time.Hour).UTC(), Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone := createUser(t, store, "gone@example.com")
+	for _, body := range []string{"a", "b", "c", "d"} {
+		createChirp(t, store, gone.ID, body)
+	}
+	if _, err := store.AnonymizeUser(ctx, gone.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	totals, err := store.GetStatsTotals(ctx)
+	want := database.GetStatsTotalsRow{Users: 3, ChirpyRedUsers: 1, Chirps: 8, ActiveSessions: 1, OpenReports: 1}
+	if err != nil || totals != want {
+		t.Errorf("GetStatsTotals: expected %+v, got %+v, %v", want, totals, err)
+	}
+
+	// Two days back keeps the window clear of time zone differences.
+	since := time.Now().Add(-48 * time.Hour)
+	signups, err := store.CountSignupsByDay(ctx, since)
+	if err != nil {
+		t.Fatalf("CountSignupsByDay: %v", err)
+	}
+	var total int64
+	for i, row := range signups {
+		total += row.Count
+		if !row.Day.Equal(row.Day.Truncate(24*time.Hour)) || (i > 0 && !row.Day.After(signups[i-1].Day)) {
+			t.Errorf("expected ascending whole days, got %+v", signups)
+		}
+	}
+	// The anonymized account did sign up.
+	if total != 4 {
+		t.Errorf("expected 4 signups since %s, got %+v", since, signups)
+	}
+	chirps, err := store.CountChirpsByDay(ctx, since)
+	total = 0
+	for _, row := range chirps {
+		total += row.Count
+	}
+	if err != nil || total != 8 {
+		t.Errorf("CountChirpsByDay: expected 8 published chirps, got %+v, %v", chirps, err)
+	}
+	if chirps, err := store.CountChirpsByDay(ctx, time.Now().Add(48*time.Hour)); err != nil || len(chirps) != 0 {
+		t.Errorf("expected no chirps after a future date, got %+v, %v", chirps, err)
+	}
+
+	posters, err := store.ListTopPosters(ctx, 5)
+	if err != nil || len(posters) != 2 || posters[0].ID != ada.ID || posters[0].ChirpCount != 3 ||
+		posters[1].Email != "bob@example.com" || posters[1].ChirpCount != 1 {
+		t.Errorf("ListTopPosters: %+v, %v", posters, err)
+	}
+	if posters, err := store.ListTopPosters(ctx, 1); err != nil || len(posters) != 1 {
+		t.Errorf("expected the limit to apply, got %+v, %v", posters, err)
+	}
+}
+
+func testDataExports(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	bob := createUser(t, store, "bob@example.com")
+
+	export, err := store.CreateDataExport(ctx, database.CreateDataExportParams{UserID: ada.ID, ExpiresInSeconds: 3600})
+	if err != nil {
+		t.Fatalf("CreateDataExport: %v", err)
+	}
+	if export.Status != "pending" || export.CompletedAt.Valid ||
+		!export.ExpiresAt.After(export.CreatedAt.Add(59*time.Minute)) {
+		t.Errorf("unexpected new export: %+v", export)
+	}
+	get := func(id, userID uuid.UUID) (database.DataExport, error) {
+		return store.GetDataExport(ctx, database.GetDataExportParams{ID: id, UserID: userID})
+	}
+	if got, err := get(export.ID, ada.ID); err != nil || got.ID != export.ID || got.Status != "pending" {
+		t.Errorf("GetDataExport: %+v, %v", got, err)
+	}
+	_, err = get(export.ID, bob.ID)
+	wantNoRows(t, "GetDataExport for another user", err)
+
+	_, err = store.CreateDataExport(ctx, database.CreateDataExportParams{UserID: ada.ID, ExpiresInSeconds: 3600})
+	if !database.IsUniqueViolation(err) {
+		t.Errorf("expected a unique violation for a second pending export, got %v", err)
+	}
+
+	for seq, data := range []string{"zi", "p"} {
+		err := store.AppendDataExportChunk(ctx, database.AppendDataExportChunkParams{ExportID: export.ID, Seq: int32(seq), Data: []byte(data)})
+		if err != nil {
+			t.Fatalf("AppendDataExportChunk: %v", err)
+		}
+	}
+	err = store.AppendDataExportChunk(ctx, database.AppendDataExportChunkParams{ExportID: export.ID, Seq: 1, Data: []byte("again")})
+	if !database.IsUniqueViolation(err) {
+		t.Errorf("expected a unique violation for a repeated chunk, got %v", err)
+	}
+	chunk := func(id uuid.UUID, seq int32) ([]byte, error) {
+		return store.GetDataExportChunk(ctx, database.GetDataExportChunkParams{ExportID: id, Seq: seq})
+	}
+	if data, err := chunk(export.ID, 1); err != nil || string(data) != "p" {
+		t.Errorf("GetDataExportChunk: %q, %v", data, err)
+	}
+	_, err = chunk(export.ID, 2)
+	wantNoRows(t, "GetDataExportChunk past the end", err)
+
+	err = store.CompleteDataExport(ctx, database.CompleteDataExportParams{ID: export.ID, ExpiresInSeconds: 7200})
+	if err != nil {
+		t.Fatalf("CompleteDataExport: %v", err)
+	}
+	got, err := get(export.ID, ada.ID)
+	if err != nil || got.Status != "ready" || !got.CompletedAt.Valid || !got.ExpiresAt.After(export.ExpiresAt) {
+		t.Errorf("expected a ready export with a later expiry, got %+v, %v", got, err)
+	}
+	if err := store.FailDataExport(ctx, export.ID); err != nil {
+		t.Fatalf("FailDataExport: %v", err)
+	}
+	if got, err := get(export.ID, ada.ID); err != nil || got.Status != "ready" {
+		t.Errorf("expected failing a ready export to change nothing, got %+v, %v", got, err)
+	}
+
+	failed, err := store.CreateDataExport(ctx, database.CreateDataExportParams{UserID: ada.ID, ExpiresInSeconds: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.FailDataExport(ctx, failed.ID); err != nil {
+		t.Fatalf("FailDataExport: %v", err)
+	}
+	if got, err := get(failed.ID, ada.ID); err != nil || got.Status != "failed" || !got.CompletedAt.Valid {
+		t.Errorf("expected a failed export, got %+v, %v", got, err)
+	}
+	err = store.AppendDataExportChunk(ctx, database.AppendDataExportChunkParams{ExportID: failed.ID, Seq: 0, Data: []byte("partial")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteDataExportChunks(ctx, failed.ID); err != nil {
+		t.Fatalf("DeleteDataExportChunks: %v", err)
+	}
+	_, err = chunk(failed.ID, 0)
+	wantNoRows(t, "GetDataExportChunk after DeleteDataExportChunks", err)
+
+	stale, err := store.CreateDataExport(ctx, database.CreateDataExportParams{UserID: ada.ID, ExpiresInSeconds: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.FailStaleDataExports(ctx, 3600); err != nil || n != 0 {
+		t.Errorf("expected no exports pending for an hour, got %d, %v", n, err)
+	}
+	if n, err := store.FailStaleDataExports(ctx, 0); err != nil || n != 1 {
+		t.Errorf("FailStaleDataExports: expected 1 row, got %d, %v", n, err)
+	}
+	if got, err := get(stale.ID, ada.ID); err != nil || got.Status != "failed" {
+		t.Errorf("expected the stale export to fail, got %+v, %v", got, err)
+	}
+
+	expired, err := store.CreateDataExport(ctx, database.CreateDataExportParams{UserID: bob.ID, ExpiresInSeconds: -60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = get(expired.ID, bob.ID)
+	wantNoRows(t, "GetDataExport for an expired export", err)
+	if n, err := store.DeleteExpiredDataExports(ctx); err != nil || n != 1 {
+		t.Errorf("DeleteExpiredDataExports: expected 1 row, got %d, %v", n, err)
+	}
+	if _, err := get(export.ID, ada.ID); err != nil {
+		t.Errorf("expected live exports to survive the purge, got %v", err)
+	}
+	if _, err := chunk(export.ID, 0); err != nil {
+		t.Errorf("expected live exports to keep their chunks, got %v", err)
+	}
+
+	for _, event := range []string{"upgraded", "downgraded"} {
+		if err := store.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{UserID: ada.ID, Event: event}); err != nil {
+			t.Fatalf("CreateSubscriptionEvent: %v", err)
+		}
+	}
+	events, err := store.ListSubscriptionEvents(ctx, ada.ID)
+	if err != nil || len(events) != 2 || events[0].Event != "upgraded" || events[1].Event != "downgraded" || events[0].CreatedAt.IsZero() {
+		t.Errorf("ListSubscriptionEvents: %+v, %v", events, err)
+	}
+	if events, err := store.ListSubscriptionEvents(ctx, bob.ID); err != nil || len(events) != 0 {
+		t.Errorf("expected no events for bob, got %+v, %v", events, err)
+	}
+}
+
+func testWebhooks(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	bob := createUser(t, store, "bob@example.com")
+	createEndpoint := func(userID uuid.UUID, allUsers bool, events ...string) database.WebhookEndpoint {
+		t.Helper()
+		endpoint, err := store.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{
+			UserID:   userID,
+			Url:      "https://example.com/hook",
+			Secret:   "whsec_test",
+			Events:   events,
+			AllUsers: allUsers,
+		})
+		if err != nil {
+			t.Fatalf("CreateWebhookEndpoint: %v", err)
+		}
+		return endpoint
+	}
+	adas := createEndpoint(ada.ID, false, "chirp.created", "user.deleted")
+	watcher := createEndpoint(bob.ID, true, "chirp.created")
+	if !slices.Equal(adas.Events, []string{"chirp.created", "user.deleted"}) || adas.Url != "https://example.com/hook" ||
+		adas.Secret != "whsec_test" || adas.AllUsers || adas.CreatedAt.IsZero() {
+		t.Errorf("unexpected new endpoint: %+v", adas)
+	}
+	if got, err := store.GetWebhookEndpoint(ctx, adas.ID); err != nil || !slices.Equal(got.Events, adas.Events) {
+		t.Errorf("GetWebhookEndpoint: %+v, %v", got, err)
+	}
+	if endpoints, err := store.ListWebhookEndpoints(ctx, ada.ID); err != nil || len(endpoints) != 1 || endpoints[0].ID != adas.ID {
+		t.Errorf("expected ada's endpoint only, got %+v, %v", endpoints, err)
+	}
+
+	subscribers := func(eventType string, userID uuid.UUID) []uuid.UUID {
+		t.Helper()
+		endpoints, err := store.ListWebhookEndpointsForEvent(ctx, database.ListWebhookEndpointsForEventParams{EventType: eventType, UserID: userID})
+		if err != nil {
+			t.Fatalf("ListWebhookEndpointsForEvent: %v", err)
+		}
+		var ids []uuid.UUID
+		for _, endpoint := range endpoints {
+			ids = append(ids, endpoint.ID)
+		}
+		return ids
+	}
+	if ids := subscribers("chirp.created", ada.ID); len(ids) != 2 {
+		t.Errorf("expected ada's endpoint and the all-users one, got %v", ids)
+	}
+	if ids := subscribers("chirp.created", bob.ID); !slices.Equal(ids, []uuid.UUID{watcher.ID}) {
+		t.Errorf("expected only bob's endpoint, got %v", ids)
+	}
+	if ids := subscribers("user.deleted", bob.ID); len(ids) != 0 {
+		t.Errorf("expected no subscribers to bob's user.deleted, got %v", ids)
+	}
+
+	for _, eventType := range []string{"chirp.created", "user.deleted"} {
+		err := store.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			EndpointID: adas.ID,
+			EventID:    uuid.New(),
+			EventType:  eventType,
+			Payload:    `{"type":"` + eventType + `"}`,
+		})
+		if err != nil {
+			t.Fatalf("CreateWebhookDelivery: %v", err)
+		}
+	}
+	claimed, err := store.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseSeconds: 60, BatchSize: 1})
+	if err != nil || len(claimed) != 1 || claimed[0].Attempts != 1 || claimed[0].Status != "pending" ||
+		!claimed[0].NextAttemptAt.After(time.Now().Add(50*time.Second)) {
+		t.Fatalf("expected one leased delivery, got %+v, %v", claimed, err)
+	}
+	first := claimed[0]
+	claimed, err = store.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseSeconds: 60, BatchSize: 10})
+	if err != nil || len(claimed) != 1 || claimed[0].ID == first.ID {
+		t.Fatalf("expected only the other delivery while the first is leased, got %+v, %v", claimed, err)
+	}
+	second := claimed[0]
+
+	// A failed attempt that is due again right away.
+	err = store.RecordWebhookAttempt(ctx, database.RecordWebhookAttemptParams{
+		ID:             first.ID,
+		Status:         "pending",
+		ResponseStatus: sql.NullInt32{Int32: 500, Valid: true},
+		LastError:      "boom",
+		RetryInSeconds: -1,
+	})
+	if err != nil {
+		t.Fatalf("RecordWebhookAttempt: %v", err)
+	}
+	claimed, err = store.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseSeconds: 60, BatchSize: 10})
+	if err != nil || len(claimed) != 1 || claimed[0].ID != first.ID || claimed[0].Attempts != 2 ||
+		claimed[0].LastError != "boom" || claimed[0].ResponseStatus.Int32 != 500 || !claimed[0].LastAttemptAt.Valid {
+		t.Fatalf("expected the failed delivery to be claimed again, got %+v, %v", claimed, err)
+	}
+	err = store.RecordWebhookAttempt(ctx, database.RecordWebhookAttemptParams{ID: first.ID, Status: "dead", LastError: "boom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.RecordWebhookAttempt(ctx, database.RecordWebhookAttemptParams{
+		ID:             second.ID,
+		Status:         "delivered",
+		ResponseStatus: sql.NullInt32{Int32: 204, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := store.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseSeconds: 60, BatchSize: 10}); err != nil || len(claimed) != 0 {
+		t.Errorf("expected finished deliveries to stay put, got %+v, %v", claimed, err)
+	}
+
+	list := func(status string) []database.WebhookDelivery {
+		t.Helper()
+		deliveries, err := store.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{
+			EndpointID: adas.ID,
+			Status:     sql.NullString{String: status, Valid: status != ""},
+			PageSize:   10,
+		})
+		if err != nil {
+			t.Fatalf("ListWebhookDeliveries: %v", err)
+		}
+		return deliveries
+	}
+	if all := list(""); len(all) != 2 || all[0].EventType != "user.deleted" {
+		t.Errorf("expected both deliveries newest first, got %+v", all)
+	}
+	if dead := list("dead"); len(dead) != 1 || dead[0].ID != first.ID || dead[0].Payload != `{"type":"chirp.created"}` {
+		t.Errorf("expected the dead delivery, got %+v", dead)
+	}
+	if got, err := store.GetWebhookDelivery(ctx, database.GetWebhookDeliveryParams{ID: second.ID, EndpointID: adas.ID}); err != nil ||
+		got.Status != "delivered" || got.ResponseStatus.Int32 != 204 {
+		t.Errorf("GetWebhookDelivery: %+v, %v", got, err)
+	}
+	_, err = store.GetWebhookDelivery(ctx, database.GetWebhookDeliveryParams{ID: second.ID, EndpointID: watcher.ID})
+	wantNoRows(t, "GetWebhookDelivery under another endpoint", err)
+
+	retried, err := store.RetryWebhookDelivery(ctx, first.ID)
+	if err != nil || retried.Status != "pending" || retried.Attempts != 0 {
+		t.Fatalf("RetryWebhookDelivery: %+v, %v", retried, err)
+	}
+	_, err = store.RetryWebhookDelivery(ctx, first.ID)
+	wantNoRows(t, "RetryWebhookDelivery on a pending delivery", err)
+	if claimed, err := store.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{LeaseSeconds: 60, BatchSize: 10}); err != nil ||
+		len(claimed) != 1 || claimed[0].ID != first.ID || claimed[0].Attempts != 1 {
+		t.Errorf("expected the retried delivery to start over, got %+v, %v", claimed, err)
+	}
+
+	// Deleting an endpoint takes its deliveries with it.
+	if err := store.DeleteWebhookEndpoint(ctx, adas.ID); err != nil {
+		t.Fatalf("DeleteWebhookEndpoint: %v", err)
+	}
+	_, err = store.GetWebhookEndpoint(ctx, adas.ID)
+	wantNoRows(t, "GetWebhookEndpoint after deleting", err)
+	_, err = store.GetWebhookDelivery(ctx, database.GetWebhookDeliveryParams{ID: second.ID, EndpointID: adas.ID})
+	wantNoRows(t, "GetWebhookDelivery after deleting its endpoint", err)
+
+	if err := store.DeleteWebhookEndpointsByUserID(ctx, bob.ID); err != nil {
+		t.Fatalf("DeleteWebhookEndpointsByUserID: %v", err)
+	}
+	if ids := subscribers("chirp.created", ada.ID); len(ids) != 0 {
+		t.Errorf("expected no endpoints left, got %v", ids)
+	}
+}
+
+func testProfiles(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	bob := createUser(t, store, "bob@example.com")
+	if ada.Handle.Valid || ada.DisplayName != "" || ada.Bio != "" {
+		t.Errorf("expected a new user to have no profile, got %+v", ada)
+	}
+	_, err := store.GetUserProfile(ctx, "ada")
+	wantNoRows(t, "GetUserProfile before a handle is set", err)
+
+	user, err := store.UpdateUserProfile(ctx, database.UpdateUserProfileParams{Handle: "Ada_L", DisplayName: "Ada", Bio: "Counting", ID: ada.ID})
+	if err != nil {
+		t.Fatalf("UpdateUserProfile: %v", err)
+	}
+	if user.Handle.String != "Ada_L" || user.DisplayName != "Ada" || user.Bio != "Counting" {
+		t.Errorf("unexpected profile: %+v", user)
+	}
+	if got, err := store.GetUserByHandle(ctx, "ada_l"); err != nil || got.ID != ada.ID {
+		t.Errorf("GetUserByHandle is case-insensitive: %+v, %v", got, err)
+	}
+	if _, err := store.UpdateUserProfile(ctx, database.UpdateUserProfileParams{Handle: "ADA_L", ID: bob.ID}); !database.IsUniqueViolation(err) {
+		t.Errorf("expected a handle differing only in case to be a unique violation, got %v", err)
+	}
+	if _, err := store.UpdateUserProfile(ctx, database.UpdateUserProfileParams{Handle: "ADA_L", DisplayName: "Ada", ID: ada.ID}); err != nil {
+		t.Errorf("expected a user to recase their own handle, got %v", err)
+	}
+	_, err = store.UpdateUserProfile(ctx, database.UpdateUserProfileParams{Handle: "nobody", ID: uuid.New()})
+	wantNoRows(t, "UpdateUserProfile", err)
+
+	createChirp(t, store, ada.ID, "one")
+	hidden := createChirp(t, store, ada.ID, "two")
+	createChirp(t, store, bob.ID, "bob's")
+	if _, err := store.HideChirp(ctx, hidden.ID); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := store.GetUserProfile(ctx, "ada_l")
+	if err != nil {
+		t.Fatalf("GetUserProfile: %v", err)
+	}
+	if profile.ID != ada.ID || profile.Handle.String != "ADA_L" || profile.ChirpCount != 1 || profile.FollowerCount != 0 || profile.AvatarUpdatedAt.Valid {
+		t.Errorf("unexpected profile: %+v", profile)
+	}
+
+	cy := createUser(t, store, "cy@example.com")
+	dee := createUser(t, store, "dee@example.com")
+	for _, follower := range []uuid.UUID{bob.ID, bob.ID, cy.ID, dee.ID} {
+		if n, err := store.FollowUser(ctx, database.FollowUserParams{FollowerID: follower, FolloweeID: ada.ID}); err != nil || n != 1 {
+			t.Fatalf("FollowUser: %d, %v", n, err)
+		}
+	}
+	if _, err := store.BanUser(ctx, dee.ID); err != nil {
+		t.Fatal(err)
+	}
+	followers := func() int64 {
+		t.Helper()
+		profile, err := store.GetUserProfile(ctx, "ada_l")
+		if err != nil {
+			t.Fatalf("GetUserProfile: %v", err)
+		}
+		return profile.FollowerCount
+	}
+	if n := followers(); n != 2 {
+		t.Errorf("expected two followers, not counting the banned one or bob twice, got %d", n)
+	}
+	if follows, err := store.ListUserFollows(ctx, bob.ID); err != nil || len(follows) != 1 || follows[0].FolloweeID != ada.ID || follows[0].CreatedAt.IsZero() {
+		t.Errorf("ListUserFollows: %+v, %v", follows, err)
+	}
+	if n, err := store.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: bob.ID, FolloweeID: ada.ID}); err != nil || n != 1 {
+		t.Errorf("UnfollowUser: %d, %v", n, err)
+	}
+	if n, err := store.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: bob.ID, FolloweeID: ada.ID}); err != nil || n != 0 {
+		t.Errorf("UnfollowUser again: %d, %v", n, err)
+	}
+	if err := store.DeleteFollowsBetween(ctx, database.DeleteFollowsBetweenParams{UserA: ada.ID, UserB: cy.ID}); err != nil {
+		t.Fatalf("DeleteFollowsBetween: %v", err)
+	}
+	if n := followers(); n != 0 {
+		t.Errorf("expected no followers after unfollowing, got %d", n)
+	}
+	if _, err := store.FollowUser(ctx, database.FollowUserParams{FollowerID: cy.ID, FolloweeID: ada.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateUserRelationship(ctx, database.CreateUserRelationshipParams{UserID: ada.ID, TargetID: bob.ID, Kind: "block"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.FollowUser(ctx, database.FollowUserParams{FollowerID: bob.ID, FolloweeID: ada.ID}); err != nil || n != 0 {
+		t.Errorf("expected FollowUser to refuse a blocked follower, got %d, %v", n, err)
+	}
+	if n := followers(); n != 1 {
+		t.Errorf("expected the blocked follow to be skipped, got %d followers", n)
+	}
+	if err := store.DeleteUserFollowsByUserID(ctx, ada.ID); err != nil {
+		t.Fatalf("DeleteUserFollowsByUserID: %v", err)
+	}
+	if n := followers(); n != 0 {
+		t.Errorf("expected DeleteUserFollowsByUserID to drop followers, got %d", n)
+	}
+
+	_, err = store.GetUserAvatar(ctx, ada.ID)
+	wantNoRows(t, "GetUserAvatar before upload", err)
+	for _, image := range [][]byte{[]byte("first"), []byte("second")} {
+		if err := store.SetUserAvatar(ctx, database.SetUserAvatarParams{UserID: ada.ID, ContentType: "image/png", Image: image}); err != nil {
+			t.Fatalf("SetUserAvatar: %v", err)
+		}
+	}
+	avatar, err := store.GetUserAvatar(ctx, ada.ID)
+	if err != nil || string(avatar.Image) != "second" || avatar.ContentType != "image/png" || avatar.UpdatedAt.IsZero() {
+		t.Errorf("expected the second upload to replace the first, got %+v, %v", avatar, err)
+	}
+	if profile, err := store.GetUserProfile(ctx, "ada_l"); err != nil || !profile.AvatarUpdatedAt.Valid {
+		t.Errorf("expected the profile to report the avatar, got %+v, %v", profile, err)
+	}
+	if n, err := store.DeleteUserAvatar(ctx, ada.ID); err != nil || n != 1 {
+		t.Errorf("DeleteUserAvatar: %d, %v", n, err)
+	}
+	if n, err := store.DeleteUserAvatar(ctx, ada.ID); err != nil || n != 0 {
+		t.Errorf("DeleteUserAvatar again: %d, %v", n, err)
+	}
+
+	if _, err := store.BanUser(ctx, ada.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.GetUserProfile(ctx, "ada_l")
+	wantNoRows(t, "GetUserProfile for a banned user", err)
+
+	if err := store.SetUserAvatar(ctx, database.SetUserAvatarParams{UserID: bob.ID, ContentType: "image/gif", Image: []byte("gif")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteUser(ctx, bob.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	_, err = store.GetUserAvatar(ctx, bob.ID)
+	wantNoRows(t, "GetUserAvatar after deleting the user", err)
+}
+
+func testMessages(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	bob := createUser(t, store, "bob@example.com")
+	cy := createUser(t, store, "cy@example.com")
+	key := func(userIDs ...uuid.UUID) string {
+		var keys []string
+		for _, userID := range userIDs {
+			keys = append(keys, userID.String())
+		}
+		return strings.Join(keys, ",")
+	}
+	startConversation := func(userIDs ...uuid.UUID) database.Conversation {
+		t.Helper()
+		conversation, err := store.CreateConversation(ctx, key(userIDs...))
+		if err != nil {
+			t.Fatalf("CreateConversation: %v", err)
+		}
+		for _, userID := range userIDs {
+			err := store.AddConversationParticipant(ctx, database.AddConversationParticipantParams{ConversationID: conversation.ID, UserID: userID})
+			if err != nil {
+				t.Fatalf("AddConversationParticipant: %v", err)
+			}
+		}
+		return conversation
+	}
+	send := func(conversationID, senderID uuid.UUID, body string) database.Message {
+		t.Helper()
+		message, err := store.CreateMessage(ctx, database.CreateMessageParams{ConversationID: conversationID, SenderID: senderID, Body: body})
+		if err != nil {
+			t.Fatalf("CreateMessage: %v", err)
+		}
+		if err := store.TouchConversation(ctx, database.TouchConversationParams{UpdatedAt: message.CreatedAt, ID: conversationID}); err != nil {
+			t.Fatalf("TouchConversation: %v", err)
+		}
+		return message
+	}
+	bodies := func(messages []database.Message) []string {
+		var out []string
+		for _, message := range messages {
+			out = append(out, message.Body)
+		}
+		return out
+	}
+
+	_, err := store.GetConversationByParticipantKey(ctx, key(ada.ID, bob.ID))
+	wantNoRows(t, "GetConversationByParticipantKey before one exists", err)
+	direct := startConversation(ada.ID, bob.ID)
+	group := startConversation(ada.ID, bob.ID, cy.ID)
+	if got, err := store.GetConversationByParticipantKey(ctx, key(ada.ID, bob.ID)); err != nil || got.ID != direct.ID {
+		t.Errorf("expected the direct conversation and not the group, got %+v, %v", got, err)
+	}
+	_, err = store.CreateConversation(ctx, key(ada.ID, bob.ID))
+	wantNoRows(t, "CreateConversation with a participant key that's taken", err)
+	if got, err := store.GetConversation(ctx, group.ID); err != nil || got.ID != group.ID || got.CreatedAt.IsZero() {
+		t.Errorf("GetConversation: %+v, %v", got, err)
+	}
+	_, err = store.GetConversation(ctx, uuid.New())
+	wantNoRows(t, "GetConversation", err)
+	if err := store.AddConversationParticipant(ctx, database.AddConversationParticipantParams{ConversationID: direct.ID, UserID: ada.ID}); err == nil {
+		t.Error("expected adding a participant twice to fail")
+	}
+	participants, err := store.ListConversationParticipants(ctx, group.ID)
+	if err != nil || len(participants) != 3 || participants[0].UserID != ada.ID || participants[0].LastReadAt.Valid {
+		t.Errorf("ListConversationParticipants: %+v, %v", participants, err)
+	}
+
+	first := send(direct.ID, ada.ID, "one")
+	second := send(direct.ID, bob.ID, "two")
+	third := send(direct.ID, bob.ID, "three")
+	send(group.ID, cy.ID, "group")
+	page, err := store.ListMessages(ctx, database.ListMessagesParams{ConversationID: direct.ID, UserID: ada.ID, PageSize: 2})
+	if err != nil || !slices.Equal(bodies(page), []string{"three", "two"}) {
+		t.Fatalf("expected the newest page first, got %v, %v", bodies(page), err)
+	}
+	page, err = store.ListMessages(ctx, database.ListMessagesParams{
+		ConversationID:  direct.ID,
+		UserID:          ada.ID,
+		BeforeCreatedAt: sql.NullTime{Time: second.CreatedAt, Valid: true},
+		BeforeID:        second.ID,
+		PageSize:        2,
+	})
+	if err != nil || !slices.Equal(bodies(page), []string{"one"}) {
+		t.Errorf("expected the page before two, got %v, %v", bodies(page), err)
+	}
+	if got, err := store.GetMessage(ctx, database.GetMessageParams{ID: first.ID, ConversationID: direct.ID}); err != nil || got.Body != "one" || got.SenderID != ada.ID {
+		t.Errorf("GetMessage: %+v, %v", got, err)
+	}
+	_, err = store.GetMessage(ctx, database.GetMessageParams{ID: first.ID, ConversationID: group.ID})
+	wantNoRows(t, "GetMessage in another conversation", err)
+
+	unread := func(userID uuid.UUID) map[uuid.UUID]int64 {
+		t.Helper()
+		rows, err := store.ListConversationsForUser(ctx, userID)
+		if err != nil {
+			t.Fatalf("ListConversationsForUser: %v", err)
+		}
+		counts := map[uuid.UUID]int64{}
+		for _, row := range rows {
+			counts[row.ID] = row.UnreadCount
+		}
+		return counts
+	}
+	rows, err := store.ListConversationsForUser(ctx, ada.ID)
+	if err != nil || len(rows) != 5 || rows[0].ID != group.ID || rows[2].ID != group.ID || rows[3].ID != direct.ID {
+		t.Errorf("expected a row per participant with the group, which had the last message, first: %+v, %v", rows, err)
+	} else if rows[0].ParticipantID != ada.ID || rows[2].ParticipantID != cy.ID || rows[4].ParticipantID != bob.ID || rows[4].ParticipantLastReadAt.Valid {
+		t.Errorf("expected participants in the order they joined, got %+v", rows)
+	}
+	if counts := unread(ada.ID); counts[direct.ID] != 2 || counts[group.ID] != 1 {
+		t.Errorf("expected ada to have unread messages from others only, got %v", counts)
+	}
+	if counts := unread(cy.ID); len(counts) != 1 || counts[group.ID] != 0 {
+		t.Errorf("expected cy to see only the group, got %v", counts)
+	}
+
+	read := func(userID uuid.UUID, at time.Time) {
+		t.Helper()
+		if err := store.MarkConversationRead(ctx, database.MarkConversationReadParams{ReadAt: at, ConversationID: direct.ID, UserID: userID}); err != nil {
+			t.Fatalf("MarkConversationRead: %v", err)
+		}
+	}
+	read(ada.ID, third.CreatedAt)
+	read(ada.ID, first.CreatedAt)
+	if counts := unread(ada.ID); counts[direct.ID] != 0 {
+		t.Errorf("expected a read receipt not to move backwards, got %v", counts)
+	}
+	participants, err = store.ListConversationParticipants(ctx, direct.ID)
+	if err != nil || !participants[0].LastReadAt.Valid || !participants[0].LastReadAt.Time.Equal(third.CreatedAt) || participants[1].LastReadAt.Valid {
+		t.Errorf("expected only ada's read receipt, got %+v, %v", participants, err)
+	}
+
+	for range 2 {
+		if err := store.DeleteMessageForUser(ctx, database.DeleteMessageForUserParams{MessageID: third.ID, UserID: bob.ID}); err != nil {
+			t.Fatalf("DeleteMessageForUser: %v", err)
+		}
+	}
+	page, err = store.ListMessages(ctx, database.ListMessagesParams{ConversationID: direct.ID, UserID: bob.ID, PageSize: 10})
+	if err != nil || !slices.Equal(bodies(page), []string{"two", "one"}) {
+		t.Errorf("expected the message bob deleted to be hidden from bob, got %v, %v", bodies(page), err)
+	}
+	page, err = store.ListMessages(ctx, database.ListMessagesParams{ConversationID: direct.ID, UserID: ada.ID, PageSize: 10})
+	if err != nil || len(page) != 3 {
+		t.Errorf("expected ada to still see every message, got %v, %v", bodies(page), err)
+	}
+
+	if err := store.DeleteUser(ctx, bob.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	page, err = store.ListMessages(ctx, database.ListMessagesParams{ConversationID: direct.ID, UserID: ada.ID, PageSize: 10})
+	if err != nil || !slices.Equal(bodies(page), []string{"one"}) {
+		t.Errorf("expected a deleted user's messages to go with them, got %v, %v", bodies(page), err)
+	}
+	if participants, err := store.ListConversationParticipants(ctx, group.ID); err != nil || len(participants) != 2 {
+		t.Errorf("expected a deleted user to leave their conversations, got %+v, %v", participants, err)
+	}
+}
+
+func testRelationships(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	ada := createUser(t, store, "ada@example.com")
+	bob := createUser(t, store, "bob@example.com")
+	cy := createUser(t, store, "cy@example.com")
+	createChirp(t, store, ada.ID, "from ada")
+	createChirp(t, store, bob.ID, "from bob")
+	createChirp(t, store, cy.ID, "from cy")
+	relate := func(userID, targetID uuid.UUID, kind string) {
+		t.Helper()
+		err := store.CreateUserRelationship(ctx, database.CreateUserRelationshipParams{UserID: userID, TargetID: targetID, Kind: kind})
+		if err != nil {
+			t.Fatalf("CreateUserRelationship(%s): %v", kind, err)
+		}
+	}
+	seenBy := func(viewerID uuid.UUID) []string {
+		t.Helper()
+		chirps, err := store.GetChirps(ctx, uuid.NullUUID{UUID: viewerID, Valid: true})
+		if err != nil {
+			t.Fatalf("GetChirps: %v", err)
+		}
+		return chirpBodies(chirps)
+	}
+	blocked := func(a, b uuid.UUID) bool {
+		t.Helper()
+		blocked, err := store.IsBlockedBetween(ctx, database.IsBlockedBetweenParams{UserA: a, UserB: b})
+		if err != nil {
+			t.Fatalf("IsBlockedBetween: %v", err)
+		}
+		return blocked
+	}
+
+	relate(ada.ID, bob.ID, "block")
+	relate(ada.ID, bob.ID, "block")
+	relate(ada.ID, cy.ID, "mute")
+	if got := seenBy(ada.ID); !slices.Equal(got, []string{"from ada"}) {
+		t.Errorf("expected ada not to see blocked or muted users, got %v", got)
+	}
+	if got := seenBy(bob.ID); !slices.Equal(got, []string{"from bob", "from cy"}) {
+		t.Errorf("expected a block to hide the blocker from the blocked, got %v", got)
+	}
+	if got := seenBy(cy.ID); len(got) != 3 {
+		t.Errorf("expected a mute to be one-way, got %v", got)
+	}
+	if chirps, err := store.GetChirps(ctx, uuid.NullUUID{}); err != nil || len(chirps) != 3 {
+		t.Errorf("expected anonymous viewers to see everything, got %v, %v", chirpBodies(chirps), err)
+	}
+	chirps, err := store.GetChirpsByUserID(ctx, database.GetChirpsByUserIDParams{UserID: ada.ID, ViewerID: uuid.NullUUID{UUID: bob.ID, Valid: true}})
+	if err != nil || len(chirps) != 0 {
+		t.Errorf("expected a blocker's chirps to be hidden on their own page, got %v, %v", chirpBodies(chirps), err)
+	}
+	chirps, err = store.GetChirpsByUserID(ctx, database.GetChirpsByUserIDParams{UserID: ada.ID})
+	if err != nil || !slices.Equal(chirpBodies(chirps), []string{"from ada"}) {
+		t.Errorf("GetChirpsByUserID without a viewer: %v, %v", chirpBodies(chirps), err)
+	}
+
+	if !blocked(ada.ID, bob.ID) || !blocked(bob.ID, ada.ID) {
+		t.Error("expected IsBlockedBetween to hold in both directions")
+	}
+	if blocked(ada.ID, cy.ID) {
+		t.Error("expected a mute not to count as a block")
+	}
+
+	relate(ada.ID, cy.ID, "block")
+	blocks, err := store.ListUserRelationships(ctx, database.ListUserRelationshipsParams{UserID: ada.ID, Kind: "block"})
+	if err != nil || len(blocks) != 2 || blocks[0].TargetID != cy.ID || blocks[1].TargetID != bob.ID || blocks[0].CreatedAt.IsZero() {
+		t.Errorf("expected ada's blocks newest first, got %+v, %v", blocks, err)
+	}
+	mutes, err := store.ListUserRelationships(ctx, database.ListUserRelationshipsParams{UserID: ada.ID, Kind: "mute"})
+	if err != nil || len(mutes) != 1 || mutes[0].TargetID != cy.ID {
+		t.Errorf("expected ada's mutes to be listed apart from blocks, got %+v, %v", mutes, err)
+	}
+
+	unblock := database.DeleteUserRelationshipParams{UserID: ada.ID, TargetID: bob.ID, Kind: "block"}
+	if n, err := store.DeleteUserRelationship(ctx, unblock); err != nil || n != 1 {
+		t.Errorf("DeleteUserRelationship: %d, %v", n, err)
+	}
+	if n, err := store.DeleteUserRelationship(ctx, unblock); err != nil || n != 0 {
+		t.Errorf("expected deleting a missing relationship to remove nothing, got %d, %v", n, err)
+	}
+	if blocked(bob.ID, ada.ID) {
+		t.Error("expected the block to be gone")
+	}
+
+	if err := store.DeleteUser(ctx, cy.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	for _, kind := range []string{"block", "mute"} {
+		rows, err := store.ListUserRelationships(ctx, database.ListUserRelationshipsParams{UserID: ada.ID, Kind: kind})
+		if err != nil || len(rows) != 0 {
+			t.Errorf("expected a deleted user's %ss to go with them, got %+v, %v", kind, rows, err)
+		}
+	}
+}
+
+func testTransactions(t *testing.T, store server.Store) {
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	var kept, dropped database.User
+	err := store.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		kept, err = store.CreateUser(ctx, database.CreateUserParams{Email: "kept@example.com", HashedPassword: "hash"})
+		if err != nil {
+			return err
+		}
+		// a nested transaction joins the outer one
+		return store.InTx(ctx, func(ctx context.Context) error {
+			_, err := store.BanUser(ctx, kept.ID)
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("committing: %v", err)
+	}
+	got, err := store.GetUserByID(ctx, kept.ID)
+	if err != nil || !got.BannedAt.Valid {
+		t.Errorf("expected the committed user to exist and be banned, got %+v, %v", got, err)
+	}
+
+	err = store.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		dropped, err = store.CreateUser(ctx, database.CreateUserParams{Email: "dropped@example.com", HashedPassword: "hash"})
+		if err != nil {
+			return err
+		}
+		if _, err := store.SuspendUser(ctx, database.SuspendUserParams{
+			SuspendedUntil: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+			ID:             kept.ID,
+		}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("expected fn's error back, got %v", err)
+	}
+	_, err = store.GetUserByID(ctx, dropped.ID)
+	wantNoRows(t, "user created in a rolled back transaction", err)
+	got, err = store.GetUserByID(ctx, kept.ID)
+	if err != nil || got.SuspendedUntil.Valid {
+		t.Errorf("expected the suspension to be rolled back, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/internal/tracing"
+	"github.com/google/uuid"
+)
+
+// authenticate validates the request's bearer access token and returns its
+// subject, provided the account still exists and hasn't been deleted. On
+// failure it has already written a 401.
+func (cfg *apiConfig) authenticate(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Missing or malformed bearer token", err)
+		return uuid.Nil, false
+	}
+
+	_, span := tracing.Start(r.Context(), "validate JWT", tracing.KindInternal)
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Invalid or expired access token", err)
+		return uuid.Nil, false
+	}
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.DeletedAt.Valid) {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "User no longer exists", nil)
+		return uuid.Nil, false
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't get user", err)
+		return uuid.Nil, false
+	}
+	setRequestUser(r.Context(), userID)
+	return userID, true
+}
+
+func (cfg *apiConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	params := parameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	if params.Email == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "email is required", nil)
+		return
+	}
+	if params.Password == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "password is required", nil)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.metrics.logins.WithLabelValues("failure").Inc()
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidLogin, "Incorrect email or password", nil)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't get user", err)
+		return
+	}
+
+	err = auth.CheckPasswordHash(user.HashedPassword, params.Password)
+	if err != nil || user.DeletedAt.Valid {
+		cfg.metrics.logins.WithLabelValues("failure").Inc()
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidLogin, "Incorrect email or password", nil)
+		return
+	}
+	if isUserRestricted(user) {
+		cfg.metrics.logins.WithLabelValues("failure").Inc()
+		respondWithError(w, r, http.StatusForbidden, codeAccountLimited, "Your account is suspended or banned", nil)
+		return
+	}
+
+	token, err := auth.MakeJWT(user.ID, auth.Role(user.Role), cfg.jwtSecret, cfg.accessTokenTTL)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't create access token", err)
+		return
+	}
+
+	refresh_token, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't create refresh token", err)
+		return
+	}
+
+	err = cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		UserID:           user.ID,
+		Token:            refresh_token,
+		ExpiresInSeconds: int32(cfg.refreshTokenTTL.Seconds()),
+	})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't save refresh token", err)
+		return
+	}
+
+	type tokenResponse struct {
+		User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	cfg.metrics.logins.WithLabelValues("success").Inc()
+	respondWithJSON(w, http.StatusOK, tokenResponse{
+		User:         toUser(user),
+		Token:        token,
+		RefreshToken: refresh_token,
+	})
+}
+
+func (cfg *apiConfig) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Missing or malformed bearer token", err)
+		return
+	}
+	userID, err := cfg.dbQueries.GetUserByRefreshToken(r.Context(), refreshToken)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Invalid, expired or revoked refresh token", err)
+		return
+	}
+
+	// look the user up again so role changes and restrictions apply on refresh
+	user, ok := cfg.activeUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	accessToken, err := auth.MakeJWT(user.ID, auth.Role(user.Role), cfg.jwtSecret, cfg.accessTokenTTL)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't create access token", err)
+		return
+	}
+
+	type tokenResponse struct {
+		Token string `json:"token"`
+	}
+
+	respondWithJSON(w, http.StatusOK, tokenResponse{
+		Token: accessToken,
+	})
+}
+
+func (cfg *apiConfig) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Missing or malformed bearer token", err)
+		return
+	}
+
+	_, err = cfg.dbQueries.RevokeRefreshToken(r.Context(), refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Unknown refresh token", nil)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't revoke refresh token", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
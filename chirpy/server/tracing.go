@@ -0,0 +1,47 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/djblackett/chirpy/internal/tracing"
+)
+
+// middlewareTracing starts a server span per request, joining the caller's
+// trace when it sends a traceparent header. Handlers and queries add child
+// spans through the request context.
+func (cfg *apiConfig) middlewareTracing(next http.Handler) http.Handler {
+	if cfg.tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := cfg.tracer.Start(ctx, r.Method, tracing.KindServer,
+			slog.String("http.request.method", r.Method),
+			slog.String("url.path", r.URL.Path),
+			slog.String("user_agent.original", r.UserAgent()),
+			slog.String("request.id", requestIDFromContext(r.Context())),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		req, matched := trackRoute(r.WithContext(ctx))
+		next.ServeHTTP(rec, req)
+
+		if matched.pattern != "" {
+			// Patterns are "GET /api/chirps/{chirpID}" or just "/app/".
+			route := matched.pattern
+			if _, path, ok := strings.Cut(route, " "); ok {
+				route = path
+			}
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(slog.String("http.route", route))
+		}
+		status := rec.statusCode()
+		span.SetAttributes(slog.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(tracing.StatusError, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/djblackett/chirpy/internal/tracing"
+	"github.com/djblackett/chirpy/server"
+)
+
+func TestTracing(t *testing.T) {
+	spans := &syncBuffer{}
+	tracer := tracing.NewTracer("chirpy-test", 1, tracing.NewWriterExporter(spans))
+	c := newTestClient(t, func(cfg *server.Config) { cfg.Tracer = tracer })
+	s := c.signUp("walt@example.com", "cook")
+
+	req, err := http.NewRequest("POST", c.srv.URL+"/api/chirps", strings.NewReader(`{"body": "Say my name"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", s.bearer())
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	expectStatus(t, resp, http.StatusCreated)
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	type span struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+	}
+	byName := map[string]span{}
+	for _, line := range spans.lines(t) {
+		data, _ := json.Marshal(line)
+		var export struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.Unmarshal(data, &export); err != nil {
+			t.Fatal(err)
+		}
+		for _, sp := range export.ResourceSpans[0].ScopeSpans[0].Spans {
+			if sp.TraceID == "4bf92f3577b34da6a3ce929d0e0e4736" {
+				byName[sp.Name] = sp
+			}
+		}
+	}
+
+	root, ok := byName["POST /api/chirps"]
+	if !ok || root.ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("expected a server span joined to the caller's trace, got %+v", byName)
+	}
+	for _, name := range []string{"decode JSON body", "validate JWT", "filter chirp"} {
+		if byName[name].ParentSpanID != root.SpanID {
+			t.Errorf("expected %q to be a child of the request span, got %+v", name, byName[name])
+		}
+	}
+
+	for _, line := range c.logs.lines(t) {
+		if line["route"] == "POST /api/chirps" && line["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("expected the access log to carry the trace ID, got %v", line)
+		}
+	}
+}
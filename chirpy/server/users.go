@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type User struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	Role        string    `json:"role"`
+	Handle      string    `json:"handle,omitempty"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+}
+
+func toUser(user database.User) User {
+	return User{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt.Time,
+		UpdatedAt:   user.UpdatedAt.Time,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed.Bool,
+		Role:        user.Role,
+		Handle:      user.Handle.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+	}
+}
+
+func (cfg *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	params := parameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	if params.Email == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "email is required", nil)
+		return
+	}
+
+	if params.Password == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "password is required", nil)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't hash password", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.CreateUser(r.Context(), database.CreateUserParams{Email: params.Email, HashedPassword: hashedPassword})
+	if database.IsUniqueViolation(err) {
+		respondWithError(w, r, http.StatusConflict, codeConflict, "email is already registered", err)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't create user", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, toUser(user))
+}
+
+func (cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if cfg.rejectRestrictedUser(w, r, userID) {
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+
+	if params.Email == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "email is required", nil)
+		return
+	}
+
+	if params.Password == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "password is required", nil)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't hash password", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.UpdateUser(r.Context(), database.UpdateUserParams{
+		Email:          params.Email,
+		HashedPassword: hashedPassword,
+		ID:             userID,
+	})
+	if database.IsUniqueViolation(err) {
+		respondWithError(w, r, http.StatusConflict, codeConflict, "email is already registered", err)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't update user", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, toUser(user))
+}
+
+// handleDeleteUser deletes the caller's account after they confirm their
+// password. Their chirps go too, or stay behind a scrubbed account when
+// AnonymizeDeletedChirps is set. Everything but the chirps is removed in one
+// transaction; access tokens already issued stop working with it, since
+// authenticate checks the account still exists.
+func (cfg *apiConfig) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	if params.Password == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeValidation, "password is required", nil)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.DeletedAt.Valid) {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "User no longer exists", nil)
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't get user", err)
+		return
+	}
+	if err := auth.CheckPasswordHash(user.HashedPassword, params.Password); err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidLogin, "Incorrect password", nil)
+		return
+	}
+
+	chirps := "deleted"
+	if cfg.anonymizeChirps {
+		chirps = "anonymized"
+	}
+	err = cfg.dbQueries.InTx(r.Context(), func(ctx context.Context) error {
+		if err := cfg.dbQueries.RevokeRefreshTokensByUserID(ctx, user.ID); err != nil {
+			return fmt.Errorf("revoking refresh tokens: %w", err)
+		}
+		if !cfg.anonymizeChirps {
+			return cfg.dbQueries.DeleteUser(ctx, user.ID)
+		}
+		// Only the chirps stay: nothing else may tie the scrubbed account to
+		// the person who had it.
+		for _, step := range []struct {
+			what string
+			run  func(context.Context, uuid.UUID) error
+		}{
+			{"webhooks", cfg.dbQueries.DeleteWebhookEndpointsByUserID},
+			{"messages", cfg.dbQueries.DeleteMessagesBySenderID},
+			{"message deletions", cfg.dbQueries.DeleteMessageDeletionsByUserID},
+			{"conversation memberships", cfg.dbQueries.DeleteConversationParticipantsByUserID},
+			{"blocks and mutes", cfg.dbQueries.DeleteUserRelationshipsByUserID},
+			{"follows", cfg.dbQueries.DeleteUserFollowsByUserID},
+			{"avatar", func(ctx context.Context, id uuid.UUID) error {
+				_, err := cfg.dbQueries.DeleteUserAvatar(ctx, id)
+				return err
+			}},
+			{"data exports", cfg.dbQueries.DeleteDataExportsByUserID},
+		} {
+			if err := step.run(ctx, user.ID); err != nil {
+				return fmt.Errorf("deleting %s: %w", step.what, err)
+			}
+		}
+		_, err := cfg.dbQueries.AnonymizeUser(ctx, user.ID)
+		return err
+	})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't delete user", err)
+		return
+	}
+	cfg.chirpCache.invalidateAuthor(user.ID)
+
+	loggerFromContext(r.Context()).Info("User deleted their account", "chirps", chirps)
+	cfg.publish(r.Context(), "user.deleted", user.ID, UserDeleted{UserID: user.ID, Chirps: chirps})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,160 @@
+package server_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/djblackett/chirpy/server"
+	"github.com/google/uuid"
+)
+
+func TestUserAndTokenFlow(t *testing.T) {
+	c := newTestClient(t)
+
+	expectProblem(t, c.do("POST", "/api/users", "", "{not json"), http.StatusBadRequest, "invalid_json")
+	expectProblem(t, c.do("POST", "/api/users", "", map[string]string{"email": "a@example.com"}), http.StatusBadRequest, "validation_failed")
+
+	s := c.signUp("walt@example.com", "cook")
+	if s.Email != "walt@example.com" || s.Role != "user" || s.IsChirpyRed {
+		t.Errorf("unexpected login response: %+v", s)
+	}
+	if s.Token == "" || s.RefreshToken == "" {
+		t.Fatalf("expected access and refresh tokens, got %+v", s)
+	}
+
+	expectProblem(t, c.do("POST", "/api/login", "", map[string]string{"email": "walt@example.com", "password": "wrong"}),
+		http.StatusUnauthorized, "invalid_credentials")
+	expectProblem(t, c.do("POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": "cook"}),
+		http.StatusUnauthorized, "invalid_credentials")
+
+	expectProblem(t, c.do("PUT", "/api/users", "", map[string]string{"email": "heisenberg@example.com", "password": "blue"}),
+		http.StatusUnauthorized, "unauthorized")
+	resp := c.do("PUT", "/api/users", s.bearer(), map[string]string{"email": "heisenberg@example.com", "password": "blue"})
+	expectStatus(t, resp, http.StatusOK)
+	if updated := decodeBody[server.User](t, resp); updated.Email != "heisenberg@example.com" {
+		t.Errorf("expected updated email, got %q", updated.Email)
+	}
+	c.login("heisenberg@example.com", "blue")
+
+	expectProblem(t, c.do("POST", "/api/users", "", map[string]string{"email": "heisenberg@example.com", "password": "other"}),
+		http.StatusConflict, "conflict")
+	jesse := c.signUp("jesse@example.com", "yo")
+	expectProblem(t, c.do("PUT", "/api/users", jesse.bearer(), map[string]string{"email": "heisenberg@example.com", "password": "yo"}),
+		http.StatusConflict, "conflict")
+
+	resp = c.do("POST", "/api/refresh", "Bearer "+s.RefreshToken, nil)
+	expectStatus(t, resp, http.StatusOK)
+	refreshed := decodeBody[struct {
+		Token string `json:"token"`
+	}](t, resp)
+	if refreshed.Token == "" {
+		t.Fatal("expected a new access token")
+	}
+	expectStatus(t, c.do("PUT", "/api/users", "Bearer "+refreshed.Token, map[string]string{"email": "walt@example.com", "password": "cook"}), http.StatusOK)
+
+	expectProblem(t, c.do("POST", "/api/refresh", "Bearer not-a-token", nil), http.StatusUnauthorized, "unauthorized")
+	expectStatus(t, c.do("POST", "/api/revoke", "Bearer "+s.RefreshToken, nil), http.StatusNoContent)
+	expectProblem(t, c.do("POST", "/api/refresh", "Bearer "+s.RefreshToken, nil), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("POST", "/api/revoke", "Bearer unknown", nil), http.StatusUnauthorized, "unauthorized")
+}
+
+func TestDeleteAccount(t *testing.T) {
+	var events []server.Event
+	c := newTestClient(t, func(cfg *server.Config) {
+		cfg.Events = server.EventSinkFunc(func(ctx context.Context, event server.Event) {
+			if event.Type == "user.deleted" {
+				events = append(events, event)
+			}
+		})
+	})
+	s := c.signUp("ada@example.com", "password")
+	other := c.signUp("bob@example.com", "password")
+	chirp := c.createChirp(s, "goodbye")
+	kept := c.createChirp(other, "still here")
+
+	expectProblem(t, c.do("DELETE", "/api/users/me", "", map[string]string{"password": "password"}), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("DELETE", "/api/users/me", s.bearer(), map[string]string{}), http.StatusBadRequest, "validation_failed")
+	expectProblem(t, c.do("DELETE", "/api/users/me", s.bearer(), map[string]string{"password": "wrong"}), http.StatusUnauthorized, "invalid_credentials")
+	if len(events) != 0 {
+		t.Fatalf("expected no events before deleting, got %+v", events)
+	}
+
+	expectStatus(t, c.do("DELETE", "/api/users/me", s.bearer(), map[string]string{"password": "password"}), http.StatusNoContent)
+	if len(events) != 1 || events[0].Type != "user.deleted" ||
+		events[0].Data != (server.UserDeleted{UserID: s.ID, Chirps: "deleted"}) {
+		t.Errorf("expected a user.deleted event, got %+v", events)
+	}
+
+	expectProblem(t, c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil), http.StatusNotFound, "not_found")
+	expectStatus(t, c.do("GET", "/api/chirps/"+kept.ID.String(), "", nil), http.StatusOK)
+	expectProblem(t, c.do("POST", "/api/refresh", "Bearer "+s.RefreshToken, nil), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("POST", "/api/login", "", map[string]string{"email": "ada@example.com", "password": "password"}),
+		http.StatusUnauthorized, "invalid_credentials")
+	// The access token is still well-formed, but it no longer authenticates.
+	expectProblem(t, c.do("POST", "/api/chirps", s.bearer(), map[string]string{"body": "ghost"}), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("GET", "/api/chirps/scheduled", s.bearer(), nil), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("DELETE", "/api/users/me", s.bearer(), map[string]string{"password": "password"}), http.StatusUnauthorized, "unauthorized")
+	// The email can be used again.
+	c.signUp("ada@example.com", "password")
+}
+
+func TestDeleteAccountAnonymizesChirps(t *testing.T) {
+	c := newTestClient(t, func(cfg *server.Config) { cfg.AnonymizeDeletedChirps = true })
+	s := c.signUp("ada@example.com", "password")
+	chirp := c.createChirp(s, "keep me")
+	expectStatus(t, c.do("PUT", "/api/users/me/profile", s.bearer(), map[string]string{"handle": "ada", "bio": "hi"}), http.StatusOK)
+	expectStatus(t, c.do("PUT", "/api/users/me/avatar", s.bearer(), "GIF89a"), http.StatusNoContent)
+	bob := c.signUp("bob@example.com", "password")
+	resp := c.do("POST", "/api/conversations", s.bearer(), map[string]any{"participant_ids": []uuid.UUID{bob.ID}})
+	expectStatus(t, resp, http.StatusCreated)
+	messagesPath := "/api/conversations/" + decodeBody[server.Conversation](t, resp).ID.String() + "/messages"
+	expectStatus(t, c.do("POST", messagesPath, s.bearer(), map[string]string{"body": "hi bob"}), http.StatusCreated)
+	expectStatus(t, c.do("POST", messagesPath, bob.bearer(), map[string]string{"body": "hi ada"}), http.StatusCreated)
+	expectStatus(t, c.do("PUT", "/api/users/"+bob.ID.String()+"/mute", s.bearer(), nil), http.StatusNoContent)
+	expectStatus(t, c.do("PUT", "/api/users/"+s.ID.String()+"/block", bob.bearer(), nil), http.StatusNoContent)
+	export, err := c.store.CreateDataExport(context.Background(), database.CreateDataExportParams{UserID: s.ID, ExpiresInSeconds: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectStatus(t, c.do("DELETE", "/api/users/me", s.bearer(), map[string]string{"password": "password"}), http.StatusNoContent)
+
+	resp = c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil)
+	expectStatus(t, resp, http.StatusOK)
+	if got := decodeBody[server.Chirp](t, resp); got.Body != "keep me" {
+		t.Errorf("expected the chirp to be kept, got %+v", got)
+	}
+	user, err := c.store.GetUserByID(context.Background(), s.ID)
+	if err != nil || !user.DeletedAt.Valid || strings.Contains(user.Email, "ada") || user.HashedPassword != "" || user.Handle.Valid || user.Bio != "" {
+		t.Errorf("expected a scrubbed account, got %+v, %v", user, err)
+	}
+	_, err = c.store.GetUserAvatar(context.Background(), s.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the avatar to be deleted, got %v", err)
+	}
+	_, err = c.store.GetDataExport(context.Background(), database.GetDataExportParams{ID: export.ID, UserID: s.ID})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the data export to be deleted, got %v", err)
+	}
+	// Only the chirps stay: ada's messages, membership and blocks go.
+	messages := decodeBody[[]server.Message](t, c.do("GET", messagesPath, bob.bearer(), nil))
+	if len(messages) != 1 || messages[0].Body != "hi ada" {
+		t.Errorf("expected only bob's message to remain, got %+v", messages)
+	}
+	inbox := decodeBody[[]server.Conversation](t, c.do("GET", "/api/conversations", bob.bearer(), nil))
+	if len(inbox) != 1 || len(inbox[0].Participants) != 1 {
+		t.Errorf("expected ada to have left the conversation, got %+v", inbox)
+	}
+	if blocks := decodeBody[[]server.Relationship](t, c.do("GET", "/api/users/me/blocks", bob.bearer(), nil)); len(blocks) != 0 {
+		t.Errorf("expected bob's block of ada to be gone, got %+v", blocks)
+	}
+	expectProblem(t, c.do("POST", "/api/refresh", "Bearer "+s.RefreshToken, nil), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("POST", "/api/chirps", s.bearer(), map[string]string{"body": "ghost"}), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("DELETE", "/api/users/me", s.bearer(), map[string]string{"password": "password"}), http.StatusUnauthorized, "unauthorized")
+	c.signUp("ada@example.com", "password")
+}
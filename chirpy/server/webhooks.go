@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djblackett/chirpy/internal/auth"
+	"github.com/djblackett/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// webhookLogSize is how many Polka events the admin dashboard lists.
+const webhookLogSize = 20
+
+// WebhookEvent is an authenticated Polka event and the status we answered with.
+type WebhookEvent struct {
+	Event      string    `json:"event"`
+	UserID     string    `json:"user_id,omitempty"`
+	Status     int       `json:"status"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// webhookLog keeps the latest events this process received, newest first.
+type webhookLog struct {
+	mu     sync.Mutex
+	events []WebhookEvent
+}
+
+func (l *webhookLog) add(event WebhookEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append([]WebhookEvent{event}, l.events...)
+	if len(l.events) > webhookLogSize {
+		l.events = l.events[:webhookLogSize]
+	}
+}
+
+func (l *webhookLog) recent() []WebhookEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]WebhookEvent{}, l.events...)
+}
+
+func (cfg *apiConfig) handlePolkaWebhook(w http.ResponseWriter, r *http.Request) {
+	type event struct {
+		Event string `json:"event"`
+		Data  struct {
+			UserID string `json:"user_id"`
+		} `json:"data"`
+	}
+
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Missing or malformed API key", err)
+		return
+	}
+	if strings.TrimSpace(apiKey) != strings.TrimSpace(cfg.polkaKey) {
+		respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Invalid API key", nil)
+		return
+	}
+
+	params := event{}
+	if !decodeJSONBody(w, r, &params) {
+		return
+	}
+	received := time.Now().UTC()
+	rec := &statusRecorder{ResponseWriter: w}
+	w = rec
+	defer func() {
+		cfg.webhookLog.add(WebhookEvent{
+			Event:      params.Event,
+			UserID:     params.Data.UserID,
+			Status:     rec.statusCode(),
+			ReceivedAt: received,
+		})
+	}()
+
+	if params.Event != "user.upgraded" {
+		cfg.metrics.webhookEvents.WithLabelValues("ignored").Inc()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	userID, err := uuid.Parse(params.Data.UserID)
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "data.user_id must be a UUID", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithLookupError(w, r, "User", err)
+		return
+	}
+
+	user, err = cfg.dbQueries.UpgradeUserToRed(r.Context(), user.ID)
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't upgrade user", err)
+		return
+	}
+	// Data exports include the subscription history. A failure here gets Polka
+	// to retry, and upgrading again is harmless.
+	err = cfg.dbQueries.CreateSubscriptionEvent(r.Context(), database.CreateSubscriptionEventParams{UserID: user.ID, Event: params.Event})
+	if err != nil {
+		respondWithInternalError(w, r, "Couldn't record subscription event", err)
+		return
+	}
+	cfg.metrics.webhookEvents.WithLabelValues(params.Event).Inc()
+	loggerFromContext(r.Context()).Info("User upgraded to Chirpy Red", "target_user_id", user.ID)
+	cfg.publish(r.Context(), "user.upgraded", user.ID, UserUpgraded{UserID: user.ID})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,28 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPolkaWebhook(t *testing.T) {
+	c := newTestClient(t)
+	s := c.signUp("red@example.com", "password")
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": s.ID.String()}}
+
+	expectProblem(t, c.do("POST", "/api/polka/webhooks", "", upgrade), http.StatusUnauthorized, "unauthorized")
+	expectProblem(t, c.do("POST", "/api/polka/webhooks", "ApiKey wrong", upgrade), http.StatusUnauthorized, "unauthorized")
+
+	apiKey := "ApiKey " + testPolkaKey
+	expectStatus(t, c.do("POST", "/api/polka/webhooks", apiKey, map[string]any{"event": "user.payment_failed"}), http.StatusNoContent)
+	expectProblem(t, c.do("POST", "/api/polka/webhooks", apiKey,
+		map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": uuid.NewString()}}),
+		http.StatusNotFound, "not_found")
+
+	expectStatus(t, c.do("POST", "/api/polka/webhooks", apiKey, upgrade), http.StatusNoContent)
+	if s = c.login("red@example.com", "password"); !s.IsChirpyRed {
+		t.Error("expected user to be upgraded to Chirpy Red")
+	}
+}
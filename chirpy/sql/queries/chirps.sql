@@ -1,17 +1,31 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, user_id, body) 
+INSERT INTO chirps (id, created_at, updated_at, user_id, body, publish_at) 
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
 -- name: GetChirps :many
-SELECT * FROM chirps
-ORDER BY created_at ASC;
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.hidden_at IS NULL
+AND chirps.publish_at IS NULL
+AND users.banned_at IS NULL
+AND (users.suspended_until IS NULL OR users.suspended_until <= NOW())
+AND (sqlc.narg('viewer_id')::uuid IS NULL OR (
+    NOT EXISTS (SELECT 1 FROM user_relationships
+                WHERE user_relationships.user_id = sqlc.narg('viewer_id')
+                AND user_relationships.target_id = chirps.user_id)
+    AND NOT EXISTS (SELECT 1 FROM user_relationships
+                    WHERE user_relationships.target_id = sqlc.narg('viewer_id')
+                    AND user_relationships.user_id = chirps.user_id
+                    AND user_relationships.kind = 'block')))
+ORDER BY chirps.created_at ASC;
 
 -- name: GetChirp :one
 SELECT * FROM chirps
@@ -22,6 +36,103 @@ DELETE FROM chirps
 WHERE id = $1;
 
 -- name: GetChirpsByUserID :many
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.user_id = @user_id
+AND chirps.hidden_at IS NULL
+AND chirps.publish_at IS NULL
+AND users.banned_at IS NULL
+AND (users.suspended_until IS NULL OR users.suspended_until <= NOW())
+AND (sqlc.narg('viewer_id')::uuid IS NULL OR (
+    NOT EXISTS (SELECT 1 FROM user_relationships
+                WHERE user_relationships.user_id = sqlc.narg('viewer_id')
+                AND user_relationships.target_id = chirps.user_id)
+    AND NOT EXISTS (SELECT 1 FROM user_relationships
+                    WHERE user_relationships.target_id = sqlc.narg('viewer_id')
+                    AND user_relationships.user_id = chirps.user_id
+                    AND user_relationships.kind = 'block')))
+ORDER BY chirps.created_at ASC;
+
+-- name: GetRecentChirps :many
+SELECT chirps.*, users.handle AS author_handle FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE (sqlc.narg('user_id')::uuid IS NULL OR chirps.user_id = sqlc.narg('user_id'))
+AND chirps.hidden_at IS NULL
+AND chirps.publish_at IS NULL
+AND users.banned_at IS NULL
+AND (users.suspended_until IS NULL OR users.suspended_until <= NOW())
+AND (sqlc.narg('viewer_id')::uuid IS NULL OR (
+    NOT EXISTS (SELECT 1 FROM user_relationships
+                WHERE user_relationships.user_id = sqlc.narg('viewer_id')
+                AND user_relationships.target_id = chirps.user_id)
+    AND NOT EXISTS (SELECT 1 FROM user_relationships
+                    WHERE user_relationships.target_id = sqlc.narg('viewer_id')
+                    AND user_relationships.user_id = chirps.user_id
+                    AND user_relationships.kind = 'block')))
+ORDER BY chirps.created_at DESC
+LIMIT @page_size::integer;
+
+-- name: GetVisibleChirp :one
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1
+AND chirps.hidden_at IS NULL
+AND chirps.publish_at IS NULL
+AND users.banned_at IS NULL
+AND (users.suspended_until IS NULL OR users.suspended_until <= NOW());
+
+-- name: GetAllChirpsByUserID :many
 SELECT * FROM chirps
 WHERE user_id = $1
-ORDER BY created_at ASC;
\ No newline at end of file
+ORDER BY created_at ASC;
+
+-- name: ImportChirps :execrows
+INSERT INTO chirps (id, body, created_at, updated_at, user_id)
+SELECT
+    unnest(@ids::uuid[]),
+    unnest(@bodies::text[]),
+    unnest(@created_ats::timestamp[]),
+    unnest(@updated_ats::timestamp[]),
+    unnest(@user_ids::uuid[])
+ON CONFLICT (id) DO NOTHING;
+
+-- name: ListChirpsForExport :many
+SELECT * FROM chirps
+WHERE hidden_at IS NULL
+AND publish_at IS NULL
+AND (sqlc.narg('user_id')::uuid IS NULL OR user_id = sqlc.narg('user_id'))
+AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since'))
+AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until'))
+AND (created_at, id) > (@after_created_at::timestamp, @after_id::uuid)
+ORDER BY created_at, id
+LIMIT @page_size::integer;
+
+-- name: ListScheduledChirps :many
+SELECT * FROM chirps
+WHERE user_id = $1
+AND publish_at IS NOT NULL
+ORDER BY publish_at ASC;
+
+-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = @publish_at::timestamp, updated_at = NOW()
+WHERE id = @id
+AND publish_at IS NOT NULL
+RETURNING *;
+
+-- name: CancelScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1
+AND publish_at IS NOT NULL;
+
+-- name: PublishDueChirps :many
+UPDATE chirps
+SET created_at = publish_at, updated_at = publish_at, publish_at = NULL
+WHERE id IN (
+    SELECT id FROM chirps
+    WHERE publish_at <= NOW()
+    ORDER BY publish_at
+    LIMIT @batch_size::integer
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
@@ -0,0 +1,73 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at, expires_at)
+VALUES (
+    gen_random_uuid(),
+    @user_id,
+    'pending',
+    NOW(),
+    NOW() + make_interval(secs => @expires_in_seconds::integer)
+)
+RETURNING *;
+
+-- name: GetDataExport :one
+SELECT * FROM data_exports
+WHERE id = @id
+AND user_id = @user_id
+AND expires_at > NOW();
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready',
+    completed_at = NOW(),
+    expires_at = NOW() + make_interval(secs => @expires_in_seconds::integer)
+WHERE id = @id
+AND status = 'pending';
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed',
+    completed_at = NOW()
+WHERE id = $1
+AND status = 'pending';
+
+-- name: FailStaleDataExports :execrows
+UPDATE data_exports
+SET status = 'failed',
+    completed_at = NOW()
+WHERE status = 'pending'
+AND created_at <= NOW() - make_interval(secs => @older_than_seconds::integer);
+
+-- name: AppendDataExportChunk :exec
+INSERT INTO data_export_chunks (export_id, seq, data)
+VALUES ($1, $2, $3);
+
+-- name: GetDataExportChunk :one
+SELECT data FROM data_export_chunks
+WHERE export_id = $1
+AND seq = $2;
+
+-- name: DeleteDataExportChunks :exec
+DELETE FROM data_export_chunks
+WHERE export_id = $1;
+
+-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports
+WHERE expires_at <= NOW();
+
+-- name: CreateSubscriptionEvent :exec
+INSERT INTO subscription_events (id, user_id, event, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW()
+);
+
+-- name: ListSubscriptionEvents :many
+SELECT * FROM subscription_events
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: DeleteDataExportsByUserID :exec
+DELETE FROM data_exports
+WHERE user_id = $1;
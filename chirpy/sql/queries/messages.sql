@@ -0,0 +1,99 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, participant_key, created_at, updated_at)
+VALUES (
+    gen_random_uuid(),
+    @participant_key::text,
+    NOW(),
+    NOW()
+)
+ON CONFLICT (participant_key) DO NOTHING
+RETURNING *;
+
+-- name: AddConversationParticipant :exec
+INSERT INTO conversation_participants (conversation_id, user_id, joined_at)
+VALUES ($1, $2, NOW());
+
+-- name: GetConversation :one
+SELECT * FROM conversations
+WHERE id = $1;
+
+-- name: GetConversationByParticipantKey :one
+SELECT * FROM conversations
+WHERE participant_key = @participant_key::text;
+
+-- name: ListConversationsForUser :many
+SELECT conversations.id, conversations.created_at, conversations.updated_at,
+    (SELECT COUNT(*) FROM messages
+     WHERE messages.conversation_id = conversations.id
+     AND messages.sender_id <> @user_id::uuid
+     AND (mine.last_read_at IS NULL OR messages.created_at > mine.last_read_at)
+     AND NOT EXISTS (SELECT 1 FROM message_deletions
+                     WHERE message_deletions.message_id = messages.id
+                     AND message_deletions.user_id = @user_id::uuid))::bigint AS unread_count,
+    participants.user_id AS participant_id,
+    participants.last_read_at AS participant_last_read_at
+FROM conversations
+JOIN conversation_participants mine ON mine.conversation_id = conversations.id
+JOIN conversation_participants participants ON participants.conversation_id = conversations.id
+WHERE mine.user_id = @user_id::uuid
+ORDER BY conversations.updated_at DESC, conversations.id, participants.joined_at, participants.user_id;
+
+-- name: ListConversationParticipants :many
+SELECT * FROM conversation_participants
+WHERE conversation_id = $1
+ORDER BY joined_at, user_id;
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET updated_at = @updated_at
+WHERE id = @id;
+
+-- name: CreateMessage :one
+INSERT INTO messages (id, conversation_id, sender_id, body, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetMessage :one
+SELECT * FROM messages
+WHERE id = $1
+AND conversation_id = $2;
+
+-- name: ListMessages :many
+SELECT * FROM messages
+WHERE conversation_id = @conversation_id
+AND NOT EXISTS (SELECT 1 FROM message_deletions
+                WHERE message_deletions.message_id = messages.id
+                AND message_deletions.user_id = @user_id::uuid)
+AND (sqlc.narg('before_created_at')::timestamp IS NULL
+     OR (created_at, id) < (sqlc.narg('before_created_at'), @before_id::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT @page_size::integer;
+
+-- name: MarkConversationRead :exec
+UPDATE conversation_participants
+SET last_read_at = GREATEST(COALESCE(last_read_at, @read_at::timestamp), @read_at::timestamp)
+WHERE conversation_id = @conversation_id
+AND user_id = @user_id;
+
+-- name: DeleteMessageForUser :exec
+INSERT INTO message_deletions (message_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteMessagesBySenderID :exec
+DELETE FROM messages
+WHERE sender_id = $1;
+
+-- name: DeleteMessageDeletionsByUserID :exec
+DELETE FROM message_deletions
+WHERE user_id = $1;
+
+-- name: DeleteConversationParticipantsByUserID :exec
+DELETE FROM conversation_participants
+WHERE user_id = $1;
@@ -0,0 +1,78 @@
+-- name: CreateChirpReport :one
+INSERT INTO chirp_reports (id, chirp_id, reporter_id, reason, details, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+
+-- name: ListOpenChirpReports :many
+SELECT * FROM chirp_reports
+WHERE status = 'open'
+ORDER BY created_at ASC;
+
+-- name: ListChirpReportsByReporter :many
+SELECT * FROM chirp_reports
+WHERE reporter_id = $1
+ORDER BY created_at ASC;
+
+-- name: ResolveChirpReports :exec
+UPDATE chirp_reports
+SET status = 'resolved',
+    resolved_at = NOW(),
+    resolved_by = $1
+WHERE chirp_id = $2
+AND status = 'open';
+
+-- name: DismissChirpReport :one
+UPDATE chirp_reports
+SET status = 'dismissed',
+    resolved_at = NOW(),
+    resolved_by = $1
+WHERE id = $2
+AND status = 'open'
+RETURNING *;
+
+-- name: HideChirp :one
+UPDATE chirps
+SET hidden_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SuspendUser :one
+UPDATE users
+SET suspended_until = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: BanUser :one
+UPDATE users
+SET banned_at = NOW(),
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id, actor_id, action, target_user_id, target_chirp_id, reason, expires_at, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW()
+)
+RETURNING *;
+
+-- name: ListModerationActions :many
+SELECT * FROM moderation_actions
+ORDER BY created_at DESC
+LIMIT $1;
@@ -1,9 +1,9 @@
 -- name: CreateRefreshToken :exec
 INSERT INTO refresh_tokens (user_id, token, expires_at, revoked_at, created_at, updated_at)
 VALUES (
-    $1,
-    $2,
-    TIMESTAMP 'now' + INTERVAL '60 days',
+    @user_id,
+    @token,
+    NOW() + make_interval(secs => @expires_in_seconds::integer),
     NULL,
     CURRENT_TIMESTAMP,
     CURRENT_TIMESTAMP
@@ -22,3 +22,15 @@ SET revoked_at = CURRENT_TIMESTAMP,
     updated_at = CURRENT_TIMESTAMP
 WHERE token = $1
 RETURNING user_id;
+
+-- name: ListRefreshTokensByUserID :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: RevokeRefreshTokensByUserID :exec
+UPDATE refresh_tokens
+SET revoked_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE user_id = $1
+AND revoked_at IS NULL;
@@ -0,0 +1,60 @@
+-- name: CreateUserRelationship :exec
+INSERT INTO user_relationships (user_id, target_id, kind, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteUserRelationship :execrows
+DELETE FROM user_relationships
+WHERE user_id = $1
+AND target_id = $2
+AND kind = $3;
+
+-- name: ListUserRelationships :many
+SELECT * FROM user_relationships
+WHERE user_id = $1
+AND kind = $2
+ORDER BY created_at DESC, target_id;
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM user_relationships
+    WHERE kind = 'block'
+    AND ((user_id = @user_a::uuid AND target_id = @user_b::uuid)
+         OR (user_id = @user_b::uuid AND target_id = @user_a::uuid))
+);
+
+-- name: DeleteUserRelationshipsByUserID :exec
+DELETE FROM user_relationships
+WHERE user_id = $1
+OR target_id = $1;
+
+-- name: FollowUser :execrows
+INSERT INTO user_follows (follower_id, followee_id, created_at)
+SELECT @follower_id::uuid, @followee_id::uuid, NOW()
+WHERE NOT EXISTS (
+    SELECT 1 FROM user_relationships
+    WHERE kind = 'block'
+    AND ((user_id = @follower_id AND target_id = @followee_id)
+         OR (user_id = @followee_id AND target_id = @follower_id))
+)
+ON CONFLICT (follower_id, followee_id) DO UPDATE SET created_at = user_follows.created_at;
+
+-- name: UnfollowUser :execrows
+DELETE FROM user_follows
+WHERE follower_id = $1
+AND followee_id = $2;
+
+-- name: ListUserFollows :many
+SELECT * FROM user_follows
+WHERE follower_id = $1
+ORDER BY created_at DESC, followee_id;
+
+-- name: DeleteFollowsBetween :exec
+DELETE FROM user_follows
+WHERE (follower_id = @user_a::uuid AND followee_id = @user_b::uuid)
+OR (follower_id = @user_b::uuid AND followee_id = @user_a::uuid);
+
+-- name: DeleteUserFollowsByUserID :exec
+DELETE FROM user_follows
+WHERE follower_id = $1
+OR followee_id = $1;
@@ -0,0 +1,32 @@
+-- name: GetStatsTotals :one
+SELECT
+    (SELECT COUNT(*) FROM users WHERE deleted_at IS NULL)::bigint AS users,
+    (SELECT COUNT(*) FROM users WHERE is_chirpy_red AND deleted_at IS NULL)::bigint AS chirpy_red_users,
+    (SELECT COUNT(*) FROM chirps WHERE publish_at IS NULL)::bigint AS chirps,
+    (SELECT COUNT(*) FROM refresh_tokens WHERE revoked_at IS NULL AND expires_at > NOW())::bigint AS active_sessions,
+    (SELECT COUNT(*) FROM chirp_reports WHERE status = 'open')::bigint AS open_reports;
+
+-- name: CountSignupsByDay :many
+SELECT date_trunc('day', created_at)::timestamp AS day, COUNT(*) AS count
+FROM users
+WHERE created_at >= @since::timestamp
+GROUP BY day
+ORDER BY day;
+
+-- name: CountChirpsByDay :many
+SELECT date_trunc('day', created_at)::timestamp AS day, COUNT(*) AS count
+FROM chirps
+WHERE created_at >= @since::timestamp
+AND publish_at IS NULL
+GROUP BY day
+ORDER BY day;
+
+-- name: ListTopPosters :many
+SELECT users.id, users.email, COUNT(chirps.id) AS chirp_count
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.publish_at IS NULL
+AND users.deleted_at IS NULL
+GROUP BY users.id, users.email
+ORDER BY chirp_count DESC, users.email
+LIMIT $1;
@@ -35,4 +35,87 @@ UPDATE users
 SET updated_at = NOW(),
     is_chirpy_red = TRUE
 WHERE id = $1
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: SetUserRoleByEmail :one
+UPDATE users
+SET updated_at = NOW(),
+    role = $1
+WHERE email = $2
+RETURNING *;
+
+-- name: CountUsersByRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1;
+
+-- name: SetUserRole :one
+UPDATE users
+SET updated_at = NOW(),
+    role = $1
+WHERE id = $2
+RETURNING *;
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
+
+-- name: AnonymizeUser :one
+UPDATE users
+SET updated_at = NOW(),
+    deleted_at = NOW(),
+    email = 'deleted-' || id || '@deleted.invalid',
+    hashed_password = '',
+    is_chirpy_red = FALSE,
+    role = 'user',
+    handle = NULL,
+    display_name = '',
+    bio = ''
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE lower(handle) = lower(@handle::text);
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET updated_at = NOW(),
+    handle = @handle::text,
+    display_name = @display_name,
+    bio = @bio
+WHERE id = @id
+RETURNING *;
+
+-- name: GetUserProfile :one
+SELECT users.id, users.handle, users.display_name, users.bio, users.created_at,
+    (SELECT COUNT(*) FROM chirps
+     WHERE chirps.user_id = users.id
+     AND chirps.hidden_at IS NULL
+     AND chirps.publish_at IS NULL)::bigint AS chirp_count,
+    (SELECT COUNT(*) FROM user_follows
+     JOIN users followers ON followers.id = user_follows.follower_id
+     WHERE user_follows.followee_id = users.id
+     AND followers.deleted_at IS NULL
+     AND followers.banned_at IS NULL)::bigint AS follower_count,
+    user_avatars.updated_at AS avatar_updated_at
+FROM users
+LEFT JOIN user_avatars ON user_avatars.user_id = users.id
+WHERE lower(users.handle) = lower(@handle::text)
+AND users.deleted_at IS NULL
+AND users.banned_at IS NULL;
+
+-- name: SetUserAvatar :exec
+INSERT INTO user_avatars (user_id, content_type, image, updated_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET content_type = EXCLUDED.content_type,
+    image = EXCLUDED.image,
+    updated_at = EXCLUDED.updated_at;
+
+-- name: GetUserAvatar :one
+SELECT * FROM user_avatars
+WHERE user_id = $1;
+
+-- name: DeleteUserAvatar :execrows
+DELETE FROM user_avatars
+WHERE user_id = $1;
@@ -0,0 +1,91 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, user_id, url, secret, events, all_users, created_at)
+VALUES (
+    gen_random_uuid(),
+    @user_id,
+    @url,
+    @secret,
+    @events::text[],
+    @all_users,
+    NOW()
+)
+RETURNING *;
+
+-- name: ListWebhookEndpoints :many
+SELECT * FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1;
+
+-- name: DeleteWebhookEndpoint :exec
+DELETE FROM webhook_endpoints
+WHERE id = $1;
+
+-- name: DeleteWebhookEndpointsByUserID :exec
+DELETE FROM webhook_endpoints
+WHERE user_id = $1;
+
+-- name: ListWebhookEndpointsForEvent :many
+SELECT * FROM webhook_endpoints
+WHERE @event_type::text = ANY(events)
+AND (user_id = @user_id OR all_users);
+
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, endpoint_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+VALUES (
+    gen_random_uuid(),
+    @endpoint_id,
+    @event_id,
+    @event_type,
+    @payload,
+    'pending',
+    NOW(),
+    NOW()
+);
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+    next_attempt_at = NOW() + make_interval(secs => @lease_seconds::integer)
+WHERE id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending'
+    AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at
+    LIMIT @batch_size::integer
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RecordWebhookAttempt :exec
+UPDATE webhook_deliveries
+SET status = @status,
+    last_attempt_at = NOW(),
+    response_status = sqlc.narg('response_status'),
+    last_error = @last_error,
+    next_attempt_at = NOW() + make_interval(secs => @retry_in_seconds::double precision)
+WHERE id = @id;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = @endpoint_id
+AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+ORDER BY created_at DESC
+LIMIT @page_size::integer;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = @id
+AND endpoint_id = @endpoint_id;
+
+-- name: RetryWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending',
+    attempts = 0,
+    next_attempt_at = NOW()
+WHERE id = @id
+AND status <> 'pending'
+RETURNING *;
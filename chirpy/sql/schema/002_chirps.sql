@@ -6,7 +6,7 @@ CREATE TABLE chirps (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     user_id UUID NOT NULL,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-)
+);
 
 -- +goose Down
 DROP TABLE chirps;
@@ -1,2 +1,7 @@
+-- +goose Up
 ALTER TABLE users
-ADD hashed_password TEXT NOT NULL DEFAULT 'unset';
\ No newline at end of file
+ADD hashed_password TEXT NOT NULL DEFAULT 'unset';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN hashed_password;
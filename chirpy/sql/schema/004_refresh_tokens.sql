@@ -1,5 +1,3 @@
-
-
 -- +goose Up
 CREATE TABLE refresh_tokens (
     token TEXT PRIMARY KEY,
@@ -9,9 +7,7 @@ CREATE TABLE refresh_tokens (
     expires_at TIMESTAMP NOT NULL,
     revoked_at TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-)
+);
 
 -- +goose Down
 DROP TABLE refresh_tokens;
-
-
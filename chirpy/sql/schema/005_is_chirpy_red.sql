@@ -1 +1,5 @@
-ALTER TABLE users ADD is_chirpy_red BOOLEAN DEFAULT FALSE;
\ No newline at end of file
+-- +goose Up
+ALTER TABLE users ADD is_chirpy_red BOOLEAN DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN is_chirpy_red;
@@ -0,0 +1,46 @@
+-- +goose Up
+ALTER TABLE users
+ADD suspended_until TIMESTAMP,
+ADD banned_at TIMESTAMP;
+
+ALTER TABLE chirps
+ADD hidden_at TIMESTAMP;
+
+CREATE TABLE chirp_reports (
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL,
+    reporter_id UUID NOT NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate', 'misinformation', 'other')),
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP,
+    resolved_by UUID,
+    FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE (chirp_id, reporter_id)
+);
+
+CREATE INDEX chirp_reports_open_idx ON chirp_reports (created_at) WHERE status = 'open';
+
+CREATE TABLE moderation_actions (
+    id UUID PRIMARY KEY,
+    actor_id UUID NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('hide_chirp', 'suspend_user', 'ban_user', 'dismiss_report')),
+    target_user_id UUID,
+    target_chirp_id UUID,
+    reason TEXT NOT NULL,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE moderation_actions;
+DROP TABLE chirp_reports;
+
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
+
+ALTER TABLE users
+DROP COLUMN suspended_until,
+DROP COLUMN banned_at;
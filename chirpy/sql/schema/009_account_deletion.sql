@@ -0,0 +1,8 @@
+-- +goose Up
+-- deleted_at marks an account whose owner deleted it but whose chirps were
+-- kept. The row stays for the chirps to point at, with its email and password
+-- scrubbed.
+ALTER TABLE users ADD deleted_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN deleted_at;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- publish_at is set while a chirp is scheduled. The publisher clears it once
+-- the time comes, and only then does the chirp show up anywhere.
+ALTER TABLE chirps ADD publish_at TIMESTAMP;
+
+CREATE INDEX chirps_publish_at_idx ON chirps (publish_at) WHERE publish_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_publish_at_idx;
+ALTER TABLE chirps DROP COLUMN publish_at;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- handle is the public name in profile URLs. It is optional so existing
+-- accounts keep working, and unique regardless of case.
+ALTER TABLE users ADD handle TEXT;
+ALTER TABLE users ADD display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD bio TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX users_handle_key ON users (lower(handle));
+
+-- Avatars live apart from users so reading a user doesn't load the image.
+CREATE TABLE user_avatars (
+    user_id UUID PRIMARY KEY,
+    content_type TEXT NOT NULL,
+    image BYTEA NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_avatars;
+DROP INDEX users_handle_key;
+ALTER TABLE users DROP COLUMN bio;
+ALTER TABLE users DROP COLUMN display_name;
+ALTER TABLE users DROP COLUMN handle;
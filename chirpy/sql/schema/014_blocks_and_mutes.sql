@@ -0,0 +1,20 @@
+-- +goose Up
+-- One row per user who blocked or muted another. Both kinds hide the
+-- target's chirps from user_id; a block also hides user_id's chirps from the
+-- target and stops them messaging each other.
+CREATE TABLE user_relationships (
+    user_id UUID NOT NULL,
+    target_id UUID NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('block', 'mute')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, target_id, kind),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (target_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- The primary key answers "whom does the viewer hide"; this answers "who
+-- blocked the viewer" for the other half of the chirp filters.
+CREATE INDEX user_relationships_blocked_idx ON user_relationships (target_id, user_id) WHERE kind = 'block';
+
+-- +goose Down
+DROP TABLE user_relationships;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- Archives are stored in chunks so neither building nor downloading one holds
+-- it in memory whole.
+CREATE TABLE data_export_chunks (
+    export_id UUID NOT NULL,
+    seq INTEGER NOT NULL,
+    data BYTEA NOT NULL,
+    PRIMARY KEY (export_id, seq),
+    FOREIGN KEY (export_id) REFERENCES data_exports(id) ON DELETE CASCADE
+);
+
+INSERT INTO data_export_chunks (export_id, seq, data)
+SELECT id, 0, archive FROM data_exports
+WHERE status = 'ready' AND archive IS NOT NULL;
+
+ALTER TABLE data_exports DROP COLUMN archive;
+
+-- Nothing is still building exports from before the upgrade.
+UPDATE data_exports
+SET status = 'failed',
+    completed_at = NOW()
+WHERE status = 'pending';
+
+-- A user builds one export at a time.
+CREATE UNIQUE INDEX data_exports_pending_idx ON data_exports (user_id) WHERE status = 'pending';
+
+-- +goose Down
+DROP INDEX data_exports_pending_idx;
+ALTER TABLE data_exports ADD archive BYTEA;
+UPDATE data_exports
+SET archive = (
+    SELECT string_agg(data, '' ORDER BY seq) FROM data_export_chunks
+    WHERE export_id = data_exports.id
+);
+DROP TABLE data_export_chunks;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- One row per user following another, for profile follower counts. Follows
+-- are kept apart from user_relationships, whose every row hides chirps.
+CREATE TABLE user_follows (
+    follower_id UUID NOT NULL,
+    followee_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id),
+    FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (followee_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Counts a profile's followers.
+CREATE INDEX user_follows_followee_idx ON user_follows (followee_id);
+
+-- +goose Down
+DROP TABLE user_follows;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- participant_key is the sorted, comma-separated IDs of everyone a
+-- conversation was started with. Its unique index makes starting the same
+-- conversation twice, even at the same moment, find the first one.
+ALTER TABLE conversations ADD participant_key TEXT;
+
+UPDATE conversations
+SET participant_key = (SELECT string_agg(user_id::text, ',' ORDER BY user_id)
+                       FROM conversation_participants
+                       WHERE conversation_participants.conversation_id = conversations.id);
+
+-- Later duplicates keep their messages but lose the key, so the first is found.
+UPDATE conversations
+SET participant_key = NULL
+WHERE EXISTS (SELECT 1 FROM conversations first
+              WHERE first.participant_key = conversations.participant_key
+              AND (first.created_at, first.id) < (conversations.created_at, conversations.id));
+
+CREATE UNIQUE INDEX conversations_participant_key ON conversations (participant_key);
+
+-- +goose Down
+DROP INDEX conversations_participant_key;
+ALTER TABLE conversations DROP COLUMN participant_key;
@@ -0,0 +1,66 @@
+-- +goose Up
+-- SQLite equivalent of sql/schema/001-007. UUIDs are stored as text and
+-- timestamps as Unix microseconds; the store fills both in rather than relying
+-- on gen_random_uuid() or NOW().
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE,
+    created_at INTEGER,
+    updated_at INTEGER,
+    hashed_password TEXT NOT NULL DEFAULT 'unset',
+    is_chirpy_red BOOLEAN DEFAULT 0,
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+    suspended_until INTEGER,
+    banned_at INTEGER
+);
+
+CREATE TABLE chirps (
+    id TEXT PRIMARY KEY,
+    body TEXT NOT NULL,
+    created_at INTEGER,
+    updated_at INTEGER,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hidden_at INTEGER
+);
+
+CREATE TABLE refresh_tokens (
+    token TEXT PRIMARY KEY,
+    created_at INTEGER,
+    updated_at INTEGER,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at INTEGER NOT NULL,
+    revoked_at INTEGER
+);
+
+CREATE TABLE chirp_reports (
+    id TEXT PRIMARY KEY,
+    chirp_id TEXT NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    reporter_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate', 'misinformation', 'other')),
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+    created_at INTEGER NOT NULL,
+    resolved_at INTEGER,
+    resolved_by TEXT,
+    UNIQUE (chirp_id, reporter_id)
+);
+
+CREATE INDEX chirp_reports_open_idx ON chirp_reports (created_at) WHERE status = 'open';
+
+CREATE TABLE moderation_actions (
+    id TEXT PRIMARY KEY,
+    actor_id TEXT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('hide_chirp', 'suspend_user', 'ban_user', 'dismiss_report')),
+    target_user_id TEXT,
+    target_chirp_id TEXT,
+    reason TEXT NOT NULL,
+    expires_at INTEGER,
+    created_at INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE moderation_actions;
+DROP TABLE chirp_reports;
+DROP TABLE refresh_tokens;
+DROP TABLE chirps;
+DROP TABLE users;
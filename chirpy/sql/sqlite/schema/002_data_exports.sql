@@ -0,0 +1,24 @@
+-- +goose Up
+-- SQLite equivalent of sql/schema/008.
+CREATE TABLE subscription_events (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE data_exports (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    archive BLOB,
+    created_at INTEGER NOT NULL,
+    completed_at INTEGER,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX data_exports_expires_at_idx ON data_exports (expires_at);
+
+-- +goose Down
+DROP TABLE data_exports;
+DROP TABLE subscription_events;
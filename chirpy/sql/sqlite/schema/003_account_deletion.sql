@@ -0,0 +1,6 @@
+-- +goose Up
+-- SQLite equivalent of sql/schema/009.
+ALTER TABLE users ADD deleted_at INTEGER;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN deleted_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- SQLite equivalent of sql/schema/010.
+ALTER TABLE chirps ADD publish_at INTEGER;
+
+CREATE INDEX chirps_publish_at_idx ON chirps (publish_at) WHERE publish_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_publish_at_idx;
+ALTER TABLE chirps DROP COLUMN publish_at;
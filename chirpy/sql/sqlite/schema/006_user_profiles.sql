@@ -0,0 +1,20 @@
+-- +goose Up
+-- SQLite equivalent of sql/schema/012.
+ALTER TABLE users ADD handle TEXT;
+ALTER TABLE users ADD display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD bio TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX users_handle_key ON users (lower(handle));
+
+CREATE TABLE user_avatars (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    content_type TEXT NOT NULL,
+    image BLOB NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE user_avatars;
+DROP INDEX users_handle_key;
+ALTER TABLE users DROP COLUMN bio;
+ALTER TABLE users DROP COLUMN display_name;
+ALTER TABLE users DROP COLUMN handle;
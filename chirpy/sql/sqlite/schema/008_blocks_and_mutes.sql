@@ -0,0 +1,14 @@
+-- +goose Up
+-- SQLite equivalent of sql/schema/014.
+CREATE TABLE user_relationships (
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('block', 'mute')),
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (user_id, target_id, kind)
+);
+
+CREATE INDEX user_relationships_blocked_idx ON user_relationships (target_id, user_id) WHERE kind = 'block';
+
+-- +goose Down
+DROP TABLE user_relationships;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- SQLite equivalent of sql/schema/015.
+CREATE TABLE data_export_chunks (
+    export_id TEXT NOT NULL REFERENCES data_exports(id) ON DELETE CASCADE,
+    seq INTEGER NOT NULL,
+    data BLOB NOT NULL,
+    PRIMARY KEY (export_id, seq)
+);
+
+INSERT INTO data_export_chunks (export_id, seq, data)
+SELECT id, 0, archive FROM data_exports
+WHERE status = 'ready' AND archive IS NOT NULL;
+
+ALTER TABLE data_exports DROP COLUMN archive;
+
+UPDATE data_exports
+SET status = 'failed',
+    completed_at = CAST(strftime('%s', 'now') AS INTEGER) * 1000000
+WHERE status = 'pending';
+
+CREATE UNIQUE INDEX data_exports_pending_idx ON data_exports (user_id) WHERE status = 'pending';
+
+-- +goose Down
+-- SQLite can't concatenate the chunks back, so ready exports fail instead.
+DROP INDEX data_exports_pending_idx;
+ALTER TABLE data_exports ADD archive BLOB;
+UPDATE data_exports SET status = 'failed' WHERE status = 'ready';
+DROP TABLE data_export_chunks;
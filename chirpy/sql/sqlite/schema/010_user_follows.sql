@@ -0,0 +1,13 @@
+-- +goose Up
+-- SQLite equivalent of sql/schema/016.
+CREATE TABLE user_follows (
+    follower_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (follower_id, followee_id)
+);
+
+CREATE INDEX user_follows_followee_idx ON user_follows (followee_id);
+
+-- +goose Down
+DROP TABLE user_follows;
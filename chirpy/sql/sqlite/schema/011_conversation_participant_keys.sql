@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQLite equivalent of sql/schema/017.
+ALTER TABLE conversations ADD participant_key TEXT;
+
+UPDATE conversations
+SET participant_key = (SELECT group_concat(user_id, ',')
+                       FROM (SELECT user_id FROM conversation_participants
+                             WHERE conversation_participants.conversation_id = conversations.id
+                             ORDER BY user_id));
+
+UPDATE conversations
+SET participant_key = NULL
+WHERE EXISTS (SELECT 1 FROM conversations AS first
+              WHERE first.participant_key = conversations.participant_key
+              AND (first.created_at, first.id) < (conversations.created_at, conversations.id));
+
+CREATE UNIQUE INDEX conversations_participant_key ON conversations (participant_key);
+
+-- +goose Down
+DROP INDEX conversations_participant_key;
+ALTER TABLE conversations DROP COLUMN participant_key;
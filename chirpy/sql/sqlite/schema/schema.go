@@ -0,0 +1,8 @@
+// Package schema embeds the goose migrations for the SQLite backend. They
+// track sql/schema, which remains the source of truth for Postgres and sqlc.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS